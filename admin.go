@@ -0,0 +1,42 @@
+package websocketnats
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminAuth require the Config.AdminToken as bearer token. The admin endpoints are never served without one, see
+// Config.Validate
+func (w *NatsWebSocket) adminAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if w.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(w.config.AdminToken)) != 1 {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// publicAdminRoutes the admin routes mounted on the public listener: the readiness probe and, without an admin listener,
+// the admin endpoints once Config.AdminToken is set and the debug endpoints once the debug token is set
+func (w *NatsWebSocket) publicAdminRoutes() map[string]http.Handler {
+	routes := make(map[string]http.Handler)
+	for pattern, handler := range w.adminRoutes {
+		switch {
+		case pattern == "/readyz":
+		case w.config.AdminListenInterface != "":
+			continue
+		case strings.HasPrefix(pattern, "/debug/"):
+			if w.debugToken() == "" {
+				continue
+			}
+		case w.config.AdminToken == "":
+			continue
+		}
+		routes[pattern] = handler
+	}
+	return routes
+}
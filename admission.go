@@ -0,0 +1,154 @@
+package websocketnats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdmissionRequest information about the upgrade request given to the admission controller
+type AdmissionRequest struct {
+	Connections int         `json:"connections"`
+	IP          string      `json:"ip"`
+	Header      http.Header `json:"header"`
+}
+
+// AdmissionDecision decision of the admission controller
+type AdmissionDecision struct {
+	Accept bool `json:"accept"`
+	// Status http status of the rejection. Defaults to 403
+	Status int    `json:"status"`
+	Reason string `json:"reason"`
+	// Tags tags set on the accepted connection, e.g. the customer the connection is billed to
+	Tags map[string]string `json:"tags"`
+}
+
+// AdmissionController consulted before the upgrade to accept, reject or tag the connection.
+// An error rejects the upgrade with 503
+type AdmissionController interface {
+	Admit(request *AdmissionRequest) (AdmissionDecision, error)
+}
+
+// HTTPAdmissionController admission controller deferring to an external capacity service.
+// The AdmissionRequest is POSTed as json and the service responds with the AdmissionDecision as json
+type HTTPAdmissionController struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPAdmissionController init the admission controller calling the service at url
+func NewHTTPAdmissionController(url string, timeout time.Duration) *HTTPAdmissionController {
+	return &HTTPAdmissionController{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Admit ask the capacity service
+func (c *HTTPAdmissionController) Admit(request *AdmissionRequest) (decision AdmissionDecision, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return
+	}
+
+	response, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("admission service responded %s", response.Status)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&decision)
+	return
+}
+
+func newAdmissionRequest(request *http.Request, ip string, connections int) *AdmissionRequest {
+	return &AdmissionRequest{
+		Connections: connections,
+		IP:          ip,
+		Header:      request.Header,
+	}
+}
+
+// remoteIP get the ip of the peer from the remote address of the request
+func remoteIP(request *http.Request) string {
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return ip
+}
+
+// parseTrustedProxies parse the IPs and CIDRs of Config.TrustedProxies
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// isTrustedProxy check the ip is one of Config.TrustedProxies
+func (w *NatsWebSocket) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range w.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP get the ip of the client: the peer of the request, unless it is a trusted proxy, in which case the last
+// untrusted address of X-Forwarded-For, or else X-Real-IP
+func (w *NatsWebSocket) clientIP(request *http.Request) string {
+	ip := remoteIP(request)
+	if !w.isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(request.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		if !w.isTrustedProxy(hop) {
+			return hop
+		}
+		ip = hop
+	}
+
+	if realIP := strings.TrimSpace(request.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return ip
+}
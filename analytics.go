@@ -0,0 +1,287 @@
+package websocketnats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAnalyticsBatchSize default number of session records written to the analytics sink at once
+	DefaultAnalyticsBatchSize = 500
+	// DefaultAnalyticsFlushInterval default interval in seconds the pending session records are written
+	DefaultAnalyticsFlushInterval = 5
+	// DefaultAnalyticsQueueSize default number of session records waiting to be written, beyond which they are dropped
+	DefaultAnalyticsQueueSize = 10000
+	// DefaultAnalyticsTimeout default timeout in milliseconds of the writes of the http analytics sink
+	DefaultAnalyticsTimeout = 10000
+)
+
+// SessionRecord analytics record of a websocket session, written once the connection is gone
+type SessionRecord struct {
+	InstanceID     string            `json:"instanceId"`
+	ConnectionID   ConnectionID      `json:"connectionId"`
+	UserID         UserID            `json:"userId"`
+	DeviceID       DeviceID          `json:"deviceId"`
+	ConnectedAt    int64             `json:"connectedAt"`
+	DisconnectedAt int64             `json:"disconnectedAt"`
+	DurationMs     int64             `json:"durationMs"`
+	BytesIn        int64             `json:"bytesIn"`
+	BytesOut       int64             `json:"bytesOut"`
+	Topics         []string          `json:"topics"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// AnalyticsSink write the session records to an analytics backend, e.g. a warehouse or a Kafka topic
+type AnalyticsSink interface {
+	Write(records []SessionRecord) error
+}
+
+// HTTPAnalyticsSink post the records as newline delimited json, e.g. to the ClickHouse http interface with
+// http://clickhouse:8123/?query=INSERT%20INTO%20sessions%20FORMAT%20JSONEachRow
+type HTTPAnalyticsSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPAnalyticsSink init the sink posting to url
+func NewHTTPAnalyticsSink(url string, timeout time.Duration) *HTTPAnalyticsSink {
+	return &HTTPAnalyticsSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Write post the records
+func (s *HTTPAnalyticsSink) Write(records []SessionRecord) error {
+	response, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(encodeRecords(records)))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("analytics sink responded %s", response.Status)
+	}
+	return nil
+}
+
+// FileAnalyticsSink append the records as newline delimited json to a file, e.g. collected by a log shipper
+type FileAnalyticsSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileAnalyticsSink init the sink appending to the file at path
+func NewFileAnalyticsSink(path string) (*FileAnalyticsSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAnalyticsSink{
+		mutex: sync.Mutex{},
+		file:  file,
+	}, nil
+}
+
+// Write append the records
+func (s *FileAnalyticsSink) Write(records []SessionRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.file.Write(encodeRecords(records))
+	return err
+}
+
+func encodeRecords(records []SessionRecord) []byte {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+	return buffer.Bytes()
+}
+
+// SessionExporter batch the session records written to the analytics sink. The records are dropped if the sink falls behind
+type SessionExporter struct {
+	sink      AnalyticsSink
+	records   chan SessionRecord
+	batchSize int
+	interval  time.Duration
+	metrics   *Metrics
+}
+
+// NewSessionExporter init the exporter writing batches of batchSize records, or the pending ones every interval
+func NewSessionExporter(sink AnalyticsSink, queueSize, batchSize int, interval time.Duration, metrics *Metrics) *SessionExporter {
+	if queueSize <= 0 {
+		queueSize = DefaultAnalyticsQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultAnalyticsBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultAnalyticsFlushInterval * time.Second
+	}
+
+	return &SessionExporter{
+		sink:      sink,
+		records:   make(chan SessionRecord, queueSize),
+		batchSize: batchSize,
+		interval:  interval,
+		metrics:   metrics,
+	}
+}
+
+// Export queue the record
+func (e *SessionExporter) Export(record SessionRecord) {
+	select {
+	case e.records <- record:
+	default:
+		e.metrics.Counter("gateway_analytics_dropped_total", "Session records dropped because the analytics sink fell behind").Inc()
+	}
+}
+
+// Run write the queued records until done is closed, then the remaining ones
+func (e *SessionExporter) Run(done chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]SessionRecord, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.sink.Write(batch); err != nil {
+			e.metrics.Counter("gateway_analytics_errors_total", "Batches of session records the analytics sink failed to write").Inc()
+		}
+		batch = make([]SessionRecord, 0, e.batchSize)
+	}
+
+	for {
+		select {
+		case record := <-e.records:
+			if batch = append(batch, record); len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-done:
+			for {
+				select {
+				case record := <-e.records:
+					if batch = append(batch, record); len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// countInbound count the bytes read from the client
+func (c *Connection) countInbound(size int) {
+	atomic.AddInt64(&c.bytesIn, int64(size))
+}
+
+// countOutbound count the bytes written to the client
+func (c *Connection) countOutbound(size int) {
+	atomic.AddInt64(&c.bytesOut, int64(size))
+}
+
+// recordTopic remember the topic was subscribed during the session
+func (c *Connection) recordTopic(topic string) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	if c.sessionTopics == nil {
+		c.sessionTopics = make(map[string]bool)
+	}
+	c.sessionTopics[topic] = true
+}
+
+// sessionRecord get the analytics record of the session, only once
+func (c *Connection) sessionRecord(instanceID string) (SessionRecord, bool) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	if c.sessionExported {
+		return SessionRecord{}, false
+	}
+	c.sessionExported = true
+
+	now := time.Now()
+	record := SessionRecord{
+		InstanceID:     instanceID,
+		ConnectionID:   c.id,
+		UserID:         c.userID,
+		DeviceID:       c.deviceID,
+		ConnectedAt:    c.startTime.UnixNano() / int64(time.Millisecond),
+		DisconnectedAt: now.UnixNano() / int64(time.Millisecond),
+		DurationMs:     int64(now.Sub(c.startTime) / time.Millisecond),
+		BytesIn:        atomic.LoadInt64(&c.bytesIn),
+		BytesOut:       atomic.LoadInt64(&c.bytesOut),
+		Topics:         []string{},
+	}
+	for topic := range c.sessionTopics {
+		record.Topics = append(record.Topics, topic)
+	}
+	sort.Strings(record.Topics)
+	if len(c.tags) > 0 {
+		record.Tags = make(map[string]string, len(c.tags))
+		for key, value := range c.tags {
+			record.Tags[key] = value
+		}
+	}
+	return record, true
+}
+
+// exportSession export the record of the session of the connection to the analytics sink, if any
+func (w *NatsWebSocket) exportSession(connection *Connection) {
+	if w.sessionExporter == nil {
+		return
+	}
+	if record, ok := connection.sessionRecord(w.instanceID); ok {
+		w.sessionExporter.Export(record)
+	}
+}
+
+// startSessionExporter start exporting the sessions to the sink of WithAnalyticsSink, or of Config.AnalyticsURL or Config.AnalyticsFile
+func (w *NatsWebSocket) startSessionExporter() {
+	if w.analyticsSink == nil && w.config.AnalyticsURL != "" {
+		timeout := time.Duration(w.config.AnalyticsTimeout) * time.Millisecond
+		if timeout <= 0 {
+			timeout = DefaultAnalyticsTimeout * time.Millisecond
+		}
+		w.analyticsSink = NewHTTPAnalyticsSink(w.config.AnalyticsURL, timeout)
+	}
+	if w.analyticsSink == nil && w.config.AnalyticsFile != "" {
+		sink, err := NewFileAnalyticsSink(w.config.AnalyticsFile)
+		if err != nil {
+			w.logger.Printf("analytics: %v", err)
+			return
+		}
+		w.analyticsSink = sink
+	}
+	if w.analyticsSink == nil {
+		return
+	}
+
+	w.sessionExporter = NewSessionExporter(
+		w.analyticsSink,
+		w.config.AnalyticsQueueSize,
+		w.config.AnalyticsBatchSize,
+		time.Duration(w.config.AnalyticsFlushInterval)*time.Second,
+		w.metrics,
+	)
+	go w.sessionExporter.Run(w.done)
+}
@@ -0,0 +1,64 @@
+package websocketnats
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryAnalyticsSink struct {
+	mutex   sync.Mutex
+	batches [][]SessionRecord
+}
+
+func (s *memoryAnalyticsSink) Write(records []SessionRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.batches = append(s.batches, records)
+	return nil
+}
+
+func TestSessionRecord(t *T) {
+	connection := NewConnection(1, nil)
+	connection.userID = "user"
+	connection.SetTag(TenantTag, "acme")
+	connection.countInbound(10)
+	connection.countOutbound(32)
+	connection.recordTopic("news")
+	connection.recordTopic("alerts")
+
+	record, ok := connection.sessionRecord("gw-1")
+	assert.True(t, ok)
+	assert.Equal(t, UserID("user"), record.UserID)
+	assert.Equal(t, int64(10), record.BytesIn)
+	assert.Equal(t, int64(32), record.BytesOut)
+	assert.Equal(t, []string{"alerts", "news"}, record.Topics)
+	assert.Equal(t, "acme", record.Tags[TenantTag])
+
+	_, ok = connection.sessionRecord("gw-1")
+	assert.False(t, ok)
+}
+
+func TestSessionExporter(t *T) {
+	sink := &memoryAnalyticsSink{}
+	exporter := NewSessionExporter(sink, 10, 2, time.Hour, NewMetrics())
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		exporter.Run(done)
+		close(stopped)
+	}()
+
+	for i := 0; i < 3; i++ {
+		exporter.Export(SessionRecord{ConnectionID: ConnectionID(i)})
+	}
+	close(done)
+	<-stopped
+
+	assert.Equal(t, 2, len(sink.batches))
+	assert.Equal(t, 2, len(sink.batches[0]))
+	assert.Equal(t, 1, len(sink.batches[1]))
+}
@@ -0,0 +1,65 @@
+// Package auth authentication of the gateway clients by the json web tokens of their identity provider
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// ErrKeyNotFound the key id of the token isn't in the JWKS
+var ErrKeyNotFound = errors.New("unable to find key")
+
+// ParseJWT parse json web token and output claims and token. The signing keys are fetched from the jwks url https://auth0.com/docs/jwks
+func ParseJWT(idtoken string, jwks string) (claims jwt.MapClaims, token *jwt.Token, err error) {
+	claims = jwt.MapClaims{}
+	token, err = jwt.ParseWithClaims(idtoken, claims, func(token *jwt.Token) (interface{}, error) {
+		return Key(token, func(refresh bool) (*jwk.Set, error) {
+			return jwk.FetchHTTP(jwks)
+		})
+	})
+	return
+}
+
+// Key get the signing key of the token from the key set. The key set is fetched again once if the key isn't found,
+// e.g. after a key rotation of the identity provider
+func Key(token *jwt.Token, fetch func(refresh bool) (*jwk.Set, error)) (interface{}, error) {
+	// validate the alg
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	keyID, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("expecting JWT header to have string kid")
+	}
+
+	for _, refresh := range []bool{false, true} {
+		keySet, err := fetch(refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		if key := keySet.LookupKeyID(keyID); len(key) == 1 {
+			return key[0].Materialize()
+		}
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// ResolveIDToken resolve id_token saved in header by removing the "bearer " rpefix
+func ResolveIDToken(token string) (idtoken string, valid bool) {
+	valid = true
+	idtokensegments := strings.Split(token, "Bearer ")
+	if len(idtokensegments) != 2 {
+		valid = false
+		return
+	}
+
+	idtoken = idtokensegments[1]
+	return
+}
@@ -0,0 +1,120 @@
+package websocketnats
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	// BinaryCapability capability a client declares to get the nats payloads in binary frames
+	BinaryCapability = "binary"
+	// BinaryCommandsMarker first byte of a binary frame holding typed commands, see splitBinaryCommands
+	BinaryCommandsMarker = 1
+)
+
+// binaryCommands names of the typed binary commands by their type byte
+var binaryCommands = map[byte]string{
+	1: "login",
+	2: "topic",
+	3: "untopic",
+	4: "publish",
+	5: "request",
+	6: "history",
+	7: "ping",
+}
+
+// splitLengthPrefixed split a binary frame made of commands each prefixed by its length as a 4 bytes big endian integer.
+// Returns nil if the frame is malformed
+func splitLengthPrefixed(message []byte) [][]byte {
+	commands := [][]byte{}
+	for len(message) > 0 {
+		if len(message) < 4 {
+			return nil
+		}
+
+		length := binary.BigEndian.Uint32(message)
+		message = message[4:]
+		if uint32(len(message)) < length {
+			return nil
+		}
+
+		commands = append(commands, message[:length])
+		message = message[length:]
+	}
+	return commands
+}
+
+// splitBinaryCommands split a binary frame, after its marker byte, made of typed commands: the type byte, see binaryCommands,
+// the number of fields on one byte and the fields each prefixed by its length as a 4 bytes big endian integer.
+// The commands are translated to the prefix protocol, e.g. login>:<token>. Only the last field may hold a colon,
+// so the payloads are binary safe. Returns nil if the frame is malformed
+func splitBinaryCommands(message []byte) [][]byte {
+	commands := [][]byte{}
+	for len(message) > 0 {
+		if len(message) < 2 {
+			return nil
+		}
+
+		name, ok := binaryCommands[message[0]]
+		count := int(message[1])
+		message = message[2:]
+		if !ok {
+			return nil
+		}
+
+		command := []byte(name)
+		if count > 0 {
+			command = append(command, '>', ':')
+		}
+		for i := 0; i < count; i++ {
+			if len(message) < 4 {
+				return nil
+			}
+
+			length := binary.BigEndian.Uint32(message)
+			message = message[4:]
+			if uint32(len(message)) < length {
+				return nil
+			}
+
+			field := message[:length]
+			message = message[length:]
+			if i < count-1 && bytes.IndexByte(field, ':') >= 0 {
+				return nil
+			}
+
+			if i > 0 {
+				command = append(command, ':')
+			}
+			command = append(command, field...)
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// onBinaryMessage handle a binary frame carrying commands. A frame starting with a zero byte holds length-prefixed
+// commands, see splitLengthPrefixed, a frame starting with BinaryCommandsMarker holds typed commands, see splitBinaryCommands,
+// any other frame is handled as a text frame, e.g. a command or a json array of commands
+func (w *NatsWebSocket) onBinaryMessage(connection *Connection, message []byte) {
+	if len(message) == 0 || (message[0] != 0 && message[0] != BinaryCommandsMarker) {
+		w.onTextFrame(connection, message)
+		return
+	}
+
+	var commands [][]byte
+	if message[0] == BinaryCommandsMarker {
+		commands = splitBinaryCommands(message[1:])
+	} else {
+		commands = splitLengthPrefixed(message)
+	}
+	if commands == nil {
+		connection.Logf("binary message rejected: malformed length prefix (%d bytes)", len(message))
+		connection.Reply([]byte("invalid binary message"))
+		return
+	}
+
+	for _, command := range commands {
+		w.onTextMessage(connection, command)
+	}
+}
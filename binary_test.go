@@ -0,0 +1,40 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLengthPrefixed(t *T) {
+	message := append([]byte{0, 0, 0, 4}, []byte("ping")...)
+	message = append(message, 0, 0, 0, 13)
+	message = append(message, []byte("topic>:test.a")...)
+
+	commands := splitLengthPrefixed(message)
+	assert.Equal(t, 2, len(commands))
+	assert.Equal(t, "ping", string(commands[0]))
+	assert.Equal(t, "topic>:test.a", string(commands[1]))
+
+	assert.Nil(t, splitLengthPrefixed([]byte{0, 0, 0, 9, 'p'}))
+	assert.Nil(t, splitLengthPrefixed([]byte{0, 0}))
+}
+
+func TestSplitBinaryCommands(t *T) {
+	message := []byte{1, 1, 0, 0, 0, 3}
+	message = append(message, []byte("jwt")...)
+	message = append(message, 4, 2, 0, 0, 0, 4)
+	message = append(message, []byte("news")...)
+	message = append(message, 0, 0, 0, 3, 0xff, ':', 0)
+	message = append(message, 7, 0)
+
+	commands := splitBinaryCommands(message)
+	assert.Equal(t, 3, len(commands))
+	assert.Equal(t, "login>:jwt", string(commands[0]))
+	assert.Equal(t, append([]byte("publish>:news:"), 0xff, ':', 0), commands[1])
+	assert.Equal(t, "ping", string(commands[2]))
+
+	assert.Nil(t, splitBinaryCommands([]byte{42, 0}))
+	assert.Nil(t, splitBinaryCommands([]byte{2, 1, 0, 0, 0, 9, 'n'}))
+	assert.Nil(t, splitBinaryCommands([]byte{4, 2, 0, 0, 0, 3, 'a', ':', 'b', 0, 0, 0, 0}))
+}
@@ -0,0 +1,113 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultBroadcastSubject default subject of the announcements to every connection, see Config.BroadcastSubject
+	DefaultBroadcastSubject = "gateway.broadcast"
+
+	// UsersBroadcast suffix of the broadcast subject of the announcements to the logged in connections only
+	UsersBroadcast = "users"
+	// AnonymousBroadcast suffix of the broadcast subject of the announcements to the connections not logged in only
+	AnonymousBroadcast = "anonymous"
+)
+
+// LoggedIn broadcast filter selecting the logged in connections
+func LoggedIn(connection *Connection) bool {
+	return connection.IsLoggedIn()
+}
+
+// Anonymous broadcast filter selecting the connections not logged in
+func Anonymous(connection *Connection) bool {
+	return !connection.IsLoggedIn()
+}
+
+// Broadcast send the payload as is to every connection the filter selects, all of them if nil, e.g. an announcement.
+// The payload is queued behind the deferred messages of the backed up connections, see SendToUser. Returns the number
+// of connections the payload was sent or queued to
+func (w *NatsWebSocket) Broadcast(payload []byte, filter func(connection *Connection) bool) int {
+	sent := 0
+	for _, connection := range w.connections.ListConnections() {
+		if filter != nil && !filter(connection) {
+			continue
+		}
+		if connection.push(payload).Status != DeviceFailed {
+			sent++
+		}
+	}
+	w.metrics.Counter("gateway_broadcasts_total", "Payloads broadcast to the connections").Inc()
+	return sent
+}
+
+// startBroadcast subscribe to Config.BroadcastSubject, broadcasting the messages to every connection, and to its
+// users and anonymous suffixes, broadcasting to the logged in connections or to the others. The subscriptions last
+// until the gateway stops
+func (w *NatsWebSocket) startBroadcast() {
+	if w.config.DisableBroadcast {
+		return
+	}
+
+	subject := w.config.BroadcastSubject
+	if subject == "" {
+		subject = DefaultBroadcastSubject
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("broadcast: %v", err)
+		return
+	}
+
+	subscriptions := []*nats.Subscription{}
+	for _, pattern := range []string{subject, subject + ".*"} {
+		subscription, err := busClient.Subscribe(pattern, func(msg *nats.Msg) {
+			w.onBroadcast(msg, subject)
+		})
+		if err != nil {
+			w.logger.Printf("broadcast: %v", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	go func() {
+		<-w.done
+		for _, subscription := range subscriptions {
+			subscription.Unsubscribe()
+		}
+		w.natsPool.Put(busClient)
+	}()
+}
+
+// onBroadcast broadcast the message to the connections its subject selects, and reply the number of connections it
+// was sent to if it was a request
+func (w *NatsWebSocket) onBroadcast(msg *nats.Msg, subject string) {
+	var filter func(connection *Connection) bool
+	switch strings.TrimPrefix(msg.Subject, subject) {
+	case "":
+	case "." + UsersBroadcast:
+		filter = LoggedIn
+	case "." + AnonymousBroadcast:
+		filter = Anonymous
+	default:
+		return
+	}
+
+	sent := w.Broadcast(msg.Data, filter)
+	if msg.Reply == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{"instanceId": w.instanceID, "sent": sent})
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		return
+	}
+	defer w.natsPool.Put(busClient)
+	busClient.Publish(msg.Reply, payload)
+}
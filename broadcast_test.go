@@ -0,0 +1,54 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcast(t *T) {
+	w := New(&Config{}, WithPool(unavailablePool{}))
+
+	connect := func(userID UserID) chan string {
+		client, server := net.Pipe()
+		received := make(chan string, 4)
+		go func() {
+			transport := NewStreamTransport(client)
+			for {
+				_, message, err := transport.ReadMessage()
+				if err != nil {
+					return
+				}
+				received <- string(message)
+			}
+		}()
+		connection := w.registerConnection(NewStreamTransport(server))
+		if userID != "" {
+			connection.Login(userID, "phone")
+			w.connections.OnLogin(connection)
+		}
+		return received
+	}
+	user := connect("user")
+	anonymous := connect("")
+
+	assert.Equal(t, 2, w.Broadcast([]byte("to all"), nil))
+	assert.Equal(t, "to all", <-user)
+	assert.Equal(t, "to all", <-anonymous)
+
+	w.onBroadcast(&nats.Msg{Subject: DefaultBroadcastSubject + ".users", Data: []byte("to users")}, DefaultBroadcastSubject)
+	assert.Equal(t, "to users", <-user)
+	w.onBroadcast(&nats.Msg{Subject: DefaultBroadcastSubject + ".anonymous", Data: []byte("to anonymous")}, DefaultBroadcastSubject)
+	assert.Equal(t, "to anonymous", <-anonymous)
+
+	select {
+	case message := <-user:
+		t.Fatalf("unexpected %q", message)
+	case message := <-anonymous:
+		t.Fatalf("unexpected %q", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -1,11 +1,27 @@
-package websocketnats
+// Package broker pool of the nats connections of the gateway, the message broker its clients subscribe and publish to
+package broker
 
 import (
 	"sync"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
+// NatsPool abstraction of a nats connection pool used by the gateway.
+// Implemented by Pool and by decorators such as InstrumentedPool
+type NatsPool interface {
+	// Get retrieves an available nats connection, creating one if needed
+	Get() (*nats.Conn, error)
+	// Put returns a connection back to the pool
+	Put(conn *nats.Conn)
+	// Empty closes all the connections currently in the pool
+	Empty()
+	// Avail returns the number of idle connections in the pool
+	Avail() int
+	// Healthy returns the number of idle connections in the pool connected to a server
+	Healthy() int
+}
+
 // Pool is a simple connection pool for nats.io connections. It will create a small pool
 // of initial connections, and if more connections are needed they will be created on demand.
 // If a connection is Put back and the pool is full it will be closed.
@@ -40,9 +56,10 @@ func NewPoolCustom(addr string, size int, df DialFunc) (*Pool, error) {
 		}
 		pool = append(pool, client)
 	}
+	// sized for the connections dialed later too, e.g. once nats is reachable after a failed start
 	p := Pool{
 		Addr: addr,
-		pool: make(chan *nats.Conn, len(pool)),
+		pool: make(chan *nats.Conn, cap(pool)),
 		df:   df,
 	}
 	for i := range pool {
@@ -63,19 +80,34 @@ func NewPool(addr string, size int) (*Pool, error) {
 	return NewPoolCustom(addr, size, nats.Connect)
 }
 
-// Get retrieves an available nats connections. If there are none available it will create a new one on the fly
+// Dial dial a new connection with the dial func of the pool, e.g. to put it in the pool once nats is reachable
+func (p *Pool) Dial() (*nats.Conn, error) {
+	return p.df(p.Addr)
+}
+
+// Get retrieves an available nats connections. If there are none available it will create a new one on the fly.
+// The connections closed for good while idle, e.g. after exhausting their reconnects, are skipped
 func (p *Pool) Get() (*nats.Conn, error) {
-	select {
-	case conn := <-p.pool:
-		return conn, nil
-	default:
-		return p.df(p.Addr)
+	for {
+		select {
+		case conn := <-p.pool:
+			if conn.IsClosed() {
+				continue
+			}
+			return conn, nil
+		default:
+			return p.df(p.Addr)
+		}
 	}
 }
 
 // Put returns a client back to the pool. If the pool is full the client is closed instead.
 // If the client is already closed (due to connection failure or whatever reasons) it will not be put back in the pool
 func (p *Pool) Put(conn *nats.Conn) {
+	if conn.IsClosed() {
+		return
+	}
+
 	select {
 	case p.pool <- conn:
 	default:
@@ -103,3 +135,21 @@ func (p *Pool) Empty() {
 func (p *Pool) Avail() int {
 	return len(p.pool)
 }
+
+// Healthy returns the number of idle connections connected to a server, the ones reconnecting not counting.
+// The idle connections closed for good are dropped meanwhile
+func (p *Pool) Healthy() int {
+	healthy := 0
+	for i := len(p.pool); i > 0; i-- {
+		select {
+		case conn := <-p.pool:
+			if conn.IsConnected() {
+				healthy++
+			}
+			p.Put(conn)
+		default:
+			return healthy
+		}
+	}
+	return healthy
+}
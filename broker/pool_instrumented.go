@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// PoolStats snapshot of the pool instrumentation
+type PoolStats struct {
+	Checkouts          int64         `json:"checkouts"`
+	Errors             int64         `json:"errors"`
+	ErrorRate          float64       `json:"errorRate"`
+	AvgCheckoutLatency time.Duration `json:"avgCheckoutLatency"`
+	MaxCheckoutLatency time.Duration `json:"maxCheckoutLatency"`
+	// Subscriptions number of active subscriptions for each connection handed out by the pool
+	Subscriptions []int `json:"subscriptions"`
+}
+
+// InstrumentedPool decorates a NatsPool recording checkout latency, error rates and subscriptions per connection
+type InstrumentedPool struct {
+	pool           NatsPool
+	mutex          sync.Mutex
+	checkouts      int64
+	errors         int64
+	totalLatency   time.Duration
+	maxLatency     time.Duration
+	checkedOutConn map[*nats.Conn]struct{}
+}
+
+// NewInstrumentedPool wrap the pool with instrumentation
+func NewInstrumentedPool(pool NatsPool) *InstrumentedPool {
+	return &InstrumentedPool{
+		pool:           pool,
+		mutex:          sync.Mutex{},
+		checkedOutConn: make(map[*nats.Conn]struct{}),
+	}
+}
+
+// Get retrieves a connection from the underlying pool and records the checkout
+func (p *InstrumentedPool) Get() (*nats.Conn, error) {
+	start := time.Now()
+	conn, err := p.pool.Get()
+	latency := time.Since(start)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.checkouts++
+	p.totalLatency += latency
+	if latency > p.maxLatency {
+		p.maxLatency = latency
+	}
+
+	if err != nil {
+		p.errors++
+		return conn, err
+	}
+
+	p.checkedOutConn[conn] = struct{}{}
+	return conn, nil
+}
+
+// Put returns the connection to the underlying pool
+func (p *InstrumentedPool) Put(conn *nats.Conn) {
+	p.mutex.Lock()
+	delete(p.checkedOutConn, conn)
+	p.mutex.Unlock()
+
+	p.pool.Put(conn)
+}
+
+// Empty empties the underlying pool
+func (p *InstrumentedPool) Empty() {
+	p.pool.Empty()
+}
+
+// Avail returns the number of idle connections in the underlying pool
+func (p *InstrumentedPool) Avail() int {
+	return p.pool.Avail()
+}
+
+// Healthy returns the number of connected idle connections in the underlying pool
+func (p *InstrumentedPool) Healthy() int {
+	return p.pool.Healthy()
+}
+
+// Stats get a snapshot of the recorded instrumentation
+func (p *InstrumentedPool) Stats() PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := PoolStats{
+		Checkouts:          p.checkouts,
+		Errors:             p.errors,
+		MaxCheckoutLatency: p.maxLatency,
+		Subscriptions:      make([]int, 0, len(p.checkedOutConn)),
+	}
+
+	if p.checkouts > 0 {
+		stats.ErrorRate = float64(p.errors) / float64(p.checkouts)
+		stats.AvgCheckoutLatency = p.totalLatency / time.Duration(p.checkouts)
+	}
+
+	for conn := range p.checkedOutConn {
+		// forget the connections closed since checkout
+		if conn.IsClosed() {
+			delete(p.checkedOutConn, conn)
+			continue
+		}
+		stats.Subscriptions = append(stats.Subscriptions, conn.NumSubscriptions())
+	}
+
+	return stats
+}
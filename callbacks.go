@@ -0,0 +1,154 @@
+package websocketnats
+
+import (
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// DeliveryMode how a topic callback relates to the websocket delivery
+type DeliveryMode int32
+
+const (
+	// DeliverAlongside the callback is invoked and bus messages are still delivered to websocket subscribers
+	DeliverAlongside DeliveryMode = 0
+	// DeliverInstead the callback replaces the websocket delivery
+	DeliverInstead DeliveryMode = 1
+)
+
+// DeliveryCallback invoked once for each bus message of a topic, as long as at least one client is subscribed to the topic
+type DeliveryCallback func(topic string, data []byte)
+
+type topicCallback struct {
+	mode     DeliveryMode
+	callback DeliveryCallback
+	// subscribers the connections whose subscription retained the callback subscription
+	subscribers  map[*Connection]struct{}
+	busClient    *nats.Conn
+	subscription *nats.Subscription
+}
+
+// TopicCallbacks registry of the per-topic delivery callbacks
+type TopicCallbacks struct {
+	mutex     sync.Mutex
+	callbacks map[string]*topicCallback
+}
+
+// NewTopicCallbacks init topic callbacks registry
+func NewTopicCallbacks() *TopicCallbacks {
+	return &TopicCallbacks{
+		mutex:     sync.Mutex{},
+		callbacks: make(map[string]*topicCallback),
+	}
+}
+
+// Register register the callback of the topic. Should be called before the gateway starts
+func (r *TopicCallbacks) Register(topic string, mode DeliveryMode, callback DeliveryCallback) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.callbacks[topic] = &topicCallback{
+		mode:        mode,
+		callback:    callback,
+		subscribers: make(map[*Connection]struct{}),
+	}
+}
+
+// DeliversToWebsocket check if bus messages of the topic should be sent to websocket subscribers
+func (r *TopicCallbacks) DeliversToWebsocket(topic string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok := r.callbacks[topic]
+	return !ok || cb.mode != DeliverInstead
+}
+
+// Retain count the connection as a subscriber of the topic. The callback subscription is created for the first subscriber,
+// the connection not being counted if it fails
+func (r *TopicCallbacks) Retain(connection *Connection, topic string, connections *SubscriptionConnections) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok := r.callbacks[topic]
+	if !ok {
+		return nil
+	}
+	if _, retained := cb.subscribers[connection]; retained {
+		return nil
+	}
+
+	if len(cb.subscribers) == 0 {
+		busClient, err := connections.Get(topic)
+		if err != nil {
+			return err
+		}
+
+		if err := cb.subscribe(topic, busClient); err != nil {
+			return err
+		}
+	}
+
+	cb.subscribers[connection] = struct{}{}
+	return nil
+}
+
+// Release forget the connection as a subscriber of the topic, unless its Retain failed. The callback subscription is
+// removed with the last subscriber
+func (r *TopicCallbacks) Release(connection *Connection, topic string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok := r.callbacks[topic]
+	if !ok {
+		return
+	}
+	if _, retained := cb.subscribers[connection]; !retained {
+		return
+	}
+
+	delete(cb.subscribers, connection)
+	if len(cb.subscribers) > 0 {
+		return
+	}
+
+	cb.subscription.Unsubscribe()
+	cb.subscription = nil
+	cb.busClient = nil
+}
+
+// subscribe make the callback subscription of the topic on the nats connection
+func (cb *topicCallback) subscribe(topic string, busClient *nats.Conn) error {
+	subscription, err := busClient.Subscribe(topic, func(msg *nats.Msg) {
+		cb.callback(msg.Subject, msg.Data)
+	})
+	if err != nil {
+		return err
+	}
+
+	cb.busClient = busClient
+	cb.subscription = subscription
+	return nil
+}
+
+// Resubscribe move the callback subscriptions made on the nats connection to the connection replacing it.
+// Returns the number of callback subscriptions that couldn't be moved
+func (r *TopicCallbacks) Resubscribe(conn *nats.Conn, connections *SubscriptionConnections) (failed int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for topic, cb := range r.callbacks {
+		if cb.subscription == nil || cb.busClient != conn {
+			continue
+		}
+
+		cb.subscription.Unsubscribe()
+		busClient, err := connections.Get(topic)
+		if err == nil {
+			err = cb.subscribe(topic, busClient)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,26 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicCallbacksFailedRetain(t *T) {
+	callbacks := NewTopicCallbacks()
+	callbacks.Register("news", DeliverInstead, func(topic string, data []byte) {})
+	connection := NewConnection(1, nil)
+
+	connections := NewSubscriptionConnections(unavailablePool{}, 1)
+	assert.NotNil(t, callbacks.Retain(connection, "news", connections))
+	assert.Empty(t, callbacks.callbacks["news"].subscribers)
+
+	// a release is only matched with a successful retain
+	callbacks.callbacks["news"].subscribers[NewConnection(2, nil)] = struct{}{}
+	callbacks.Release(connection, "news")
+	assert.Len(t, callbacks.callbacks["news"].subscribers, 1)
+
+	assert.Nil(t, callbacks.Retain(connection, "other", connections))
+	assert.False(t, callbacks.DeliversToWebsocket("news"))
+	assert.True(t, callbacks.DeliversToWebsocket("other"))
+}
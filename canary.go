@@ -0,0 +1,38 @@
+package websocketnats
+
+import (
+	"hash/fnv"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// CanaryTag connection tag set to "true" on the canary connections
+	CanaryTag = "canary"
+)
+
+// isCanary decide at login if the connection is a canary: its token has one of the Config.CanaryClaims,
+// or its user falls in the Config.CanaryPercent slice. The slice is picked by user so all the devices of a user agree
+func (w *NatsWebSocket) isCanary(userID UserID, claims jwt.MapClaims) bool {
+	for claim, value := range w.config.CanaryClaims {
+		if claimValue, ok := claims[claim].(string); ok && claimValue == value {
+			return true
+		}
+	}
+
+	if w.config.CanaryPercent <= 0 {
+		return false
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	return int(hash.Sum32()%100) < w.config.CanaryPercent
+}
+
+// routeSubject get the nats subject the topic is subscribed on, Config.CanaryTopicPrefix followed by the topic for the canary connections
+func (w *NatsWebSocket) routeSubject(connection *Connection, topic string) string {
+	if w.config.CanaryTopicPrefix != "" && connection.GetTag(CanaryTag) == "true" && !w.isTemporaryTopic(topic) {
+		return w.config.CanaryTopicPrefix + topic
+	}
+	return topic
+}
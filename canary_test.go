@@ -0,0 +1,23 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanary(t *T) {
+	w := New(&Config{CanaryClaims: map[string]string{"group": "beta"}, CanaryTopicPrefix: "v2."})
+
+	assert.True(t, w.isCanary("user", jwt.MapClaims{"group": "beta"}))
+	assert.False(t, w.isCanary("user", jwt.MapClaims{"group": "stable"}))
+
+	connection := NewConnection(1, nil)
+	assert.Equal(t, "test.a", w.routeSubject(connection, "test.a"))
+	connection.SetTag(CanaryTag, "true")
+	assert.Equal(t, "v2.test.a", w.routeSubject(connection, "test.a"))
+
+	w.config.CanaryPercent = 100
+	assert.True(t, w.isCanary("user", jwt.MapClaims{}))
+}
@@ -0,0 +1,52 @@
+package websocketnats
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+)
+
+const (
+	// ChallengePrefix request a login nonce, e.g. challenge>:. Replies challenge>:<nonce>
+	ChallengePrefix = "challenge>:"
+
+	// DefaultChallengeTTL default time in seconds a login nonce is valid
+	DefaultChallengeTTL = 30
+)
+
+// challenge issue a single use nonce the client embeds as the nonce claim of its login token,
+// so a captured login frame can't be replayed on another connection
+func (w *NatsWebSocket) challenge(connection *Connection) {
+	ttl := w.config.ChallengeTTL
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		connection.Logf("challenge failed: %v", err)
+		connection.Reply([]byte(ChallengePrefix + "unavailable"))
+		return
+	}
+
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+
+	connection.dataMutex.Lock()
+	connection.nonce = nonce
+	connection.nonceExpiry = time.Now().Add(time.Duration(ttl) * time.Second)
+	connection.dataMutex.Unlock()
+
+	connection.Reply([]byte(ChallengePrefix + nonce))
+}
+
+// verifyNonce check the nonce claim against the nonce issued to the connection. The nonce is consumed by the attempt
+func (c *Connection) verifyNonce(nonce string) bool {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	expected, expiry := c.nonce, c.nonceExpiry
+	c.nonce = ""
+
+	return expected != "" && time.Now().Before(expiry) && subtle.ConstantTimeCompare([]byte(expected), []byte(nonce)) == 1
+}
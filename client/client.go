@@ -0,0 +1,283 @@
+// Package client Go client of the nats websocket gateway for backend services.
+// The client logs in as a privileged service with one of the gateway service tokens, and can then push messages to users,
+// query their presence and receive the gateway events, without hand rolling the websocket protocol
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	websocketnats "github.com/ilovelili/dongfeng-websocket-nats"
+)
+
+const (
+	// DefaultTimeout default time to wait for the gateway replies
+	DefaultTimeout = 5 * time.Second
+)
+
+var (
+	// ErrNotAuthorized the service token was rejected by the gateway
+	ErrNotAuthorized = errors.New("client: not authorized")
+	// ErrTimeout the gateway didn't reply in time
+	ErrTimeout = errors.New("client: timeout")
+	// ErrClosed the client is closed
+	ErrClosed = errors.New("client: closed")
+)
+
+// Client privileged service connection to the gateway
+type Client struct {
+	// Timeout time to wait for the gateway replies
+	Timeout time.Duration
+
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	waiters    map[string][]chan string
+	events     chan websocketnats.GatewayEvent
+	done       chan struct{}
+	// jsonProtocol the gateway speaks the json protocol, older gateways only speak the prefix protocol
+	jsonProtocol bool
+}
+
+// Dial connect to the gateway at url, e.g. ws://localhost:8080/, and login with the service token
+func Dial(url, token string) (*Client, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{websocketnats.JSONSubprotocol}
+
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Timeout:      DefaultTimeout,
+		conn:         conn,
+		waiters:      make(map[string][]chan string),
+		done:         make(chan struct{}),
+		jsonProtocol: conn.Subprotocol() == websocketnats.JSONSubprotocol,
+	}
+
+	go c.readLoop()
+
+	reply, err := c.request(websocketnats.ServicePrefix, websocketnats.ServicePrefix+token)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if reply != "ok" {
+		c.Close()
+		return nil, ErrNotAuthorized
+	}
+
+	return c, nil
+}
+
+// PushToUser send the payload to all the connections of the user. Returns the number of connections it was delivered to
+func (c *Client) PushToUser(userID string, payload []byte) (int, error) {
+	key := websocketnats.PushPrefix + userID + ":"
+	reply, err := c.request(key, key+string(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(reply)
+}
+
+// Presence get the number of connections of the user on the gateway. Zero means offline
+func (c *Client) Presence(userID string) (int, error) {
+	key := websocketnats.PresencePrefix + userID + ":"
+	reply, err := c.request(key, websocketnats.PresencePrefix+userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(reply)
+}
+
+// Events subscribe to the gateway events. The channel is closed with the client
+func (c *Client) Events() (<-chan websocketnats.GatewayEvent, error) {
+	c.mutex.Lock()
+	if c.events == nil {
+		c.events = make(chan websocketnats.GatewayEvent, 64)
+	}
+	events := c.events
+	c.mutex.Unlock()
+
+	reply, err := c.request(websocketnats.EventsPrefix, websocketnats.EventsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply != "ok" {
+		return nil, ErrNotAuthorized
+	}
+
+	return events, nil
+}
+
+// Close close the connection to the gateway
+func (c *Client) Close() error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return c.conn.Close()
+}
+
+// request send the command and wait for the reply starting with key. Replies of the same key come back in order
+func (c *Client) request(key, command string) (string, error) {
+	waiter := make(chan string, 1)
+
+	c.mutex.Lock()
+	select {
+	case <-c.done:
+		c.mutex.Unlock()
+		return "", ErrClosed
+	default:
+	}
+	c.waiters[key] = append(c.waiters[key], waiter)
+	c.mutex.Unlock()
+
+	frame := []byte(command)
+	if c.jsonProtocol {
+		frame = encodeCommand(command)
+	}
+
+	c.writeMutex.Lock()
+	err := c.conn.WriteMessage(websocket.TextMessage, frame)
+	c.writeMutex.Unlock()
+
+	if err != nil {
+		c.forget(key, waiter)
+		return "", err
+	}
+
+	select {
+	case reply, ok := <-waiter:
+		if !ok {
+			return "", ErrClosed
+		}
+		return reply, nil
+	case <-time.After(c.Timeout):
+		c.forget(key, waiter)
+		return "", ErrTimeout
+	}
+}
+
+func (c *Client) forget(key string, waiter chan string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	waiters := c.waiters[key]
+	for i := range waiters {
+		if waiters[i] == waiter {
+			c.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Client) readLoop() {
+	defer func() {
+		c.mutex.Lock()
+		close(c.done)
+		for _, waiters := range c.waiters {
+			for _, waiter := range waiters {
+				close(waiter)
+			}
+		}
+		c.waiters = make(map[string][]chan string)
+		if c.events != nil {
+			close(c.events)
+		}
+		c.mutex.Unlock()
+	}()
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if c.jsonProtocol {
+			message = decodeReply(message)
+		}
+
+		if bytes.HasPrefix(message, []byte(websocketnats.EventPrefix)) {
+			c.onEvent(message[len(websocketnats.EventPrefix):])
+			continue
+		}
+
+		c.onReply(message)
+	}
+}
+
+func (c *Client) onEvent(payload []byte) {
+	var event websocketnats.GatewayEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case c.events <- event:
+	default:
+		// drop the event rather than blocking the replies
+	}
+}
+
+func (c *Client) onReply(message []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, waiters := range c.waiters {
+		if len(waiters) == 0 || !bytes.HasPrefix(message, []byte(key)) {
+			continue
+		}
+
+		waiters[0] <- string(message[len(key):])
+		c.waiters[key] = waiters[1:]
+		return
+	}
+}
+
+// encodeCommand wrap the prefix command, e.g. push>:<user id>:<payload>, in a json message
+func encodeCommand(command string) []byte {
+	index := strings.Index(command, ">:")
+	data, _ := json.Marshal(command[index+2:])
+	frame, _ := json.Marshal(websocketnats.JSONMessage{
+		Version: websocketnats.JSONProtocolVersion,
+		Type:    command[:index],
+		Data:    data,
+	})
+	return frame
+}
+
+// decodeReply unwrap the prefix response carried by a json reply or error, the other frames are returned as is
+func decodeReply(frame []byte) []byte {
+	var message websocketnats.JSONMessage
+	if json.Unmarshal(frame, &message) != nil || message.Version == 0 {
+		return frame
+	}
+
+	switch message.Type {
+	case websocketnats.ReplyEnvelope:
+		var data string
+		if json.Unmarshal(message.Data, &data) == nil {
+			return []byte(data)
+		}
+		return message.Data
+	case websocketnats.ErrorEnvelope:
+		return []byte(message.Message)
+	}
+	return frame
+}
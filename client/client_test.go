@@ -0,0 +1,142 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/websocket"
+	websocketnats "github.com/ilovelili/dongfeng-websocket-nats"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type unavailablePool struct{}
+
+func (unavailablePool) Get() (*nats.Conn, error) { return nil, errors.New("unavailable") }
+func (unavailablePool) Put(conn *nats.Conn)      {}
+func (unavailablePool) Empty()                   {}
+func (unavailablePool) Avail() int               { return 0 }
+func (unavailablePool) Healthy() int             { return 0 }
+
+// startGateway serve an in-process gateway whose users login with the tokens signed by the returned key
+func startGateway(t *T, config *websocketnats.Config) (url string, key *rsa.PrivateKey, stop func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(writer, `{"keys":[{"kty":"RSA","kid":"k1","n":"%s","e":"%s"}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	}))
+
+	config.URLPattern = "/"
+	config.HeartbeatInterval = -1
+	config.ServiceTokens = []string{"secret"}
+	config.JWKS = jwks.URL
+	gateway := websocketnats.New(config, websocketnats.WithPool(unavailablePool{}))
+	server := httptest.NewServer(gateway.Handler())
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), key, func() {
+		server.Close()
+		gateway.Stop()
+		jwks.Close()
+	}
+}
+
+// loginUser connect a user to the gateway, speaking the json protocol unless legacy
+func loginUser(t *T, url string, key *rsa.PrivateKey, userID string, legacy bool) *websocket.Conn {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": userID, "userId": userID})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	assert.Nil(t, err)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+
+	command := websocketnats.LoginPrefix + "Bearer " + signed
+	frame := []byte(command)
+	if !legacy {
+		frame = encodeCommand(command)
+	}
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, frame))
+	return conn
+}
+
+// readUntil read the frames of the connection until one contains text
+func readUntil(conn *websocket.Conn, text string) bool {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return false
+		}
+		if strings.Contains(string(frame), text) {
+			return true
+		}
+	}
+}
+
+func testClient(t *T, config *websocketnats.Config, legacy bool) {
+	url, key, stop := startGateway(t, config)
+	defer stop()
+
+	_, err := Dial(url, "wrong")
+	assert.Equal(t, ErrNotAuthorized, err)
+
+	c, err := Dial(url, "secret")
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Equal(t, !legacy, c.jsonProtocol)
+
+	events, err := c.Events()
+	assert.Nil(t, err)
+
+	user := loginUser(t, url, key, "u1", legacy)
+	defer user.Close()
+
+	select {
+	case event := <-events:
+		assert.Equal(t, websocketnats.LoginEvent, event.Type)
+		assert.Equal(t, websocketnats.UserID("u1"), event.UserID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no login event")
+	}
+
+	count, err := c.Presence("u1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = c.Presence("u2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	delivered, err := c.PushToUser("u1", []byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.True(t, readUntil(user, "hello"))
+}
+
+func TestClientJSONProtocol(t *T) {
+	testClient(t, &websocketnats.Config{}, false)
+}
+
+func TestClientLegacyProtocol(t *T) {
+	testClient(t, &websocketnats.Config{LegacyProtocol: true, Subprotocols: []string{websocketnats.ProtobufSubprotocol}}, true)
+}
+
+func TestDecodeReply(t *T) {
+	assert.Equal(t, "push>:u1:2", string(decodeReply([]byte(`{"v":1,"type":"reply","data":"push>:u1:2"}`))))
+	assert.Equal(t, "service>:Not Authorized", string(decodeReply([]byte(`{"v":1,"type":"error","code":"not_authorized","message":"service>:Not Authorized"}`))))
+	assert.Equal(t, `event>:{"type":"login"}`, string(decodeReply([]byte(`event>:{"type":"login"}`))))
+	assert.Equal(t, `{"type":"reply"}`, string(decodeReply([]byte(`{"type":"reply"}`))))
+}
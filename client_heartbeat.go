@@ -0,0 +1,78 @@
+package websocketnats
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeartbeatNotice heartbeat interval the client must honor, sent after the login
+	HeartbeatNotice = "heartbeat"
+
+	// DefaultClientHeartbeatTolerance default number of heartbeat intervals a client may miss before it is disconnected
+	DefaultClientHeartbeatTolerance = 2
+)
+
+// negotiateHeartbeat get the interval the client must send a frame within, e.g. ping. The client may ask a longer one
+// with the heartbeat query parameter of the upgrade url in seconds, up to Config.MaxClientHeartbeatInterval.
+// The interval is doubled while the gateway holds more than Config.HeartbeatLoadThreshold connections
+func (w *NatsWebSocket) negotiateHeartbeat(request *http.Request) time.Duration {
+	interval := w.config.ClientHeartbeatInterval
+	if interval <= 0 {
+		return 0
+	}
+
+	if request != nil {
+		requested, err := strconv.Atoi(request.URL.Query().Get("heartbeat"))
+		if err == nil && requested > interval && requested <= w.config.MaxClientHeartbeatInterval {
+			interval = requested
+		}
+	}
+
+	if w.config.HeartbeatLoadThreshold > 0 && w.connections.GetStats().NumberOfConnections > w.config.HeartbeatLoadThreshold {
+		interval *= 2
+	}
+
+	return time.Duration(interval) * time.Second
+}
+
+// advertiseHeartbeat send the negotiated heartbeat to the client and start enforcing it
+func (w *NatsWebSocket) advertiseHeartbeat(connection *Connection) {
+	interval := w.negotiateHeartbeat(connection.request)
+	if interval == 0 {
+		return
+	}
+
+	tolerance := w.config.ClientHeartbeatTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultClientHeartbeatTolerance
+	}
+
+	connection.SetHeartbeat(interval, tolerance)
+	connection.ReplyNotice(Notice{
+		Type:      HeartbeatNotice,
+		Interval:  int64(interval / time.Millisecond),
+		Tolerance: tolerance,
+	})
+}
+
+// SetHeartbeat require a frame from the client at least every interval, tolerating the given number of missed intervals
+func (c *Connection) SetHeartbeat(interval time.Duration, tolerance int) {
+	c.dataMutex.Lock()
+	c.heartbeatTimeout = interval * time.Duration(tolerance+1)
+	c.dataMutex.Unlock()
+
+	c.extendReadDeadline()
+}
+
+// extendReadDeadline push back the read deadline after a frame is received. The read fails once the client misses too many heartbeats
+func (c *Connection) extendReadDeadline() {
+	c.dataMutex.RLock()
+	timeout := c.heartbeatTimeout
+	c.dataMutex.RUnlock()
+
+	if timeout > 0 {
+		c.ws.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
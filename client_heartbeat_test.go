@@ -0,0 +1,26 @@
+package websocketnats
+
+import (
+	"net/http/httptest"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateHeartbeat(t *T) {
+	w := New(&Config{ClientHeartbeatInterval: 30, MaxClientHeartbeatInterval: 300})
+
+	assert.Equal(t, 30*time.Second, w.negotiateHeartbeat(httptest.NewRequest("GET", "/ws", nil)))
+	assert.Equal(t, 120*time.Second, w.negotiateHeartbeat(httptest.NewRequest("GET", "/ws?heartbeat=120", nil)))
+	assert.Equal(t, 30*time.Second, w.negotiateHeartbeat(httptest.NewRequest("GET", "/ws?heartbeat=600", nil)))
+
+	// the interval is relaxed under load
+	w.config.HeartbeatLoadThreshold = 1
+	w.connections.AddNewConnection(NewConnection(1, nil))
+	w.connections.AddNewConnection(NewConnection(2, nil))
+	assert.Equal(t, 60*time.Second, w.negotiateHeartbeat(httptest.NewRequest("GET", "/ws", nil)))
+
+	w.config.ClientHeartbeatInterval = 0
+	assert.Equal(t, time.Duration(0), w.negotiateHeartbeat(httptest.NewRequest("GET", "/ws", nil)))
+}
@@ -0,0 +1,28 @@
+// Command websocket-nats runs the nats websocket gateway standalone, configured by a json or yaml file and the
+// environment variables, see websocketnats.LoadConfig. The config is reloaded on SIGHUP
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	websocketnats "github.com/ilovelili/dongfeng-websocket-nats"
+)
+
+func main() {
+	path := flag.String("config", "", "config file, json or yaml. The config is read from the environment only if empty")
+	flag.Parse()
+
+	config, err := websocketnats.LoadConfig(*path)
+	if err != nil {
+		log.Fatalf("can't load the config: %v", err)
+	}
+
+	gateway := websocketnats.New(config, websocketnats.WithConfigLoader(func() (*websocketnats.Config, error) {
+		return websocketnats.LoadConfig(*path)
+	}))
+	if err := gateway.Start(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package websocketnats
+
+import (
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// codecs codecs by websocket subprotocol
+var codecs = map[string]Codec{
+	ProtobufSubprotocol: ProtobufCodec{},
+	JSONSubprotocol:     JSONCodec{},
+}
+
+// errorCodes error code of the error responses, by response or by the suffix of the prefixed responses, e.g. publish>:<subject>:forbidden
+var errorCodes = map[string]string{
+	"go away":                  "unauthorized",
+	"Not Authorized":           "not_authorized",
+	"invalid topic":            "invalid_topic",
+	"already subscribed":       "already_subscribed",
+	"not subscribed":           "not_subscribed",
+	TooManyCommandsResponse:    "too_many_commands",
+	"invalid publish":          "invalid_command",
+	"invalid push":             "invalid_command",
+	"invalid request":          "invalid_command",
+	"too many requests":        "too_many_requests",
+	"timeout":                  "timeout",
+	ReadOnlyResponse:           "read_only",
+	UnknownCommandResponse:     "unknown_command",
+	"invalid binary message":   "invalid_command",
+	"forbidden":                "forbidden",
+	"unavailable":              "unavailable",
+	"pending":                  "pending",
+	"error":                    "error",
+	NatsUnavailable:            "unavailable",
+	TooManyConnectionsResponse: "too_many_connections",
+}
+
+// replyEnvelope wrap the response of a command, as an error envelope if it is an error response
+func replyEnvelope(response []byte, id uint64) Envelope {
+	text := string(response)
+	if index := strings.LastIndex(text, ":"); index >= 0 && strings.Contains(text, ">:") {
+		text = text[index+1:]
+	}
+
+	if code, ok := errorCodes[text]; ok {
+		return Envelope{Command: ErrorEnvelope, Payload: response, Error: code, ID: id}
+	}
+	return Envelope{Command: ReplyEnvelope, Payload: response, ID: id}
+}
+
+// envelopeCommand map the envelope to the text command, i.e. <command>>:<topic>:<payload>, ping being the only command without prefix
+func envelopeCommand(envelope Envelope) []byte {
+	if envelope.Command == "ping" {
+		return []byte("ping")
+	}
+
+	command := []byte(envelope.Command + ">:")
+	if envelope.Topic != "" {
+		command = append(command, envelope.Topic...)
+		if len(envelope.Payload) > 0 {
+			command = append(command, ':')
+		}
+	}
+	return append(command, envelope.Payload...)
+}
+
+// sendEnvelope write the envelope with the codec of the connection
+func (c *Connection) sendEnvelope(envelope Envelope) {
+	frame := c.codec.Encode(envelope)
+	if c.codec.FrameType() == websocket.BinaryMessage {
+		c.SendBinary(frame)
+		return
+	}
+	c.SendText(frame)
+}
+
+// onEnvelope handle a frame of a connection with a codec. The replies of the command carry its id
+func (w *NatsWebSocket) onEnvelope(connection *Connection, frame []byte) {
+	envelope, err := connection.codec.Decode(frame)
+	if err != nil {
+		connection.Logf("envelope rejected: %v", err)
+		connection.sendEnvelope(Envelope{Command: ErrorEnvelope, Error: "invalid_envelope", Payload: []byte(err.Error())})
+		return
+	}
+
+	connection.dataMutex.Lock()
+	connection.requestID = envelope.ID
+	connection.dataMutex.Unlock()
+
+	if envelope.Command == RequestEnvelope {
+		w.onRequestEnvelope(connection, envelope)
+	} else {
+		w.onTextMessage(connection, envelopeCommand(envelope))
+	}
+
+	connection.dataMutex.Lock()
+	connection.requestID = 0
+	connection.dataMutex.Unlock()
+}
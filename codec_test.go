@@ -0,0 +1,65 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelopeRoundTrip(t *T) {
+	envelope := Envelope{Command: MessageEnvelope, Topic: "test.a", Payload: []byte{0, 1, 2}, ID: 300}
+	frame := MarshalEnvelope(envelope)
+	// command is field 1, length delimited
+	assert.Equal(t, []byte{0x0a, 7}, frame[:2])
+
+	decoded, err := UnmarshalEnvelope(frame)
+	assert.Nil(t, err)
+	assert.Equal(t, envelope, decoded)
+
+	// unknown varint field 6 is skipped
+	decoded, err = UnmarshalEnvelope(append(frame, 0x30, 0x96, 0x01))
+	assert.Nil(t, err)
+	assert.Equal(t, envelope, decoded)
+
+	_, err = UnmarshalEnvelope([]byte{0x0a, 9, 'r'})
+	assert.Equal(t, ErrMalformedEnvelope, err)
+}
+
+func TestEnvelopeCommand(t *T) {
+	assert.Equal(t, "ping", string(envelopeCommand(Envelope{Command: "ping"})))
+	assert.Equal(t, "topic>:test.a", string(envelopeCommand(Envelope{Command: "topic", Topic: "test.a"})))
+	assert.Equal(t, "publish>:test.a:hi", string(envelopeCommand(Envelope{Command: "publish", Topic: "test.a", Payload: []byte("hi")})))
+	assert.Equal(t, "login>:token", string(envelopeCommand(Envelope{Command: "login", Payload: []byte("token")})))
+}
+
+func TestReplyEnvelope(t *T) {
+	assert.Equal(t, Envelope{Command: ReplyEnvelope, Payload: []byte("ok"), ID: 3}, replyEnvelope([]byte("ok"), 3))
+	assert.Equal(t, "invalid_topic", replyEnvelope([]byte("invalid topic"), 0).Error)
+	assert.Equal(t, "not_authorized", replyEnvelope([]byte(LoginPrefix+"Not Authorized"), 0).Error)
+	assert.Equal(t, "forbidden", replyEnvelope([]byte(PublishPrefix+"test.a:forbidden"), 0).Error)
+	assert.Equal(t, ReplyEnvelope, replyEnvelope([]byte(PublishPrefix+"test.a:ok"), 0).Command)
+}
+
+func TestJSONCodec(t *T) {
+	codec := JSONCodec{}
+
+	envelope, err := codec.Decode([]byte(`{"v":1,"type":"subscribe","topic":"test.a","id":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "topic>:test.a", string(envelopeCommand(envelope)))
+	assert.Equal(t, uint64(2), envelope.ID)
+
+	envelope, _ = codec.Decode([]byte(`{"v":1,"type":"login","data":"token"}`))
+	assert.Equal(t, "login>:token", string(envelopeCommand(envelope)))
+
+	envelope, _ = codec.Decode([]byte(`{"v":1,"type":"publish","topic":"test.a","data":{"a":1}}`))
+	assert.Equal(t, `publish>:test.a:{"a":1}`, string(envelopeCommand(envelope)))
+
+	_, err = codec.Decode([]byte(`{"v":2,"type":"ping"}`))
+	assert.NotNil(t, err)
+	_, err = codec.Decode([]byte(`ping`))
+	assert.NotNil(t, err)
+
+	assert.Equal(t, `{"v":1,"type":"message","topic":"test.a","data":{"a":1}}`, string(codec.Encode(Envelope{Command: MessageEnvelope, Topic: "test.a", Payload: []byte(`{"a":1}`)})))
+	assert.Equal(t, `{"v":1,"type":"reply","id":1,"data":"ok"}`, string(codec.Encode(replyEnvelope([]byte("ok"), 1))))
+	assert.Equal(t, `{"v":1,"type":"error","id":2,"code":"unauthorized","message":"go away"}`, string(codec.Encode(replyEnvelope([]byte("go away"), 2))))
+}
@@ -0,0 +1,94 @@
+package websocketnats
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultCompressionThreshold default size in bytes from which the messages are compressed, see Config.CompressionThreshold
+	DefaultCompressionThreshold = 256
+)
+
+// compressedTransport websocket connection that negotiated permessage-deflate. Only the messages over the threshold
+// are compressed, the smaller ones not being worth the cpu, and the written payloads are counted in raw bytes
+type compressedTransport struct {
+	*websocket.Conn
+	threshold int
+	raw       *Counter
+}
+
+func (t *compressedTransport) WriteMessage(messageType int, data []byte) error {
+	t.EnableWriteCompression(len(data) >= t.threshold)
+	t.raw.Add(float64(len(data)))
+	return t.Conn.WriteMessage(messageType, data)
+}
+
+// wireCountingWriter response writer whose hijacked connection counts the bytes written to the socket
+type wireCountingWriter struct {
+	http.ResponseWriter
+	wire *Counter
+}
+
+func (w *wireCountingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, readWriter, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &wireCountingConn{Conn: conn, wire: w.wire}, readWriter, nil
+}
+
+type wireCountingConn struct {
+	net.Conn
+	wire *Counter
+}
+
+func (c *wireCountingConn) Write(p []byte) (int, error) {
+	written, err := c.Conn.Write(p)
+	c.wire.Add(float64(written))
+	return written, err
+}
+
+// offersCompression check if the client offers the permessage-deflate extension
+func offersCompression(request *http.Request) bool {
+	for _, extensions := range request.Header["Sec-Websocket-Extensions"] {
+		if strings.Contains(strings.ToLower(extensions), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeCompressed upgrade the request of a client offering permessage-deflate, with the compression level and threshold of the config
+func (w *NatsWebSocket) upgradeCompressed(writer http.ResponseWriter, request *http.Request) (Transport, string, error) {
+	if _, ok := writer.(http.Hijacker); ok {
+		writer = &wireCountingWriter{
+			ResponseWriter: writer,
+			wire:           w.metrics.Counter("gateway_compression_wire_bytes_total", "Bytes written to the sockets of the connections negotiating permessage-deflate"),
+		}
+	}
+
+	connection, err := w.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if w.config.CompressionLevel != 0 {
+		connection.SetCompressionLevel(w.config.CompressionLevel)
+	}
+	threshold := w.config.CompressionThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+
+	transport := &compressedTransport{
+		Conn:      connection,
+		threshold: threshold,
+		raw:       w.metrics.Counter("gateway_compression_raw_bytes_total", "Message bytes written to the connections negotiating permessage-deflate, before compression"),
+	}
+	return transport, connection.Subprotocol(), nil
+}
@@ -0,0 +1,37 @@
+package websocketnats
+
+import (
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *T) {
+	gateway := New(&Config{URLPattern: "/", HeartbeatInterval: -1, EnableCompression: true, CompressionLevel: 9, CompressionThreshold: 1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	conn, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Contains(t, response.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"ping","id":1}`)))
+	_, reply, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), "pong")
+
+	var builder strings.Builder
+	gateway.Metrics().WriteTo(&builder)
+	assert.Contains(t, builder.String(), "gateway_compression_raw_bytes_total")
+	assert.Contains(t, builder.String(), "gateway_compression_wire_bytes_total")
+
+	assert.NotNil(t, (&Config{URLPattern: "/", CompressionLevel: 10}).Validate())
+}
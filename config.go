@@ -0,0 +1,243 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	nats "github.com/nats-io/nats.go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ConfigEnvPrefix prefix of the environment variables overriding the config, followed by the json name of the setting
+	// in upper snake case, e.g. DONGFENG_NATS_ADDRESS for natsAddress
+	ConfigEnvPrefix = "DONGFENG_"
+
+	// DefaultListenInterface default interface the gateway listens on
+	DefaultListenInterface = ":8080"
+	// DefaultURLPattern default path of the websocket endpoint
+	DefaultURLPattern = "/"
+	// DefaultNatsPoolSize default number of pooled nats connections
+	DefaultNatsPoolSize = 8
+)
+
+// LoadConfig load the config from the json or yaml file, by its extension, overridden by the environment variables, see
+// ConfigEnvPrefix. The settings of list, map or struct type are set by json values in the environment, except the lists
+// of strings which are comma separated. Without a path, the config is loaded from the environment only.
+// The missing essential settings are defaulted, then the config is validated
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			if data, err = yamlToJSON(data); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	if err := applyEnv(config, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetDefaults default the missing essential settings: the listen interface, the url pattern, the nats address and pool size
+func (c *Config) SetDefaults() {
+	if c.ListenInterface == "" {
+		c.ListenInterface = DefaultListenInterface
+	}
+	if c.URLPattern == "" {
+		c.URLPattern = DefaultURLPattern
+	}
+	if c.NatsAddress == "" && len(c.NatsServers) == 0 {
+		c.NatsAddress = nats.DefaultURL
+	}
+	if c.NatsPoolSize == 0 {
+		c.NatsPoolSize = DefaultNatsPoolSize
+	}
+}
+
+// Validate check the config for inconsistent settings
+func (c *Config) Validate() error {
+	if c.NatsPoolSize < 0 {
+		return errors.New("config: natsPoolSize must be positive")
+	}
+	if !strings.HasPrefix(c.URLPattern, "/") {
+		return fmt.Errorf("config: urlPattern %q must start with /", c.URLPattern)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("config: tlsCertFile and tlsKeyFile must be set together")
+	}
+	if c.WebTransportListen != "" && c.TLSCertFile == "" {
+		return errors.New("config: webTransportListen requires tlsCertFile and tlsKeyFile")
+	}
+	if (c.AdminTLSCertFile == "") != (c.AdminTLSKeyFile == "") {
+		return errors.New("config: adminTlsCertFile and adminTlsKeyFile must be set together")
+	}
+	switch c.UnknownCommands {
+	case "", UnknownCommandIgnore, UnknownCommandReply, UnknownCommandScore:
+	default:
+		return fmt.Errorf("config: invalid unknownCommands %q", c.UnknownCommands)
+	}
+	if c.AdminListenInterface != "" && c.AdminToken == "" {
+		return errors.New("config: adminListenInterface requires adminToken")
+	}
+	if c.Pprof && c.DebugToken == "" && c.AdminToken == "" {
+		return errors.New("config: pprof requires debugToken or adminToken")
+	}
+	switch c.UserLimitPolicy {
+	case "", UserLimitReject, UserLimitEvict:
+	default:
+		return fmt.Errorf("config: invalid userLimitPolicy %q", c.UserLimitPolicy)
+	}
+	switch c.OutboundRatePolicy {
+	case "", OutboundRateDrop, OutboundRateCoalesce:
+	default:
+		return fmt.Errorf("config: invalid outboundRatePolicy %q", c.OutboundRatePolicy)
+	}
+	switch c.SendQueuePolicy {
+	case "", SendQueueDrop, SendQueueClose:
+	default:
+		return fmt.Errorf("config: invalid sendQueuePolicy %q", c.SendQueuePolicy)
+	}
+	if c.CompressionLevel < -2 || c.CompressionLevel > 9 {
+		return fmt.Errorf("config: compressionLevel %d out of -2..9", c.CompressionLevel)
+	}
+	for _, subprotocol := range c.Subprotocols {
+		if _, ok := codecs[subprotocol]; !ok {
+			return fmt.Errorf("config: unsupported subprotocol %q", subprotocol)
+		}
+	}
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	for i, topic := range c.Topics {
+		if topic.Pattern == "" {
+			return fmt.Errorf("config: topic %d has no pattern", i)
+		}
+	}
+	return nil
+}
+
+// applyEnv override the settings of the config with the environment variables found by lookup
+func applyEnv(config *Config, lookup func(key string) (string, bool)) error {
+	value := reflect.ValueOf(config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := ConfigEnvPrefix + envName(name)
+		env, ok := lookup(key)
+		if !ok {
+			continue
+		}
+
+		if err := setField(value.Field(i), env); err != nil {
+			return fmt.Errorf("config: %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// envName convert the json name of a setting to upper snake case, e.g. natsAddress to NATS_ADDRESS
+func envName(name string) string {
+	runes := []rune(name)
+	env := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			env = append(env, '_')
+		}
+		env = append(env, unicode.ToUpper(r))
+	}
+	return string(env)
+}
+
+func setField(field reflect.Value, env string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(env)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(env)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(env, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(env, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	default:
+		if field.Type() == reflect.TypeOf([]string{}) && !strings.HasPrefix(env, "[") {
+			values := []string{}
+			for _, value := range strings.Split(env, ",") {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+			field.Set(reflect.ValueOf(values))
+			return nil
+		}
+		return json.Unmarshal([]byte(env), field.Addr().Interface())
+	}
+	return nil
+}
+
+// yamlToJSON convert a yaml document to json, so it is decoded by the json names of the settings
+func yamlToJSON(data []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(document))
+}
+
+// jsonValue convert the yaml maps, keyed by interface{}, to json objects
+func jsonValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			object[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = jsonValue(item)
+		}
+		return typed
+	}
+	return value
+}
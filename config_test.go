@@ -0,0 +1,51 @@
+package websocketnats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *T) {
+	assert.Equal(t, "NATS_ADDRESS", envName("natsAddress"))
+	assert.Equal(t, "JWKS", envName("jwks"))
+	assert.Equal(t, "NATS_TLS_CA_FILE", envName("natsTlsCaFile"))
+	assert.Equal(t, "URL_PATTERN", envName("urlPattern"))
+}
+
+func TestLoadConfig(t *T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`
+natsAddress: nats://bus:4222
+natsPoolSize: 4
+topics:
+  - pattern: news
+    rateLimit: 10
+`), 0600))
+
+	os.Setenv("DONGFENG_NATS_POOL_SIZE", "6")
+	os.Setenv("DONGFENG_PUBLISH_TOPICS", "chat.>, orders.*")
+	defer os.Unsetenv("DONGFENG_NATS_POOL_SIZE")
+	defer os.Unsetenv("DONGFENG_PUBLISH_TOPICS")
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "nats://bus:4222", config.NatsAddress)
+	assert.Equal(t, 6, config.NatsPoolSize)
+	assert.Equal(t, []string{"chat.>", "orders.*"}, config.PublishTopics)
+	assert.Equal(t, []TopicConfig{{Pattern: "news", RateLimit: 10}}, config.Topics)
+	assert.Equal(t, DefaultListenInterface, config.ListenInterface)
+	assert.Equal(t, DefaultURLPattern, config.URLPattern)
+
+	os.Setenv("DONGFENG_URL_PATTERN", "ws")
+	defer os.Unsetenv("DONGFENG_URL_PATTERN")
+	_, err = LoadConfig(path)
+	assert.NotNil(t, err)
+}
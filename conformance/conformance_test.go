@@ -0,0 +1,46 @@
+package conformance
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	websocketnats "github.com/ilovelili/dongfeng-websocket-nats"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type unavailablePool struct{}
+
+func (unavailablePool) Get() (*nats.Conn, error) { return nil, errors.New("unavailable") }
+func (unavailablePool) Put(conn *nats.Conn)      {}
+func (unavailablePool) Empty()                   {}
+func (unavailablePool) Avail() int               { return 0 }
+func (unavailablePool) Healthy() int             { return 0 }
+
+func TestScenarios(t *T) {
+	gateway := websocketnats.New(&websocketnats.Config{URLPattern: "/", HeartbeatInterval: -1}, websocketnats.WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+
+	runner := &Runner{URL: "ws" + strings.TrimPrefix(server.URL, "http"), Vars: map[string]string{"TOKEN": "", "TOPIC": "", "PUBLISH_SUBJECT": ""}}
+	runner.Run(t, Scenarios()...)
+
+	failing, err := ParseScenario("failing", strings.NewReader(`send {"v":1,"type":"ping","id":1}`+"\nexpect-json {\"type\":\"error\"}"))
+	assert.Nil(t, err)
+	assert.Contains(t, runner.Execute(failing).Error(), `failing:2: expect-json {"type":"error"}: got`)
+}
+
+func TestParseScenario(t *T) {
+	scenario, err := ParseScenario("login", strings.NewReader("# comment\n\nsend login>:Bearer ${TOKEN}\nexpect-close 1008\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Step{{3, Send, "login>:Bearer ${TOKEN}"}, {4, ExpectClose, "1008"}}, scenario.Steps)
+
+	_, err = ParseScenario("invalid", strings.NewReader("send ping\nexpect-none soon"))
+	assert.NotNil(t, err)
+	_, err = ParseScenario("invalid", strings.NewReader("shout ping"))
+	assert.EqualError(t, err, `invalid:1: unknown action "shout"`)
+}
@@ -0,0 +1,286 @@
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	websocketnats "github.com/ilovelili/dongfeng-websocket-nats"
+)
+
+const (
+	// DefaultTimeout default time to wait for an expected frame
+	DefaultTimeout = 5 * time.Second
+)
+
+// ErrSkipped the scenario requires variables that aren't set, see Require
+var ErrSkipped = errors.New("conformance: skipped")
+
+// Conn connection to the gateway the scenarios are run over. SDK authors implement it on top of their SDK to check it
+// speaks the protocol, the default being a raw websocket, see Dial
+type Conn interface {
+	// Send send a text frame
+	Send(text string) error
+	// Receive get the next frame received within the timeout. Returns a *CloseError once the gateway closed the connection
+	Receive(timeout time.Duration) (string, error)
+	// Close close the connection
+	Close() error
+}
+
+// CloseError the gateway closed the connection with the close code
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("closed: %d %s", e.Code, e.Text)
+}
+
+// errTimeout no frame received within the timeout
+var errTimeout = errors.New("timeout")
+
+// Dial open a raw websocket connection to the gateway at url, e.g. ws://localhost:8080/, negotiating the json protocol
+func Dial(url string) (Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{websocketnats.JSONSubprotocol}
+
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &websocketConn{conn: conn, frames: make(chan string, 64), done: make(chan struct{}), closed: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+type websocketConn struct {
+	conn   *websocket.Conn
+	frames chan string
+	done   chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func (c *websocketConn) readLoop() {
+	defer close(c.done)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				c.err = &CloseError{Code: closeErr.Code, Text: closeErr.Text}
+			} else {
+				c.err = err
+			}
+			return
+		}
+		select {
+		case c.frames <- string(data):
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *websocketConn) Send(text string) error {
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+func (c *websocketConn) Receive(timeout time.Duration) (string, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-time.After(timeout):
+		return "", errTimeout
+	case <-c.done:
+		// the frames read before the close come first
+		select {
+		case frame := <-c.frames:
+			return frame, nil
+		default:
+			return "", c.err
+		}
+	}
+}
+
+func (c *websocketConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// Runner runs the scenarios against the gateway at URL
+type Runner struct {
+	// URL websocket url of the gateway, e.g. ws://localhost:8080/
+	URL string
+	// Vars variables expanded in the steps, e.g. TOKEN, falling back to the environment
+	Vars map[string]string
+	// Dial connects to the gateway, Dial by default
+	Dial func(url string) (Conn, error)
+	// Timeout time to wait for an expected frame, DefaultTimeout by default
+	Timeout time.Duration
+}
+
+// Run run each scenario as a subtest, skipping the ones whose required variables aren't set
+func (r *Runner) Run(t *testing.T, scenarios ...*Scenario) {
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			if err := r.Execute(scenario); err == ErrSkipped {
+				t.Skip("required variables not set")
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Execute run the scenario. Returns the first failed step, or ErrSkipped
+func (r *Runner) Execute(scenario *Scenario) error {
+	dial := r.Dial
+	if dial == nil {
+		dial = Dial
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := dial(r.URL)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+
+	for _, step := range scenario.Steps {
+		argument := os.Expand(step.Argument, r.lookup)
+		if step.Action == Require {
+			for _, name := range strings.Fields(step.Argument) {
+				if r.lookup(name) == "" {
+					return ErrSkipped
+				}
+			}
+			continue
+		}
+
+		switch step.Action {
+		case Reconnect:
+			conn.Close()
+			conn, err = dial(r.URL)
+		case Sleep:
+			duration, _ := time.ParseDuration(argument)
+			time.Sleep(duration)
+		case Timeout:
+			timeout, _ = time.ParseDuration(argument)
+		default:
+			err = r.step(conn, step.Action, argument, timeout)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s %s: %v", scenario.Name, step.Line, step.Action, argument, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) step(conn Conn, action, argument string, timeout time.Duration) error {
+	switch action {
+	case Send:
+		return conn.Send(argument)
+	case Expect:
+		frame, err := conn.Receive(timeout)
+		if err != nil {
+			return err
+		}
+		if frame != argument {
+			return fmt.Errorf("got %.128q", frame)
+		}
+	case ExpectMatch, Await, ExpectJSON, AwaitJSON:
+		match, err := matcher(action, argument)
+		if err != nil {
+			return err
+		}
+		for deadline := time.Now().Add(timeout); ; {
+			frame, err := conn.Receive(time.Until(deadline))
+			if err != nil {
+				return err
+			}
+			if match(frame) {
+				return nil
+			}
+			if action == ExpectMatch || action == ExpectJSON {
+				return fmt.Errorf("got %.128q", frame)
+			}
+		}
+	case ExpectNone:
+		duration, _ := time.ParseDuration(argument)
+		frame, err := conn.Receive(duration)
+		if err == errTimeout {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("got %.128q", frame)
+	case ExpectClose:
+		code, _ := strconv.Atoi(argument)
+		for deadline := time.Now().Add(timeout); ; {
+			_, err := conn.Receive(time.Until(deadline))
+			if closeErr, ok := err.(*CloseError); ok {
+				if closeErr.Code != code {
+					return fmt.Errorf("closed with %d %s", closeErr.Code, closeErr.Text)
+				}
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matcher match the frames against the regular expression, or against the fields of the json object for the json actions
+func matcher(action, argument string) (func(frame string) bool, error) {
+	if action == ExpectMatch || action == Await {
+		expression, err := regexp.Compile(argument)
+		if err != nil {
+			return nil, err
+		}
+		return expression.MatchString, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(argument), &fields); err != nil {
+		return nil, err
+	}
+	return func(frame string) bool {
+		var object map[string]interface{}
+		if json.Unmarshal([]byte(frame), &object) != nil {
+			return false
+		}
+		for name, value := range fields {
+			if !reflect.DeepEqual(object[name], value) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func (r *Runner) lookup(name string) string {
+	if value, ok := r.Vars[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
@@ -0,0 +1,130 @@
+// Package conformance protocol conformance harness of the nats websocket gateway, for the authors of client SDKs.
+// A scenario is a script of commands sent to a live gateway and of frames expected back, run over a raw websocket
+// speaking the json protocol or through the SDK under test by implementing Conn. The built-in scenarios cover the login, the resume, the acks and the
+// error handling, see Scenarios
+package conformance
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Send send the argument as a text frame, e.g. send login>:Bearer ${TOKEN}
+	Send = "send"
+	// Expect the next frame equals the argument
+	Expect = "expect"
+	// ExpectMatch the next frame matches the regular expression
+	ExpectMatch = "expect-match"
+	// Await skip the frames until one matches the regular expression, e.g. the messages delivered meanwhile
+	Await = "await"
+	// ExpectJSON the next frame is a json object holding the fields of the argument, e.g. expect-json {"type":"reply","id":1}
+	ExpectJSON = "expect-json"
+	// AwaitJSON skip the frames until one is a json object holding the fields of the argument
+	AwaitJSON = "await-json"
+	// ExpectNone no frame arrives within the duration, e.g. expect-none 500ms
+	ExpectNone = "expect-none"
+	// ExpectClose the gateway closes the connection with the close code, e.g. expect-close 1008
+	ExpectClose = "expect-close"
+	// Reconnect close the connection and dial the gateway again
+	Reconnect = "reconnect"
+	// Sleep wait for the duration
+	Sleep = "sleep"
+	// Timeout set the time to wait for the expected frames of the next steps, DefaultTimeout by default
+	Timeout = "timeout"
+	// Require skip the scenario unless the variables are set, e.g. require TOKEN TOPIC
+	Require = "require"
+)
+
+// Step one line of a scenario
+type Step struct {
+	Line     int
+	Action   string
+	Argument string
+}
+
+// Scenario named list of steps. Blank lines and the lines starting with # are ignored, the arguments of the steps are
+// expanded with the variables of the runner, e.g. ${TOKEN}
+type Scenario struct {
+	Name  string
+	Steps []Step
+}
+
+// ParseScenario parse the steps of the scenario, one per line as <action> <argument>
+func ParseScenario(name string, reader io.Reader) (*Scenario, error) {
+	scenario := &Scenario{Name: name}
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		action, argument := text, ""
+		if index := strings.IndexByte(text, ' '); index >= 0 {
+			action, argument = text[:index], strings.TrimSpace(text[index+1:])
+		}
+
+		if err := validate(action, argument); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, line, err)
+		}
+		scenario.Steps = append(scenario.Steps, Step{Line: line, Action: action, Argument: argument})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+// LoadScenarios parse the scenario files matching the glob pattern, named after their file name, e.g. testdata/*.scenario
+func LoadScenarios(pattern string) ([]*Scenario, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	scenarios := make([]*Scenario, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scenario, err := ParseScenario(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, nil
+}
+
+func validate(action, argument string) error {
+	switch action {
+	case Send, Expect, Reconnect:
+		return nil
+	case ExpectMatch, Await, ExpectJSON, AwaitJSON, Require:
+		if argument == "" {
+			return fmt.Errorf("%s needs an argument", action)
+		}
+	case ExpectNone, Sleep, Timeout:
+		if _, err := time.ParseDuration(argument); err != nil {
+			return fmt.Errorf("%s: %v", action, err)
+		}
+	case ExpectClose:
+		if _, err := strconv.Atoi(argument); err != nil {
+			return fmt.Errorf("%s: invalid close code %q", action, argument)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return nil
+}
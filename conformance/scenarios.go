@@ -0,0 +1,92 @@
+package conformance
+
+import (
+	"strings"
+)
+
+// builtin scenarios of the json protocol, see Scenarios. The scenarios requiring a gateway setup are skipped unless
+// their variables are set: TOKEN a valid id token, TOPIC a topic the user may subscribe to with the history service
+// configured, PUBLISH_SUBJECT a subject of Config.PublishTopics
+var builtin = []struct {
+	name   string
+	script string
+}{
+	{"ping", `
+send {"v":1,"type":"ping","id":1}
+expect-json {"v":1,"type":"reply","id":1,"data":"pong"}
+`},
+	{"invalid-envelope", `
+send nonsense
+expect-json {"type":"error","code":"invalid_envelope"}
+# the gateway answers the versions it supports only
+send {"v":2,"type":"ping","id":1}
+expect-json {"type":"error","code":"invalid_envelope"}
+`},
+	{"login-malformed", `
+# the token must be sent as Bearer <token>
+send {"v":1,"type":"login","data":"garbage","id":1}
+expect-json {"type":"error","id":1,"code":"not_authorized"}
+`},
+	{"login-invalid", `
+send {"v":1,"type":"login","data":"Bearer invalid","id":1}
+expect-json {"type":"error","id":1,"code":"not_authorized"}
+`},
+	{"commands-before-login", `
+send {"v":1,"type":"subscribe","topic":"conformance","id":1}
+expect-json {"type":"error","id":1,"code":"unauthorized"}
+send {"v":1,"type":"publish","topic":"conformance","data":{},"id":2}
+expect-json {"type":"error","id":2,"code":"unauthorized"}
+send {"v":1,"type":"history","topic":"conformance","id":3}
+expect-json {"type":"error","id":3,"code":"unauthorized"}
+`},
+	{"unsubscribe-not-subscribed", `
+send {"v":1,"type":"unsubscribe","topic":"conformance","id":1}
+expect-json {"type":"error","id":1,"code":"not_subscribed"}
+`},
+	{"login", `
+require TOKEN
+send {"v":1,"type":"login","data":"Bearer ${TOKEN}","id":1}
+expect-json {"type":"reply","id":1}
+# logging in again as the same user is acknowledged
+send {"v":1,"type":"login","data":"Bearer ${TOKEN}","id":2}
+expect-json {"type":"reply","id":2,"data":"ok"}
+`},
+	{"publish-ack", `
+require TOKEN PUBLISH_SUBJECT
+send {"v":1,"type":"login","data":"Bearer ${TOKEN}","id":1}
+expect-json {"type":"reply","id":1}
+send {"v":1,"type":"publish","topic":"${PUBLISH_SUBJECT}","data":{},"id":2}
+await-json {"type":"reply","id":2}
+send {"v":1,"type":"publish","topic":"conformance.*","data":{},"id":3}
+await-json {"type":"error","id":3,"code":"forbidden"}
+send {"v":1,"type":"publish","id":4}
+await-json {"type":"error","id":4,"code":"invalid_command"}
+`},
+	{"resume", `
+require TOKEN TOPIC
+send {"v":1,"type":"login","data":"Bearer ${TOKEN}","id":1}
+expect-json {"type":"reply","id":1}
+send {"v":1,"type":"subscribe","topic":"${TOPIC}","id":2}
+# the client reconnects and resumes the topic from the history: the backfilled messages, then the count
+reconnect
+send {"v":1,"type":"login","data":"Bearer ${TOKEN}","id":1}
+expect-json {"type":"reply","id":1}
+send {"v":1,"type":"history","topic":"${TOPIC}?since=0","id":2}
+await history>:${TOPIC}:[0-9]+$
+`},
+}
+
+// Scenarios get the built-in scenarios: the ping, the invalid envelopes, the login, the commands refused before the
+// login, the publish acks and the resume of a topic after a reconnect. The scenarios needing a valid token or topics are
+// skipped unless the variables TOKEN, TOPIC and PUBLISH_SUBJECT are set
+func Scenarios() []*Scenario {
+	scenarios := make([]*Scenario, 0, len(builtin))
+	for _, scenario := range builtin {
+		parsed, err := ParseScenario(scenario.name, strings.NewReader(scenario.script))
+		if err != nil {
+			panic(err)
+		}
+		scenarios = append(scenarios, parsed)
+	}
+	return scenarios
+}
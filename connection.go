@@ -1,10 +1,15 @@
 package websocketnats
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
 )
 
 // ConnectionID connection id
@@ -15,12 +20,12 @@ type UserID string
 
 // DeviceID device id.
 // Regarding to device, although the best approach is to get the device info by parsing the JWT provided by Auth0, I am not very sure if Auth0 provides device info scope.
-// So, we fallback to IP if deviceID not saved in JWT
+// So, the device id is resolved at login by the DeviceIdentifier, see DefaultDeviceIdentifier
 type DeviceID string
 
 // Connection wraps websocket connection.
 type Connection struct {
-	ws            *websocket.Conn
+	ws            Transport
 	id            ConnectionID
 	userID        UserID
 	deviceID      DeviceID
@@ -28,52 +33,199 @@ type Connection struct {
 	lastMessageAt time.Time
 	dataMutex     sync.RWMutex
 	writeMutex    sync.Mutex
+	// closed set by the first Close
+	closed        bool
+	logger        *LogThrottle
+	subscriptions map[string][]*nats.Subscription
+	subscribes    map[string]int
+	tags          map[string]string
+	transcript    *Transcript
+	tap           *Transcript
+	outbound      *OutboundStats
+	outboundDepth int64
+	outboundPeak  int64
+	batching      bool
+	replies       [][]byte
+	nonce         string
+	nonceExpiry   time.Time
+	request       *http.Request
+	capabilities  []string
+	namespaces    []string
+	backfills     map[string]*backfill
+	// maxMessageSize, claimCheck and messageIDField handle the messages too large for the client
+	maxMessageSize int
+	claimCheck     ClaimCheckStore
+	messageIDField string
+	deferred       *fairQueue
+	binaryPayloads bool
+	gzipPayloads   bool
+	codec          Codec
+	requestID      uint64
+	roles          []string
+	rpcInFlight    int64
+	readOnly       bool
+	sessionID      string
+	// heartbeatTimeout time without any frame from the client before the read fails, 0 if not enforced
+	heartbeatTimeout time.Duration
+	// frames and processing queue the frames for the command workers
+	frames     []inputFrame
+	processing bool
+	// softLimits and limitWarnings warn the client approaching a limit, see Config.SoftLimitRatio
+	softLimits    *SoftLimits
+	limitWarnings map[string]time.Time
+	// policies weigh the topics of the deferred messages, see fairQueue
+	policies *TopicPolicies
+	// flow counts the deferred messages of each topic for the flow advisories, see Config.FlowHighWatermark
+	flow *FlowControl
+	// preferences notification preferences of the logged in user, see WithPreferenceStore
+	preferences *preferenceCache
+	// bytesIn, bytesOut and sessionTopics describe the session exported to the analytics sink
+	bytesIn         int64
+	bytesOut        int64
+	sessionTopics   map[string]bool
+	sessionExported bool
+	// unknownCommands misbehavior score of the connection, see Config.UnknownCommands
+	unknownCommands int
+	// maxReadSize read limit of the connection once logged in, see Config.MaxReadSize
+	maxReadSize int64
+	// events publishes the delivery results, see EventBus
+	events *EventBus
+	// writeTimeout time to write a frame before the connection is closed, see Config.WriteTimeout
+	writeTimeout  time.Duration
+	writeTimeouts *Counter
+	// tokenExpiry expiry of the token the connection logged in with, see Config.TokenExpiryGrace
+	tokenExpiry       time.Time
+	tokenExpiryWarned bool
+	// outboundRate limits the messages delivered to the connection, see Config.MaxOutboundMessagesPerSecond
+	outboundRate *outboundRate
+	// pump writes the frames queued by the senders, see Config.SendQueueSize
+	pump *writePump
+	// trace context of the upgrade span, see WithTracer
+	trace context.Context
 }
 
 // NewConnection init the connection
-func NewConnection(id ConnectionID, ws *websocket.Conn) *Connection {
+func NewConnection(id ConnectionID, ws Transport) *Connection {
 	c := &Connection{
-		ws:         ws,
-		id:         id,
-		userID:     "",
-		deviceID:   "",
-		startTime:  time.Now(),
-		dataMutex:  sync.RWMutex{},
-		writeMutex: sync.Mutex{},
+		ws:            ws,
+		id:            id,
+		userID:        "",
+		deviceID:      "",
+		startTime:     time.Now(),
+		dataMutex:     sync.RWMutex{},
+		writeMutex:    sync.Mutex{},
+		logger:        NewLogThrottle(fmt.Sprintf("connection %d: ", id), DefaultMaxConnectionLogsPerMinute, time.Minute),
+		subscriptions: make(map[string][]*nats.Subscription),
+		subscribes:    make(map[string]int),
+		tags:          make(map[string]string),
 	}
 	return c
 }
 
 // ReadMessage read
 func (c *Connection) ReadMessage() (messageType int, p []byte, err error) {
-	return c.ws.ReadMessage()
+	messageType, p, err = c.ws.ReadMessage()
+	if err == nil {
+		c.record(TranscriptInbound, messageType, p)
+	}
+	return
+}
+
+// SetLogLimit set the maximum number of log lines the connection may write per minute
+func (c *Connection) SetLogLimit(limit int) {
+	c.logger = NewLogThrottle(fmt.Sprintf("connection %d: ", c.id), limit, time.Minute)
+}
+
+// SetLogOutput write the connection log lines to the logger
+func (c *Connection) SetLogOutput(output *log.Logger) {
+	c.logger.SetOutput(output)
+}
+
+// Logf write a connection scoped log line, throttled to prevent a single client from flooding the logs
+func (c *Connection) Logf(format string, v ...interface{}) {
+	c.logger.Printf(format, v...)
 }
 
 // SendText write text
 func (c *Connection) SendText(message []byte) {
+	c.writeText(message)
+}
+
+// writeText write text, returning the write error, or the queueing error with a write pump
+func (c *Connection) writeText(message []byte) error {
+	if c.pump != nil {
+		return c.queueFrame(websocket.TextMessage, message)
+	}
+	return c.writeFrame(websocket.TextMessage, message)
+}
+
+// writeFrame write a frame to the transport
+func (c *Connection) writeFrame(messageType int, data []byte) error {
+	c.acquireOutbound()
+	defer c.releaseOutbound()
+
 	c.writeMutex.Lock()
 	defer c.writeMutex.Unlock()
 
-	c.ws.WriteMessage(websocket.TextMessage, message)
+	return c.writeLocked(messageType, data)
+}
+
+// writeLocked write a frame to the transport with the write mutex held
+func (c *Connection) writeLocked(messageType int, data []byte) error {
+	c.setWriteDeadline()
+	err := c.ws.WriteMessage(messageType, data)
+	c.checkWrite(err)
+	c.countOutbound(len(data))
+	c.record(TranscriptOutbound, messageType, data)
+	return err
+}
+
+// Reply write the response of a command. Responses are buffered while the connection processes a batch of commands
+func (c *Connection) Reply(message []byte) {
+	c.dataMutex.Lock()
+	if c.batching {
+		c.replies = append(c.replies, message)
+		c.dataMutex.Unlock()
+		return
+	}
+	requestID := c.requestID
+	c.dataMutex.Unlock()
+
+	if c.codec != nil {
+		c.sendEnvelope(replyEnvelope(message, requestID))
+		return
+	}
+	c.SendText(message)
 }
 
 // SendBinary write binary
 func (c *Connection) SendBinary(message []byte) {
-	c.writeMutex.Lock()
-	defer c.writeMutex.Unlock()
-
-	c.ws.WriteMessage(websocket.BinaryMessage, message)
+	if c.pump != nil {
+		c.queueFrame(websocket.BinaryMessage, message)
+		return
+	}
+	c.writeFrame(websocket.BinaryMessage, message)
 }
 
-// Close close the connection and set connection id to -1
+// Close close the connection and set connection id to -1. Closing it again is a no-op
 func (c *Connection) Close(code int, reason string) {
 	c.dataMutex.Lock()
+	if c.closed {
+		c.dataMutex.Unlock()
+		return
+	}
+	c.closed = true
 	c.dataMutex.Unlock()
-	c.writeMutex.Lock()
-	defer c.writeMutex.Unlock()
 
-	c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+	c.writeMutex.Lock()
+	c.flushWritePump()
+	c.setWriteDeadline()
+	c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
 	c.ws.Close()
+	c.writeMutex.Unlock()
+
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
 
 	c.id = -1
 	c.userID = ""
@@ -93,7 +245,7 @@ func (c *Connection) IsClosed() bool {
 	c.dataMutex.RLock()
 	defer c.dataMutex.RUnlock()
 
-	return c.IsClosed()
+	return c.id == -1
 }
 
 // GetInfo get connection id, user id, device id from connection
@@ -112,6 +264,22 @@ func (c *Connection) GetStartTime() time.Time {
 	return c.startTime
 }
 
+// SetTag tag the connection, e.g. with the customer resolved by the admission controller
+func (c *Connection) SetTag(key, value string) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.tags[key] = value
+}
+
+// GetTag get the tag value of the connection
+func (c *Connection) GetTag(key string) string {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	return c.tags[key]
+}
+
 // Login login using user id and device id
 func (c *Connection) Login(userID UserID, deviceID DeviceID) {
 	c.dataMutex.Lock()
@@ -119,7 +287,7 @@ func (c *Connection) Login(userID UserID, deviceID DeviceID) {
 
 	c.userID = userID
 	c.deviceID = deviceID
-	c.ws.SetReadLimit(0)
+	c.ws.SetReadLimit(c.maxReadSize)
 }
 
 // UpdateLastPingTime update last message ping time
@@ -129,3 +297,73 @@ func (c *Connection) UpdateLastPingTime() {
 
 	c.lastMessageAt = time.Now()
 }
+
+// AddSubscription track a nats subscription created on behalf of the connection. Returns true if it is the first subscription to the topic
+func (c *Connection) AddSubscription(topic string, subscription *nats.Subscription) bool {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.subscriptions[topic] = append(c.subscriptions[topic], subscription)
+	c.subscribes[topic]++
+	return len(c.subscriptions[topic]) == 1
+}
+
+// RetainSubscription count one more subscribe of the topic, see DuplicateRefCount
+func (c *Connection) RetainSubscription(topic string) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.subscribes[topic]++
+}
+
+// ReleaseSubscription count one unsubscribe of the topic. Returns true once the subscribes are all matched
+func (c *Connection) ReleaseSubscription(topic string) bool {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.subscribes[topic]--
+	return c.subscribes[topic] <= 0
+}
+
+// RemoveSubscription stop tracking the subscriptions of the topic and return them
+func (c *Connection) RemoveSubscription(topic string) []*nats.Subscription {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	subscriptions := c.subscriptions[topic]
+	delete(c.subscriptions, topic)
+	delete(c.subscribes, topic)
+	return subscriptions
+}
+
+// IsSubscribed check if the connection is subscribed to the topic
+func (c *Connection) IsSubscribed(topic string) bool {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	_, ok := c.subscriptions[topic]
+	return ok
+}
+
+// GetTopics get the topics the connection is subscribed to
+func (c *Connection) GetTopics() []string {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	topics := make([]string, 0, len(c.subscriptions))
+	for topic := range c.subscriptions {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// TakeSubscriptions remove and return all the tracked subscriptions. Subsequent calls return an empty map
+func (c *Connection) TakeSubscriptions() map[string][]*nats.Subscription {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	subscriptions := c.subscriptions
+	c.subscriptions = make(map[string][]*nats.Subscription)
+	c.subscribes = make(map[string]int)
+	return subscriptions
+}
@@ -0,0 +1,107 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// KickedReason default close reason of the connections closed by the admin API
+	KickedReason = "Kicked"
+)
+
+// ConnectionInfo connection described by the /connections admin endpoint
+type ConnectionInfo struct {
+	ID            ConnectionID `json:"id"`
+	UserID        UserID       `json:"userId,omitempty"`
+	DeviceID      DeviceID     `json:"deviceId,omitempty"`
+	RemoteAddr    string       `json:"remoteAddr,omitempty"`
+	Subscriptions []string     `json:"subscriptions"`
+	ConnectedAt   time.Time    `json:"connectedAt"`
+	// Throttled messages dropped or coalesced by the outbound rate limits of the connection
+	Throttled ThrottleCounts `json:"throttled"`
+}
+
+// describeConnection get the description of the connection
+func describeConnection(connection *Connection) ConnectionInfo {
+	connectionID, userID, deviceID := connection.GetInfo()
+	info := ConnectionInfo{
+		ID:            connectionID,
+		UserID:        userID,
+		DeviceID:      deviceID,
+		Subscriptions: connection.GetTopics(),
+		ConnectedAt:   connection.GetStartTime(),
+		Throttled:     connection.GetThrottleCounts(),
+	}
+	if connection.request != nil {
+		info.RemoteAddr = connection.request.RemoteAddr
+	}
+	sort.Strings(info.Subscriptions)
+	return info
+}
+
+// selectConnections get the connections the query selects by connectionId, userId or deviceId, all of them if none is
+// given. Returns false if the connectionId is invalid
+func (w *NatsWebSocket) selectConnections(request *http.Request) ([]*Connection, bool) {
+	query := request.URL.Query()
+	var connectionID int64
+	if query.Get("connectionId") != "" {
+		id, err := strconv.ParseInt(query.Get("connectionId"), 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		connectionID = id
+	}
+
+	if connections := w.findConnections(ConnectionID(connectionID), UserID(query.Get("userId")), DeviceID(query.Get("deviceId"))); connections != nil {
+		return connections, true
+	}
+	return w.connections.ListConnections(), true
+}
+
+// handleConnections list the connections on GET, a single one with connectionId, and close the connections selected by
+// connectionId, userId or deviceId on DELETE
+func (w *NatsWebSocket) handleConnections(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodDelete {
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	selected := query.Get("connectionId") != "" || query.Get("userId") != "" || query.Get("deviceId") != ""
+	if request.Method == http.MethodDelete && !selected {
+		http.Error(writer, "connectionId, userId or deviceId required", http.StatusBadRequest)
+		return
+	}
+
+	connections, ok := w.selectConnections(request)
+	if !ok {
+		http.Error(writer, "invalid connectionId", http.StatusBadRequest)
+		return
+	}
+	if selected && len(connections) == 0 {
+		http.Error(writer, "connection not found", http.StatusNotFound)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method == http.MethodDelete {
+		json.NewEncoder(writer).Encode(map[string]int{"closed": w.kick(connections, query.Get("reason"))})
+		return
+	}
+
+	if query.Get("connectionId") != "" {
+		json.NewEncoder(writer).Encode(describeConnection(connections[0]))
+		return
+	}
+
+	infos := make([]ConnectionInfo, 0, len(connections))
+	for _, connection := range connections {
+		infos = append(infos, describeConnection(connection))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	json.NewEncoder(writer).Encode(infos)
+}
@@ -0,0 +1,88 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionsAPI(t *T) {
+	w := New(&Config{URLPattern: "/ws", AdminToken: "secret"}, WithPool(unavailablePool{}))
+	handler := w.Handler()
+
+	connect := func(userID UserID, deviceID DeviceID) *Connection {
+		client, server := net.Pipe()
+		go discard(client)
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if userID != "" {
+			connection.Login(userID, deviceID)
+			w.connections.OnLogin(connection)
+		}
+		return connection
+	}
+	phone := connect("user", "phone")
+	phone.AddSubscription("news", nil)
+	connect("user", "tablet")
+	connect("other", "laptop")
+	connect("", "")
+
+	call := func(method, target string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, nil)
+		request.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	var infos []ConnectionInfo
+	assert.Nil(t, json.Unmarshal(call(http.MethodGet, "/connections").Body.Bytes(), &infos))
+	assert.Len(t, infos, 4)
+	assert.Nil(t, json.Unmarshal(call(http.MethodGet, "/connections?userId=user").Body.Bytes(), &infos))
+	assert.Len(t, infos, 2)
+
+	var info ConnectionInfo
+	assert.Nil(t, json.Unmarshal(call(http.MethodGet, "/connections?connectionId=1").Body.Bytes(), &info))
+	assert.Equal(t, UserID("user"), info.UserID)
+	assert.Equal(t, DeviceID("phone"), info.DeviceID)
+	assert.Equal(t, []string{"news"}, info.Subscriptions)
+	assert.NotEmpty(t, info.RemoteAddr)
+
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/connections?connectionId=42").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/connections?connectionId=x").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodDelete, "/connections").Code)
+
+	// kick by device, then by user
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, "/connections?deviceId=laptop").Code)
+	assert.Nil(t, w.connections.GetDeviceConnection("laptop"))
+	assert.Equal(t, `{"closed":2}`+"\n", call(http.MethodDelete, "/connections?userId=user").Body.String())
+	assert.Len(t, w.connections.ListConnections(), 1)
+}
+
+func TestConnectionsAPIRequiresToken(t *T) {
+	assert.NotNil(t, (&Config{URLPattern: "/", AdminListenInterface: ":8081"}).Validate())
+	assert.Nil(t, (&Config{URLPattern: "/", AdminListenInterface: ":8081", AdminToken: "secret"}).Validate())
+
+	w := New(&Config{URLPattern: "/ws"}, WithPool(unavailablePool{}))
+	client, server := net.Pipe()
+	go discard(client)
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("user", "phone")
+	w.connections.OnLogin(connection)
+
+	// not mounted on the public listener without a token
+	recorder := httptest.NewRecorder()
+	w.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/connections?userId=user", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Len(t, w.connections.ListConnections(), 1)
+
+	// and rejected on the admin listener
+	recorder = httptest.NewRecorder()
+	w.adminRoutes["/connections"].ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/connections?userId=user", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Len(t, w.connections.ListConnections(), 1)
+}
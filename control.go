@@ -0,0 +1,165 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// KickCommand close the connections of a user, a device or a connection id
+	KickCommand = "kick"
+	// BroadcastCommand send the payload to every connection
+	BroadcastCommand = "broadcast"
+	// ReloadCommand reload the config with the config loader, see WithConfigLoader
+	ReloadCommand = "reload"
+	// StatsCommand get the connection stats of the instance
+	StatsCommand = "stats"
+)
+
+// ControlCommand command sent to the gateway over nats on Config.ControlSubject
+type ControlCommand struct {
+	Command      string       `json:"command"`
+	ConnectionID ConnectionID `json:"connectionId,omitempty"`
+	UserID       UserID       `json:"userId,omitempty"`
+	DeviceID     DeviceID     `json:"deviceId,omitempty"`
+	Reason       string       `json:"reason,omitempty"`
+	// Payload message sent to the connections by BroadcastCommand
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ControlResponse reply to a control command, from the instance that handled it
+type ControlResponse struct {
+	InstanceID string             `json:"instanceId"`
+	Command    string             `json:"command"`
+	OK         bool               `json:"ok"`
+	Error      string             `json:"error,omitempty"`
+	Closed     int                `json:"closed,omitempty"`
+	Delivered  int                `json:"delivered,omitempty"`
+	Stats      *ConnectionsReport `json:"stats,omitempty"`
+}
+
+var errUnknownControlCommand = errors.New("unknown command")
+
+// startControlChannel subscribe to Config.ControlSubject, the commands to every instance, and to the subject suffixed by
+// the instance id, the commands to this instance only. The subscriptions last until the gateway stops
+func (w *NatsWebSocket) startControlChannel() {
+	if w.config.ControlSubject == "" {
+		return
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("control: %v", err)
+		return
+	}
+
+	subscriptions := []*nats.Subscription{}
+	for _, subject := range []string{w.config.ControlSubject, w.config.ControlSubject + "." + w.instanceID} {
+		subscription, err := busClient.Subscribe(subject, w.onControlMessage)
+		if err != nil {
+			w.logger.Printf("control: %v", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	go func() {
+		<-w.done
+		for _, subscription := range subscriptions {
+			subscription.Unsubscribe()
+		}
+		w.natsPool.Put(busClient)
+	}()
+}
+
+// onControlMessage handle a control command and reply if it was a request
+func (w *NatsWebSocket) onControlMessage(msg *nats.Msg) {
+	var command ControlCommand
+	response := ControlResponse{InstanceID: w.instanceID}
+	if err := json.Unmarshal(msg.Data, &command); err != nil {
+		response.Error = err.Error()
+	} else {
+		response = w.HandleControl(command)
+	}
+
+	w.metrics.Counter("gateway_control_commands_total", "Commands received on the control subject by command and result",
+		"command", response.Command, "result", map[bool]string{true: "ok", false: "error"}[response.OK]).Inc()
+	if msg.Reply == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(response)
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		return
+	}
+	defer w.natsPool.Put(busClient)
+	busClient.Publish(msg.Reply, payload)
+}
+
+// HandleControl run a control command, as received on Config.ControlSubject
+func (w *NatsWebSocket) HandleControl(command ControlCommand) ControlResponse {
+	response := ControlResponse{InstanceID: w.instanceID, Command: command.Command, OK: true}
+	fail := func(err error) ControlResponse {
+		response.OK = false
+		response.Error = err.Error()
+		return response
+	}
+
+	switch command.Command {
+	case KickCommand:
+		connections := w.findConnections(command.ConnectionID, command.UserID, command.DeviceID)
+		if connections == nil {
+			return fail(errors.New("connectionId, userId or deviceId required"))
+		}
+		response.Closed = w.kick(connections, command.Reason)
+	case BroadcastCommand:
+		response.Delivered = w.Broadcast(command.Payload, nil)
+	case ReloadCommand:
+		if err := w.reloadFromLoader(); err != nil {
+			return fail(err)
+		}
+	case StatsCommand:
+		stats := w.GetConnectionsReport()
+		response.Stats = &stats
+	default:
+		return fail(errUnknownControlCommand)
+	}
+	return response
+}
+
+// findConnections get the connections of the connection id, the user or the device, whichever is set first.
+// Returns nil if none is set
+func (w *NatsWebSocket) findConnections(connectionID ConnectionID, userID UserID, deviceID DeviceID) []*Connection {
+	switch {
+	case connectionID != 0:
+		if connection := w.connections.GetConnectionByID(connectionID); connection != nil {
+			return []*Connection{connection}
+		}
+	case userID != "":
+		return append([]*Connection{}, w.connections.ListUserConnections(userID)...)
+	case deviceID != "":
+		if connection := w.connections.GetDeviceConnection(deviceID); connection != nil {
+			return []*Connection{connection}
+		}
+	default:
+		return nil
+	}
+	return []*Connection{}
+}
+
+// kick close the connections with the reason, KickedReason by default. Returns the number closed
+func (w *NatsWebSocket) kick(connections []*Connection, reason string) int {
+	if reason == "" {
+		reason = KickedReason
+	}
+	for _, connection := range connections {
+		connection.Logf("kicked: %s", reason)
+		w.disconnect(connection, websocket.ClosePolicyViolation, reason)
+	}
+	w.metrics.Counter("gateway_admin_kicks_total", "Connections closed by the admin api or the control channel").Add(float64(len(connections)))
+	return len(connections)
+}
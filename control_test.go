@@ -0,0 +1,57 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleControl(t *T) {
+	w := New(&Config{InstanceID: "gateway-1"}, WithPool(unavailablePool{}))
+
+	received := make(chan []byte, 4)
+	connect := func(userID UserID, deviceID DeviceID) *Connection {
+		client, server := net.Pipe()
+		go func() {
+			transport := NewStreamTransport(client)
+			for {
+				_, message, err := transport.ReadMessage()
+				if err != nil {
+					return
+				}
+				received <- message
+			}
+		}()
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.Login(userID, deviceID)
+		w.connections.OnLogin(connection)
+		return connection
+	}
+	connect("user", "phone")
+	connect("other", "laptop")
+
+	response := w.HandleControl(ControlCommand{Command: BroadcastCommand, Payload: []byte(`{"text":"maintenance"}`)})
+	assert.True(t, response.OK)
+	assert.Equal(t, "gateway-1", response.InstanceID)
+	assert.Equal(t, 2, response.Delivered)
+	assert.Equal(t, `{"text":"maintenance"}`, string(<-received))
+
+	response = w.HandleControl(ControlCommand{Command: StatsCommand})
+	assert.Equal(t, 2, response.Stats.Users)
+
+	response = w.HandleControl(ControlCommand{Command: KickCommand})
+	assert.False(t, response.OK)
+	response = w.HandleControl(ControlCommand{Command: KickCommand, UserID: "user"})
+	assert.True(t, response.OK)
+	assert.Equal(t, 1, response.Closed)
+	assert.Empty(t, w.connections.ListUserConnections("user"))
+
+	response = w.HandleControl(ControlCommand{Command: ReloadCommand})
+	assert.Equal(t, errNoConfigLoader.Error(), response.Error)
+	assert.False(t, w.HandleControl(ControlCommand{Command: "shutdown"}).OK)
+
+	// malformed commands without reply subject are dropped
+	w.onControlMessage(&nats.Msg{Data: []byte("{")})
+}
@@ -0,0 +1,29 @@
+package websocketnats
+
+import (
+	"time"
+)
+
+const (
+	// DefaultDeferredQueueSize default number of messages a connection may have deferred by the delivery deadline
+	DefaultDeferredQueueSize = 256
+)
+
+// fanOut deliver the message to the recipients. Once the deadline elapses, the remaining recipients get the message
+// through their deferred queue so a slow recipient doesn't stall the nats dispatcher. The recipients the message is too
+// large for share a single claim-check. Returns the number of deferred deliveries
+func fanOut(recipients []*Connection, topic string, data []byte, deadline time.Duration) int {
+	claim := &sharedClaim{}
+	start := time.Now()
+	for i, connection := range recipients {
+		if deadline > 0 && time.Since(start) > deadline {
+			for _, deferred := range recipients[i:] {
+				deferred.deliverDeferred(topic, data, claim)
+			}
+			return len(recipients) - i
+		}
+
+		connection.deliver(topic, data, false, claim)
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package websocketnats
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+)
+
+// debugToken get the bearer token required by the debug endpoints, Config.DebugToken or else Config.AdminToken
+func (w *NatsWebSocket) debugToken() string {
+	if w.config.DebugToken != "" {
+		return w.config.DebugToken
+	}
+	return w.config.AdminToken
+}
+
+// debugAuth require the debug token as bearer token. The debug endpoints are never served without one, see Config.Validate
+func (w *NatsWebSocket) debugAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+		expected := w.debugToken()
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// debugRoutes the pprof handlers and the runtime stats, by pattern
+func (w *NatsWebSocket) debugRoutes() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/debug/pprof/":        http.HandlerFunc(pprof.Index),
+		"/debug/pprof/cmdline": http.HandlerFunc(pprof.Cmdline),
+		"/debug/pprof/profile": http.HandlerFunc(pprof.Profile),
+		"/debug/pprof/symbol":  http.HandlerFunc(pprof.Symbol),
+		"/debug/pprof/trace":   http.HandlerFunc(pprof.Trace),
+		"/debug/runtime":       http.HandlerFunc(w.handleRuntime),
+	}
+}
+
+// registerDebugRoutes serve the debug endpoints on the admin routes, unless they have their own listener, see startDebugServer
+func (w *NatsWebSocket) registerDebugRoutes() {
+	if !w.config.Pprof || w.config.DebugListenInterface != "" {
+		return
+	}
+	for pattern, handler := range w.debugRoutes() {
+		w.adminRoutes[pattern] = w.debugAuth(handler)
+	}
+}
+
+// startDebugServer serve the debug endpoints on Config.DebugListenInterface
+func (w *NatsWebSocket) startDebugServer() {
+	mux := http.NewServeMux()
+	for pattern, handler := range w.debugRoutes() {
+		mux.Handle(pattern, w.debugAuth(handler))
+	}
+
+	w.debugServer = &http.Server{Addr: w.config.DebugListenInterface, Handler: mux}
+	w.logger.Println("Start debug-http on: " + w.config.DebugListenInterface)
+
+	server := w.debugServer
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			w.logger.Printf("debug-http: %v", err)
+		}
+	}()
+}
+
+// RuntimeStats runtime state of the gateway served on /debug/runtime, to tell a goroutine leak from dangling subscriptions
+// or stalled writes
+type RuntimeStats struct {
+	Goroutines    int    `json:"goroutines"`
+	HeapAlloc     uint64 `json:"heapAlloc"`
+	HeapInUse     uint64 `json:"heapInUse"`
+	HeapObjects   uint64 `json:"heapObjects"`
+	NumGC         uint32 `json:"numGC"`
+	PauseTotalNs  uint64 `json:"pauseTotalNs"`
+	Connections   int    `json:"connections"`
+	Subscriptions int    `json:"subscriptions"`
+	// Outbound frames being written to the clients
+	Outbound int64 `json:"outbound"`
+}
+
+func (w *NatsWebSocket) handleRuntime(writer http.ResponseWriter, request *http.Request) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	stats := RuntimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    memory.HeapAlloc,
+		HeapInUse:    memory.HeapInuse,
+		HeapObjects:  memory.HeapObjects,
+		NumGC:        memory.NumGC,
+		PauseTotalNs: memory.PauseTotalNs,
+		Connections:  w.connections.GetStats().NumberOfConnections,
+	}
+	stats.Outbound, _, _ = w.outbound.Get()
+	if w.subscriptions != nil {
+		stats.Subscriptions = w.subscriptions.Count()
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(stats)
+}
@@ -0,0 +1,42 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugEndpoints(t *T) {
+	assert.NotNil(t, (&Config{URLPattern: "/", Pprof: true}).Validate())
+	assert.Nil(t, (&Config{URLPattern: "/", Pprof: true, DebugToken: "debug"}).Validate())
+
+	w := New(&Config{URLPattern: "/ws", Pprof: true, DebugToken: "debug"}, WithPool(unavailablePool{}))
+	handler := w.Handler()
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/debug/runtime", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/debug/pprof/", "admin").Code)
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/", "debug").Code)
+
+	response := get("/debug/runtime", "debug")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var stats RuntimeStats
+	assert.Nil(t, json.Unmarshal(response.Body.Bytes(), &stats))
+	assert.True(t, stats.Goroutines > 0)
+
+	// not served unless enabled
+	handler = New(&Config{URLPattern: "/ws"}, WithPool(unavailablePool{})).Handler()
+	assert.Equal(t, http.StatusNotFound, get("/debug/runtime", "debug").Code)
+}
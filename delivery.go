@@ -0,0 +1,131 @@
+package websocketnats
+
+// payload nats message waiting to be delivered
+type payload struct {
+	topic string
+	data  []byte
+	// raw the data is written as is, e.g. a message pushed to the user, see SendToUser
+	raw bool
+}
+
+// Deliver send a message of the topic, unless the topic is being backfilled in which case it is sent once the backfill is over
+func (c *Connection) Deliver(topic string, data []byte) {
+	c.deliver(topic, data, false, nil)
+}
+
+// deliverDeferred deliver the message through the deferred queue of the connection, sent by its own goroutine
+func (c *Connection) deliverDeferred(topic string, data []byte, claim *sharedClaim) {
+	c.deliver(topic, data, true, claim)
+}
+
+// deliver deliver the message, claim sharing the claim-check of an oversized message with its other recipients
+func (c *Connection) deliver(topic string, data []byte, deferred bool, claim *sharedClaim) {
+	if !c.allowsDelivery(topic) {
+		return
+	}
+
+	data, ok := c.decodePayload(data)
+	if !ok {
+		return
+	}
+
+	c.dataMutex.Lock()
+	if pending := c.backfills[topic]; pending != nil {
+		pending.messages = append(pending.messages, data)
+		c.dataMutex.Unlock()
+		return
+	}
+	maxMessageSize := c.maxMessageSize
+	c.dataMutex.Unlock()
+
+	c.checkSoftLimit(MessageSizeLimit, topic, len(data), maxMessageSize)
+	if maxMessageSize > 0 && len(data) > maxMessageSize {
+		c.deliverOversized(topic, data, claim)
+		c.events.PublishDelivery(DeliveryEvent{Connection: c, Topic: topic, Size: len(data), Result: DeliveryOversized})
+		return
+	}
+
+	if c.outboundRate != nil {
+		send, flush := c.outboundRate.admit(topic, data)
+		if flush {
+			go c.flushThrottled()
+		}
+		if !send {
+			c.events.PublishDelivery(DeliveryEvent{Connection: c, Topic: topic, Size: len(data), Result: DeliveryThrottled})
+			return
+		}
+	}
+
+	c.send(topic, data, deferred)
+}
+
+// send send the message, or queue it behind the messages deferred by the delivery deadline
+func (c *Connection) send(topic string, data []byte, deferred bool) {
+	// keep the order behind the messages deferred by the delivery deadline
+	c.dataMutex.Lock()
+	if deferred || c.deferred != nil {
+		c.enqueueDeferred(payload{topic: topic, data: data})
+		c.dataMutex.Unlock()
+		return
+	}
+	c.dataMutex.Unlock()
+
+	c.sendPayload(topic, data)
+	c.events.PublishDelivery(DeliveryEvent{Connection: c, Topic: topic, Size: len(data), Result: DeliverySent})
+}
+
+// enqueueDeferred queue the message for the deferred delivery goroutine of the connection, see fairQueue. Lock must be held
+func (c *Connection) enqueueDeferred(message payload) {
+	if c.deferred == nil {
+		c.deferred = newFairQueue(c.policies.Weight)
+		go c.drainDeferred(c.deferred)
+	}
+
+	c.flow.queued(message.topic)
+	if dropped := c.deferred.push(message, DefaultDeferredQueueSize); dropped != nil {
+		c.flow.delivered(dropped.topic)
+		c.logger.Printf("deferred queue full, message of %s dropped", dropped.topic)
+		c.events.PublishDelivery(DeliveryEvent{Connection: c, Topic: dropped.topic, Size: len(dropped.data), Result: DeliveryDropped})
+	}
+}
+
+// drainDeferred send the deferred messages until the queue is empty
+func (c *Connection) drainDeferred(queue *fairQueue) {
+	for {
+		c.dataMutex.Lock()
+		message, ok := queue.pop()
+		if !ok {
+			c.deferred = nil
+			c.dataMutex.Unlock()
+			return
+		}
+		c.dataMutex.Unlock()
+
+		if message.raw {
+			c.SendText(message.data)
+		} else {
+			c.sendPayload(message.topic, message.data)
+		}
+		c.flow.delivered(message.topic)
+		c.events.PublishDelivery(DeliveryEvent{Connection: c, Topic: message.topic, Size: len(message.data), Result: DeliverySent})
+	}
+}
+
+// sendPayload write a nats payload, in a binary frame if the client takes binary payloads or the payload is compressed.
+// The clients with a codec get the payload in a message envelope
+func (c *Connection) sendPayload(topic string, data []byte) {
+	if c.codec != nil {
+		c.sendEnvelope(Envelope{Command: MessageEnvelope, Topic: topic, Payload: data})
+		return
+	}
+
+	c.dataMutex.RLock()
+	binaryPayloads := c.binaryPayloads
+	c.dataMutex.RUnlock()
+
+	if binaryPayloads || isGzip(data) {
+		c.SendBinary(data)
+		return
+	}
+	c.SendText(data)
+}
@@ -0,0 +1,55 @@
+package websocketnats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// DeviceIdentifier resolve the canonical device id at login from the upgrade request, the token claims and
+// the capabilities the client declared in the capabilities query parameter of the upgrade url
+type DeviceIdentifier func(request *http.Request, userID UserID, claims jwt.MapClaims, capabilities []string) DeviceID
+
+// DefaultDeviceIdentifier hash the user id, the user agent, the platform claim and the installationId query parameter
+// of the upgrade url. Clients should send a stable installation id so each device is told apart
+func DefaultDeviceIdentifier(request *http.Request, userID UserID, claims jwt.MapClaims, capabilities []string) DeviceID {
+	platform, _ := claims["platform"].(string)
+
+	hash := sha256.New()
+	for _, part := range []string{string(userID), request.UserAgent(), platform, request.URL.Query().Get("installationId")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return DeviceID(hex.EncodeToString(hash.Sum(nil)[:16]))
+}
+
+// parseCapabilities get the capabilities declared in the upgrade url, e.g. ?capabilities=binary,gzip
+func parseCapabilities(request *http.Request) []string {
+	declared := request.URL.Query().Get("capabilities")
+	if declared == "" {
+		return nil
+	}
+
+	capabilities := strings.Split(declared, ",")
+	for i := range capabilities {
+		capabilities[i] = strings.TrimSpace(capabilities[i])
+	}
+	return capabilities
+}
+
+// GetCapabilities get the capabilities declared by the client
+func (c *Connection) GetCapabilities() []string {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	return c.capabilities
+}
+
+// HasCapability check if the client declared the capability
+func (c *Connection) HasCapability(capability string) bool {
+	return contains(c.GetCapabilities(), capability)
+}
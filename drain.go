@@ -0,0 +1,128 @@
+package websocketnats
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ShutdownReason reason of the close frames sent to the connections on shutdown
+	ShutdownReason = "server restarting"
+	// DefaultMaxReconnectDelay default upper bound in seconds of the jittered reconnect delay sent on shutdown
+	DefaultMaxReconnectDelay = 10
+)
+
+// IsDraining check if the gateway is draining, i.e. refusing new connections before shutting down
+func (w *NatsWebSocket) IsDraining() bool {
+	return atomic.LoadInt32(&w.draining) == 1
+}
+
+// Drain stop accepting new connections, and send every connection a shutdown notice with the reason, its resume token and
+// an individual, jittered reconnect delay so the clients don't reconnect all at once. Each connection is closed after the grace period
+func (w *NatsWebSocket) Drain(reason string, grace time.Duration) {
+	atomic.StoreInt32(&w.draining, 1)
+
+	maxDelay := w.config.MaxReconnectDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxReconnectDelay
+	}
+
+	connections := w.connections.ListConnections()
+	w.logger.Printf("drain: closing %d connections in %v: %s", len(connections), grace, reason)
+
+	wg := sync.WaitGroup{}
+	for _, connection := range connections {
+		wg.Add(1)
+		go func(connection *Connection, delay time.Duration) {
+			defer wg.Done()
+
+			w.sendSessionEvent(connection, GatewayMessage{
+				Event:       DrainSessionEvent,
+				Reason:      reason,
+				GracePeriod: int64(grace / time.Millisecond),
+			})
+
+			connection.SendNotice(Notice{
+				Type:           ShutdownNotice,
+				Reason:         reason,
+				ReconnectDelay: int64(delay / time.Millisecond),
+				GracePeriod:    int64(grace / time.Millisecond),
+				ResumeToken:    connection.SessionID(),
+			})
+
+			time.Sleep(grace)
+			w.unregisterConnection(connection)
+			connection.Close(websocket.CloseGoingAway, reason)
+		}(connection, time.Duration(rand.Int63n(int64(maxDelay)*int64(time.Second))))
+	}
+
+	wg.Wait()
+}
+
+// Shutdown stop accepting upgrades, close every connection with a ShutdownReason close frame once its in-flight write is
+// over, unsubscribe its topics from nats, then shutdown the http servers and empty the nats pool.
+// Returns the context error if its deadline elapsed before the connections were closed, the servers and pool being shut down anyway
+func (w *NatsWebSocket) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&w.draining, 1)
+	w.stopOnce.Do(func() { close(w.done) })
+
+	connections := w.connections.ListConnections()
+	w.logger.Printf("shutdown: closing %d connections", len(connections))
+
+	closed := make(chan struct{})
+	go func() {
+		wg := sync.WaitGroup{}
+		for _, connection := range connections {
+			wg.Add(1)
+			go func(connection *Connection) {
+				defer wg.Done()
+
+				w.unregisterConnection(connection)
+				connection.Close(websocket.CloseServiceRestart, ShutdownReason)
+				w.onClose(connection)
+			}(connection)
+		}
+		wg.Wait()
+		close(closed)
+	}()
+
+	var err error
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		err = ctx.Err()
+		w.logger.Printf("shutdown: %v before the connections were closed", err)
+	}
+
+	if w.httpServer != nil {
+		if shutdownErr := w.httpServer.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+		w.logger.Println("http: shutdown")
+	}
+
+	if w.debugServer != nil {
+		w.debugServer.Shutdown(ctx)
+	}
+	if w.webTransport != nil {
+		w.webTransport.Close()
+	}
+	if w.adminServer != nil {
+		w.adminServer.Shutdown(ctx)
+		w.logger.Println("admin: shutdown")
+	}
+
+	if w.subscriptionConns != nil {
+		w.subscriptionConns.Close()
+	}
+	if w.natsPool != nil {
+		w.natsPool.Empty()
+		w.logger.Println("nats-pool: empty")
+	}
+	return err
+}
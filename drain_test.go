@@ -0,0 +1,63 @@
+package websocketnats
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *T) {
+	w := New(&Config{}, WithPool(unavailablePool{}))
+	client, server := net.Pipe()
+	defer client.Close()
+	w.registerConnection(NewStreamTransport(server))
+
+	// the stream transport reports the close messages as errors, the frame is read raw
+	frames := make(chan []byte, 1)
+	go func() {
+		frame := make([]byte, 5+len(websocket.FormatCloseMessage(websocket.CloseServiceRestart, ShutdownReason)))
+		io.ReadFull(client, frame)
+		assert.Equal(t, byte(websocket.CloseMessage), frame[0])
+		frames <- frame[5:]
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, w.Shutdown(ctx))
+	assert.True(t, w.IsDraining())
+	assert.Equal(t, websocket.FormatCloseMessage(websocket.CloseServiceRestart, ShutdownReason), <-frames)
+	assert.Equal(t, 0, w.connections.GetStats().NumberOfConnections)
+}
+
+func TestDrain(t *T) {
+	w := New(&Config{}, WithPool(unavailablePool{}))
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := w.registerConnection(NewStreamTransport(server))
+
+	notices := make(chan Notice, 1)
+	go func() {
+		_, frame, err := NewStreamTransport(client).ReadMessage()
+		assert.Nil(t, err)
+
+		var notice Notice
+		json.Unmarshal([]byte(strings.TrimPrefix(string(frame), NoticePrefix)), &notice)
+		notices <- notice
+		discard(client)
+	}()
+
+	w.Drain(ShutdownReason, 0)
+	notice := <-notices
+	assert.Equal(t, ShutdownNotice, notice.Type)
+	assert.Equal(t, ShutdownReason, notice.Reason)
+	assert.Equal(t, connection.SessionID(), notice.ResumeToken)
+	assert.NotEmpty(t, notice.ResumeToken)
+	assert.Equal(t, 0, w.connections.GetStats().NumberOfConnections)
+}
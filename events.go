@@ -0,0 +1,163 @@
+package websocketnats
+
+import (
+	"sync"
+)
+
+const (
+	// ConnectedEvent a connection was upgraded
+	ConnectedEvent = "connected"
+	// LoggedInEvent a connection logged in, as a user or a service
+	LoggedInEvent = "logged_in"
+	// DisconnectedEvent a connection was closed and unregistered
+	DisconnectedEvent = "disconnected"
+
+	// DeliverySent the message was written to the connection
+	DeliverySent = "sent"
+	// DeliveryDropped the message was dropped from the full deferred queue of the connection
+	DeliveryDropped = "dropped"
+	// DeliveryThrottled the message was dropped, or delayed to be coalesced, by the outbound rate limits of the connection
+	DeliveryThrottled = "throttled"
+	// DeliveryOversized the message exceeded the max message size of the connection, an oversized notice was sent instead
+	DeliveryOversized = "oversized"
+)
+
+// ConnectionEvent event of the lifecycle of a connection
+type ConnectionEvent struct {
+	Type         string
+	Connection   *Connection
+	ConnectionID ConnectionID
+	UserID       UserID
+	DeviceID     DeviceID
+}
+
+// DeliveryEvent result of the delivery of a message to a connection
+type DeliveryEvent struct {
+	Connection *Connection
+	Topic      string
+	Size       int
+	Result     string
+}
+
+// PolicyEvent the reloadable settings changed, see Reload. Config is the config now applied
+type PolicyEvent struct {
+	Config *Config
+}
+
+// EventBus in-process bus the modules of the gateway communicate through, e.g. the service events, the session analytics
+// and the metrics, so the cross-cutting features attach to it rather than to the connection handling. The handlers run on
+// the goroutine publishing the event, in their subscription order, and must not block
+type EventBus struct {
+	mutex              sync.RWMutex
+	connectionHandlers []func(event ConnectionEvent)
+	deliveryHandlers   []func(event DeliveryEvent)
+	policyHandlers     []func(event PolicyEvent)
+}
+
+// NewEventBus init the event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		mutex: sync.RWMutex{},
+	}
+}
+
+// OnConnection subscribe the handler to the connection events
+func (b *EventBus) OnConnection(handler func(event ConnectionEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.connectionHandlers = append(b.connectionHandlers, handler)
+}
+
+// OnDelivery subscribe the handler to the delivery results
+func (b *EventBus) OnDelivery(handler func(event DeliveryEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.deliveryHandlers = append(b.deliveryHandlers, handler)
+}
+
+// OnPolicyChange subscribe the handler to the policy changes
+func (b *EventBus) OnPolicyChange(handler func(event PolicyEvent)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.policyHandlers = append(b.policyHandlers, handler)
+}
+
+// PublishConnection hand the connection event to its handlers
+func (b *EventBus) PublishConnection(event ConnectionEvent) {
+	b.mutex.RLock()
+	handlers := b.connectionHandlers
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// PublishDelivery hand the delivery result to its handlers
+func (b *EventBus) PublishDelivery(event DeliveryEvent) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.RLock()
+	handlers := b.deliveryHandlers
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// PublishPolicyChange hand the policy change to its handlers
+func (b *EventBus) PublishPolicyChange(event PolicyEvent) {
+	b.mutex.RLock()
+	handlers := b.policyHandlers
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Events get the event bus of the gateway, to attach handlers to, e.g. an audit log
+func (w *NatsWebSocket) Events() *EventBus {
+	return w.events
+}
+
+// publishConnection publish the connection event of the connection
+func (w *NatsWebSocket) publishConnection(eventType string, connection *Connection) {
+	connectionID, userID, deviceID := connection.GetInfo()
+	w.events.PublishConnection(ConnectionEvent{
+		Type:         eventType,
+		Connection:   connection,
+		ConnectionID: connectionID,
+		UserID:       userID,
+		DeviceID:     deviceID,
+	})
+}
+
+// subscribeModules attach the modules of the gateway to the event bus: the service events, the session analytics and the metrics
+func (w *NatsWebSocket) subscribeModules() {
+	w.events.OnConnection(func(event ConnectionEvent) {
+		switch event.Type {
+		case LoggedInEvent:
+			w.emitEvent(LoginEvent, event.ConnectionID, event.UserID, event.DeviceID)
+		case DisconnectedEvent:
+			w.emitEvent(LogoutEvent, event.ConnectionID, event.UserID, event.DeviceID)
+			w.exportSession(event.Connection)
+		}
+	})
+
+	w.events.OnDelivery(func(event DeliveryEvent) {
+		if event.Result != DeliverySent {
+			w.metrics.Counter("gateway_deliveries_failed_total", "Messages not delivered to a connection by result", "result", event.Result).Inc()
+		}
+	})
+
+	w.events.OnPolicyChange(func(event PolicyEvent) {
+		w.metrics.Counter("gateway_config_reloads_total", "Config reloads").Inc()
+	})
+}
@@ -0,0 +1,52 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *T) {
+	w := New(&Config{})
+
+	reloaded := 0
+	w.Events().OnPolicyChange(func(event PolicyEvent) {
+		reloaded = event.Config.MaxUnknownCommands
+	})
+	w.Reload(&Config{MaxUnknownCommands: 3})
+	assert.Equal(t, 3, reloaded)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go discard(client)
+
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.maxMessageSize = 4
+
+	results := []string{}
+	w.Events().OnDelivery(func(event DeliveryEvent) {
+		results = append(results, event.Topic+":"+event.Result)
+	})
+	connection.Deliver("news", []byte("hi"))
+	connection.Deliver("news", []byte("too large"))
+	assert.Equal(t, []string{"news:" + DeliverySent, "news:" + DeliveryOversized}, results)
+
+	events := []string{}
+	w.Events().OnConnection(func(event ConnectionEvent) {
+		events = append(events, event.Type+":"+string(event.UserID))
+	})
+	connection.Login("user", "device")
+	w.publishConnection(LoggedInEvent, connection)
+	w.unregisterConnection(connection)
+	assert.Equal(t, []string{LoggedInEvent + ":user", DisconnectedEvent + ":user"}, events)
+}
+
+func discard(conn net.Conn) {
+	buffer := make([]byte, 1024)
+	for {
+		if _, err := conn.Read(buffer); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package websocketnats
+
+import (
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ilovelili/dongfeng-websocket-nats/auth"
+	"github.com/ilovelili/dongfeng-websocket-nats/broker"
+	"github.com/ilovelili/dongfeng-websocket-nats/protocol"
+	"github.com/ilovelili/dongfeng-websocket-nats/store"
+)
+
+// The gateway is split into subpackages the users may depend on alone: protocol for the envelopes and their codecs,
+// auth for the token validation, broker for the nats connection pools and store for the stores. The names below keep
+// the programs written against the flat package compiling
+
+const (
+	// ProtobufSubprotocol see protocol.ProtobufSubprotocol
+	ProtobufSubprotocol = protocol.ProtobufSubprotocol
+	// JSONSubprotocol see protocol.JSONSubprotocol
+	JSONSubprotocol = protocol.JSONSubprotocol
+	// JSONProtocolVersion see protocol.JSONProtocolVersion
+	JSONProtocolVersion = protocol.JSONProtocolVersion
+
+	// ReplyEnvelope see protocol.ReplyEnvelope
+	ReplyEnvelope = protocol.ReplyEnvelope
+	// MessageEnvelope see protocol.MessageEnvelope
+	MessageEnvelope = protocol.MessageEnvelope
+	// NoticeEnvelope see protocol.NoticeEnvelope
+	NoticeEnvelope = protocol.NoticeEnvelope
+	// ErrorEnvelope see protocol.ErrorEnvelope
+	ErrorEnvelope = protocol.ErrorEnvelope
+)
+
+// ErrMalformedEnvelope see protocol.ErrMalformedEnvelope
+var ErrMalformedEnvelope = protocol.ErrMalformedEnvelope
+
+// Envelope see protocol.Envelope
+type Envelope = protocol.Envelope
+
+// Codec see protocol.Codec
+type Codec = protocol.Codec
+
+// ProtobufCodec see protocol.ProtobufCodec
+type ProtobufCodec = protocol.ProtobufCodec
+
+// JSONCodec see protocol.JSONCodec
+type JSONCodec = protocol.JSONCodec
+
+// JSONMessage see protocol.JSONMessage
+type JSONMessage = protocol.JSONMessage
+
+// MarshalEnvelope see protocol.MarshalEnvelope
+func MarshalEnvelope(envelope Envelope) []byte {
+	return protocol.MarshalEnvelope(envelope)
+}
+
+// UnmarshalEnvelope see protocol.UnmarshalEnvelope
+func UnmarshalEnvelope(frame []byte) (Envelope, error) {
+	return protocol.UnmarshalEnvelope(frame)
+}
+
+// ParseJWT see auth.ParseJWT
+func ParseJWT(idtoken string, jwks string) (claims jwt.MapClaims, token *jwt.Token, err error) {
+	return auth.ParseJWT(idtoken, jwks)
+}
+
+// ResolveIDToken see auth.ResolveIDToken
+func ResolveIDToken(token string) (idtoken string, valid bool) {
+	return auth.ResolveIDToken(token)
+}
+
+// NatsPool see broker.NatsPool
+type NatsPool = broker.NatsPool
+
+// Pool see broker.Pool
+type Pool = broker.Pool
+
+// DialFunc see broker.DialFunc
+type DialFunc = broker.DialFunc
+
+// InstrumentedPool see broker.InstrumentedPool
+type InstrumentedPool = broker.InstrumentedPool
+
+// PoolStats see broker.PoolStats
+type PoolStats = broker.PoolStats
+
+// NewPool see broker.NewPool
+func NewPool(addr string, size int) (*Pool, error) {
+	return broker.NewPool(addr, size)
+}
+
+// NewPoolCustom see broker.NewPoolCustom
+func NewPoolCustom(addr string, size int, df DialFunc) (*Pool, error) {
+	return broker.NewPoolCustom(addr, size, df)
+}
+
+// NewInstrumentedPool see broker.NewInstrumentedPool
+func NewInstrumentedPool(pool NatsPool) *InstrumentedPool {
+	return broker.NewInstrumentedPool(pool)
+}
+
+// ClaimCheckStore see store.ClaimCheckStore
+type ClaimCheckStore = store.ClaimCheckStore
+
+// ErrClaimTooLarge see store.ErrClaimTooLarge
+var ErrClaimTooLarge = store.ErrClaimTooLarge
+
+// MemoryClaimCheckStore see store.MemoryClaimCheckStore
+type MemoryClaimCheckStore = store.MemoryClaimCheckStore
+
+// NewMemoryClaimCheckStore see store.NewMemoryClaimCheckStore
+func NewMemoryClaimCheckStore(baseURL string, ttl time.Duration, maxBytes int) *MemoryClaimCheckStore {
+	return store.NewMemoryClaimCheckStore(baseURL, ttl, maxBytes)
+}
@@ -0,0 +1,104 @@
+package websocketnats
+
+// fairQueue deferred messages of a connection, queued per topic and sent by weighted round robin so a firehose topic
+// can't starve the other topics of the connection. Each turn of a topic sends up to its weight of messages, see TopicConfig.Weight
+type fairQueue struct {
+	order   []string
+	queues  map[string][]payload
+	credits map[string]int
+	cursor  int
+	size    int
+	weight  func(topic string) int
+}
+
+func newFairQueue(weight func(topic string) int) *fairQueue {
+	return &fairQueue{
+		queues:  make(map[string][]payload),
+		credits: make(map[string]int),
+		weight:  weight,
+	}
+}
+
+// push queue the message. Once the queue holds capacity messages, the oldest message of the largest topic queue is
+// evicted to make room, unless it is the topic of the message in which case the message is dropped. Returns the payload
+// dropped, if any
+func (q *fairQueue) push(message payload, capacity int) (dropped *payload) {
+	if q.size >= capacity {
+		largest := message.topic
+		for _, topic := range q.order {
+			if len(q.queues[topic]) > len(q.queues[largest]) {
+				largest = topic
+			}
+		}
+		if largest == message.topic {
+			return &message
+		}
+
+		evicted := q.queues[largest][0]
+		q.queues[largest] = q.queues[largest][1:]
+		q.size--
+		if len(q.queues[largest]) == 0 {
+			q.remove(largest)
+		}
+		dropped = &evicted
+	}
+
+	if len(q.queues[message.topic]) == 0 {
+		q.order = append(q.order, message.topic)
+	}
+	q.queues[message.topic] = append(q.queues[message.topic], message)
+	q.size++
+	return dropped
+}
+
+// pop get the next message to send. Returns false if the queue is empty
+func (q *fairQueue) pop() (payload, bool) {
+	if q.size == 0 {
+		return payload{}, false
+	}
+	if q.cursor >= len(q.order) {
+		q.cursor = 0
+	}
+
+	topic := q.order[q.cursor]
+	if q.credits[topic] <= 0 {
+		q.credits[topic] = q.topicWeight(topic)
+	}
+
+	message := q.queues[topic][0]
+	q.queues[topic] = q.queues[topic][1:]
+	q.size--
+	q.credits[topic]--
+
+	if len(q.queues[topic]) == 0 {
+		q.remove(topic)
+	} else if q.credits[topic] == 0 {
+		q.cursor++
+	}
+	return message, true
+}
+
+// remove the emptied topic from the round robin
+func (q *fairQueue) remove(topic string) {
+	for i, queued := range q.order {
+		if queued == topic {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			if i < q.cursor {
+				q.cursor--
+			}
+			break
+		}
+	}
+	delete(q.queues, topic)
+	delete(q.credits, topic)
+}
+
+func (q *fairQueue) topicWeight(topic string) int {
+	if q.weight == nil {
+		return 1
+	}
+	if weight := q.weight(topic); weight > 0 {
+		return weight
+	}
+	return 1
+}
@@ -0,0 +1,46 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairQueue(t *T) {
+	queue := newFairQueue(func(topic string) int {
+		if topic == "firehose" {
+			return 2
+		}
+		return 0
+	})
+
+	for i := 0; i < 5; i++ {
+		queue.push(payload{topic: "firehose", data: []byte{byte(i)}}, 10)
+	}
+	queue.push(payload{topic: "alerts", data: []byte{0}}, 10)
+	queue.push(payload{topic: "alerts", data: []byte{1}}, 10)
+
+	sent := []string{}
+	for {
+		message, ok := queue.pop()
+		if !ok {
+			break
+		}
+		sent = append(sent, message.topic)
+	}
+	assert.Equal(t, []string{"firehose", "firehose", "alerts", "firehose", "firehose", "alerts", "firehose"}, sent)
+}
+
+func TestFairQueueFull(t *T) {
+	queue := newFairQueue(nil)
+	queue.push(payload{topic: "firehose", data: []byte{0}}, 2)
+	queue.push(payload{topic: "firehose", data: []byte{1}}, 2)
+
+	dropped := queue.push(payload{topic: "alerts"}, 2)
+	assert.Equal(t, "firehose", dropped.topic)
+	assert.Equal(t, []byte{0}, dropped.data)
+
+	dropped = queue.push(payload{topic: "firehose", data: []byte{2}}, 2)
+	assert.Equal(t, []byte{2}, dropped.data)
+	assert.Equal(t, 2, queue.size)
+}
@@ -0,0 +1,95 @@
+package websocketnats
+
+import (
+	"sync"
+)
+
+const (
+	// SubscribeRejectedNotice a subscription was rejected
+	SubscribeRejectedNotice = "subscribe_rejected"
+	// SubscribeShuntedNotice a subscription was moved to another topic
+	SubscribeShuntedNotice = "subscribe_shunted"
+
+	// FanoutLimitCode the topic reached its maximum number of subscribers on this instance
+	FanoutLimitCode = "fanout_limit"
+)
+
+// TopicFanout fan-out cap of a topic on one gateway instance
+type TopicFanout struct {
+	// MaxSubscribers number of websocket subscribers of the topic
+	MaxSubscribers int `json:"maxSubscribers"`
+	// OverflowTopic subscribers beyond the cap are subscribed to this sampled or summary variant of the topic instead.
+	// They are rejected if empty
+	OverflowTopic string `json:"overflowTopic"`
+}
+
+// FanoutCounter number of websocket subscribers per topic
+type FanoutCounter struct {
+	mutex       sync.Mutex
+	subscribers map[string]int
+}
+
+// NewFanoutCounter init fan-out counter
+func NewFanoutCounter() *FanoutCounter {
+	return &FanoutCounter{
+		mutex:       sync.Mutex{},
+		subscribers: make(map[string]int),
+	}
+}
+
+// Acquire count a new subscriber of the topic unless the limit is reached. A limit less than 1 is unlimited
+func (f *FanoutCounter) Acquire(topic string, limit int) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if limit > 0 && f.subscribers[topic] >= limit {
+		return false
+	}
+
+	f.subscribers[topic]++
+	return true
+}
+
+// Release forget a subscriber of the topic
+func (f *FanoutCounter) Release(topic string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.subscribers[topic] <= 1 {
+		delete(f.subscribers, topic)
+		return
+	}
+	f.subscribers[topic]--
+}
+
+// Get get the number of subscribers of the topic
+func (f *FanoutCounter) Get(topic string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.subscribers[topic]
+}
+
+// acquireFanout count the connection as subscriber of the topic, shunting it to the overflow topic if the topic is full.
+// Returns the topic to subscribe to, or false if the subscription is rejected
+func (w *NatsWebSocket) acquireFanout(connection *Connection, topic string) (string, bool) {
+	if connection.IsSubscribed(topic) {
+		return topic, true
+	}
+
+	fanout := w.config.TopicFanout[topic]
+	if w.fanout.Acquire(topic, fanout.MaxSubscribers) {
+		connection.checkSoftLimit(FanoutLimitCode, topic, w.fanout.Get(topic), fanout.MaxSubscribers)
+		return topic, true
+	}
+
+	if fanout.OverflowTopic != "" && (connection.IsSubscribed(fanout.OverflowTopic) ||
+		w.fanout.Acquire(fanout.OverflowTopic, w.config.TopicFanout[fanout.OverflowTopic].MaxSubscribers)) {
+		connection.SendNotice(Notice{Type: SubscribeShuntedNotice, Code: FanoutLimitCode, Topic: topic, OverflowTopic: fanout.OverflowTopic})
+		return fanout.OverflowTopic, true
+	}
+
+	w.metrics.Counter("gateway_fanout_rejections_total", "Subscriptions rejected by the topic fan-out cap", "topic", topic).Inc()
+	connection.SendNotice(Notice{Type: SubscribeRejectedNotice, Code: FanoutLimitCode, Topic: topic})
+	return "", false
+}
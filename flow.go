@@ -0,0 +1,120 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFlowSubjectPrefix default prefix of the subjects the flow advisories are published to, followed by the topic
+	DefaultFlowSubjectPrefix = "gateway.flow"
+
+	// FlowSlow the delivery queues of the topic are over the high watermark, the producers should slow down
+	FlowSlow = "slow"
+	// FlowResume the pressure cleared, the producers may resume their rate
+	FlowResume = "resume"
+)
+
+// FlowAdvisory flow control advisory published to the producers of a topic
+type FlowAdvisory struct {
+	InstanceID string `json:"instanceId"`
+	Topic      string `json:"topic"`
+	State      string `json:"state"`
+	Pending    int    `json:"pending"`
+	Time       int64  `json:"time"`
+}
+
+// FlowControl messages of each topic waiting in the delivery queues of the connections. A topic over the high
+// watermark gets a slow advisory, and a resume advisory once its pending messages drop to half the watermark
+type FlowControl struct {
+	mutex         sync.Mutex
+	pending       map[string]int
+	slow          map[string]bool
+	highWatermark int
+	publish       func(advisory FlowAdvisory)
+}
+
+// NewFlowControl init the flow control, the advisories being handed to publish. A high watermark less than 1 disables the advisories
+func NewFlowControl(highWatermark int, publish func(advisory FlowAdvisory)) *FlowControl {
+	return &FlowControl{
+		mutex:         sync.Mutex{},
+		pending:       make(map[string]int),
+		slow:          make(map[string]bool),
+		highWatermark: highWatermark,
+		publish:       publish,
+	}
+}
+
+// Pending get the number of messages of the topic waiting in the delivery queues
+func (f *FlowControl) Pending(topic string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.pending[topic]
+}
+
+func (f *FlowControl) queued(topic string) {
+	if f == nil {
+		return
+	}
+	f.update(topic, 1)
+}
+
+func (f *FlowControl) delivered(topic string) {
+	if f == nil {
+		return
+	}
+	f.update(topic, -1)
+}
+
+func (f *FlowControl) update(topic string, delta int) {
+	f.mutex.Lock()
+	pending := f.pending[topic] + delta
+	if pending > 0 {
+		f.pending[topic] = pending
+	} else {
+		delete(f.pending, topic)
+	}
+
+	state := ""
+	if f.highWatermark > 0 && !f.slow[topic] && pending >= f.highWatermark {
+		f.slow[topic] = true
+		state = FlowSlow
+	} else if f.slow[topic] && pending <= f.highWatermark/2 {
+		delete(f.slow, topic)
+		state = FlowResume
+	}
+	f.mutex.Unlock()
+
+	if state != "" && f.publish != nil {
+		f.publish(FlowAdvisory{Topic: topic, State: state, Pending: pending, Time: time.Now().Unix()})
+	}
+}
+
+// publishFlowAdvisory publish the advisory to the flow subject of its topic
+func (w *NatsWebSocket) publishFlowAdvisory(advisory FlowAdvisory) {
+	advisory.InstanceID = w.instanceID
+	payload, err := json.Marshal(advisory)
+	if err != nil {
+		return
+	}
+
+	prefix := w.config.FlowSubjectPrefix
+	if prefix == "" {
+		prefix = DefaultFlowSubjectPrefix
+	}
+
+	if w.natsPool == nil {
+		return
+	}
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("flow advisory: %v", err)
+		return
+	}
+	if err := busClient.Publish(prefix+"."+advisory.Topic, payload); err != nil {
+		w.logger.Printf("flow advisory: %v", err)
+	}
+	w.natsPool.Put(busClient)
+}
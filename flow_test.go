@@ -0,0 +1,38 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowControl(t *T) {
+	var advisories []FlowAdvisory
+	flow := NewFlowControl(4, func(advisory FlowAdvisory) {
+		advisories = append(advisories, advisory)
+	})
+
+	for i := 0; i < 5; i++ {
+		flow.queued("news")
+	}
+	flow.queued("sports")
+	assert.Equal(t, 5, flow.Pending("news"))
+	assert.Len(t, advisories, 1)
+	assert.Equal(t, "news", advisories[0].Topic)
+	assert.Equal(t, FlowSlow, advisories[0].State)
+	assert.Equal(t, 4, advisories[0].Pending)
+
+	flow.delivered("news")
+	flow.delivered("news")
+	assert.Len(t, advisories, 1)
+
+	flow.delivered("news")
+	assert.Len(t, advisories, 2)
+	assert.Equal(t, FlowResume, advisories[1].State)
+	assert.Equal(t, 2, advisories[1].Pending)
+
+	flow.delivered("news")
+	flow.delivered("news")
+	assert.Equal(t, 0, flow.Pending("news"))
+	assert.Len(t, advisories, 2)
+}
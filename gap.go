@@ -0,0 +1,116 @@
+package websocketnats
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// GapPrefix notice of the messages of a topic possibly missed while the gateway was disconnected from nats,
+	// e.g. gap>:<topic>:<from>:<to> with unix timestamps in milliseconds. Clients should refetch the state of the topic
+	GapPrefix = "gap>:"
+	// GapEnvelope envelope command of the gap notices, the payload being <from>:<to>
+	GapEnvelope = "gap"
+)
+
+// natsOutages disconnect time of the pooled nats connections currently down
+type natsOutages struct {
+	mutex sync.Mutex
+	since map[*nats.Conn]time.Time
+}
+
+func newNatsOutages() *natsOutages {
+	return &natsOutages{
+		mutex: sync.Mutex{},
+		since: make(map[*nats.Conn]time.Time),
+	}
+}
+
+func (o *natsOutages) down(conn *nats.Conn) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.since[conn]; !ok {
+		o.since[conn] = time.Now()
+	}
+}
+
+func (o *natsOutages) up(conn *nats.Conn) (time.Time, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	since, ok := o.since[conn]
+	delete(o.since, conn)
+	return since, ok
+}
+
+// NatsOptions options the nats connections of the gateway are dialed with: the authentication of the config, the options
+// of WithNatsOptions and the handlers watching the disconnections to notify the gaps. Pools supplied with WithPool should dial with them too
+func (w *NatsWebSocket) NatsOptions() []nats.Option {
+	options := append(natsAuthOptions(w.config), natsReconnectOptions(w.config)...)
+	options = append(options, w.natsOptions...)
+	return append(options,
+		nats.DisconnectHandler(w.onNatsDisconnect),
+		nats.ReconnectHandler(w.onNatsReconnect),
+		nats.ClosedHandler(w.onNatsClosed),
+	)
+}
+
+// dialNats dial the pooled nats connections with the gateway options
+func (w *NatsWebSocket) dialNats(url string, options ...nats.Option) (*nats.Conn, error) {
+	return nats.Connect(url, append(options, w.NatsOptions()...)...)
+}
+
+// onNatsReconnect notify the subscribers of the subscriptions made on the connection of the gap
+func (w *NatsWebSocket) onNatsReconnect(conn *nats.Conn) {
+	from, ok := w.outages.up(conn)
+	if !ok {
+		return
+	}
+	to := time.Now()
+
+	affected := w.affectedBy(conn)
+	w.logger.Printf("nats: reconnected after %v, notifying %d connections", to.Sub(from), len(affected))
+	w.sendGaps(affected, from, to)
+}
+
+// affectedBy get the subscribers of the subscriptions made on the nats connection, with their topics
+func (w *NatsWebSocket) affectedBy(conn *nats.Conn) map[*Connection][]string {
+	affected := map[*Connection][]string{}
+	if w.subscriptions != nil {
+		affected = w.subscriptions.Affected(conn)
+	}
+	if w.ordered != nil {
+		for connection, topics := range w.ordered.Affected(conn) {
+			affected[connection] = append(affected[connection], topics...)
+		}
+	}
+	if w.merged != nil {
+		for connection, topics := range w.merged.Affected(conn) {
+			affected[connection] = append(affected[connection], topics...)
+		}
+	}
+	return affected
+}
+
+func (w *NatsWebSocket) sendGaps(affected map[*Connection][]string, from, to time.Time) {
+	w.metrics.Counter("gateway_nats_gaps_total", "Reconnections of the nats connections carrying subscriptions").Inc()
+	for connection, topics := range affected {
+		for _, topic := range topics {
+			connection.SendGap(topic, from, to)
+		}
+	}
+}
+
+// SendGap notify the client the messages of the topic published between from and to may be missing
+func (c *Connection) SendGap(topic string, from, to time.Time) {
+	interval := strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10) + ":" + strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10)
+	if c.codec != nil {
+		c.sendEnvelope(Envelope{Command: GapEnvelope, Topic: topic, Payload: []byte(interval)})
+		return
+	}
+	c.SendText([]byte(GapPrefix + topic + ":" + interval))
+}
@@ -0,0 +1,40 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNatsOutages(t *T) {
+	outages := newNatsOutages()
+	conn := &nats.Conn{}
+
+	_, ok := outages.up(conn)
+	assert.False(t, ok)
+
+	outages.down(conn)
+	since, _ := outages.up(conn)
+	outages.down(conn)
+	outages.down(conn)
+	again, ok := outages.up(conn)
+	assert.True(t, ok)
+	assert.False(t, again.Before(since))
+
+	_, ok = outages.up(conn)
+	assert.False(t, ok)
+}
+
+func TestSendGap(t *T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := NewConnection(1, NewStreamTransport(server))
+
+	go connection.SendGap("news", time.Unix(1, 0), time.Unix(2, int64(500*time.Millisecond)))
+	_, message, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "gap>:news:1000:2500", string(message))
+}
@@ -0,0 +1,158 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GatewayTopicPrefix prefix of the synthetic topics served by the gateway itself rather than nats
+	GatewayTopicPrefix = "$gateway."
+	// GatewayStatsTopic periodic snapshots of the gateway stats
+	GatewayStatsTopic = "$gateway.stats"
+	// GatewaySessionTopic events about the session of the subscribed connection
+	GatewaySessionTopic = "$gateway.session"
+
+	// DefaultGatewayStatsInterval default interval in seconds of the $gateway.stats snapshots
+	DefaultGatewayStatsInterval = 10
+
+	// SubscribedSessionEvent the connection subscribed to a topic
+	SubscribedSessionEvent = "subscribed"
+	// DrainSessionEvent the gateway is draining and the connection will be closed after the grace period
+	DrainSessionEvent = "drain"
+)
+
+// GatewayMessage message delivered on the synthetic gateway topics
+type GatewayMessage struct {
+	Topic       string            `json:"topic"`
+	Event       string            `json:"event,omitempty"`
+	EventTopic  string            `json:"eventTopic,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	GracePeriod int64             `json:"gracePeriod,omitempty"`
+	Stats       *ConnectionsStats `json:"stats,omitempty"`
+	Time        int64             `json:"time"`
+}
+
+// GatewayTopics connections subscribed to the synthetic gateway topics
+type GatewayTopics struct {
+	mutex       sync.RWMutex
+	subscribers map[string]map[*Connection]struct{}
+}
+
+// NewGatewayTopics init gateway topics
+func NewGatewayTopics() *GatewayTopics {
+	return &GatewayTopics{
+		mutex:       sync.RWMutex{},
+		subscribers: make(map[string]map[*Connection]struct{}),
+	}
+}
+
+// Add subscribe the connection to the topic
+func (g *GatewayTopics) Add(topic string, connection *Connection) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.subscribers[topic] == nil {
+		g.subscribers[topic] = make(map[*Connection]struct{})
+	}
+	g.subscribers[topic][connection] = struct{}{}
+}
+
+// Remove unsubscribe the connection from all the topics
+func (g *GatewayTopics) Remove(connection *Connection) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for topic, subscribers := range g.subscribers {
+		delete(subscribers, connection)
+		if len(subscribers) == 0 {
+			delete(g.subscribers, topic)
+		}
+	}
+}
+
+// IsSubscribed check if the connection is subscribed to the topic
+func (g *GatewayTopics) IsSubscribed(topic string, connection *Connection) bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	_, ok := g.subscribers[topic][connection]
+	return ok
+}
+
+// List get a copy of the subscribers of the topic
+func (g *GatewayTopics) List(topic string) []*Connection {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	connections := make([]*Connection, 0, len(g.subscribers[topic]))
+	for connection := range g.subscribers[topic] {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+func isGatewayTopic(topic string) bool {
+	return strings.HasPrefix(topic, GatewayTopicPrefix)
+}
+
+// subscribeGatewayTopic subscribe the connection to a synthetic gateway topic
+func (w *NatsWebSocket) subscribeGatewayTopic(connection *Connection, topic string) {
+	if topic != GatewayStatsTopic && topic != GatewaySessionTopic {
+		connection.Logf("subscribe rejected: invalid topic %.64q", topic)
+		connection.Reply([]byte("invalid topic"))
+		return
+	}
+
+	w.gatewayTopics.Add(topic, connection)
+}
+
+// sendSessionEvent send the event to the connection if it is subscribed to $gateway.session
+func (w *NatsWebSocket) sendSessionEvent(connection *Connection, message GatewayMessage) {
+	if !w.gatewayTopics.IsSubscribed(GatewaySessionTopic, connection) {
+		return
+	}
+
+	message.Topic = GatewaySessionTopic
+	message.Time = time.Now().Unix()
+
+	payload, _ := json.Marshal(message)
+	connection.SendText(payload)
+}
+
+// publishGatewayStats send the stats snapshots to the $gateway.stats subscribers until the gateway stops
+func (w *NatsWebSocket) publishGatewayStats() {
+	interval := time.Duration(w.config.GatewayStatsInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultGatewayStatsInterval * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+
+		subscribers := w.gatewayTopics.List(GatewayStatsTopic)
+		if len(subscribers) == 0 {
+			continue
+		}
+
+		stats := w.connections.GetStats()
+		payload, _ := json.Marshal(GatewayMessage{
+			Topic: GatewayStatsTopic,
+			Stats: &stats,
+			Time:  time.Now().Unix(),
+		})
+
+		for _, connection := range subscribers {
+			connection.SendText(payload)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package websocketnats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// GzipCapability capability a client declares to get the gzip compressed nats payloads as they are, in binary frames
+	GzipCapability = "gzip"
+
+	// MaxGunzipSize upper bound of a decompressed payload, protecting against decompression bombs
+	MaxGunzipSize = 16 << 20
+)
+
+var errGunzipTooLarge = errors.New("decompressed payload too large")
+
+// isGzip detect a gzip compressed payload by its magic number. The nats client has no headers to carry a content encoding
+func isGzip(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(reader, MaxGunzipSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > MaxGunzipSize {
+		return nil, errGunzipTooLarge
+	}
+	return decompressed, nil
+}
+
+// decodePayload decompress the gzip payloads for the clients that didn't declare the gzip capability, if Config.GzipPayloads is enabled
+func (c *Connection) decodePayload(data []byte) ([]byte, bool) {
+	c.dataMutex.RLock()
+	gzipPayloads := c.gzipPayloads
+	c.dataMutex.RUnlock()
+
+	if !gzipPayloads || !isGzip(data) || c.HasCapability(GzipCapability) {
+		return data, true
+	}
+
+	decompressed, err := gunzip(data)
+	if err != nil {
+		c.Logf("gzip payload dropped: %v", err)
+		return nil, false
+	}
+	return decompressed, true
+}
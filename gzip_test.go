@@ -0,0 +1,38 @@
+package websocketnats
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodePayload(t *T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("whosyourdaddy"))
+	writer.Close()
+
+	connection := NewConnection(1, nil)
+
+	// disabled, passed through
+	data, ok := connection.decodePayload(compressed.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, compressed.Bytes(), data)
+
+	connection.gzipPayloads = true
+	data, ok = connection.decodePayload(compressed.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, "whosyourdaddy", string(data))
+
+	data, ok = connection.decodePayload([]byte("plain"))
+	assert.True(t, ok)
+	assert.Equal(t, "plain", string(data))
+
+	// the client takes the compressed payload
+	connection.capabilities = []string{GzipCapability}
+	data, ok = connection.decodePayload(compressed.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, compressed.Bytes(), data)
+}
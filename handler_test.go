@@ -0,0 +1,87 @@
+package websocketnats
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailablePool nats pool whose connections are never available
+type unavailablePool struct{}
+
+func (unavailablePool) Get() (*nats.Conn, error) { return nil, errors.New("unavailable") }
+func (unavailablePool) Put(conn *nats.Conn)      {}
+func (unavailablePool) Empty()                   {}
+func (unavailablePool) Avail() int               { return 0 }
+func (unavailablePool) Healthy() int             { return 0 }
+
+func TestHandler(t *T) {
+	gateway := New(&Config{URLPattern: "/ws", HeartbeatInterval: -1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", gateway.Handler())
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/ws")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, err = http.Get(server.URL + "/readyz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	assert.NotNil(t, gateway.subscriptions)
+}
+
+func TestWithListener(t *T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := &http.Server{ReadHeaderTimeout: time.Second}
+	gateway := New(&Config{URLPattern: "/ws", HeartbeatInterval: -1}, WithPool(unavailablePool{}), WithListener(listener), WithHTTPServer(server))
+
+	stopped := make(chan error)
+	go func() { stopped <- gateway.Start() }()
+
+	response, err := http.Get("http://" + listener.Addr().String() + "/readyz")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotNil(t, server.Handler)
+
+	gateway.Stop()
+	assert.Equal(t, http.ErrServerClosed, <-stopped)
+}
+
+func TestHandlerAdminRoutes(t *T) {
+	get := func(handler http.Handler, path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	w := New(&Config{URLPattern: "/ws", HeartbeatInterval: -1}, WithPool(unavailablePool{}))
+	defer w.Stop()
+	handler := w.Handler()
+
+	// only the readiness probe is public without a token
+	assert.Equal(t, http.StatusOK, get(handler, "/readyz"))
+	for _, path := range []string{"/metrics", "/status", "/reload", "/transcripts", "/taps"} {
+		assert.Equal(t, http.StatusNotFound, get(handler, path), path)
+		assert.Equal(t, http.StatusUnauthorized, get(w.adminRoutes[path], path), path)
+	}
+
+	// nor with a token when they have their own listener
+	w = New(&Config{URLPattern: "/ws", HeartbeatInterval: -1, AdminListenInterface: "127.0.0.1:0", AdminToken: "secret"}, WithPool(unavailablePool{}))
+	defer w.Stop()
+	handler = w.Handler()
+	assert.Equal(t, http.StatusOK, get(handler, "/readyz"))
+	assert.Equal(t, http.StatusNotFound, get(handler, "/metrics"))
+}
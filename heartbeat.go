@@ -0,0 +1,116 @@
+package websocketnats
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultHeartbeatSubject default subject the gateway heartbeats are published to
+	DefaultHeartbeatSubject = "gateway.heartbeat"
+	// DefaultHeartbeatInterval default heartbeat interval in seconds
+	DefaultHeartbeatInterval = 10
+)
+
+// Heartbeat periodically published by each gateway instance so a fleet dashboard and the peers can discover it
+type Heartbeat struct {
+	InstanceID string           `json:"instanceId"`
+	Version    string           `json:"version"`
+	Build      BuildInfo        `json:"build"`
+	Address    string           `json:"address"`
+	Healthy    bool             `json:"healthy"`
+	Stats      ConnectionsStats `json:"stats"`
+	Time       int64            `json:"time"`
+}
+
+// InstanceID get the id of the gateway instance
+func (w *NatsWebSocket) InstanceID() string {
+	return w.instanceID
+}
+
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gateway"
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func (w *NatsWebSocket) newHeartbeat() Heartbeat {
+	address := w.config.AdvertiseAddress
+	if address == "" {
+		address = w.config.ListenInterface
+	}
+
+	return Heartbeat{
+		InstanceID: w.instanceID,
+		Version:    Version(),
+		Build:      Build(),
+		Address:    address,
+		Healthy:    true,
+		Stats:      w.connections.GetStats(),
+		Time:       time.Now().Unix(),
+	}
+}
+
+// startBusTasks start the tasks holding a nats connection, once nats is connected
+func (w *NatsWebSocket) startBusTasks() {
+	w.startHeartbeat()
+	w.startControlChannel()
+	w.startUserPush()
+	w.startBroadcast()
+	w.startPresence()
+}
+
+func (w *NatsWebSocket) startHeartbeat() {
+	if w.config.HeartbeatInterval < 0 {
+		return
+	}
+
+	subject := w.config.HeartbeatSubject
+	if subject == "" {
+		subject = DefaultHeartbeatSubject
+	}
+
+	interval := time.Duration(w.config.HeartbeatInterval) * time.Second
+	if interval == 0 {
+		interval = DefaultHeartbeatInterval * time.Second
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("heartbeat: %v", err)
+		return
+	}
+
+	go func() {
+		defer w.natsPool.Put(busClient)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			heartbeat := w.newHeartbeat()
+			heartbeat.Healthy = busClient.IsConnected()
+
+			payload, _ := json.Marshal(heartbeat)
+			if err := busClient.Publish(subject, payload); err != nil {
+				w.logger.Printf("heartbeat: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
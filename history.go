@@ -0,0 +1,244 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HistoryPrefix request the history of a topic, e.g. history>:<topic>?since=<unix timestamp>.
+	// The messages are sent as backfill>:<topic>:<payload>, followed by history>:<topic>:<count> or history>:<topic>:error,
+	// then the live subscription continues without gaps or duplicates
+	HistoryPrefix = "history>:"
+	// BackfillPrefix prefix of the history messages
+	BackfillPrefix = "backfill>:"
+
+	// DefaultHistoryTimeout default timeout in milliseconds of the history service calls
+	DefaultHistoryTimeout = 5000
+	// DefaultMessageIDField default field of the json payloads identifying the messages, used to drop the live messages already backfilled
+	DefaultMessageIDField = "id"
+)
+
+// HistoryRequest request sent to the history service
+type HistoryRequest struct {
+	Topic  string `json:"topic"`
+	Since  int64  `json:"since"`
+	UserID UserID `json:"userId"`
+}
+
+// HistorySource service storing the past messages of the topics, oldest first
+type HistorySource interface {
+	Fetch(request HistoryRequest) ([]json.RawMessage, error)
+}
+
+// HTTPHistorySource history service called with GET <url>?topic=<topic>&since=<since>&userId=<user id>, responding a json array of messages
+type HTTPHistorySource struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPHistorySource init the history source calling the service at url
+func NewHTTPHistorySource(url string, timeout time.Duration) *HTTPHistorySource {
+	return &HTTPHistorySource{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Fetch call the history service
+func (s *HTTPHistorySource) Fetch(request HistoryRequest) (messages []json.RawMessage, err error) {
+	query := url.Values{}
+	query.Set("topic", request.Topic)
+	query.Set("since", strconv.FormatInt(request.Since, 10))
+	query.Set("userId", string(request.UserID))
+
+	separator := "?"
+	if strings.Contains(s.url, "?") {
+		separator = "&"
+	}
+
+	response, err := s.client.Get(s.url + separator + query.Encode())
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("history service responded %s", response.Status)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&messages)
+	return
+}
+
+// NatsHistorySource history service requested over nats with the json HistoryRequest, replying a json array of messages
+type NatsHistorySource struct {
+	pool    NatsPool
+	subject string
+	timeout time.Duration
+}
+
+// NewNatsHistorySource init the history source requesting the subject
+func NewNatsHistorySource(pool NatsPool, subject string, timeout time.Duration) *NatsHistorySource {
+	return &NatsHistorySource{
+		pool:    pool,
+		subject: subject,
+		timeout: timeout,
+	}
+}
+
+// Fetch request the history service
+func (s *NatsHistorySource) Fetch(request HistoryRequest) (messages []json.RawMessage, err error) {
+	busClient, err := s.pool.Get()
+	if err != nil {
+		return
+	}
+	defer s.pool.Put(busClient)
+
+	payload, _ := json.Marshal(request)
+	reply, err := busClient.Request(s.subject, payload, s.timeout)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(reply.Data, &messages)
+	return
+}
+
+// backfill live messages of a topic held back while its history is sent
+type backfill struct {
+	messages [][]byte
+}
+
+// startBackfill hold back the live messages of the topic. Returns false if a backfill of the topic is already running
+func (c *Connection) startBackfill(topic string) bool {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	if c.backfills == nil {
+		c.backfills = make(map[string]*backfill)
+	}
+	if c.backfills[topic] != nil {
+		return false
+	}
+
+	c.backfills[topic] = &backfill{}
+	return true
+}
+
+// endBackfill send the held back live messages of the topic but the duplicates, then resume the live delivery
+func (c *Connection) endBackfill(topic string, duplicate func(data []byte) bool) {
+	for messages := c.takeBackfill(topic); len(messages) > 0; messages = c.takeBackfill(topic) {
+		for _, data := range messages {
+			if !duplicate(data) {
+				c.sendPayload(topic, data)
+			}
+		}
+	}
+}
+
+// takeBackfill take the live messages of the topic held back so far. Once none is left the live delivery resumes
+func (c *Connection) takeBackfill(topic string) [][]byte {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	pending := c.backfills[topic]
+	if len(pending.messages) == 0 {
+		delete(c.backfills, topic)
+		return nil
+	}
+
+	messages := pending.messages
+	pending.messages = nil
+	return messages
+}
+
+// messageKey identify the message by its id field if it is a json object having one, by its content otherwise
+func messageKey(data []byte, field string) string {
+	if id := messageID(data, field); id != "" {
+		return id
+	}
+	return string(data)
+}
+
+// messageID get the id field of a json payload, empty if there is none
+func messageID(data []byte, field string) string {
+	if len(data) == 0 || data[0] != '{' {
+		return ""
+	}
+
+	var payload map[string]interface{}
+	if json.Unmarshal(data, &payload) != nil {
+		return ""
+	}
+
+	if id, ok := payload[field]; ok {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+// history backfill the topic from the history source, then splice the live subscription in
+func (w *NatsWebSocket) history(connection *Connection, request []byte) {
+	topic := string(request)
+	var since int64
+	if index := strings.IndexByte(topic, '?'); index >= 0 {
+		query, _ := url.ParseQuery(topic[index+1:])
+		since, _ = strconv.ParseInt(query.Get("since"), 10, 64)
+		topic = topic[:index]
+	}
+
+	if _, ok := w.topicPolicy(connection, topic); !ok || hasWildcard(topic) || !connection.AllowsTopic(topic) {
+		connection.Logf("history rejected: invalid topic %.64q", topic)
+		connection.Reply([]byte("invalid topic"))
+		return
+	}
+
+	if w.historySource == nil {
+		connection.Reply([]byte(HistoryPrefix + topic + ":unavailable"))
+		return
+	}
+
+	if !connection.startBackfill(topic) {
+		connection.Reply([]byte(HistoryPrefix + topic + ":pending"))
+		return
+	}
+
+	if !connection.IsSubscribed(topic) {
+		w.setupSubsrciber(connection, []byte(topic))
+	}
+
+	_, userID, _ := connection.GetInfo()
+	go func() {
+		messages, err := w.historySource.Fetch(HistoryRequest{Topic: topic, Since: since, UserID: userID})
+
+		field := w.config.MessageIDField
+		if field == "" {
+			field = DefaultMessageIDField
+		}
+
+		backfilled := make(map[string]struct{}, len(messages))
+		for _, message := range messages {
+			backfilled[messageKey(message, field)] = struct{}{}
+			connection.SendText(append([]byte(BackfillPrefix+topic+":"), message...))
+		}
+
+		if err != nil {
+			connection.Logf("history of %s: %v", topic, err)
+			connection.SendText([]byte(HistoryPrefix + topic + ":error"))
+		} else {
+			connection.SendText([]byte(HistoryPrefix + topic + ":" + strconv.Itoa(len(messages))))
+		}
+
+		connection.endBackfill(topic, func(data []byte) bool {
+			_, ok := backfilled[messageKey(data, field)]
+			return ok
+		})
+	}()
+}
@@ -0,0 +1,26 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfill(t *T) {
+	connection := NewConnection(1, nil)
+	assert.True(t, connection.startBackfill("test.a"))
+	assert.False(t, connection.startBackfill("test.a"))
+
+	// live messages are held back during the backfill
+	connection.Deliver("test.a", []byte(`{"id":2}`))
+	connection.Deliver("test.a", []byte(`{"id":3}`))
+
+	messages := connection.takeBackfill("test.a")
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, messageKey([]byte(`{"id":2, "text":"hello"}`), "id"), messageKey(messages[0], "id"))
+	assert.Equal(t, "whosyourdaddy", messageKey([]byte("whosyourdaddy"), "id"))
+
+	// nothing left, the live delivery resumes
+	assert.Nil(t, connection.takeBackfill("test.a"))
+	assert.True(t, connection.startBackfill("test.a"))
+}
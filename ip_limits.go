@@ -0,0 +1,15 @@
+package websocketnats
+
+// admitIP check the client ip is under Config.MaxAnonymousConnectionsPerIP before the upgrade
+func (w *NatsWebSocket) admitIP(ip string) bool {
+	limit := w.liveConfig().MaxAnonymousConnectionsPerIP
+	if limit <= 0 {
+		return true
+	}
+
+	if _, anonymous := w.connections.CountIPConnections(ip); anonymous >= limit {
+		w.metrics.Counter("gateway_ip_limit_rejections_total", "Upgrade requests rejected for too many anonymous connections from the ip").Inc()
+		return false
+	}
+	return true
+}
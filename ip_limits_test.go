@@ -0,0 +1,83 @@
+package websocketnats
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymousConnectionsPerIP(t *T) {
+	gateway := New(&Config{URLPattern: "/", HeartbeatInterval: -1, MaxAnonymousConnectionsPerIP: 1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	assert.True(t, waitFor(func() bool {
+		_, anonymous := gateway.connections.CountIPConnections("127.0.0.1")
+		return anonymous == 1
+	}))
+
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	}
+
+	first.Close()
+	assert.True(t, waitFor(func() bool {
+		connections, _ := gateway.connections.CountIPConnections("127.0.0.1")
+		return connections == 0
+	}))
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	second.Close()
+}
+
+func TestCountIPConnections(t *T) {
+	storage := NewConnectionsStorage()
+	_, server := net.Pipe()
+	connection := NewConnection(1, NewStreamTransport(server))
+	storage.AddNewConnection(connection)
+	storage.SetRemoteIP(connection, "10.0.0.1")
+
+	connections, anonymous := storage.CountIPConnections("10.0.0.1")
+	assert.Equal(t, 1, connections)
+	assert.Equal(t, 1, anonymous)
+
+	connection.Login("user", "phone")
+	storage.OnLogin(connection)
+	connections, anonymous = storage.CountIPConnections("10.0.0.1")
+	assert.Equal(t, 1, connections)
+	assert.Equal(t, 0, anonymous)
+
+	storage.RemoveConnection(connection)
+	connections, anonymous = storage.CountIPConnections("10.0.0.1")
+	assert.Equal(t, 0, connections)
+	assert.Equal(t, 0, anonymous)
+}
+
+func TestClientIP(t *T) {
+	w := New(&Config{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}}, WithPool(unavailablePool{}))
+	request := func(remoteAddr string, header http.Header) *http.Request {
+		return &http.Request{RemoteAddr: remoteAddr, Header: header}
+	}
+
+	// untrusted peers can't forge their ip
+	assert.Equal(t, "203.0.113.7", w.clientIP(request("203.0.113.7:5000", http.Header{"X-Forwarded-For": {"1.2.3.4"}})))
+	// the last address the trusted proxies didn't add
+	assert.Equal(t, "198.51.100.2", w.clientIP(request("10.1.2.3:5000", http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.2", "10.0.0.9"}})))
+	assert.Equal(t, "198.51.100.3", w.clientIP(request("192.168.1.1:5000", http.Header{"X-Real-Ip": {"198.51.100.3"}})))
+	assert.Equal(t, "10.1.2.3", w.clientIP(request("10.1.2.3:5000", http.Header{})))
+
+	assert.NotNil(t, (&Config{URLPattern: "/", TrustedProxies: []string{"lb.internal"}}).Validate())
+}
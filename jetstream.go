@@ -0,0 +1,275 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultJetStreamDeliverPrefix default subject prefix the durable consumers deliver to, followed by the consumer name
+	DefaultJetStreamDeliverPrefix = "_GW.deliver"
+	// DefaultJetStreamTimeout default timeout of the JetStream API requests
+	DefaultJetStreamTimeout = 5 * time.Second
+
+	// DeliverAll deliver every message of the stream, or from where the durable consumer left off
+	DeliverAll = "all"
+	// DeliverLast deliver the last message of the stream, then the new ones
+	DeliverLast = "last"
+	// DeliverNew deliver the messages published after the subscription
+	DeliverNew = "new"
+	// deliverByStartSequence deliver from the start sequence given by the client
+	deliverByStartSequence = "by_start_sequence"
+)
+
+// ConsumerOptions options of the JetStream consumer a subscription is bound to
+type ConsumerOptions struct {
+	// Durable name of the durable consumer, empty for an ephemeral one
+	Durable string
+	// Deliver deliver policy, DeliverAll, DeliverLast or DeliverNew. Ignored if StartSequence is set
+	Deliver string
+	// StartSequence stream sequence to deliver from
+	StartSequence uint64
+	// FilterSubject subject of the stream messages delivered
+	FilterSubject string
+}
+
+type consumerConfig struct {
+	DurableName    string `json:"durable_name,omitempty"`
+	DeliverSubject string `json:"deliver_subject"`
+	DeliverPolicy  string `json:"deliver_policy"`
+	OptStartSeq    uint64 `json:"opt_start_seq,omitempty"`
+	AckPolicy      string `json:"ack_policy"`
+	FilterSubject  string `json:"filter_subject,omitempty"`
+}
+
+type consumerRequest struct {
+	StreamName string         `json:"stream_name"`
+	Config     consumerConfig `json:"config"`
+}
+
+type consumerResponse struct {
+	Name   string         `json:"name"`
+	Config consumerConfig `json:"config"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// JetStreamBridge binds topic subscriptions to JetStream push consumers, through the JetStream API of the core nats protocol.
+// The messages are acknowledged once delivered to the websocket, so a durable consumer resumes after the last delivered message
+type JetStreamBridge struct {
+	mutex         sync.Mutex
+	connections   *SubscriptionConnections
+	deliverPrefix string
+	timeout       time.Duration
+	consumers     map[*Connection]map[string]*StreamSubscription
+}
+
+// StreamSubscription subscription of a connection bound to a JetStream consumer
+type StreamSubscription struct {
+	stream       string
+	consumer     string
+	durable      bool
+	busClient    *nats.Conn
+	subscription *nats.Subscription
+	// deliverSubject and handler bind the consumer again on another connection, see Resubscribe
+	deliverSubject string
+	handler        func(msg *nats.Msg)
+}
+
+// NewJetStreamBridge init the bridge. Durable consumers deliver to deliverPrefix followed by their name
+func NewJetStreamBridge(connections *SubscriptionConnections, deliverPrefix string, timeout time.Duration) *JetStreamBridge {
+	if deliverPrefix == "" {
+		deliverPrefix = DefaultJetStreamDeliverPrefix
+	}
+	if timeout <= 0 {
+		timeout = DefaultJetStreamTimeout
+	}
+
+	return &JetStreamBridge{
+		mutex:         sync.Mutex{},
+		connections:   connections,
+		deliverPrefix: deliverPrefix,
+		timeout:       timeout,
+		consumers:     make(map[*Connection]map[string]*StreamSubscription),
+	}
+}
+
+// durableName name of the durable consumer of a device subscribed to a topic
+func durableName(userID UserID, deviceID DeviceID, topic string) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s", userID, deviceID, topic)
+	return fmt.Sprintf("gw_%x", hash.Sum64())
+}
+
+// Subscribe bind the subscription of the connection to the topic to a consumer of the stream. The handler gets the messages,
+// which are acknowledged once it returns. An existing durable consumer is resumed as is
+func (b *JetStreamBridge) Subscribe(connection *Connection, topic, stream string, options ConsumerOptions, handler func(msg *nats.Msg)) error {
+	busClient, err := b.connections.Get(topic)
+	if err != nil {
+		return err
+	}
+
+	config := consumerConfig{
+		DurableName:    options.Durable,
+		DeliverSubject: nats.NewInbox(),
+		DeliverPolicy:  DeliverAll,
+		AckPolicy:      "explicit",
+		FilterSubject:  options.FilterSubject,
+	}
+	if options.Durable != "" {
+		config.DeliverSubject = b.deliverPrefix + "." + options.Durable
+	}
+	switch {
+	case options.StartSequence > 0:
+		config.DeliverPolicy = deliverByStartSequence
+		config.OptStartSeq = options.StartSequence
+	case options.Deliver != "":
+		config.DeliverPolicy = options.Deliver
+	}
+
+	var response consumerResponse
+	if options.Durable != "" {
+		// resume the durable consumer of a previous connection of the device
+		if err := b.request(busClient, fmt.Sprintf("$JS.API.CONSUMER.INFO.%s.%s", stream, options.Durable), nil, &response); err == nil && response.Error == nil {
+			config = response.Config
+		}
+	}
+
+	subscription, err := bindConsumer(busClient, config.DeliverSubject, handler)
+	if err != nil {
+		return err
+	}
+
+	if response.Name == "" || response.Error != nil {
+		subject := fmt.Sprintf("$JS.API.CONSUMER.CREATE.%s", stream)
+		if options.Durable != "" {
+			subject = fmt.Sprintf("$JS.API.CONSUMER.DURABLE.CREATE.%s.%s", stream, options.Durable)
+		}
+
+		response = consumerResponse{}
+		payload, _ := json.Marshal(consumerRequest{StreamName: stream, Config: config})
+		if err := b.request(busClient, subject, payload, &response); err != nil || response.Error != nil {
+			subscription.Unsubscribe()
+			if err == nil {
+				err = fmt.Errorf("jetstream: %s", response.Error.Description)
+			}
+			return err
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.consumers[connection] == nil {
+		b.consumers[connection] = make(map[string]*StreamSubscription)
+	}
+	b.consumers[connection][topic] = &StreamSubscription{
+		stream:         stream,
+		consumer:       response.Name,
+		durable:        options.Durable != "",
+		busClient:      busClient,
+		subscription:   subscription,
+		deliverSubject: config.DeliverSubject,
+		handler:        handler,
+	}
+	return nil
+}
+
+// bindConsumer subscribe the handler to the deliver subject of a consumer, acknowledging the messages once handled
+func bindConsumer(busClient *nats.Conn, deliverSubject string, handler func(msg *nats.Msg)) (*nats.Subscription, error) {
+	return busClient.Subscribe(deliverSubject, func(msg *nats.Msg) {
+		handler(msg)
+		if msg.Reply != "" {
+			busClient.Publish(msg.Reply, []byte("+ACK"))
+		}
+	})
+}
+
+// Resubscribe bind the consumers delivering on the nats connection, closed or disconnected, on the connection replacing it.
+// Returns the number of stream subscriptions that couldn't be bound
+func (b *JetStreamBridge) Resubscribe(conn *nats.Conn) (failed int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, subscriptions := range b.consumers {
+		for topic, streamSubscription := range subscriptions {
+			if streamSubscription.busClient != conn {
+				continue
+			}
+
+			// not replayed if the connection reconnects
+			streamSubscription.subscription.Unsubscribe()
+
+			busClient, err := b.connections.Get(topic)
+			if err != nil {
+				failed++
+				continue
+			}
+
+			subscription, err := bindConsumer(busClient, streamSubscription.deliverSubject, streamSubscription.handler)
+			if err != nil {
+				failed++
+				continue
+			}
+			streamSubscription.busClient = busClient
+			streamSubscription.subscription = subscription
+		}
+	}
+	return failed
+}
+
+// Release stop the delivery of the stream subscription of the connection to the topic. Ephemeral consumers are deleted,
+// durable ones only if deleteDurable is set, e.g. when the client unsubscribes rather than disconnects
+func (b *JetStreamBridge) Release(connection *Connection, topic string, deleteDurable bool) {
+	b.mutex.Lock()
+	streamSubscription := b.consumers[connection][topic]
+	delete(b.consumers[connection], topic)
+	if len(b.consumers[connection]) == 0 {
+		delete(b.consumers, connection)
+	}
+	b.mutex.Unlock()
+
+	if streamSubscription == nil {
+		return
+	}
+
+	streamSubscription.subscription.Unsubscribe()
+	if !streamSubscription.durable || deleteDurable {
+		var response consumerResponse
+		subject := fmt.Sprintf("$JS.API.CONSUMER.DELETE.%s.%s", streamSubscription.stream, streamSubscription.consumer)
+		b.request(streamSubscription.busClient, subject, nil, &response)
+	}
+}
+
+func (b *JetStreamBridge) request(busClient *nats.Conn, subject string, payload []byte, response *consumerResponse) error {
+	reply, err := busClient.Request(subject, payload, b.timeout)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(reply.Data, response)
+}
+
+// subscribeStream bind the subscription of the connection to the stream of the topic, see TopicConfig.Stream
+func (w *NatsWebSocket) subscribeStream(connection *Connection, topic, subject string, policy TopicConfig, options SubscriptionOptions, filter MessageFilter) error {
+	consumerOptions := ConsumerOptions{
+		Deliver:       options.Deliver,
+		StartSequence: options.StartSequence,
+		FilterSubject: subject,
+	}
+	if policy.Durable {
+		_, userID, deviceID := connection.GetInfo()
+		consumerOptions.Durable = durableName(userID, deviceID, topic)
+	}
+
+	subscribers := map[*Connection]MessageFilter{connection: filter}
+	return w.jetstream.Subscribe(connection, topic, policy.Stream, consumerOptions, func(msg *nats.Msg) {
+		w.dispatch(topic, subject, msg, subscribers)
+	})
+}
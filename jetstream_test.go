@@ -0,0 +1,24 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurableName(t *T) {
+	name := durableName("min", "phone", "orders")
+	assert.Equal(t, name, durableName("min", "phone", "orders"))
+	assert.NotEqual(t, name, durableName("min", "laptop", "orders"))
+	assert.Regexp(t, "^gw_[0-9a-f]+$", name)
+}
+
+func TestStreamSubscriptionOptions(t *T) {
+	topic, options := parseSubscription("orders?deliver=last")
+	assert.Equal(t, "orders", topic)
+	assert.Equal(t, DeliverLast, options.Deliver)
+
+	_, options = parseSubscription("orders?start_seq=42&deliver=bogus")
+	assert.Equal(t, "", options.Deliver)
+	assert.Equal(t, uint64(42), options.StartSequence)
+}
@@ -1,59 +1,177 @@
 package websocketnats
 
 import (
-	"errors"
 	"fmt"
-	"strings"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/ilovelili/dongfeng-websocket-nats/auth"
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
-var (
-	// JWKS jwks jwks https://auth0.com/docs/jwks
-	JWKS string
+const (
+	// DefaultJWKSCacheTTL default time in seconds the JWKS is cached
+	DefaultJWKSCacheTTL = 300
+	// DefaultJWKSTimeout default timeout in milliseconds of the JWKS fetches
+	DefaultJWKSTimeout = 5000
+	// DefaultJWKSRefreshInterval minimum time in seconds between two fetches of the JWKS, e.g. forced by unknown key ids,
+	// the cached key set being served in between. Capped to the cache ttl
+	DefaultJWKSRefreshInterval = 60
 )
 
-// ParseJWT parse json web token and output claims and token
-func ParseJWT(idtoken string, jwks string) (claims jwt.MapClaims, token *jwt.Token, err error) {
-	claims = jwt.MapClaims{}
-	JWKS = jwks
-	token, err = jwt.ParseWithClaims(idtoken, claims, getKey)
-	return
+// JWKSCache caches the key set of the jwks url, instrumented in the gateway metrics: the cache hits and misses,
+// the fetch latency and the fetch errors by status. A failed fetch falls back to the expired key set if any.
+// The concurrent misses share a single fetch, made without holding the cache lock, and the refreshes forced by an unknown
+// key id are throttled to one per refresh interval, so the tokens of random key ids can't flood the identity provider
+type JWKSCache struct {
+	mutex           sync.Mutex
+	client          *http.Client
+	ttl             time.Duration
+	refreshInterval time.Duration
+	metrics         *Metrics
+	url             string
+	keySet          *jwk.Set
+	fetchedAt       time.Time
+	attemptedAt     time.Time
+	pending         map[string]*jwksFetch
+}
+
+// jwksFetch fetch of the key set of a url in flight, awaited by the concurrent misses
+type jwksFetch struct {
+	url    string
+	done   chan struct{}
+	keySet *jwk.Set
+	err    error
 }
 
-func getKey(token *jwt.Token) (interface{}, error) {
-	// validate the alg
-	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+// NewJWKSCache init the cache, the key set being fetched within the timeout and kept for the ttl
+func NewJWKSCache(ttl, timeout time.Duration, metrics *Metrics) *JWKSCache {
+	if ttl <= 0 {
+		ttl = DefaultJWKSCacheTTL * time.Second
+	}
+	if timeout <= 0 {
+		timeout = DefaultJWKSTimeout * time.Millisecond
 	}
 
-	keyID, ok := token.Header["kid"].(string)
-	if !ok {
-		return nil, errors.New("expecting JWT header to have string kid")
+	refreshInterval := DefaultJWKSRefreshInterval * time.Second
+	if ttl < refreshInterval {
+		refreshInterval = ttl
 	}
 
-	keySet, err := jwk.FetchHTTP(JWKS)
-	if err != nil {
-		return nil, err
+	return &JWKSCache{
+		mutex:           sync.Mutex{},
+		client:          &http.Client{Timeout: timeout},
+		ttl:             ttl,
+		refreshInterval: refreshInterval,
+		metrics:         metrics,
+		pending:         make(map[string]*jwksFetch),
 	}
+}
 
-	if key := keySet.LookupKeyID(keyID); len(key) == 1 {
-		return key[0].Materialize()
+// Get get the key set of the url, from the cache unless it expired, the url changed or refresh is set. Within the refresh
+// interval of the previous fetch, the cached key set of the url is served even if expired or refresh is set
+func (c *JWKSCache) Get(url string, refresh bool) (*jwk.Set, error) {
+	c.mutex.Lock()
+	if c.keySet != nil && c.url == url {
+		expired := time.Since(c.fetchedAt) >= c.ttl
+		if (refresh || expired) && time.Since(c.attemptedAt) < c.refreshInterval {
+			c.metrics.Counter("gateway_jwks_refreshes_throttled_total", "JWKS fetches skipped within the refresh interval of the previous one").Inc()
+			refresh, expired = false, false
+		}
+		if !refresh && !expired {
+			c.metrics.Counter("gateway_jwks_cache_hits_total", "Logins whose JWKS was served from the cache").Inc()
+			keySet := c.keySet
+			c.mutex.Unlock()
+			return keySet, nil
+		}
 	}
+	c.metrics.Counter("gateway_jwks_cache_misses_total", "Logins whose JWKS was fetched from the identity provider").Inc()
 
-	return nil, errors.New("unable to find key")
+	pending := c.pending[url]
+	if pending == nil {
+		pending = &jwksFetch{url: url, done: make(chan struct{})}
+		c.pending[url] = pending
+		c.attemptedAt = time.Now()
+		go c.fetchPending(pending)
+	}
+	c.mutex.Unlock()
+
+	<-pending.done
+	return pending.keySet, pending.err
 }
 
-// ResolveIDToken resolve id_token saved in header by removing the "bearer " rpefix
-func ResolveIDToken(token string) (idtoken string, valid bool) {
-	valid = true
-	idtokensegments := strings.Split(token, "Bearer ")
-	if len(idtokensegments) != 2 {
-		valid = false
-		return
+// fetchPending fetch the key set of the pending fetch and cache it. A failure falls back to the cached key set of the url
+func (c *JWKSCache) fetchPending(pending *jwksFetch) {
+	start := time.Now()
+	keySet, status, err := c.fetch(pending.url)
+	c.metrics.Histogram("gateway_jwks_fetch_seconds", "Latency of the JWKS fetches", DefaultLatencyBuckets).Observe(time.Since(start).Seconds())
+
+	c.mutex.Lock()
+	if err != nil {
+		c.metrics.Counter("gateway_jwks_fetch_errors_total", "Failed JWKS fetches by status", "status", status).Inc()
+		if c.keySet != nil && c.url == pending.url {
+			keySet, err = c.keySet, nil
+		}
+	} else {
+		c.url = pending.url
+		c.keySet = keySet
+		c.fetchedAt = time.Now()
 	}
+	delete(c.pending, pending.url)
+	c.mutex.Unlock()
 
-	idtoken = idtokensegments[1]
+	pending.keySet, pending.err = keySet, err
+	close(pending.done)
+}
+
+// fetch get the key set. The status of a failure is its http status, or network or invalid
+func (c *JWKSCache) fetch(url string) (*jwk.Set, string, error) {
+	response, err := c.client.Get(url)
+	if err != nil {
+		return nil, "network", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, strconv.Itoa(response.StatusCode), fmt.Errorf("jwks: %s", response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, "network", err
+	}
+
+	keySet, err := jwk.Parse(body)
+	if err != nil {
+		return nil, "invalid", err
+	}
+	return keySet, "", nil
+}
+
+// parseJWT parse the token with the keys of the cached JWKS of Config.JWKS, the validation latency being observed by result
+func (w *NatsWebSocket) parseJWT(idtoken string) (claims jwt.MapClaims, token *jwt.Token, err error) {
+	start := time.Now()
+	jwks := w.liveConfig().JWKS
+
+	claims = jwt.MapClaims{}
+	token, err = jwt.ParseWithClaims(idtoken, claims, func(token *jwt.Token) (interface{}, error) {
+		return auth.Key(token, func(refresh bool) (*jwk.Set, error) {
+			return w.jwks.Get(jwks, refresh)
+		})
+	})
+
+	result := "valid"
+	if err != nil || !token.Valid {
+		result = "invalid"
+		if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Inner == auth.ErrKeyNotFound {
+			result = "key_not_found"
+			w.metrics.Counter("gateway_jwt_key_not_found_total", "Tokens whose key id isn't in the JWKS, even after refetching it").Inc()
+		}
+	}
+	w.metrics.Histogram("gateway_jwt_validation_seconds", "Latency of the token validations, JWKS fetch included", DefaultLatencyBuckets, "result", result).Observe(time.Since(start).Seconds())
 	return
 }
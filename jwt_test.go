@@ -0,0 +1,103 @@
+package websocketnats
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSCache(t *T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+		fmt.Fprintf(writer, `{"keys":[{"kty":"RSA","kid":"k1","n":"%s","e":"%s"}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	}))
+	defer server.Close()
+
+	w := New(&Config{JWKS: server.URL})
+	w.jwks = NewJWKSCache(time.Hour, time.Second, w.metrics)
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "min"})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		assert.Nil(t, err)
+		return signed
+	}
+
+	_, token, err := w.parseJWT(sign("k1"))
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+
+	status = http.StatusInternalServerError
+	_, token, err = w.parseJWT(sign("k1"))
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+
+	// the refresh forced by the unknown key id is throttled right after a fetch
+	_, _, err = w.parseJWT(sign("unknown"))
+	assert.NotNil(t, err)
+
+	// and refetches once the refresh interval elapsed, falling back to the cached key set on failure
+	w.jwks.attemptedAt = time.Now().Add(-2 * DefaultJWKSRefreshInterval * time.Second)
+	_, _, err = w.parseJWT(sign("unknown"))
+	assert.NotNil(t, err)
+
+	var builder strings.Builder
+	w.metrics.WriteTo(&builder)
+	output := builder.String()
+	assert.Contains(t, output, "gateway_jwks_cache_hits_total 4")
+	assert.Contains(t, output, "gateway_jwks_cache_misses_total 2")
+	assert.Contains(t, output, "gateway_jwks_refreshes_throttled_total 1")
+	assert.Contains(t, output, `gateway_jwks_fetch_errors_total{status="500"} 1`)
+	assert.Contains(t, output, "gateway_jwt_key_not_found_total 2")
+	assert.Contains(t, output, `gateway_jwt_validation_seconds_count{result="valid"} 2`)
+	assert.Contains(t, output, `gateway_jwt_validation_seconds_count{result="key_not_found"} 2`)
+}
+
+func TestJWKSCacheSingleFetch(t *T) {
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		fmt.Fprint(writer, `{"keys":[]}`)
+	}))
+	defer server.Close()
+
+	cache := NewJWKSCache(time.Hour, time.Second, NewMetrics())
+	results := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := cache.Get(server.URL, true)
+			results <- err
+		}()
+	}
+
+	// the cache isn't locked during the fetch
+	assert.True(t, waitFor(func() bool { return atomic.LoadInt32(&fetches) == 1 }))
+	_, err := cache.Get("http://127.0.0.1:1/other", false)
+	assert.NotNil(t, err)
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, <-results)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
@@ -0,0 +1,81 @@
+package websocketnats
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxConnectionLogsPerMinute default number of log lines a single connection may write per minute
+	DefaultMaxConnectionLogsPerMinute = 10
+)
+
+// LogThrottle limits the number of log lines written within a time window.
+// Lines exceeding the limit are dropped and reported as a single summary line once the window rolls over,
+// so a misbehaving client can't flood the log pipeline
+type LogThrottle struct {
+	mutex       sync.Mutex
+	output      *log.Logger
+	prefix      string
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// NewLogThrottle init a log throttle allowing at most limit lines per window. A limit less than 1 disables logging
+func NewLogThrottle(prefix string, limit int, window time.Duration) *LogThrottle {
+	return &LogThrottle{
+		mutex:       sync.Mutex{},
+		output:      log.New(os.Stderr, "", log.LstdFlags),
+		prefix:      prefix,
+		limit:       limit,
+		window:      window,
+		windowStart: time.Now(),
+	}
+}
+
+// Printf write the log line if the limit of the current window is not exceeded
+func (t *LogThrottle) Printf(format string, v ...interface{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.windowStart) >= t.window {
+		if t.suppressed > 0 {
+			t.output.Printf("%s%d log messages suppressed", t.prefix, t.suppressed)
+		}
+
+		t.windowStart = now
+		t.count = 0
+		t.suppressed = 0
+	}
+
+	if t.count >= t.limit {
+		t.suppressed++
+		return
+	}
+
+	t.count++
+	t.output.Print(t.prefix + fmt.Sprintf(format, v...))
+}
+
+// SetOutput write the log lines to the logger
+func (t *LogThrottle) SetOutput(output *log.Logger) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.output = output
+}
+
+// Suppressed get the number of log lines dropped in the current window
+func (t *LogThrottle) Suppressed() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.suppressed
+}
@@ -0,0 +1,22 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogThrottle(t *T) {
+	throttle := NewLogThrottle("test: ", 2, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		throttle.Printf("malformed frame %d", i)
+	}
+	assert.Equal(t, 3, throttle.Suppressed())
+
+	// roll over the window
+	throttle.windowStart = time.Now().Add(-time.Minute)
+	throttle.Printf("malformed frame")
+	assert.Equal(t, 0, throttle.Suppressed())
+}
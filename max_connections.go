@@ -0,0 +1,15 @@
+package websocketnats
+
+// ServerFullReason body of the 503 responding to an upgrade past Config.MaxConnections
+const ServerFullReason = "server full"
+
+// admitConnection check the gateway is under Config.MaxConnections before the upgrade
+func (w *NatsWebSocket) admitConnection() bool {
+	limit := w.liveConfig().MaxConnections
+	if limit <= 0 || w.connections.GetStats().NumberOfConnections < limit {
+		return true
+	}
+
+	w.metrics.Counter("gateway_server_full_rejections_total", "Upgrade requests rejected because the gateway reached its maximum connections").Inc()
+	return false
+}
@@ -0,0 +1,34 @@
+package websocketnats
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConnections(t *T) {
+	gateway := New(&Config{URLPattern: "/", HeartbeatInterval: -1, MaxConnections: 1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	defer first.Close()
+	assert.True(t, waitFor(func() bool { return len(gateway.connections.ListConnections()) == 1 }))
+
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	if assert.NotNil(t, response) {
+		assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		body, _ := ioutil.ReadAll(response.Body)
+		assert.Contains(t, string(body), ServerFullReason)
+	}
+}
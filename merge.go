@@ -0,0 +1,252 @@
+package websocketnats
+
+import (
+	"bytes"
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultMergeMaxKeys default number of keys whose latest message a merged topic keeps, see TopicConfig.DedupKey
+	DefaultMergeMaxKeys = 1000
+)
+
+// MergedStreams serves the topics merging several nats subjects into one stream, see TopicConfig.Merge. Each merged
+// topic holds one nats subscription per subject, shared by all its websocket subscribers, and keeps the latest message
+// of each dedup key: a message equal to the latest of its key is dropped, and the new subscribers get the latest messages first
+type MergedStreams struct {
+	mutex       sync.Mutex
+	connections *SubscriptionConnections
+	dispatch    SubscriptionDispatcher
+	streams     map[string]*mergedStream
+}
+
+type mergedStream struct {
+	topic         string
+	subjects      []string
+	dedupKey      string
+	maxKeys       int
+	busClient     *nats.Conn
+	subscriptions []*nats.Subscription
+	// subscribers copied on write, so the messages are dispatched without holding the lock
+	subscribers map[*Connection]MessageFilter
+	// latest message of each dedup key, keys in the order they were last updated
+	latest map[string][]byte
+	keys   []string
+}
+
+// NewMergedStreams init the merged streams
+func NewMergedStreams(connections *SubscriptionConnections, dispatch SubscriptionDispatcher) *MergedStreams {
+	return &MergedStreams{
+		mutex:       sync.Mutex{},
+		connections: connections,
+		dispatch:    dispatch,
+		streams:     make(map[string]*mergedStream),
+	}
+}
+
+// Subscribe add the connection to the subscribers of the merged topic, subscribing its subjects on the first one
+func (m *MergedStreams) Subscribe(connection *Connection, topic string, policy TopicConfig, filter MessageFilter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stream := m.streams[topic]
+	if stream == nil {
+		busClient, err := m.connections.Get(topic)
+		if err != nil {
+			return err
+		}
+
+		maxKeys := policy.MaxDedupKeys
+		if maxKeys <= 0 {
+			maxKeys = DefaultMergeMaxKeys
+		}
+		stream = &mergedStream{
+			topic:       topic,
+			subjects:    policy.Merge,
+			dedupKey:    policy.DedupKey,
+			maxKeys:     maxKeys,
+			busClient:   busClient,
+			subscribers: make(map[*Connection]MessageFilter),
+			latest:      make(map[string][]byte),
+		}
+		if err := m.subscribe(stream); err != nil {
+			return err
+		}
+		m.streams[topic] = stream
+	}
+
+	subscribers := make(map[*Connection]MessageFilter, len(stream.subscribers)+1)
+	for subscriber, subscriberFilter := range stream.subscribers {
+		subscribers[subscriber] = subscriberFilter
+	}
+	subscribers[connection] = filter
+	stream.subscribers = subscribers
+	return nil
+}
+
+// subscribe make the nats subscriptions of the subjects of the stream on its connection
+func (m *MergedStreams) subscribe(stream *mergedStream) error {
+	subscriptions := make([]*nats.Subscription, 0, len(stream.subjects))
+	for _, subject := range stream.subjects {
+		subscription, err := stream.busClient.Subscribe(subject, func(msg *nats.Msg) {
+			m.onMessage(stream, msg)
+		})
+		if err != nil {
+			for _, subscription := range subscriptions {
+				subscription.Unsubscribe()
+			}
+			return err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	stream.subscriptions = subscriptions
+	return nil
+}
+
+func (m *MergedStreams) onMessage(stream *mergedStream, msg *nats.Msg) {
+	m.mutex.Lock()
+	if !stream.keep(msg.Data) {
+		m.mutex.Unlock()
+		return
+	}
+	subscribers := stream.subscribers
+	m.mutex.Unlock()
+
+	m.dispatch(stream.topic, stream.topic, msg, subscribers)
+}
+
+// keep record the message as the latest of its dedup key. Returns false if it is a duplicate of the latest. Lock must be held
+func (s *mergedStream) keep(data []byte) bool {
+	key := messageID(data, s.dedupKey)
+	if s.dedupKey == "" || key == "" {
+		return true
+	}
+
+	if latest, ok := s.latest[key]; ok {
+		if bytes.Equal(latest, data) {
+			return false
+		}
+		for i, kept := range s.keys {
+			if kept == key {
+				s.keys = append(s.keys[:i], s.keys[i+1:]...)
+				break
+			}
+		}
+	} else if len(s.keys) >= s.maxKeys {
+		delete(s.latest, s.keys[0])
+		s.keys = s.keys[1:]
+	}
+
+	s.latest[key] = data
+	s.keys = append(s.keys, key)
+	return true
+}
+
+// Latest get the latest message of each dedup key of the merged topic, the oldest first
+func (m *MergedStreams) Latest(topic string) [][]byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stream := m.streams[topic]
+	if stream == nil {
+		return nil
+	}
+
+	latest := make([][]byte, 0, len(stream.keys))
+	for _, key := range stream.keys {
+		latest = append(latest, stream.latest[key])
+	}
+	return latest
+}
+
+// Resubscribe move the merged topics subscribed on the nats connection, closed or disconnected, to the connection
+// replacing it. Returns the number of topics that couldn't be moved
+func (m *MergedStreams) Resubscribe(conn *nats.Conn) (failed int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, stream := range m.streams {
+		if stream.busClient != conn {
+			continue
+		}
+
+		// not replayed if the connection reconnects
+		for _, subscription := range stream.subscriptions {
+			subscription.Unsubscribe()
+		}
+
+		busClient, err := m.connections.Get(stream.topic)
+		if err != nil {
+			failed++
+			continue
+		}
+
+		stream.busClient = busClient
+		if err := m.subscribe(stream); err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Affected get the subscribers of the merged topics subscribed on the nats connection, with their topics
+func (m *MergedStreams) Affected(busClient *nats.Conn) map[*Connection][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	affected := make(map[*Connection][]string)
+	for _, stream := range m.streams {
+		if stream.busClient != busClient {
+			continue
+		}
+		for connection := range stream.subscribers {
+			affected[connection] = append(affected[connection], stream.topic)
+		}
+	}
+	return affected
+}
+
+// Unsubscribe remove the connection from the subscribers of the merged topic. The last one leaving releases the nats subscriptions
+func (m *MergedStreams) Unsubscribe(connection *Connection, topic string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stream := m.streams[topic]
+	if stream == nil {
+		return
+	}
+	if _, ok := stream.subscribers[connection]; !ok {
+		return
+	}
+
+	if len(stream.subscribers) == 1 {
+		delete(m.streams, topic)
+		for _, subscription := range stream.subscriptions {
+			subscription.Unsubscribe()
+		}
+		return
+	}
+
+	subscribers := make(map[*Connection]MessageFilter, len(stream.subscribers)-1)
+	for subscriber, filter := range stream.subscribers {
+		if subscriber != connection {
+			subscribers[subscriber] = filter
+		}
+	}
+	stream.subscribers = subscribers
+}
+
+// sendLatest send the latest messages of the merged topic to its new subscriber
+func (w *NatsWebSocket) sendLatest(connection *Connection, topic string, filter MessageFilter) {
+	for _, data := range w.merged.Latest(topic) {
+		if data = w.topics.Apply(topic, data); data == nil {
+			continue
+		}
+		if filter == nil || filter(data) {
+			connection.Deliver(topic, data)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergedStreamDedup(t *T) {
+	dispatched := []string{}
+	merged := NewMergedStreams(NewSubscriptionConnections(unavailablePool{}, 1), func(topic, subject string, msg *nats.Msg, subscribers map[*Connection]MessageFilter) {
+		dispatched = append(dispatched, string(msg.Data))
+	})
+	stream := &mergedStream{topic: "orders", dedupKey: "orderId", maxKeys: 2, latest: make(map[string][]byte)}
+	merged.streams["orders"] = stream
+
+	for _, data := range []string{
+		`{"orderId":1,"status":"created"}`,
+		`{"orderId":1,"status":"created"}`,
+		`{"orderId":2,"status":"created"}`,
+		`{"orderId":1,"status":"cancelled"}`,
+		`{"orderId":3,"status":"created"}`,
+		`not json`,
+	} {
+		merged.onMessage(stream, &nats.Msg{Subject: "orders.any", Data: []byte(data)})
+	}
+
+	assert.Equal(t, []string{
+		`{"orderId":1,"status":"created"}`,
+		`{"orderId":2,"status":"created"}`,
+		`{"orderId":1,"status":"cancelled"}`,
+		`{"orderId":3,"status":"created"}`,
+		`not json`,
+	}, dispatched)
+
+	latest := merged.Latest("orders")
+	assert.Equal(t, 2, len(latest))
+	assert.Equal(t, `{"orderId":1,"status":"cancelled"}`, string(latest[0]))
+	assert.Equal(t, `{"orderId":3,"status":"created"}`, string(latest[1]))
+	assert.Nil(t, merged.Latest("unknown"))
+}
@@ -0,0 +1,298 @@
+package websocketnats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetricKind counter, gauge or histogram
+type MetricKind string
+
+const (
+	// CounterMetric monotonically increasing value
+	CounterMetric MetricKind = "counter"
+	// GaugeMetric value going up and down
+	GaugeMetric MetricKind = "gauge"
+	// HistogramMetric distribution of observed values
+	HistogramMetric MetricKind = "histogram"
+)
+
+// DefaultLatencyBuckets default histogram buckets in seconds for latencies
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Metrics in-process registry of the gateway metrics, exposed in the prometheus text format
+type Metrics struct {
+	mutex    sync.RWMutex
+	families map[string]*metricFamily
+	onScrape []func()
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    MetricKind
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	mutex        sync.Mutex
+	labels       string
+	labelPairs   []string
+	value        float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+// Counter handle of a counter series
+type Counter struct{ series *metricSeries }
+
+// Gauge handle of a gauge series
+type Gauge struct{ series *metricSeries }
+
+// Histogram handle of a histogram series
+type Histogram struct {
+	series  *metricSeries
+	buckets []float64
+}
+
+// NewMetrics init metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mutex:    sync.RWMutex{},
+		families: make(map[string]*metricFamily),
+	}
+}
+
+// Counter get or create the counter series. Labels are given as name, value pairs
+func (m *Metrics) Counter(name, help string, labels ...string) *Counter {
+	_, series := m.getSeries(name, help, CounterMetric, nil, labels)
+	return &Counter{series: series}
+}
+
+// Gauge get or create the gauge series. Labels are given as name, value pairs
+func (m *Metrics) Gauge(name, help string, labels ...string) *Gauge {
+	_, series := m.getSeries(name, help, GaugeMetric, nil, labels)
+	return &Gauge{series: series}
+}
+
+// Histogram get or create the histogram series. Labels are given as name, value pairs
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	family, series := m.getSeries(name, help, HistogramMetric, buckets, labels)
+	return &Histogram{series: series, buckets: family.buckets}
+}
+
+// OnScrape register a hook run before the metrics are written, typically to refresh gauges
+func (m *Metrics) OnScrape(hook func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.onScrape = append(m.onScrape, hook)
+}
+
+func (m *Metrics) getSeries(name, help string, kind MetricKind, buckets []float64, labels []string) (*metricFamily, *metricSeries) {
+	key := formatLabels(labels)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{
+			name:    name,
+			help:    help,
+			kind:    kind,
+			buckets: buckets,
+			series:  make(map[string]*metricSeries),
+		}
+		m.families[name] = family
+	}
+
+	series, ok := family.series[key]
+	if !ok {
+		series = &metricSeries{
+			labels:       key,
+			labelPairs:   labels,
+			bucketCounts: make([]uint64, len(family.buckets)),
+		}
+		family.series[key] = series
+	}
+
+	return family, series
+}
+
+// Inc increment the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increment the counter by delta
+func (c *Counter) Add(delta float64) {
+	c.series.mutex.Lock()
+	defer c.series.mutex.Unlock()
+
+	c.series.value += delta
+}
+
+// Set set the gauge value
+func (g *Gauge) Set(value float64) {
+	g.series.mutex.Lock()
+	defer g.series.mutex.Unlock()
+
+	g.series.value = value
+}
+
+// Add add delta to the gauge value
+func (g *Gauge) Add(delta float64) {
+	g.series.mutex.Lock()
+	defer g.series.mutex.Unlock()
+
+	g.series.value += delta
+}
+
+// Observe record a value in the histogram
+func (h *Histogram) Observe(value float64) {
+	h.series.mutex.Lock()
+	defer h.series.mutex.Unlock()
+
+	h.series.value += value
+	h.series.count++
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.series.bucketCounts[i]++
+		}
+	}
+}
+
+// MetricSample value of a series at the time of the snapshot. Value is the sum of the observed values for histograms
+type MetricSample struct {
+	Name   string
+	Kind   MetricKind
+	Labels []string
+	Value  float64
+	Count  uint64
+}
+
+// Snapshot run the scrape hooks and get the current value of every series, for the push based sinks
+func (m *Metrics) Snapshot() []MetricSample {
+	m.runScrapeHooks()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	samples := []MetricSample{}
+	for name, family := range m.families {
+		for _, series := range family.series {
+			series.mutex.Lock()
+			samples = append(samples, MetricSample{
+				Name:   name,
+				Kind:   family.kind,
+				Labels: series.labelPairs,
+				Value:  series.value,
+				Count:  series.count,
+			})
+			series.mutex.Unlock()
+		}
+	}
+	return samples
+}
+
+func (m *Metrics) runScrapeHooks() {
+	m.mutex.RLock()
+	hooks := m.onScrape
+	m.mutex.RUnlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// WriteTo write the metrics in the prometheus text exposition format
+func (m *Metrics) WriteTo(writer io.Writer) (int64, error) {
+	m.runScrapeHooks()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		family := m.families[name]
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			family.series[key].write(&builder, family)
+		}
+	}
+
+	n, err := io.WriteString(writer, builder.String())
+	return int64(n), err
+}
+
+func (s *metricSeries) write(builder *strings.Builder, family *metricFamily) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if family.kind != HistogramMetric {
+		fmt.Fprintf(builder, "%s%s %s\n", family.name, wrapLabels(s.labels), formatFloat(s.value))
+		return
+	}
+
+	for i, bound := range family.buckets {
+		fmt.Fprintf(builder, "%s_bucket%s %d\n", family.name, wrapLabels(joinLabels(s.labels, fmt.Sprintf("le=%q", formatFloat(bound)))), s.bucketCounts[i])
+	}
+	fmt.Fprintf(builder, "%s_bucket%s %d\n", family.name, wrapLabels(joinLabels(s.labels, `le="+Inf"`)), s.count)
+	fmt.Fprintf(builder, "%s_sum%s %s\n", family.name, wrapLabels(s.labels), formatFloat(s.value))
+	fmt.Fprintf(builder, "%s_count%s %d\n", family.name, wrapLabels(s.labels), s.count)
+}
+
+// ServeHTTP serve the metrics to the prometheus scraper
+func (m *Metrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(writer)
+}
+
+func formatLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(value)
+}
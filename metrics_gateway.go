@@ -0,0 +1,45 @@
+package websocketnats
+
+func (w *NatsWebSocket) registerMetrics() {
+	users := w.metrics.Gauge("gateway_users", "Number of logged in users")
+	devices := w.metrics.Gauge("gateway_devices", "Number of logged in devices")
+	notLogged := w.metrics.Gauge("gateway_not_logged_connections", "Number of connections not logged in yet")
+
+	outboundDepth := w.metrics.Gauge("gateway_outbound_depth", "Number of frames waiting to be written across all the connections")
+	outboundPeak := w.metrics.Gauge("gateway_outbound_peak_depth", "Peak number of frames waiting to be written across all the connections")
+	outboundPauses := w.metrics.Gauge("gateway_outbound_pauses", "Number of times the subscriptions were paused by the outbound high watermark")
+
+	w.metrics.OnScrape(func() {
+		depth, peak, pauses := w.outbound.Get()
+		outboundDepth.Set(float64(depth))
+		outboundPeak.Set(float64(peak))
+		outboundPauses.Set(float64(pauses))
+
+		stats := w.connections.GetStats()
+		users.Set(float64(stats.NumberOfUsers))
+		devices.Set(float64(stats.NumberOfDevices))
+		notLogged.Set(float64(stats.NumberOfNotLoggedConnections))
+
+		if w.subscriptions != nil {
+			w.metrics.Gauge("gateway_subscriptions", "Number of nats subscriptions held for the websocket subscribers").Set(float64(w.subscriptions.Count()))
+		}
+
+		if w.upgradeLimiter != nil {
+			w.metrics.Gauge("gateway_upgrades_in_flight", "Number of upgrade handshakes in flight").Set(float64(w.upgradeLimiter.InFlight()))
+			w.metrics.Gauge("gateway_upgrades_queued", "Number of upgrade requests waiting for a slot").Set(float64(w.upgradeLimiter.Queued()))
+		}
+
+		if pool, ok := w.natsPool.(*InstrumentedPool); ok {
+			poolStats := pool.Stats()
+			w.metrics.Gauge("gateway_pool_checkouts", "Number of nats connections checked out of the pool").Set(float64(poolStats.Checkouts))
+			w.metrics.Gauge("gateway_pool_errors", "Number of failed nats connection checkouts").Set(float64(poolStats.Errors))
+			w.metrics.Gauge("gateway_pool_checkout_latency_seconds", "Average nats connection checkout latency").Set(poolStats.AvgCheckoutLatency.Seconds())
+
+			subscriptions := 0
+			for _, count := range poolStats.Subscriptions {
+				subscriptions += count
+			}
+			w.metrics.Gauge("gateway_pool_subscriptions", "Number of nats subscriptions on the checked out connections").Set(float64(subscriptions))
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package websocketnats
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMetricsPushInterval default interval in seconds the metrics are pushed to the sink
+	DefaultMetricsPushInterval = 10
+
+	// maxStatsDPacket keeps the packets under the usual MTU
+	maxStatsDPacket = 1432
+)
+
+// MetricsSink push based metrics backend, for the instances that can't be scraped
+type MetricsSink interface {
+	Push(samples []MetricSample) error
+}
+
+// StatsDSink push the metrics to a statsd agent over udp. Counters are sent as the increment since the last push,
+// gauges as they are and histograms as their sum and count. Labels are sent as datadog tags if enabled, dropped otherwise
+type StatsDSink struct {
+	connection net.Conn
+	prefix     string
+	tags       bool
+	counters   map[string]float64
+}
+
+// NewStatsDSink init a statsd sink sending to address, e.g. 127.0.0.1:8125. Set tags to send the labels as dogstatsd tags
+func NewStatsDSink(address string, prefix string, tags bool) (*StatsDSink, error) {
+	connection, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsDSink{
+		connection: connection,
+		prefix:     prefix,
+		tags:       tags,
+		counters:   make(map[string]float64),
+	}, nil
+}
+
+// Push send the samples, batched in packets
+func (s *StatsDSink) Push(samples []MetricSample) error {
+	lines := []string{}
+	for _, sample := range samples {
+		switch sample.Kind {
+		case CounterMetric:
+			key := sample.Name + "{" + formatLabels(sample.Labels) + "}"
+			delta := sample.Value - s.counters[key]
+			s.counters[key] = sample.Value
+			if delta > 0 {
+				lines = append(lines, s.format(sample.Name, delta, "c", sample.Labels))
+			}
+		case GaugeMetric:
+			lines = append(lines, s.format(sample.Name, sample.Value, "g", sample.Labels))
+		case HistogramMetric:
+			lines = append(lines, s.format(sample.Name+".sum", sample.Value, "g", sample.Labels))
+			lines = append(lines, s.format(sample.Name+".count", float64(sample.Count), "g", sample.Labels))
+		}
+	}
+
+	packet := ""
+	for _, line := range lines {
+		if len(packet)+len(line)+1 > maxStatsDPacket && packet != "" {
+			if _, err := s.connection.Write([]byte(packet)); err != nil {
+				return err
+			}
+			packet = ""
+		}
+
+		if packet != "" {
+			packet += "\n"
+		}
+		packet += line
+	}
+
+	if packet == "" {
+		return nil
+	}
+
+	_, err := s.connection.Write([]byte(packet))
+	return err
+}
+
+// Close close the udp socket
+func (s *StatsDSink) Close() error {
+	return s.connection.Close()
+}
+
+func (s *StatsDSink) format(name string, value float64, kind string, labels []string) string {
+	line := fmt.Sprintf("%s%s:%s|%s", s.prefix, name, formatFloat(value), kind)
+	if !s.tags || len(labels) < 2 {
+		return line
+	}
+
+	tags := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		tags = append(tags, labels[i]+":"+labels[i+1])
+	}
+	return line + "|#" + strings.Join(tags, ",")
+}
+
+// pushMetrics push the metrics to the sink until the gateway stops
+func (w *NatsWebSocket) pushMetrics() {
+	interval := time.Duration(w.config.MetricsPushInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultMetricsPushInterval * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+
+		if err := w.metricsSink.Push(w.metrics.Snapshot()); err != nil {
+			w.logger.Printf("metrics: %v", err)
+		}
+	}
+}
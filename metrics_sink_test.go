@@ -0,0 +1,39 @@
+package websocketnats
+
+import (
+	"net"
+	"strings"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsDSink(t *T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sink, err := NewStatsDSink(listener.LocalAddr().String(), "gateway.", true)
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	metrics := NewMetrics()
+	metrics.Counter("connects_total", "Connects", "tenant", "acme").Add(3)
+	assert.Nil(t, sink.Push(metrics.Snapshot()))
+
+	buffer := make([]byte, maxStatsDPacket)
+	n, _, err := listener.ReadFrom(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "gateway.connects_total:3|c|#tenant:acme", string(buffer[:n]))
+
+	// counters are sent as the increment since the last push
+	metrics.Counter("connects_total", "Connects", "tenant", "acme").Add(2)
+	metrics.Gauge("users", "Users").Set(7)
+	assert.Nil(t, sink.Push(metrics.Snapshot()))
+
+	n, _, err = listener.ReadFrom(buffer)
+	assert.Nil(t, err)
+	lines := strings.Split(string(buffer[:n]), "\n")
+	assert.Contains(t, lines, "gateway.connects_total:2|c|#tenant:acme")
+	assert.Contains(t, lines, "gateway.users:7|g")
+}
@@ -0,0 +1,25 @@
+package websocketnats
+
+import (
+	"strings"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWriteTo(t *T) {
+	metrics := NewMetrics()
+	metrics.Counter("test_total", "Test counter", "topic", "test.a").Add(2)
+	metrics.Histogram("test_seconds", "Test histogram", []float64{0.1, 1}).Observe(0.5)
+
+	var builder strings.Builder
+	metrics.WriteTo(&builder)
+	output := builder.String()
+
+	assert.Contains(t, output, "# TYPE test_total counter\n")
+	assert.Contains(t, output, `test_total{topic="test.a"} 2`)
+	assert.Contains(t, output, `test_seconds_bucket{le="0.1"} 0`)
+	assert.Contains(t, output, `test_seconds_bucket{le="1"} 1`)
+	assert.Contains(t, output, `test_seconds_bucket{le="+Inf"} 1`)
+	assert.Contains(t, output, "test_seconds_count 1")
+}
@@ -0,0 +1,92 @@
+package websocketnats
+
+import (
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// NamespaceResolver resolve at login the topic patterns the connection may subscribe to from the token claims.
+// Patterns use the nats wildcards, e.g. dash.* or dash.>. A nil result leaves the connection unrestricted
+type NamespaceResolver func(claims jwt.MapClaims) []string
+
+// audienceNamespaces default namespace resolver mapping the aud and azp claims through Config.AudienceNamespaces.
+// Once a mapping is configured, a token of an unmapped audience may not subscribe to anything
+func (w *NatsWebSocket) audienceNamespaces(claims jwt.MapClaims) []string {
+	if len(w.config.AudienceNamespaces) == 0 {
+		return nil
+	}
+
+	audiences := []string{}
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = append(audiences, aud)
+	case []interface{}:
+		for _, value := range aud {
+			if audience, ok := value.(string); ok {
+				audiences = append(audiences, audience)
+			}
+		}
+	}
+	if azp, ok := claims["azp"].(string); ok {
+		audiences = append(audiences, azp)
+	}
+
+	namespaces := []string{}
+	for _, audience := range audiences {
+		namespaces = append(namespaces, w.config.AudienceNamespaces[audience]...)
+	}
+	return namespaces
+}
+
+// matchSubject check if the subject matches the nats pattern, where * matches one token and > the remaining ones.
+// A subject with wildcards matches if every subject it covers does, e.g. orders.* and orders.eu.> are within orders.>
+func matchSubject(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || subjectTokens[i] == ">" || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// hasWildcard check if the subject has a * or > token
+func hasWildcard(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsTopic check if the topic is within the namespaces of the connection
+func (c *Connection) AllowsTopic(topic string) bool {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	if c.namespaces == nil {
+		return true
+	}
+
+	for _, pattern := range c.namespaces {
+		if matchSubject(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Connection) setNamespaces(namespaces []string) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.namespaces = namespaces
+}
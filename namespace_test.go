@@ -0,0 +1,46 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchSubject(t *T) {
+	assert.True(t, matchSubject("dash.*", "dash.orders"))
+	assert.False(t, matchSubject("dash.*", "dash.orders.created"))
+	assert.True(t, matchSubject("dash.>", "dash.orders.created"))
+	assert.False(t, matchSubject("dash.>", "dash"))
+	assert.False(t, matchSubject("dash.*", "mobile.orders"))
+	assert.True(t, matchSubject("dash.orders", "dash.orders"))
+}
+
+func TestMatchWildcardSubject(t *T) {
+	assert.True(t, matchSubject("dash.>", "dash.*"))
+	assert.True(t, matchSubject("dash.>", "dash.orders.>"))
+	assert.True(t, matchSubject("dash.*", "dash.*"))
+	assert.False(t, matchSubject("dash.*", "dash.>"))
+	assert.False(t, matchSubject("dash.orders", "dash.*"))
+	assert.False(t, matchSubject("dash.>", ">"))
+
+	assert.True(t, hasWildcard("orders.*"))
+	assert.True(t, hasWildcard("events.>"))
+	assert.False(t, hasWildcard("orders.eu"))
+
+	assert.Equal(t, "orders.eu", deliveredTopic("orders.*", "canary.orders.*", &nats.Msg{Subject: "canary.orders.eu"}))
+	assert.Equal(t, "orders.eu", deliveredTopic("orders.eu", "orders.eu", &nats.Msg{Subject: "orders.eu"}))
+}
+
+func TestAudienceNamespaces(t *T) {
+	w := New(&Config{AudienceNamespaces: map[string][]string{"dashboard": {"dash.>"}}})
+
+	connection := NewConnection(1, nil)
+	connection.setNamespaces(w.audienceNamespaces(jwt.MapClaims{"aud": []interface{}{"dashboard"}}))
+	assert.True(t, connection.AllowsTopic("dash.orders"))
+	assert.False(t, connection.AllowsTopic("mobile.orders"))
+
+	connection.setNamespaces(w.audienceNamespaces(jwt.MapClaims{"aud": "unknown"}))
+	assert.False(t, connection.AllowsTopic("dash.orders"))
+}
@@ -0,0 +1,34 @@
+package websocketnats
+
+import (
+	nats "github.com/nats-io/nats.go"
+)
+
+// natsAuthOptions the authentication options of the nats connections from the config. An unreadable NKey seed file
+// fails the connections with its error
+func natsAuthOptions(config *Config) []nats.Option {
+	options := []nats.Option{}
+	if config.NatsUser != "" {
+		options = append(options, nats.UserInfo(config.NatsUser, config.NatsPassword))
+	}
+	if config.NatsToken != "" {
+		options = append(options, nats.Token(config.NatsToken))
+	}
+	if config.NatsTLSCAFile != "" {
+		options = append(options, nats.RootCAs(config.NatsTLSCAFile))
+	}
+	if config.NatsTLSCertFile != "" {
+		options = append(options, nats.ClientCert(config.NatsTLSCertFile, config.NatsTLSKeyFile))
+	}
+	if config.NatsCredentialsFile != "" {
+		options = append(options, nats.UserCredentials(config.NatsCredentialsFile))
+	}
+	if config.NatsNkeySeedFile != "" {
+		nkey, err := nats.NkeyOptionFromSeed(config.NatsNkeySeedFile)
+		if err != nil {
+			nkey = func(*nats.Options) error { return err }
+		}
+		options = append(options, nkey)
+	}
+	return options
+}
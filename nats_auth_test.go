@@ -0,0 +1,59 @@
+package websocketnats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNatsAuthOptions(t *T) {
+	assert.Empty(t, natsAuthOptions(&Config{}))
+
+	options := nats.GetDefaultOptions()
+	for _, option := range natsAuthOptions(&Config{NatsUser: "gateway", NatsPassword: "secret", NatsToken: "token"}) {
+		option(&options)
+	}
+	assert.Equal(t, "gateway", options.User)
+	assert.Equal(t, "secret", options.Password)
+	assert.Equal(t, "token", options.Token)
+}
+
+func TestNatsNkeyOptions(t *T) {
+	dir, err := ioutil.TempDir("", "nats-auth")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	user, err := nkeys.CreateUser()
+	assert.Nil(t, err)
+	seed, _ := user.Seed()
+	publicKey, _ := user.PublicKey()
+	seedFile := filepath.Join(dir, "user.nk")
+	assert.Nil(t, ioutil.WriteFile(seedFile, seed, 0600))
+
+	options := nats.GetDefaultOptions()
+	for _, option := range natsAuthOptions(&Config{NatsNkeySeedFile: seedFile}) {
+		assert.Nil(t, option(&options))
+	}
+	assert.Equal(t, string(publicKey), options.Nkey)
+	assert.NotNil(t, options.SignatureCB)
+
+	options = nats.GetDefaultOptions()
+	for _, option := range natsAuthOptions(&Config{NatsCredentialsFile: filepath.Join(dir, "user.creds")}) {
+		assert.Nil(t, option(&options))
+	}
+	assert.NotNil(t, options.UserJWT)
+	assert.NotNil(t, options.SignatureCB)
+
+	// an unreadable seed file fails the connections
+	options = nats.GetDefaultOptions()
+	failed := false
+	for _, option := range natsAuthOptions(&Config{NatsNkeySeedFile: filepath.Join(dir, "missing.nk")}) {
+		failed = failed || option(&options) != nil
+	}
+	assert.True(t, failed)
+}
@@ -0,0 +1,70 @@
+package websocketnats
+
+import (
+	"encoding/json"
+)
+
+const (
+	// NoticePrefix structured notice sent by the gateway, e.g. notice>:{"type":"shutdown",...}
+	NoticePrefix = "notice>:"
+)
+
+const (
+	// ShutdownNotice the gateway is shutting down or draining
+	ShutdownNotice = "shutdown"
+)
+
+// Notice structured notice sent to the client
+type Notice struct {
+	Type   string `json:"type"`
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+	// OverflowTopic topic a subscription was shunted to
+	OverflowTopic string `json:"overflowTopic,omitempty"`
+	// ReconnectDelay time in milliseconds the client should wait before reconnecting
+	ReconnectDelay int64 `json:"reconnectDelay,omitempty"`
+	// GracePeriod time in milliseconds before the gateway closes the connection
+	GracePeriod int64 `json:"gracePeriod,omitempty"`
+	// ResumeToken session id of the connection, for the client to resume its session once reconnected
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// ExpiresAt unix time in milliseconds the token of the connection expires at
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// MessageID id of the message the notice is about
+	MessageID string `json:"messageId,omitempty"`
+	// Size size in bytes of the message the notice is about
+	Size int `json:"size,omitempty"`
+	// URL url the client can fetch the message from
+	URL string `json:"url,omitempty"`
+	// Interval heartbeat interval in milliseconds
+	Interval int64 `json:"interval,omitempty"`
+	// Tolerance number of heartbeat intervals the client may miss
+	Tolerance int `json:"tolerance,omitempty"`
+	// Limit hard limit the notice is about
+	Limit int `json:"limit,omitempty"`
+	// Usage usage of the limit when the notice was sent
+	Usage int `json:"usage,omitempty"`
+	// Region region the notice is about
+	Region string `json:"region,omitempty"`
+}
+
+// SendNotice send a structured notice to the client
+func (c *Connection) SendNotice(notice Notice) {
+	payload, _ := json.Marshal(notice)
+	if c.codec != nil {
+		c.sendEnvelope(Envelope{Command: NoticeEnvelope, Payload: payload})
+		return
+	}
+	c.SendText(append([]byte(NoticePrefix), payload...))
+}
+
+// ReplyNotice send a structured notice as a command response, so it keeps its place among the responses of a batch
+func (c *Connection) ReplyNotice(notice Notice) {
+	if c.codec != nil {
+		c.SendNotice(notice)
+		return
+	}
+
+	payload, _ := json.Marshal(notice)
+	c.Reply(append([]byte(NoticePrefix), payload...))
+}
@@ -0,0 +1,170 @@
+package websocketnats
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+)
+
+// Option customizes the NatsWebSocket created by New
+type Option func(*NatsWebSocket)
+
+// WithPool use the given nats pool instead of dialing one from Config.NatsServers or Config.NatsAddress on Start.
+// Wrap the pool with NewInstrumentedPool to observe checkout latency, error rates and subscriptions
+func WithPool(pool NatsPool) Option {
+	return func(w *NatsWebSocket) {
+		w.natsPool = pool
+	}
+}
+
+// WithNatsOptions dial the nats connections with additional options, e.g. nats.Nkey or nats.UserCredentials
+func WithNatsOptions(options ...nats.Option) Option {
+	return func(w *NatsWebSocket) {
+		w.natsOptions = append(w.natsOptions, options...)
+	}
+}
+
+// WithTLSConfig serve the listener over tls with the config, e.g. with a GetCertificate reloading the certificates.
+// Config.TLSCertFile and Config.TLSKeyFile are loaded on top of it if set
+func WithTLSConfig(config *tls.Config) Option {
+	return func(w *NatsWebSocket) {
+		w.tlsConfig = config
+	}
+}
+
+// WithHTTPServer serve the gateway with the server, e.g. to set its timeouts or its HTTP/2 settings.
+// Its address, handler and tls config default to Config.ListenInterface, Handler and WithTLSConfig
+func WithHTTPServer(server *http.Server) Option {
+	return func(w *NatsWebSocket) {
+		w.httpServer = server
+	}
+}
+
+// WithListener serve the gateway on the listener instead of listening on Config.ListenInterface,
+// e.g. a socket passed by systemd or an ephemeral port in tests
+func WithListener(listener net.Listener) Option {
+	return func(w *NatsWebSocket) {
+		w.listener = listener
+	}
+}
+
+// WithConfigLoader reload the config from the loader on SIGHUP and on the /reload admin endpoint, see Reload
+func WithConfigLoader(loader ConfigLoader) Option {
+	return func(w *NatsWebSocket) {
+		w.configLoader = loader
+	}
+}
+
+// WithTopicCallback register a delivery callback of the topic, see NatsWebSocket.OnTopic
+func WithTopicCallback(topic string, mode DeliveryMode, callback DeliveryCallback) Option {
+	return func(w *NatsWebSocket) {
+		w.callbacks.Register(topic, mode, callback)
+	}
+}
+
+// WithAdmissionController consult the controller before upgrading each connection
+func WithAdmissionController(controller AdmissionController) Option {
+	return func(w *NatsWebSocket) {
+		w.admission = controller
+	}
+}
+
+// WithDeviceIdentifier resolve the device ids with the identifier instead of DefaultDeviceIdentifier
+func WithDeviceIdentifier(identifier DeviceIdentifier) Option {
+	return func(w *NatsWebSocket) {
+		w.deviceIdentifier = identifier
+	}
+}
+
+// WithLogger write the gateway and connection logs to the logger instead of stderr
+func WithLogger(logger *log.Logger) Option {
+	return func(w *NatsWebSocket) {
+		w.logger = logger
+	}
+}
+
+// WithUpgrader upgrade the websocket connections with the upgrader, e.g. to check their origin or to size their buffers.
+// The upgrader negotiates the protobuf and json subprotocols unless it sets its own
+func WithUpgrader(upgrader websocket.Upgrader) Option {
+	return func(w *NatsWebSocket) {
+		if len(upgrader.Subprotocols) == 0 {
+			upgrader.Subprotocols = w.upgrader.Subprotocols
+		}
+		w.upgrader = upgrader
+	}
+}
+
+// WithReadLimit set the size in bytes of the largest message read from a client before its login, unless
+// Config.MaxReadSizeBeforeLogin is set. Defaults to DefaultReadLimit
+func WithReadLimit(limit int64) Option {
+	return func(w *NatsWebSocket) {
+		w.readLimit = limit
+	}
+}
+
+// WithNamespaceResolver restrict the topics of the connections with the resolver instead of Config.AudienceNamespaces
+func WithNamespaceResolver(resolver NamespaceResolver) Option {
+	return func(w *NatsWebSocket) {
+		w.namespaceResolver = resolver
+	}
+}
+
+// WithHistorySource serve the history>: command from the source instead of Config.HistoryURL or Config.HistorySubject
+func WithHistorySource(source HistorySource) Option {
+	return func(w *NatsWebSocket) {
+		w.historySource = source
+	}
+}
+
+// WithClaimCheckStore keep the oversized messages in the store instead of the memory one of Config.ClaimCheckURL
+func WithClaimCheckStore(store ClaimCheckStore) Option {
+	return func(w *NatsWebSocket) {
+		w.claimCheck = store
+	}
+}
+
+// WithTransform register the transform referenced by name in the TopicConfig.Transform of the topics
+func WithTransform(name string, transform Transform) Option {
+	return func(w *NatsWebSocket) {
+		w.topics.RegisterTransform(name, transform)
+	}
+}
+
+// WithStatsEncoder serialize the stats reports published to Config.StatsSubject with the encoder instead of json
+func WithStatsEncoder(encoder StatsEncoder) Option {
+	return func(w *NatsWebSocket) {
+		w.statsEncoder = encoder
+	}
+}
+
+// WithPreferenceStore filter the deliveries with the notification preferences of the users, cached per connection
+func WithPreferenceStore(store PreferenceStore) Option {
+	return func(w *NatsWebSocket) {
+		w.preferenceStore = store
+	}
+}
+
+// WithAnalyticsSink export the session records to the sink instead of Config.AnalyticsURL or Config.AnalyticsFile, e.g. a Kafka producer
+func WithAnalyticsSink(sink AnalyticsSink) Option {
+	return func(w *NatsWebSocket) {
+		w.analyticsSink = sink
+	}
+}
+
+// WithMetricsSink push the metrics to the sink besides serving them on /metrics
+func WithMetricsSink(sink MetricsSink) Option {
+	return func(w *NatsWebSocket) {
+		w.metricsSink = sink
+	}
+}
+
+// WithTracer trace the upgrades, the logins, the subscribes and the deliveries with the tracer, e.g. an OpenTelemetry adapter
+func WithTracer(tracer Tracer) Option {
+	return func(w *NatsWebSocket) {
+		w.tracer = tracer
+	}
+}
@@ -0,0 +1,19 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions(t *T) {
+	gateway := New(nil)
+	assert.Equal(t, DefaultURLPattern, gateway.config.URLPattern)
+	assert.Equal(t, int64(DefaultReadLimit), gateway.readLimit)
+
+	gateway = New(nil, WithReadLimit(4096), WithUpgrader(websocket.Upgrader{ReadBufferSize: 512}))
+	assert.Equal(t, int64(4096), gateway.readLimit)
+	assert.Equal(t, 512, gateway.upgrader.ReadBufferSize)
+	assert.Equal(t, []string{ProtobufSubprotocol, JSONSubprotocol}, gateway.upgrader.Subprotocols)
+}
@@ -0,0 +1,234 @@
+package websocketnats
+
+import (
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultOrderedQueueSize default size of the per user delivery queue in ordered mode
+	DefaultOrderedQueueSize = 1024
+)
+
+// userQueue single delivery queue of a user. All the topics the user's devices are subscribed to are
+// fed into one channel by the subscription connection of the user, which keeps the order the messages were received by nats
+type userQueue struct {
+	busClient     *nats.Conn
+	messages      chan *nats.Msg
+	subscriptions map[string]*nats.Subscription
+	subscribers   map[string]map[*Connection]MessageFilter
+}
+
+// OrderedDelivery per user FIFO delivery across all the subscriptions of the user
+type OrderedDelivery struct {
+	mutex       sync.Mutex
+	connections *SubscriptionConnections
+	callbacks   *TopicCallbacks
+	outbound    *OutboundStats
+	queueSize   int
+	queues      map[UserID]*userQueue
+	users       map[*Connection]UserID
+	deadline    time.Duration
+	exceeded    *Counter
+	topics      *TopicPolicies
+}
+
+// NewOrderedDelivery init ordered delivery
+func NewOrderedDelivery(connections *SubscriptionConnections, callbacks *TopicCallbacks, outbound *OutboundStats, queueSize int) *OrderedDelivery {
+	if queueSize < 1 {
+		queueSize = DefaultOrderedQueueSize
+	}
+
+	return &OrderedDelivery{
+		mutex:       sync.Mutex{},
+		connections: connections,
+		callbacks:   callbacks,
+		outbound:    outbound,
+		queueSize:   queueSize,
+		queues:      make(map[UserID]*userQueue),
+		users:       make(map[*Connection]UserID),
+	}
+}
+
+// SetDeadline bound the time a message may spend being delivered to the devices of a user, the remaining ones
+// get it through their deferred queue. The counter counts the deadlines exceeded
+func (d *OrderedDelivery) SetDeadline(deadline time.Duration, exceeded *Counter) {
+	d.deadline = deadline
+	d.exceeded = exceeded
+}
+
+// SetTopics apply the topic policies, i.e. transforms, last values and priorities, to the delivered messages
+func (d *OrderedDelivery) SetTopics(topics *TopicPolicies) {
+	d.topics = topics
+}
+
+// Subscribe subscribe the logged in connection to the topic through the queue of its user. A nil filter delivers every message
+func (d *OrderedDelivery) Subscribe(connection *Connection, topic string, filter MessageFilter) error {
+	_, userID, _ := connection.GetInfo()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	queue := d.queues[userID]
+	if queue == nil {
+		busClient, err := d.connections.Get(string(userID))
+		if err != nil {
+			return err
+		}
+
+		queue = &userQueue{
+			busClient:     busClient,
+			messages:      make(chan *nats.Msg, d.queueSize),
+			subscriptions: make(map[string]*nats.Subscription),
+			subscribers:   make(map[string]map[*Connection]MessageFilter),
+		}
+		d.queues[userID] = queue
+		go d.deliver(queue)
+	}
+
+	if queue.subscriptions[topic] == nil {
+		subscription, err := queue.busClient.ChanSubscribe(topic, queue.messages)
+		if err != nil {
+			d.release(userID, queue)
+			return err
+		}
+
+		queue.subscriptions[topic] = subscription
+		queue.subscribers[topic] = make(map[*Connection]MessageFilter)
+	}
+
+	queue.subscribers[topic][connection] = filter
+	d.users[connection] = userID
+	return nil
+}
+
+// Unsubscribe remove the connection from the topic subscribers of its user.
+// The connection is looked up by reference since its user is forgotten once closed
+func (d *OrderedDelivery) Unsubscribe(connection *Connection, topic string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	userID, ok := d.users[connection]
+	queue := d.queues[userID]
+	if !ok || queue == nil || queue.subscribers[topic] == nil {
+		return
+	}
+
+	delete(queue.subscribers[topic], connection)
+	if !queue.isSubscribed(connection) {
+		delete(d.users, connection)
+	}
+
+	if len(queue.subscribers[topic]) > 0 {
+		return
+	}
+
+	queue.subscriptions[topic].Unsubscribe()
+	delete(queue.subscriptions, topic)
+	delete(queue.subscribers, topic)
+
+	d.release(userID, queue)
+}
+
+// Resubscribe move the queues subscribing on the nats connection, closed or disconnected, to the connection replacing it.
+// Returns the number of topics that couldn't be resubscribed
+func (d *OrderedDelivery) Resubscribe(conn *nats.Conn) (failed int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for userID, queue := range d.queues {
+		if queue.busClient != conn {
+			continue
+		}
+
+		// not replayed if the connection reconnects
+		for _, subscription := range queue.subscriptions {
+			subscription.Unsubscribe()
+		}
+
+		busClient, err := d.connections.Get(string(userID))
+		if err != nil {
+			failed += len(queue.subscriptions)
+			continue
+		}
+
+		queue.busClient = busClient
+		for topic := range queue.subscriptions {
+			subscription, err := busClient.ChanSubscribe(topic, queue.messages)
+			if err != nil {
+				failed++
+				continue
+			}
+			queue.subscriptions[topic] = subscription
+		}
+	}
+	return failed
+}
+
+// Affected get the connections of the users whose queue subscribes on the nats connection, with their topics
+func (d *OrderedDelivery) Affected(busClient *nats.Conn) map[*Connection][]string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	affected := make(map[*Connection][]string)
+	for connection, userID := range d.users {
+		if queue := d.queues[userID]; queue != nil && queue.busClient == busClient {
+			affected[connection] = connection.GetTopics()
+		}
+	}
+	return affected
+}
+
+// release drop the queue of the user once nothing is subscribed anymore. Lock must be held
+func (d *OrderedDelivery) release(userID UserID, queue *userQueue) {
+	if len(queue.subscriptions) > 0 {
+		return
+	}
+
+	delete(d.queues, userID)
+	close(queue.messages)
+}
+
+func (q *userQueue) isSubscribed(connection *Connection) bool {
+	for _, subscribers := range q.subscribers {
+		if _, ok := subscribers[connection]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *OrderedDelivery) deliver(queue *userQueue) {
+	for msg := range queue.messages {
+		topic := msg.Sub.Subject
+		if !d.callbacks.DeliversToWebsocket(topic) {
+			continue
+		}
+
+		delivered := deliveredTopic(topic, topic, msg)
+		data := msg.Data
+		if d.topics != nil {
+			if data = d.topics.Apply(delivered, data); data == nil {
+				continue
+			}
+		}
+
+		d.mutex.Lock()
+		recipients := make([]*Connection, 0, len(queue.subscribers[topic]))
+		for connection, filter := range queue.subscribers[topic] {
+			if filter == nil || filter(data) {
+				recipients = append(recipients, connection)
+			}
+		}
+		d.mutex.Unlock()
+
+		if d.topics == nil || !d.topics.Prioritized(topic) {
+			d.outbound.WaitBelowHighWatermark()
+		}
+		if fanOut(recipients, delivered, data, d.deadline) > 0 && d.exceeded != nil {
+			d.exceeded.Inc()
+		}
+	}
+}
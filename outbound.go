@@ -0,0 +1,113 @@
+package websocketnats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultMaxOutboundPause default time in milliseconds a subscription is paused while over the high watermark
+	DefaultMaxOutboundPause = 1000
+)
+
+// OutboundStats outbound queue depth across all the connections, i.e. the number of frames waiting to be written.
+// Above the high watermark the upstream subscriptions are paused until the depth drops to half the watermark
+type OutboundStats struct {
+	mutex         sync.Mutex
+	depth         int64
+	peak          int64
+	pauses        int64
+	highWatermark int64
+	maxPause      time.Duration
+	paused        chan struct{}
+}
+
+// NewOutboundStats init outbound stats. A high watermark less than 1 disables the pausing
+func NewOutboundStats(highWatermark int, maxPause time.Duration) *OutboundStats {
+	return &OutboundStats{
+		mutex:         sync.Mutex{},
+		highWatermark: int64(highWatermark),
+		maxPause:      maxPause,
+	}
+}
+
+func (o *OutboundStats) acquire() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.depth++
+	if o.depth > o.peak {
+		o.peak = o.depth
+	}
+
+	if o.highWatermark > 0 && o.depth >= o.highWatermark && o.paused == nil {
+		o.paused = make(chan struct{})
+		o.pauses++
+	}
+}
+
+func (o *OutboundStats) release() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.depth--
+	if o.paused != nil && o.depth <= o.highWatermark/2 {
+		close(o.paused)
+		o.paused = nil
+	}
+}
+
+// WaitBelowHighWatermark block the caller, typically a nats subscription callback, while the global depth is over the high watermark.
+// The wait is bounded by the max pause so a stuck peer can't stall the delivery forever
+func (o *OutboundStats) WaitBelowHighWatermark() {
+	o.mutex.Lock()
+	paused := o.paused
+	o.mutex.Unlock()
+
+	if paused == nil {
+		return
+	}
+
+	timer := time.NewTimer(o.maxPause)
+	defer timer.Stop()
+
+	select {
+	case <-paused:
+	case <-timer.C:
+	}
+}
+
+// Get get the current depth, the peak depth and the number of times the subscriptions were paused
+func (o *OutboundStats) Get() (depth, peak, pauses int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.depth, o.peak, o.pauses
+}
+
+// GetOutboundDepth get the current and peak number of frames waiting to be written to the connection
+func (c *Connection) GetOutboundDepth() (depth, peak int64) {
+	return atomic.LoadInt64(&c.outboundDepth), atomic.LoadInt64(&c.outboundPeak)
+}
+
+func (c *Connection) acquireOutbound() {
+	depth := atomic.AddInt64(&c.outboundDepth, 1)
+	for {
+		peak := atomic.LoadInt64(&c.outboundPeak)
+		if depth <= peak || atomic.CompareAndSwapInt64(&c.outboundPeak, peak, depth) {
+			break
+		}
+	}
+
+	if c.outbound != nil {
+		c.outbound.acquire()
+	}
+}
+
+func (c *Connection) releaseOutbound() {
+	atomic.AddInt64(&c.outboundDepth, -1)
+	if c.outbound != nil {
+		c.outbound.release()
+	}
+}
@@ -0,0 +1,208 @@
+package websocketnats
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// OutboundRateDrop a message over the outbound rate of the connection is dropped
+	OutboundRateDrop = "drop"
+	// OutboundRateCoalesce a message over the outbound rate of the connection replaces the previous message of its topic
+	// waiting for the rate, the latest message of each topic being sent once the rate allows it
+	OutboundRateCoalesce = "coalesce"
+)
+
+// ThrottleCounts messages dropped or coalesced by the outbound rate limits, see Config.MaxOutboundMessagesPerSecond
+type ThrottleCounts struct {
+	Dropped   int64 `json:"dropped"`
+	Coalesced int64 `json:"coalesced"`
+}
+
+// throttleCounts counters updated atomically
+type throttleCounts struct {
+	dropped   int64
+	coalesced int64
+}
+
+func (t *throttleCounts) get() ThrottleCounts {
+	if t == nil {
+		return ThrottleCounts{}
+	}
+	return ThrottleCounts{Dropped: atomic.LoadInt64(&t.dropped), Coalesced: atomic.LoadInt64(&t.coalesced)}
+}
+
+// outboundRate token buckets limiting the messages and the bytes per second delivered to a connection, with a burst of
+// one second. A limit less than 1 is unlimited
+type outboundRate struct {
+	mutex         sync.Mutex
+	policy        string
+	messageRate   float64
+	byteRate      float64
+	messageTokens float64
+	byteTokens    float64
+	refilled      time.Time
+	// pending latest message of each topic waiting for the rate, in the order the topics were throttled
+	pending  map[string][]byte
+	order    []string
+	flushing bool
+	counts   throttleCounts
+	// total counts of the gateway, and throttled counter of the policy
+	total     *throttleCounts
+	throttled *Counter
+}
+
+func newOutboundRate(messagesPerSecond, bytesPerSecond int, policy string, total *throttleCounts, throttled *Counter) *outboundRate {
+	return &outboundRate{
+		policy:        policy,
+		messageRate:   float64(messagesPerSecond),
+		byteRate:      float64(bytesPerSecond),
+		messageTokens: float64(messagesPerSecond),
+		byteTokens:    float64(bytesPerSecond),
+		refilled:      time.Now(),
+		pending:       make(map[string][]byte),
+		total:         total,
+		throttled:     throttled,
+	}
+}
+
+// refill add the tokens earned since the last refill. Lock must be held
+func (r *outboundRate) refill(now time.Time) {
+	elapsed := now.Sub(r.refilled).Seconds()
+	r.refilled = now
+	if r.messageRate > 0 {
+		r.messageTokens = math.Min(r.messageRate, r.messageTokens+elapsed*r.messageRate)
+	}
+	if r.byteRate > 0 {
+		r.byteTokens = math.Min(r.byteRate, r.byteTokens+elapsed*r.byteRate)
+	}
+}
+
+// byteCost tokens a message of the size needs, a message larger than the byte rate waiting for a full bucket
+func (r *outboundRate) byteCost(size int) float64 {
+	return math.Min(float64(size), r.byteRate)
+}
+
+// take consume the tokens of a message of the size if available. Lock must be held
+func (r *outboundRate) take(size int) bool {
+	if r.messageRate > 0 && r.messageTokens < 1 {
+		return false
+	}
+	if r.byteRate > 0 && r.byteTokens < r.byteCost(size) {
+		return false
+	}
+
+	r.messageTokens--
+	r.byteTokens -= float64(size)
+	return true
+}
+
+// delay time until the tokens of a message of the size are available. Lock must be held
+func (r *outboundRate) delay(size int) time.Duration {
+	var wait float64
+	if r.messageRate > 0 && r.messageTokens < 1 {
+		wait = (1 - r.messageTokens) / r.messageRate
+	}
+	if r.byteRate > 0 && r.byteTokens < r.byteCost(size) {
+		wait = math.Max(wait, (r.byteCost(size)-r.byteTokens)/r.byteRate)
+	}
+	return time.Duration(wait*float64(time.Second)) + time.Millisecond
+}
+
+// admit decide if the message is sent now. Otherwise it is dropped, or with OutboundRateCoalesce kept as the pending
+// message of its topic, in which case flush is true if the caller must start flushing the pending messages
+func (r *outboundRate) admit(topic string, data []byte) (send bool, flush bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// keep the order behind the pending messages
+	if !r.flushing {
+		r.refill(time.Now())
+		if r.take(len(data)) {
+			return true, false
+		}
+	}
+
+	if r.policy != OutboundRateCoalesce {
+		r.count(&r.counts.dropped, &r.total.dropped)
+		return false, false
+	}
+
+	if _, ok := r.pending[topic]; ok {
+		r.count(&r.counts.coalesced, &r.total.coalesced)
+	} else {
+		r.order = append(r.order, topic)
+	}
+	r.pending[topic] = data
+
+	flush = !r.flushing
+	r.flushing = true
+	return false, flush
+}
+
+// count increment the counter of the connection and of the gateway. Lock must be held
+func (r *outboundRate) count(connection *int64, total *int64) {
+	atomic.AddInt64(connection, 1)
+	atomic.AddInt64(total, 1)
+	r.throttled.Inc()
+}
+
+// next wait for the rate to allow the next pending message and pop it, or stop flushing once none is pending
+func (r *outboundRate) next() (topic string, data []byte, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for len(r.order) > 0 {
+		topic = r.order[0]
+		data = r.pending[topic]
+		r.refill(time.Now())
+		if r.take(len(data)) {
+			r.order = r.order[1:]
+			delete(r.pending, topic)
+			return topic, data, true
+		}
+
+		delay := r.delay(len(data))
+		r.mutex.Unlock()
+		time.Sleep(delay)
+		r.mutex.Lock()
+	}
+
+	r.flushing = false
+	return "", nil, false
+}
+
+// flushThrottled send the pending messages of the coalescing outbound rate as the rate allows
+func (c *Connection) flushThrottled() {
+	for {
+		topic, data, ok := c.outboundRate.next()
+		if !ok {
+			return
+		}
+		c.send(topic, data, false)
+	}
+}
+
+// GetThrottleCounts get the messages dropped or coalesced by the outbound rate limits of the connection
+func (c *Connection) GetThrottleCounts() ThrottleCounts {
+	if c.outboundRate == nil {
+		return ThrottleCounts{}
+	}
+	return c.outboundRate.counts.get()
+}
+
+// newOutboundRate get the outbound rate limits of a new connection, nil if unlimited
+func (w *NatsWebSocket) newOutboundRate() *outboundRate {
+	if w.config.MaxOutboundMessagesPerSecond <= 0 && w.config.MaxOutboundBytesPerSecond <= 0 {
+		return nil
+	}
+
+	policy := w.config.OutboundRatePolicy
+	if policy == "" {
+		policy = OutboundRateDrop
+	}
+	throttled := w.metrics.Counter("gateway_outbound_throttled_total", "Messages dropped or coalesced by the outbound rate limits by policy", "policy", policy)
+	return newOutboundRate(w.config.MaxOutboundMessagesPerSecond, w.config.MaxOutboundBytesPerSecond, policy, &w.throttled, throttled)
+}
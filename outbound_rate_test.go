@@ -0,0 +1,73 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func throttledConnection(config *Config) (*NatsWebSocket, *Connection, chan string) {
+	w := New(config, WithPool(unavailablePool{}))
+	received := make(chan string, 16)
+	client, server := net.Pipe()
+	go func() {
+		transport := NewStreamTransport(client)
+		for {
+			_, message, err := transport.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(message)
+		}
+	}()
+	return w, w.registerConnection(NewStreamTransport(server)), received
+}
+
+func TestOutboundRateDrop(t *T) {
+	w, connection, received := throttledConnection(&Config{MaxOutboundMessagesPerSecond: 2})
+
+	for _, message := range []string{"1", "2", "3", "4"} {
+		connection.Deliver("news", []byte(message))
+	}
+	assert.Equal(t, "1", <-received)
+	assert.Equal(t, "2", <-received)
+	select {
+	case message := <-received:
+		t.Fatalf("throttled message %q delivered", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Equal(t, ThrottleCounts{Dropped: 2}, connection.GetThrottleCounts())
+	assert.Equal(t, ThrottleCounts{Dropped: 2}, w.GetConnectionsReport().Throttled)
+}
+
+func TestOutboundRateCoalesce(t *T) {
+	_, connection, received := throttledConnection(&Config{MaxOutboundMessagesPerSecond: 4, OutboundRatePolicy: OutboundRateCoalesce})
+
+	for _, message := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+		connection.Deliver("news", []byte(message))
+	}
+	connection.Deliver("weather", []byte("rain"))
+
+	for _, expected := range []string{"1", "2", "3", "4", "7", "rain"} {
+		select {
+		case message := <-received:
+			assert.Equal(t, expected, message)
+		case <-time.After(time.Second):
+			t.Fatalf("%q not delivered", expected)
+		}
+	}
+	assert.Equal(t, ThrottleCounts{Coalesced: 2}, connection.GetThrottleCounts())
+}
+
+func TestOutboundByteRate(t *T) {
+	rate := newOutboundRate(0, 10, OutboundRateDrop, &throttleCounts{}, nil)
+	assert.True(t, rate.take(8))
+	assert.False(t, rate.take(8))
+	// a message larger than the rate waits for a full bucket
+	rate.byteTokens = 10
+	assert.True(t, rate.take(25))
+	assert.True(t, rate.delay(1) > time.Second)
+}
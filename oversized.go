@@ -0,0 +1,95 @@
+package websocketnats
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// OversizedNotice a message exceeded the max message size of the client and was not delivered
+	OversizedNotice = "oversized"
+
+	// DefaultClaimCheckTTL default time in seconds an oversized payload can be fetched from the claim-check store
+	DefaultClaimCheckTTL = 300
+	// DefaultClaimCheckMaxBytes default max bytes of oversized messages the claim-check store keeps
+	DefaultClaimCheckMaxBytes = 64 << 20
+	// ClaimCheckPath path the MemoryClaimCheckStore is served on
+	ClaimCheckPath = "/claims/"
+	// MinMessageSize lowest max message size a client may request with the maxMessageSize query parameter
+	MinMessageSize = 4096
+
+	// claimCheckExpiryInterval interval the expired claims are removed from the MemoryClaimCheckStore
+	claimCheckExpiryInterval = 10 * time.Second
+)
+
+// negotiateMaxMessageSize the client may lower Config.MaxMessageSize with the maxMessageSize query parameter of the upgrade
+// url, not below MinMessageSize
+func (w *NatsWebSocket) negotiateMaxMessageSize(request *http.Request) int {
+	limit := w.liveConfig().MaxMessageSize
+
+	requested, err := strconv.Atoi(request.URL.Query().Get("maxMessageSize"))
+	if err != nil || requested <= 0 {
+		return limit
+	}
+	if requested < MinMessageSize {
+		requested = MinMessageSize
+	}
+	if limit <= 0 || requested < limit {
+		limit = requested
+	}
+
+	return limit
+}
+
+// sharedClaim claim-check of a message, put once and shared by the recipients of the message, see fanOut
+type sharedClaim struct {
+	mutex sync.Mutex
+	data  []byte
+	url   string
+	err   error
+}
+
+// put put the message in the store unless the recipients before put the same payload. A nil claim always puts it
+func (s *sharedClaim) put(store ClaimCheckStore, topic string, data []byte) (string, error) {
+	if s == nil {
+		return store.Put(topic, data)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// the recipients decompressing the gzip payloads claim another payload, see decodePayload
+	if s.data != nil && bytes.Equal(s.data, data) {
+		return s.url, s.err
+	}
+
+	url, err := store.Put(topic, data)
+	if s.data == nil {
+		s.data, s.url, s.err = data, url, err
+	}
+	return url, err
+}
+
+// deliverOversized notify the client the message exceeds its max message size, with the claim-check url if a store is
+// configured. The claim is shared with the other recipients of the message unless claim is nil
+func (c *Connection) deliverOversized(topic string, data []byte, claim *sharedClaim) {
+	notice := Notice{
+		Type:      OversizedNotice,
+		Topic:     topic,
+		MessageID: messageID(data, c.messageIDField),
+		Size:      len(data),
+	}
+
+	if c.claimCheck != nil {
+		url, err := claim.put(c.claimCheck, topic, data)
+		if err != nil {
+			c.Logf("claim-check of %s: %v", topic, err)
+		}
+		notice.URL = url
+	}
+
+	c.SendNotice(notice)
+}
@@ -0,0 +1,133 @@
+package websocketnats
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryClaimCheckStore(t *T) {
+	store := NewMemoryClaimCheckStore("https://gateway.example.com/claims/", time.Minute, 0)
+
+	url, err := store.Put("test.a", []byte("whosyourdaddy"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(url, "https://gateway.example.com/claims/"))
+
+	recorder := httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	assert.Equal(t, "whosyourdaddy", string(body))
+
+	recorder = httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", "/claims/unknown", nil))
+	assert.Equal(t, 404, recorder.Code)
+}
+
+func TestMemoryClaimCheckStoreLimits(t *T) {
+	store := NewMemoryClaimCheckStore("/claims/", time.Minute, 8)
+
+	_, err := store.Put("test.a", []byte("whosyourdaddy"))
+	assert.Equal(t, ErrClaimTooLarge, err)
+
+	first, _ := store.Put("test.a", []byte("abcd"))
+	second, _ := store.Put("test.a", []byte("efgh"))
+	third, _ := store.Put("test.a", []byte("ijkl"))
+	assert.Equal(t, 8, store.Size())
+
+	recorder := httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest("GET", first, nil))
+	assert.Equal(t, 404, recorder.Code)
+
+	for _, url := range []string{second, third} {
+		recorder = httptest.NewRecorder()
+		store.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, 200, recorder.Code)
+	}
+
+	store.Expire(time.Now())
+	assert.Equal(t, 8, store.Size())
+	store.Expire(time.Now().Add(2 * time.Minute))
+	assert.Equal(t, 0, store.Size())
+}
+
+// countingClaimCheckStore claim-check store counting the payloads put
+type countingClaimCheckStore struct {
+	puts int
+}
+
+func (s *countingClaimCheckStore) Put(topic string, data []byte) (string, error) {
+	s.puts++
+	return "/claims/" + strconv.Itoa(s.puts), nil
+}
+
+func TestFanOutSharesClaim(t *T) {
+	store := &countingClaimCheckStore{}
+	w := New(&Config{}, WithClaimCheckStore(store))
+
+	oversized := 0
+	w.Events().OnDelivery(func(event DeliveryEvent) {
+		if event.Result == DeliveryOversized {
+			oversized++
+		}
+	})
+
+	recipients := []*Connection{}
+	for i := 0; i < 3; i++ {
+		client, server := net.Pipe()
+		defer client.Close()
+		go discard(client)
+
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.maxMessageSize = 4
+		connection.claimCheck = w.claimCheck
+		recipients = append(recipients, connection)
+	}
+
+	fanOut(recipients, "news", []byte("too large"), 0)
+	assert.Equal(t, 3, oversized)
+	assert.Equal(t, 1, store.puts)
+}
+
+func TestNegotiateMaxMessageSize(t *T) {
+	w := New(&Config{MaxMessageSize: 16384})
+
+	assert.Equal(t, 8192, w.negotiateMaxMessageSize(httptest.NewRequest("GET", "/ws?maxMessageSize=8192", nil)))
+	assert.Equal(t, MinMessageSize, w.negotiateMaxMessageSize(httptest.NewRequest("GET", "/ws?maxMessageSize=1", nil)))
+	assert.Equal(t, 16384, w.negotiateMaxMessageSize(httptest.NewRequest("GET", "/ws?maxMessageSize=65536", nil)))
+	assert.Equal(t, 16384, w.negotiateMaxMessageSize(httptest.NewRequest("GET", "/ws", nil)))
+
+	w = New(&Config{})
+	assert.Equal(t, MinMessageSize, w.negotiateMaxMessageSize(httptest.NewRequest("GET", "/ws?maxMessageSize=1", nil)))
+}
+
+func TestReadLimits(t *T) {
+	w := New(&Config{}, WithReadLimit(2048))
+	beforeLogin, afterLogin := w.readLimits()
+	assert.Equal(t, int64(2048), beforeLogin)
+	assert.Equal(t, int64(DefaultMaxReadSize), afterLogin)
+
+	w.Reload(&Config{MaxReadSizeBeforeLogin: 512, MaxReadSize: 4096})
+	beforeLogin, afterLogin = w.readLimits()
+	assert.Equal(t, int64(512), beforeLogin)
+	assert.Equal(t, int64(4096), afterLogin)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	transport := NewStreamTransport(server)
+	transport.SetReadLimit(beforeLogin)
+	connection := NewConnection(1, transport)
+	connection.maxReadSize = afterLogin
+	connection.Login("user", "device")
+
+	go NewStreamTransport(client).WriteMessage(websocket.TextMessage, make([]byte, 1024))
+	_, message, err := transport.ReadMessage()
+	assert.Nil(t, err)
+	assert.Len(t, message, 1024)
+}
@@ -0,0 +1,91 @@
+package websocketnats
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// PongTimeoutReason close reason of the connections that stopped answering the pings
+	PongTimeoutReason = "PongTimeout"
+	// pingWriteTimeout time to write a ping before giving up on the connection until the next round
+	pingWriteTimeout = time.Second
+)
+
+// pinger transport sending websocket control frames, e.g. *websocket.Conn
+type pinger interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+}
+
+// pongHandler transport notifying the pongs, e.g. *websocket.Conn
+type pongHandler interface {
+	SetPongHandler(handler func(data string) error)
+}
+
+// watchPongs count the pongs of the connection as activity, pushing back its read deadline like any frame
+func (c *Connection) watchPongs() {
+	if transport, ok := c.ws.(pongHandler); ok {
+		transport.SetPongHandler(func(string) error {
+			c.UpdateLastPingTime()
+			c.extendReadDeadline()
+			return nil
+		})
+	}
+}
+
+// lastActivity get the time of the last frame or pong of the client, the connection time if none
+func (c *Connection) lastActivity() time.Time {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	if c.lastMessageAt.After(c.startTime) {
+		return c.lastMessageAt
+	}
+	return c.startTime
+}
+
+// startPings ping the connections every Config.PingInterval, closing the ones without any frame or pong within
+// Config.PongTimeout, e.g. half-open behind a NAT or a proxy, until the gateway is stopped
+func (w *NatsWebSocket) startPings() {
+	if w.config.PingInterval <= 0 {
+		return
+	}
+
+	interval := time.Duration(w.config.PingInterval) * time.Second
+	timeout := time.Duration(w.config.PongTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * interval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.pingConnections(timeout)
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// pingConnections ping each connection, unregistering and closing the ones silent for longer than the timeout
+func (w *NatsWebSocket) pingConnections(timeout time.Duration) {
+	now := time.Now()
+	for _, connection := range w.connections.ListConnections() {
+		if now.Sub(connection.lastActivity()) > timeout {
+			w.metrics.Counter("gateway_pong_timeouts_total", "Connections closed for answering no ping").Inc()
+			connection.Logf("no pong for %s, closing", now.Sub(connection.lastActivity()).Round(time.Second))
+			w.disconnect(connection, websocket.CloseGoingAway, PongTimeoutReason)
+			continue
+		}
+
+		if transport, ok := connection.ws.(pinger); ok {
+			transport.WriteControl(websocket.PingMessage, nil, now.Add(pingWriteTimeout))
+		}
+	}
+}
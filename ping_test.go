@@ -0,0 +1,65 @@
+package websocketnats
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingConnections(t *T) {
+	gateway := New(&Config{URLPattern: "/", HeartbeatInterval: -1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	// the default ping handler answers the pings while the client reads
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	assert.True(t, waitFor(func() bool { return len(gateway.connections.ListConnections()) == 1 }))
+	connection := gateway.connections.ListConnections()[0]
+	connected := connection.lastActivity()
+
+	gateway.pingConnections(time.Minute)
+	assert.True(t, waitFor(func() bool { return connection.lastActivity().After(connected) }))
+
+	client, stream := net.Pipe()
+	defer client.Close()
+	go discard(client)
+	silent := gateway.registerConnection(NewStreamTransport(stream))
+	silent.Login("user", "phone")
+	gateway.connections.OnLogin(silent)
+	silent.startTime = time.Now().Add(-time.Hour)
+	assert.Equal(t, 2, gateway.connections.GetStats().NumberOfConnections)
+
+	gateway.pingConnections(time.Minute)
+	assert.True(t, silent.IsClosed())
+	assert.False(t, connection.IsClosed())
+	// the timed out connection is removed from the storage, along with its user
+	assert.Equal(t, 1, gateway.connections.GetStats().NumberOfConnections)
+	assert.Empty(t, gateway.connections.ListUserConnections("user"))
+}
+
+// waitFor poll the condition for up to a second
+func waitFor(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
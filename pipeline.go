@@ -0,0 +1,111 @@
+package websocketnats
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	// DefaultMaxBatchCommands default number of commands allowed in one frame
+	DefaultMaxBatchCommands = 100
+)
+
+// splitBatch split a frame carrying several commands, either newline delimited or as a json array of strings
+func splitBatch(message []byte) (commands [][]byte, isJSON bool) {
+	if bytes.HasPrefix(message, []byte("[")) {
+		var entries []string
+		if err := json.Unmarshal(message, &entries); err == nil {
+			for _, entry := range entries {
+				commands = append(commands, []byte(entry))
+			}
+			return commands, true
+		}
+	}
+
+	if bytes.IndexByte(message, '\n') < 0 {
+		return nil, false
+	}
+
+	for _, command := range bytes.Split(message, []byte("\n")) {
+		if command = bytes.TrimSuffix(command, []byte("\r")); len(command) > 0 {
+			commands = append(commands, command)
+		}
+	}
+	return commands, false
+}
+
+func (c *Connection) startBatch() {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.batching = true
+	c.replies = nil
+}
+
+func (c *Connection) takeReplies() [][]byte {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	replies := c.replies
+	c.replies = nil
+	return replies
+}
+
+func (c *Connection) endBatch() {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.batching = false
+	c.replies = nil
+}
+
+// onTextFrame handle a text frame, which carries a batch of commands if Config.CommandPipelining is enabled.
+// The responses of a batch are sent back in one frame in the order of the commands, in the same format as the request.
+// A command without response gets an empty line, or null in a json array
+func (w *NatsWebSocket) onTextFrame(connection *Connection, message []byte) {
+	if !w.config.CommandPipelining {
+		w.onTextMessage(connection, message)
+		return
+	}
+
+	commands, isJSON := splitBatch(message)
+	if commands == nil {
+		w.onTextMessage(connection, message)
+		return
+	}
+
+	maxCommands := w.liveConfig().MaxBatchCommands
+	if maxCommands <= 0 {
+		maxCommands = DefaultMaxBatchCommands
+	}
+
+	connection.checkSoftLimit(BatchCommandsLimit, "", len(commands), maxCommands)
+	if len(commands) > maxCommands {
+		connection.Logf("batch rejected: %d commands", len(commands))
+		connection.Reply([]byte(TooManyCommandsResponse))
+		return
+	}
+
+	responses := make([][]byte, len(commands))
+	connection.startBatch()
+	for i, command := range commands {
+		w.onTextMessage(connection, command)
+		responses[i] = bytes.Join(connection.takeReplies(), []byte("\n"))
+	}
+	connection.endBatch()
+
+	if !isJSON {
+		connection.SendText(bytes.Join(responses, []byte("\n")))
+		return
+	}
+
+	entries := make([]interface{}, len(responses))
+	for i, response := range responses {
+		if len(response) > 0 {
+			entries[i] = string(response)
+		}
+	}
+
+	payload, _ := json.Marshal(entries)
+	connection.SendText(payload)
+}
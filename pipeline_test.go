@@ -0,0 +1,20 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBatch(t *T) {
+	commands, isJSON := splitBatch([]byte("login>:Bearer x\r\ntopic>:test.a\ntopic>:test.b\n"))
+	assert.False(t, isJSON)
+	assert.Equal(t, [][]byte{[]byte("login>:Bearer x"), []byte("topic>:test.a"), []byte("topic>:test.b")}, commands)
+
+	commands, isJSON = splitBatch([]byte(`["ping","topic>:test.a"]`))
+	assert.True(t, isJSON)
+	assert.Equal(t, [][]byte{[]byte("ping"), []byte("topic>:test.a")}, commands)
+
+	commands, _ = splitBatch([]byte("ping"))
+	assert.Nil(t, commands)
+}
@@ -0,0 +1,186 @@
+package websocketnats
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPreferencesTTL default time in seconds the preferences of a connection are cached
+	DefaultPreferencesTTL = 300
+)
+
+// NotificationPreferences delivery preferences of a user on a device
+type NotificationPreferences struct {
+	// MutedTopics topic patterns not delivered, nats wildcards allowed
+	MutedTopics []string `json:"mutedTopics"`
+	// QuietHours nothing is delivered between the start and the end, if set
+	QuietHours *QuietHours `json:"quietHours"`
+	// OptedOut the device opted out of every delivery
+	OptedOut bool `json:"optedOut"`
+}
+
+// QuietHours daily interval during which nothing is delivered, e.g. 22:00 to 07:00
+type QuietHours struct {
+	// Start time of day the quiet hours start, as HH:MM
+	Start string `json:"start"`
+	// End time of day the quiet hours end, as HH:MM
+	End string `json:"end"`
+	// Location IANA time zone of the times, e.g. Asia/Tokyo. Defaults to UTC
+	Location string `json:"location"`
+}
+
+// PreferenceStore resolve the preferences of a user on a device. Nil preferences deliver everything
+type PreferenceStore interface {
+	Preferences(userID UserID, deviceID DeviceID) (*NotificationPreferences, error)
+}
+
+// Allows check if a message of the topic is delivered at the time
+func (p *NotificationPreferences) Allows(topic string, now time.Time) bool {
+	if p == nil {
+		return true
+	}
+	if p.OptedOut || p.QuietHours.contains(now) {
+		return false
+	}
+
+	for _, pattern := range p.MutedTopics {
+		if pattern == topic || matchSubject(pattern, topic) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *QuietHours) contains(now time.Time) bool {
+	if q == nil {
+		return false
+	}
+
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return false
+	}
+
+	if location, err := time.LoadLocation(q.Location); err == nil {
+		now = now.In(location)
+	}
+	minute := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	// quiet hours spanning midnight
+	if from > to {
+		return minute >= from || minute < to
+	}
+	return minute >= from && minute < to
+}
+
+// preferenceCache preferences of a connection, refreshed in the background once expired
+type preferenceCache struct {
+	mutex       sync.Mutex
+	store       PreferenceStore
+	userID      UserID
+	deviceID    DeviceID
+	ttl         time.Duration
+	preferences *NotificationPreferences
+	expires     time.Time
+	refreshing  bool
+}
+
+func newPreferenceCache(store PreferenceStore, userID UserID, deviceID DeviceID, ttl time.Duration) *preferenceCache {
+	return &preferenceCache{
+		mutex:    sync.Mutex{},
+		store:    store,
+		userID:   userID,
+		deviceID: deviceID,
+		ttl:      ttl,
+	}
+}
+
+// load fetch the preferences from the store. The cached ones are kept if the store fails
+func (c *preferenceCache) load() error {
+	preferences, err := c.store.Preferences(c.userID, c.deviceID)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.refreshing = false
+	c.expires = time.Now().Add(c.ttl)
+	if err != nil {
+		return err
+	}
+	c.preferences = preferences
+	return nil
+}
+
+// get the cached preferences, refreshing them in the background if expired
+func (c *preferenceCache) get() *NotificationPreferences {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.refreshing && time.Now().After(c.expires) {
+		c.refreshing = true
+		go c.load()
+	}
+	return c.preferences
+}
+
+// invalidate refresh the preferences on the next delivery
+func (c *preferenceCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.expires = time.Time{}
+}
+
+// allowsDelivery check the preferences of the connection allow the message of the topic
+func (c *Connection) allowsDelivery(topic string) bool {
+	c.dataMutex.RLock()
+	cache := c.preferences
+	c.dataMutex.RUnlock()
+
+	if cache == nil {
+		return true
+	}
+	return cache.get().Allows(topic, time.Now())
+}
+
+// loadPreferences cache the preferences of the logged in connection
+func (w *NatsWebSocket) loadPreferences(connection *Connection) {
+	if w.preferenceStore == nil {
+		return
+	}
+
+	ttl := time.Duration(w.config.PreferencesTTL) * time.Second
+	if ttl <= 0 {
+		ttl = DefaultPreferencesTTL * time.Second
+	}
+
+	_, userID, deviceID := connection.GetInfo()
+	cache := newPreferenceCache(w.preferenceStore, userID, deviceID, ttl)
+	if err := cache.load(); err != nil {
+		connection.Logf("preferences: %v", err)
+	}
+
+	connection.dataMutex.Lock()
+	connection.preferences = cache
+	connection.dataMutex.Unlock()
+}
+
+// InvalidatePreferences refresh the cached preferences of the connections of the user, e.g. after the user changed them
+func (w *NatsWebSocket) InvalidatePreferences(userID UserID) {
+	for _, connection := range w.connections.ListUserConnections(userID) {
+		connection.dataMutex.RLock()
+		cache := connection.preferences
+		connection.dataMutex.RUnlock()
+
+		if cache != nil {
+			cache.invalidate()
+		}
+	}
+}
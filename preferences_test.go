@@ -0,0 +1,48 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticPreferenceStore struct {
+	preferences *NotificationPreferences
+	calls       int
+}
+
+func (s *staticPreferenceStore) Preferences(userID UserID, deviceID DeviceID) (*NotificationPreferences, error) {
+	s.calls++
+	return s.preferences, nil
+}
+
+func TestNotificationPreferences(t *T) {
+	noon := time.Date(2018, 4, 6, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2018, 4, 6, 23, 0, 0, 0, time.UTC)
+
+	preferences := &NotificationPreferences{MutedTopics: []string{"promo.>"}}
+	assert.False(t, preferences.Allows("promo.spring", noon))
+	assert.True(t, preferences.Allows("orders", noon))
+
+	preferences.QuietHours = &QuietHours{Start: "22:00", End: "07:00"}
+	assert.False(t, preferences.Allows("orders", night))
+	assert.True(t, preferences.Allows("orders", noon))
+
+	preferences.QuietHours = &QuietHours{Start: "22:00", End: "07:00", Location: "Asia/Tokyo"}
+	assert.False(t, preferences.Allows("orders", noon.Add(2*time.Hour)))
+
+	assert.False(t, (&NotificationPreferences{OptedOut: true}).Allows("orders", noon))
+	assert.True(t, (*NotificationPreferences)(nil).Allows("orders", noon))
+}
+
+func TestPreferenceCache(t *T) {
+	store := &staticPreferenceStore{preferences: &NotificationPreferences{OptedOut: true}}
+	w := New(&Config{}, WithPreferenceStore(store))
+	connection := NewConnection(1, nil)
+	connection.userID = "user"
+
+	w.loadPreferences(connection)
+	assert.False(t, connection.allowsDelivery("orders"))
+	assert.Equal(t, 1, store.calls)
+}
@@ -0,0 +1,112 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"sort"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultPresenceSubject default subject of the presence requests, see Config.PresenceSubject
+	DefaultPresenceSubject = "gateway.presence"
+)
+
+// PresenceRequest presence request sent on Config.PresenceSubject: whether the user or the device has a connection,
+// or the online users if neither is set
+type PresenceRequest struct {
+	UserID   UserID   `json:"userId,omitempty"`
+	DeviceID DeviceID `json:"deviceId,omitempty"`
+}
+
+// PresenceResponse reply to a presence request, from the instance that handled it
+type PresenceResponse struct {
+	InstanceID string     `json:"instanceId"`
+	UserID     UserID     `json:"userId,omitempty"`
+	DeviceID   DeviceID   `json:"deviceId,omitempty"`
+	Online     bool       `json:"online"`
+	Devices    []DeviceID `json:"devices,omitempty"`
+	Users      []UserID   `json:"users,omitempty"`
+}
+
+// IsUserOnline check if the user has a logged in connection on this instance
+func (w *NatsWebSocket) IsUserOnline(userID UserID) bool {
+	return len(w.connections.ListUserConnections(userID)) > 0
+}
+
+// IsDeviceOnline check if the device has a logged in connection on this instance
+func (w *NatsWebSocket) IsDeviceOnline(deviceID DeviceID) bool {
+	return w.connections.GetDeviceConnection(deviceID) != nil
+}
+
+// OnlineUsers get the users with a logged in connection on this instance
+func (w *NatsWebSocket) OnlineUsers() []UserID {
+	users := w.connections.ListUsers()
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+// Presence answer a presence request, as received on Config.PresenceSubject
+func (w *NatsWebSocket) Presence(request PresenceRequest) PresenceResponse {
+	response := PresenceResponse{InstanceID: w.instanceID, UserID: request.UserID, DeviceID: request.DeviceID}
+	switch {
+	case request.UserID != "":
+		for _, connection := range w.connections.ListUserConnections(request.UserID) {
+			_, _, deviceID := connection.GetInfo()
+			response.Devices = append(response.Devices, deviceID)
+		}
+		sort.Slice(response.Devices, func(i, j int) bool { return response.Devices[i] < response.Devices[j] })
+		response.Online = len(response.Devices) > 0
+	case request.DeviceID != "":
+		response.Online = w.IsDeviceOnline(request.DeviceID)
+	default:
+		response.Users = w.OnlineUsers()
+		response.Online = len(response.Users) > 0
+	}
+	return response
+}
+
+// startPresence answer the presence requests on Config.PresenceSubject until the gateway stops
+func (w *NatsWebSocket) startPresence() {
+	if w.config.DisablePresence {
+		return
+	}
+
+	subject := w.config.PresenceSubject
+	if subject == "" {
+		subject = DefaultPresenceSubject
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("presence: %v", err)
+		return
+	}
+
+	subscription, err := busClient.Subscribe(subject, func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			return
+		}
+
+		var request PresenceRequest
+		if len(msg.Data) > 0 {
+			if err := json.Unmarshal(msg.Data, &request); err != nil {
+				return
+			}
+		}
+
+		payload, _ := json.Marshal(w.Presence(request))
+		busClient.Publish(msg.Reply, payload)
+	})
+	if err != nil {
+		w.logger.Printf("presence: %v", err)
+		w.natsPool.Put(busClient)
+		return
+	}
+
+	go func() {
+		<-w.done
+		subscription.Unsubscribe()
+		w.natsPool.Put(busClient)
+	}()
+}
@@ -0,0 +1,36 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresence(t *T) {
+	w := New(&Config{InstanceID: "gateway-1"}, WithPool(unavailablePool{}))
+
+	connect := func(userID UserID, deviceID DeviceID) {
+		client, server := net.Pipe()
+		go discard(client)
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.Login(userID, deviceID)
+		w.connections.OnLogin(connection)
+	}
+	connect("bob", "tablet")
+	connect("alice", "phone")
+	connect("alice", "laptop")
+
+	assert.True(t, w.IsUserOnline("alice"))
+	assert.False(t, w.IsUserOnline("carol"))
+	assert.True(t, w.IsDeviceOnline("tablet"))
+	assert.False(t, w.IsDeviceOnline("watch"))
+	assert.Equal(t, []UserID{"alice", "bob"}, w.OnlineUsers())
+
+	response := w.Presence(PresenceRequest{UserID: "alice"})
+	assert.Equal(t, "gateway-1", response.InstanceID)
+	assert.True(t, response.Online)
+	assert.Equal(t, []DeviceID{"laptop", "phone"}, response.Devices)
+	assert.False(t, w.Presence(PresenceRequest{DeviceID: "watch"}).Online)
+	assert.Equal(t, []UserID{"alice", "bob"}, w.Presence(PresenceRequest{}).Users)
+}
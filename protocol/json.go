@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// JSONSubprotocol websocket subprotocol of the clients speaking the json protocol, e.g. {"v":1,"type":"subscribe","topic":"news","id":1}.
+	// The clients that negotiate no subprotocol speak it as well unless the gateway keeps the legacy prefix protocol
+	JSONSubprotocol = "json.v1"
+	// JSONProtocolVersion version of the json protocol, sent in every frame
+	JSONProtocolVersion = 1
+)
+
+// jsonCommands commands of the json protocol named differently from the prefix protocol
+var jsonCommands = map[string]string{
+	"subscribe":   "topic",
+	"unsubscribe": "untopic",
+}
+
+// JSONMessage frame of the json protocol.
+// Requests carry the type of the command, e.g. login, subscribe, unsubscribe, publish or history, the topic, the data and an id echoed in the reply.
+// The gateway sends the command responses with the reply or error type, the nats messages with the message type and the notices with the notice type.
+// The errors carry a code, e.g. unauthorized, invalid_topic or forbidden, and the legacy response as message
+type JSONMessage struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      uint64          `json:"id,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Code    string          `json:"code,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// JSONCodec codec of the json protocol
+type JSONCodec struct{}
+
+// FrameType json messages are sent in text frames
+func (JSONCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+// Decode unmarshal the json message. A string data is unquoted, e.g. the token of the login, any other data is passed as is
+func (JSONCodec) Decode(frame []byte) (envelope Envelope, err error) {
+	var message JSONMessage
+	if err = json.Unmarshal(frame, &message); err != nil {
+		return
+	}
+
+	if message.Version > JSONProtocolVersion {
+		err = fmt.Errorf("unsupported version %d", message.Version)
+		return
+	}
+	if message.Type == "" {
+		err = fmt.Errorf("missing type")
+		return
+	}
+
+	envelope = Envelope{Command: message.Type, Topic: message.Topic, ID: message.ID}
+	if command, ok := jsonCommands[message.Type]; ok {
+		envelope.Command = command
+	}
+
+	var data string
+	if json.Unmarshal(message.Data, &data) == nil {
+		envelope.Payload = []byte(data)
+	} else {
+		envelope.Payload = message.Data
+	}
+	return
+}
+
+// Encode marshal the envelope. The json payloads are embedded as is, the others as strings, base64 encoded if not valid utf-8
+func (JSONCodec) Encode(envelope Envelope) []byte {
+	message := JSONMessage{
+		Version: JSONProtocolVersion,
+		Type:    envelope.Command,
+		ID:      envelope.ID,
+		Topic:   envelope.Topic,
+	}
+
+	if envelope.Error != "" {
+		message.Code = envelope.Error
+		message.Message = string(envelope.Payload)
+	} else if len(envelope.Payload) > 0 {
+		message.Data = jsonData(envelope.Payload)
+	}
+
+	frame, _ := json.Marshal(message)
+	return frame
+}
+
+func jsonData(payload []byte) json.RawMessage {
+	if json.Valid(payload) {
+		return payload
+	}
+
+	var data interface{} = payload
+	if utf8.Valid(payload) {
+		data = string(payload)
+	}
+	encoded, _ := json.Marshal(data)
+	return encoded
+}
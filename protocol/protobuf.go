@@ -0,0 +1,154 @@
+// Package protocol wire protocol of the gateway clients: the envelopes and their codecs, the protobuf Envelope of
+// envelope.proto and the json frames of JSONSubprotocol. It is versioned independently from the gateway
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ProtobufSubprotocol websocket subprotocol of the clients exchanging protobuf Envelope frames, see envelope.proto
+	ProtobufSubprotocol = "protobuf"
+
+	// ReplyEnvelope envelope command of the command responses
+	ReplyEnvelope = "reply"
+	// MessageEnvelope envelope command of the nats messages
+	MessageEnvelope = "message"
+	// NoticeEnvelope envelope command of the notices
+	NoticeEnvelope = "notice"
+	// ErrorEnvelope envelope command of the error responses and of the frames that couldn't be decoded
+	ErrorEnvelope = "error"
+)
+
+// ErrMalformedEnvelope the frame isn't a valid protobuf Envelope
+var ErrMalformedEnvelope = errors.New("malformed envelope")
+
+// Envelope frame of the clients with a codec, see envelope.proto
+type Envelope struct {
+	Command string
+	Topic   string
+	Payload []byte
+	// Error code of the error envelopes, e.g. invalid_topic
+	Error string
+	// ID id of the command, echoed in its reply
+	ID uint64
+}
+
+// Codec translates the frames of a connection from and to envelopes
+type Codec interface {
+	// FrameType websocket message type of the frames
+	FrameType() int
+	// Decode unmarshal a frame
+	Decode(frame []byte) (Envelope, error)
+	// Encode marshal a response, message or notice
+	Encode(envelope Envelope) []byte
+}
+
+// ProtobufCodec codec of the protobuf Envelope frames
+type ProtobufCodec struct{}
+
+// FrameType protobuf envelopes are sent in binary frames
+func (ProtobufCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+// Decode unmarshal the envelope
+func (ProtobufCodec) Decode(frame []byte) (Envelope, error) {
+	return UnmarshalEnvelope(frame)
+}
+
+// Encode marshal the envelope
+func (ProtobufCodec) Encode(envelope Envelope) []byte {
+	return MarshalEnvelope(envelope)
+}
+
+// MarshalEnvelope encode the envelope in the protobuf wire format
+func MarshalEnvelope(envelope Envelope) []byte {
+	frame := []byte{}
+	frame = appendField(frame, 1, []byte(envelope.Command))
+	frame = appendField(frame, 2, []byte(envelope.Topic))
+	frame = appendField(frame, 3, envelope.Payload)
+	frame = appendField(frame, 4, []byte(envelope.Error))
+	if envelope.ID != 0 {
+		frame = appendVarint(frame, 5<<3)
+		frame = appendVarint(frame, envelope.ID)
+	}
+	return frame
+}
+
+func appendVarint(frame []byte, value uint64) []byte {
+	varint := make([]byte, binary.MaxVarintLen64)
+	return append(frame, varint[:binary.PutUvarint(varint, value)]...)
+}
+
+// appendField append a length delimited field, omitted if empty as in proto3
+func appendField(frame []byte, number uint64, value []byte) []byte {
+	if len(value) == 0 {
+		return frame
+	}
+
+	frame = appendVarint(frame, number<<3|2)
+	frame = appendVarint(frame, uint64(len(value)))
+	return append(frame, value...)
+}
+
+// UnmarshalEnvelope decode the envelope from the protobuf wire format. Unknown fields are skipped
+func UnmarshalEnvelope(frame []byte) (envelope Envelope, err error) {
+	for len(frame) > 0 {
+		key, n := binary.Uvarint(frame)
+		if n <= 0 {
+			return envelope, ErrMalformedEnvelope
+		}
+		frame = frame[n:]
+
+		var value []byte
+		switch key & 7 {
+		case 0: // varint
+			number, n := binary.Uvarint(frame)
+			if n <= 0 {
+				return envelope, ErrMalformedEnvelope
+			}
+			frame = frame[n:]
+			if key>>3 == 5 {
+				envelope.ID = number
+			}
+			continue
+		case 1: // 64-bit
+			if len(frame) < 8 {
+				return envelope, ErrMalformedEnvelope
+			}
+			frame = frame[8:]
+			continue
+		case 5: // 32-bit
+			if len(frame) < 4 {
+				return envelope, ErrMalformedEnvelope
+			}
+			frame = frame[4:]
+			continue
+		case 2: // length delimited
+			length, n := binary.Uvarint(frame)
+			if n <= 0 || uint64(len(frame)-n) < length {
+				return envelope, ErrMalformedEnvelope
+			}
+			value = frame[n : n+int(length)]
+			frame = frame[n+int(length):]
+		default:
+			return envelope, ErrMalformedEnvelope
+		}
+
+		switch key >> 3 {
+		case 1:
+			envelope.Command = string(value)
+		case 2:
+			envelope.Topic = string(value)
+		case 3:
+			envelope.Payload = value
+		case 4:
+			envelope.Error = string(value)
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package websocketnats
+
+import (
+	"bytes"
+)
+
+const (
+	// PublishPrefix publish a message to nats, e.g. publish>:<subject>:<payload>. Replies publish>:<subject>:ok or publish>:<subject>:<error>
+	PublishPrefix = "publish>:"
+)
+
+// canPublish check if the subject matches one of the Config.PublishTopics patterns and is within the namespaces of the connection
+func (w *NatsWebSocket) canPublish(connection *Connection, subject string) bool {
+	if hasWildcard(subject) || !connection.AllowsTopic(subject) {
+		return false
+	}
+
+	for _, pattern := range w.liveConfig().PublishTopics {
+		if matchSubject(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish publish the payload of the logged in connection to the allow-listed subject
+func (w *NatsWebSocket) publish(connection *Connection, message []byte) {
+	arguments := bytes.SplitN(message, []byte(":"), 2)
+	if len(arguments) != 2 || len(arguments[0]) == 0 {
+		connection.Reply([]byte("invalid publish"))
+		return
+	}
+
+	subject := string(arguments[0])
+	if !w.canPublish(connection, subject) {
+		connection.Logf("publish rejected: subject %.64q not allowed", subject)
+		connection.Reply([]byte(PublishPrefix + subject + ":forbidden"))
+		return
+	}
+
+	if !w.IsReady() {
+		connection.Reply([]byte(PublishPrefix + subject + ":" + NatsUnavailable))
+		return
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		connection.Reply([]byte(PublishPrefix + subject + ":" + NatsUnavailable))
+		return
+	}
+	defer w.natsPool.Put(busClient)
+
+	if err := busClient.Publish(subject, arguments[1]); err != nil {
+		connection.Logf("publish to %s: %v", subject, err)
+		connection.Reply([]byte(PublishPrefix + subject + ":error"))
+		return
+	}
+
+	w.metrics.Counter("gateway_client_publishes_total", "Messages published to nats by the clients").Inc()
+	connection.Reply([]byte(PublishPrefix + subject + ":ok"))
+}
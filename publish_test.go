@@ -0,0 +1,18 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanPublish(t *T) {
+	w := New(&Config{PublishTopics: []string{"chat.>"}})
+	connection := NewConnection(1, nil)
+
+	assert.True(t, w.canPublish(connection, "chat.room.1"))
+	assert.False(t, w.canPublish(connection, "orders.created"))
+
+	connection.setNamespaces([]string{"chat.room.2"})
+	assert.False(t, w.canPublish(connection, "chat.room.1"))
+}
@@ -0,0 +1,157 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"strings"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultUserPushSubject default subject pattern of the messages to a user, see Config.UserPushSubject
+	DefaultUserPushSubject = "user.*.push"
+)
+
+const (
+	// DeviceDelivered the message was written to the connection of the device
+	DeviceDelivered = "delivered"
+	// DeviceQueued the connection of the device is backed up, the message waits in its deferred queue behind the earlier ones
+	DeviceQueued = "queued"
+	// DeviceFailed the message couldn't be sent to the device, see DeviceDelivery.Reason
+	DeviceFailed = "failed"
+
+	// closedReason the connection of the device was closed meanwhile
+	closedReason = "closed"
+)
+
+// DeviceDelivery result of the delivery of a message to a device of a user
+type DeviceDelivery struct {
+	DeviceID     DeviceID     `json:"deviceId"`
+	ConnectionID ConnectionID `json:"connectionId"`
+	Status       string       `json:"status"`
+	// Reason why the delivery failed, e.g. closed or the write error
+	Reason string `json:"reason,omitempty"`
+}
+
+// SendToUser send the message to every connected device of the user. Returns the result of each device, none if the
+// user is offline on this instance, so the notification services fall back to another channel, e.g. push or email,
+// for the devices the message didn't reach
+func (w *NatsWebSocket) SendToUser(userID UserID, data []byte) []DeviceDelivery {
+	connections := w.connections.ListUserConnections(userID)
+	results := make([]DeviceDelivery, 0, len(connections))
+	for _, connection := range connections {
+		results = append(results, connection.push(data))
+	}
+	return results
+}
+
+// SendToUserAsync send the message to every connected device of the user without blocking the caller, the callback
+// getting the result of each device, see SendToUser
+func (w *NatsWebSocket) SendToUserAsync(userID UserID, data []byte, callback func(results []DeviceDelivery)) {
+	go func() {
+		results := w.SendToUser(userID, data)
+		if callback != nil {
+			callback(results)
+		}
+	}()
+}
+
+// push write the pushed message, queued behind the deferred messages if any so the order is kept
+func (c *Connection) push(data []byte) DeviceDelivery {
+	connectionID, _, deviceID := c.GetInfo()
+	result := DeviceDelivery{DeviceID: deviceID, ConnectionID: connectionID, Status: DeviceDelivered}
+	if connectionID == -1 {
+		result.Status, result.Reason = DeviceFailed, closedReason
+		return result
+	}
+
+	c.dataMutex.Lock()
+	if c.deferred != nil {
+		c.enqueueDeferred(payload{data: data, raw: true})
+		c.dataMutex.Unlock()
+		result.Status = DeviceQueued
+		return result
+	}
+	c.dataMutex.Unlock()
+
+	if err := c.writeText(data); err != nil {
+		result.Status, result.Reason = DeviceFailed, err.Error()
+	}
+	return result
+}
+
+// userPushSubject get the subject pattern of the messages to a user and the position of the user id token
+func (w *NatsWebSocket) userPushSubject() (subject string, userToken int) {
+	subject = w.config.UserPushSubject
+	if subject == "" {
+		subject = DefaultUserPushSubject
+	}
+	for i, token := range strings.Split(subject, ".") {
+		if token == "*" {
+			return subject, i
+		}
+	}
+	return subject, -1
+}
+
+// startUserPush subscribe to the messages to a user, delivered to the connections of the user on this instance, see
+// SendToUser. The subscription lasts until the gateway stops
+func (w *NatsWebSocket) startUserPush() {
+	if w.config.DisableUserPush {
+		return
+	}
+
+	subject, userToken := w.userPushSubject()
+	if userToken < 0 {
+		w.logger.Printf("user push: subject %q has no * token for the user id", subject)
+		return
+	}
+
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		w.logger.Printf("user push: %v", err)
+		return
+	}
+
+	subscription, err := busClient.Subscribe(subject, func(msg *nats.Msg) {
+		w.onUserPush(msg, userToken)
+	})
+	if err != nil {
+		w.logger.Printf("user push: %v", err)
+		w.natsPool.Put(busClient)
+		return
+	}
+
+	go func() {
+		<-w.done
+		subscription.Unsubscribe()
+		w.natsPool.Put(busClient)
+	}()
+}
+
+// onUserPush deliver the message to the user of its subject, and reply the results of the devices if it was a request
+func (w *NatsWebSocket) onUserPush(msg *nats.Msg, userToken int) {
+	tokens := strings.Split(msg.Subject, ".")
+	if userToken >= len(tokens) {
+		return
+	}
+
+	results := w.SendToUser(UserID(tokens[userToken]), msg.Data)
+	result := "delivered"
+	if len(results) == 0 {
+		result = "offline"
+	}
+	w.metrics.Counter("gateway_user_pushes_total", "Messages published to the user push subject by result", "result", result).Inc()
+
+	if msg.Reply == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(results)
+	busClient, err := w.natsPool.Get()
+	if err != nil {
+		return
+	}
+	defer w.natsPool.Put(busClient)
+	busClient.Publish(msg.Reply, payload)
+}
@@ -0,0 +1,73 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToUser(t *T) {
+	w := New(&Config{})
+	assert.Empty(t, w.SendToUser("user", []byte("hi")))
+
+	connect := func(deviceID DeviceID) *Connection {
+		client, server := net.Pipe()
+		go discard(client)
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.Login("user", deviceID)
+		w.connections.OnLogin(connection)
+		return connection
+	}
+
+	connect("phone")
+	backedUp := connect("tablet")
+	backedUp.deferred = newFairQueue(nil)
+	connect("laptop").Close(websocket.CloseGoingAway, "")
+
+	statuses := map[DeviceID]string{}
+	results := w.SendToUser("user", []byte("hi"))
+	for _, result := range results {
+		statuses[result.DeviceID] = result.Status
+	}
+	assert.Len(t, results, 3)
+	assert.Equal(t, DeviceDelivered, statuses["phone"])
+	assert.Equal(t, DeviceQueued, statuses["tablet"])
+	// the closed connection lost its device id
+	assert.Equal(t, DeviceFailed, statuses[""])
+
+	queued, ok := backedUp.deferred.pop()
+	assert.True(t, ok)
+	assert.True(t, queued.raw)
+
+	done := make(chan []DeviceDelivery, 1)
+	w.SendToUserAsync("user", []byte("hi"), func(results []DeviceDelivery) { done <- results })
+	assert.Len(t, <-done, len(results))
+}
+
+func TestUserPush(t *T) {
+	w := New(&Config{}, WithPool(unavailablePool{}))
+	subject, userToken := w.userPushSubject()
+	assert.Equal(t, DefaultUserPushSubject, subject)
+	assert.Equal(t, 1, userToken)
+	_, userToken = New(&Config{UserPushSubject: "push.users.*"}).userPushSubject()
+	assert.Equal(t, 2, userToken)
+
+	client, server := net.Pipe()
+	received := make(chan []byte, 1)
+	go func() {
+		_, message, err := NewStreamTransport(client).ReadMessage()
+		if err == nil {
+			received <- message
+		}
+	}()
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("alice", "phone")
+	w.connections.OnLogin(connection)
+
+	w.onUserPush(&nats.Msg{Subject: "user.bob.push", Data: []byte("not for alice")}, userToken)
+	w.onUserPush(&nats.Msg{Subject: "user.alice.push", Data: []byte("hi alice")}, 1)
+	assert.Equal(t, "hi alice", string(<-received))
+}
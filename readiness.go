@@ -0,0 +1,68 @@
+package websocketnats
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// NatsUnavailable reply to the subscription requests while nats is not connected
+	NatsUnavailable = "nats unavailable, retry later"
+
+	minNatsRetryWait = time.Second
+	maxNatsRetryWait = 30 * time.Second
+)
+
+// IsReady check if the gateway is connected to nats and can serve subscriptions
+func (w *NatsWebSocket) IsReady() bool {
+	return atomic.LoadInt32(&w.ready) == 1
+}
+
+func (w *NatsWebSocket) setReady(ready bool) {
+	var value int32
+	if ready {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&w.ready, value) != value {
+		w.logger.Printf("readiness: ready=%v", ready)
+	}
+}
+
+// connectNatsWithBackoff keep dialing nats until connected, then hand the connection to the pool and turn ready
+func (w *NatsWebSocket) connectNatsWithBackoff(pool *Pool, onReady func()) {
+	wait := minNatsRetryWait
+	for {
+		select {
+		case <-time.After(wait):
+		case <-w.done:
+			return
+		}
+
+		conn, err := pool.Dial()
+		if err != nil {
+			w.logger.Printf("nats: still unavailable, retry in %v: %v", wait, err)
+			wait *= 2
+			if wait > maxNatsRetryWait {
+				wait = maxNatsRetryWait
+			}
+			continue
+		}
+
+		pool.Put(conn)
+		w.setReady(true)
+		onReady()
+		return
+	}
+}
+
+// handleReadyz readiness probe. Unauthenticated so orchestrators can probe it
+func (w *NatsWebSocket) handleReadyz(writer http.ResponseWriter, request *http.Request) {
+	if !w.IsReady() {
+		http.Error(writer, NatsUnavailable, http.StatusServiceUnavailable)
+		return
+	}
+
+	writer.Write([]byte("ready"))
+}
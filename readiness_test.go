@@ -0,0 +1,43 @@
+package websocketnats
+
+import (
+	"errors"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectNatsWithBackoff(t *T) {
+	var reachable int32
+	pool, err := NewPoolCustom("nats://127.0.0.1:4222", 2, func(url string, options ...nats.Option) (*nats.Conn, error) {
+		if atomic.LoadInt32(&reachable) == 0 {
+			return nil, errors.New("nats unavailable")
+		}
+		return &nats.Conn{}, nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, pool.Avail())
+
+	w := New(&Config{}, WithPool(unavailablePool{}))
+	defer w.Stop()
+
+	atomic.StoreInt32(&reachable, 1)
+	ready := make(chan struct{})
+	go w.connectNatsWithBackoff(pool, func() { close(ready) })
+
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not ready once nats is reachable")
+	}
+	assert.True(t, w.IsReady())
+	// the pool keeps the connection dialed after the recovery, and the ones put back later
+	assert.Equal(t, 1, pool.Avail())
+	conn, err := pool.Get()
+	assert.Nil(t, err)
+	pool.Put(conn)
+	assert.Equal(t, 1, pool.Avail())
+}
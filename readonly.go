@@ -0,0 +1,50 @@
+package websocketnats
+
+import (
+	"bytes"
+)
+
+const (
+	// ReadOnlyResponse response of the commands refused to the read-only connections
+	ReadOnlyResponse = "read only"
+)
+
+// writeCommandPrefixes commands refused to the read-only connections
+var writeCommandPrefixes = []string{PublishPrefix, RequestPrefix}
+
+// IsReadOnly check if the connection may only subscribe, see Config.ReadOnlyRoles
+func (c *Connection) IsReadOnly() bool {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	return c.readOnly
+}
+
+// setReadOnly make the connection read-only if it holds one of the read-only roles
+func (w *NatsWebSocket) setReadOnly(connection *Connection) {
+	if len(w.config.ReadOnlyRoles) == 0 || !connection.HasAnyRole(w.config.ReadOnlyRoles) {
+		return
+	}
+
+	connection.dataMutex.Lock()
+	defer connection.dataMutex.Unlock()
+
+	connection.readOnly = true
+}
+
+// refuseReadOnly refuse the commands writing to the bus to the read-only connections. Returns true if refused
+func (w *NatsWebSocket) refuseReadOnly(connection *Connection, message []byte) bool {
+	if !connection.IsReadOnly() {
+		return false
+	}
+
+	for _, prefix := range writeCommandPrefixes {
+		if bytes.HasPrefix(message, []byte(prefix)) {
+			connection.Logf("command refused: read-only connection")
+			w.metrics.Counter("gateway_read_only_refusals_total", "Commands refused to the read-only connections").Inc()
+			connection.Reply([]byte(ReadOnlyResponse))
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *T) {
+	w := New(&Config{ReadOnlyRoles: []string{"observer"}, PublishTopics: []string{"chat.>"}})
+	connection := NewConnection(1, nil)
+	w.setReadOnly(connection)
+	assert.False(t, connection.IsReadOnly())
+
+	connection.setRoles([]string{"observer"})
+	w.setReadOnly(connection)
+	assert.True(t, connection.IsReadOnly())
+	assert.False(t, w.refuseReadOnly(connection, []byte("topic>:chat.room")))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	connection.ws = NewStreamTransport(server)
+
+	go w.onTextMessage(connection, []byte("publish>:chat.room:hello"))
+	_, message, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, ReadOnlyResponse, string(message))
+	assert.Equal(t, "read_only", replyEnvelope(message, 7).Error)
+}
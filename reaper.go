@@ -0,0 +1,66 @@
+package websocketnats
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// IdleReason close reason of the connections reaped for being idle
+	IdleReason = "Idle"
+	// reapInterval interval the idle connections are looked for
+	reapInterval = 5 * time.Second
+)
+
+// startReaper close the idle connections and the ones whose token expired every reapInterval until the gateway is
+// stopped, see reapIdleConnections and expireTokens
+func (w *NatsWebSocket) startReaper() {
+	go func() {
+		ticker := time.NewTicker(reapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				w.reapIdleConnections(now)
+				w.expireTokens(now)
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// reapIdleConnections close the logged in connections without a frame or a pong for Config.IdleTimeout, and the anonymous
+// ones for Config.AnonymousIdleTimeout
+func (w *NatsWebSocket) reapIdleConnections(now time.Time) {
+	config := w.liveConfig()
+	idleTimeout := time.Duration(config.IdleTimeout) * time.Second
+	anonymousIdleTimeout := time.Duration(config.AnonymousIdleTimeout) * time.Second
+	if anonymousIdleTimeout == 0 {
+		anonymousIdleTimeout = UnLoggedConnectionTimeout * time.Second
+	}
+
+	for _, connection := range w.connections.ListConnections() {
+		idle := now.Sub(connection.lastActivity())
+		if connection.IsLoggedIn() {
+			if idleTimeout > 0 && idle > idleTimeout {
+				w.reap(connection, "logged_in", idle)
+			}
+			continue
+		}
+
+		if anonymousIdleTimeout > 0 && idle > anonymousIdleTimeout {
+			w.reap(connection, "anonymous", idle)
+		}
+	}
+}
+
+// reap unregister and close the idle connection
+func (w *NatsWebSocket) reap(connection *Connection, state string, idle time.Duration) {
+	w.metrics.Counter("gateway_idle_connections_reaped_total", "Connections closed for being idle, by login state", "state", state).Inc()
+	connection.Logf("idle for %s, closing", idle.Round(time.Second))
+	w.disconnect(connection, websocket.CloseGoingAway, IdleReason)
+}
@@ -0,0 +1,48 @@
+package websocketnats
+
+import (
+	"net/http/httptest"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReapIdleConnections(t *T) {
+	gateway := New(&Config{URLPattern: "/", HeartbeatInterval: -1}, WithPool(unavailablePool{}))
+	defer gateway.Stop()
+
+	server := httptest.NewServer(gateway.Handler())
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	assert.True(t, waitFor(func() bool { return len(gateway.connections.ListConnections()) == 1 }))
+
+	// an anonymous connection idle for less than UnLoggedConnectionTimeout is kept
+	gateway.reapIdleConnections(time.Now().Add(time.Second))
+	assert.Len(t, gateway.connections.ListConnections(), 1)
+
+	gateway.reapIdleConnections(time.Now().Add(2 * UnLoggedConnectionTimeout * time.Second))
+	select {
+	case err := <-closed:
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+		assert.Contains(t, err.Error(), IdleReason)
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+	assert.True(t, waitFor(func() bool { return len(gateway.connections.ListConnections()) == 0 }))
+}
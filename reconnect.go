@@ -0,0 +1,140 @@
+package websocketnats
+
+import (
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultNatsMaxReconnects default reconnect attempts of a nats connection, retrying forever
+	DefaultNatsMaxReconnects = -1
+)
+
+// natsURL the servers the nats connections connect to, NatsServers if set, NatsAddress otherwise.
+// The connections fail over between them and the servers discovered from the cluster
+func natsURL(config *Config) string {
+	if len(config.NatsServers) > 0 {
+		return strings.Join(config.NatsServers, ",")
+	}
+	return config.NatsAddress
+}
+
+// natsReconnectOptions the reconnect options of the nats connections from the config
+func natsReconnectOptions(config *Config) []nats.Option {
+	maxReconnects := config.NatsMaxReconnects
+	if maxReconnects == 0 {
+		maxReconnects = DefaultNatsMaxReconnects
+	}
+
+	options := []nats.Option{nats.MaxReconnects(maxReconnects)}
+	if config.NatsReconnectWait > 0 {
+		options = append(options, nats.ReconnectWait(time.Duration(config.NatsReconnectWait)*time.Millisecond))
+	}
+	if config.NatsReconnectBufferSize > 0 {
+		options = append(options, nats.ReconnectBufSize(config.NatsReconnectBufferSize))
+	}
+	if config.NatsDontRandomize {
+		options = append(options, nats.DontRandomize())
+	}
+	return options
+}
+
+// onNatsDisconnect record the outage of the connection, and move its subscriptions to a connected pooled connection if
+// the pool has one rather than waiting for it to reconnect, see rebalance
+func (w *NatsWebSocket) onNatsDisconnect(conn *nats.Conn) {
+	w.outages.down(conn)
+
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	if w.subscriptionConns == nil || w.natsPool.Healthy() == 0 {
+		return
+	}
+	w.rebalance(nil)
+}
+
+// onNatsClosed move the subscriptions of a nats connection closed for good, e.g. after exhausting its reconnects,
+// to other pooled connections, and notify their subscribers of the gap
+func (w *NatsWebSocket) onNatsClosed(conn *nats.Conn) {
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+
+	if w.subscriptionConns == nil {
+		return
+	}
+	w.rebalance(conn)
+}
+
+// rebalance move the subscriptions of the subscription connections down to connected pooled connections, see
+// SubscriptionConnections.Rebalance, and those of the closed connection if it was already replaced
+func (w *NatsWebSocket) rebalance(closed *nats.Conn) {
+	replaced := w.subscriptionConns.Rebalance()
+	if closed != nil && !containsConn(replaced, closed) {
+		replaced = append(replaced, closed)
+	}
+
+	for _, conn := range replaced {
+		w.moveSubscriptions(conn)
+		w.natsPool.Put(conn)
+	}
+}
+
+// moveSubscriptions move the subscriptions made on the nats connection to the connection replacing it, and notify their
+// subscribers of the gap
+func (w *NatsWebSocket) moveSubscriptions(conn *nats.Conn) {
+	// the consumers keep the stream messages, the stream subscriptions don't miss any
+	if w.jetstream != nil {
+		if failed := w.jetstream.Resubscribe(conn); failed > 0 {
+			w.logger.Printf("nats: %d stream subscriptions couldn't be moved off a connection down", failed)
+		}
+	}
+	if failed := w.callbacks.Resubscribe(conn, w.subscriptionConns); failed > 0 {
+		w.logger.Printf("nats: %d topic callbacks couldn't be moved off a connection down", failed)
+	}
+
+	from, disconnected := w.outages.up(conn)
+	affected := w.affectedBy(conn)
+	if len(affected) == 0 {
+		return
+	}
+
+	failed := 0
+	if w.subscriptions != nil {
+		failed += w.subscriptions.Resubscribe(conn)
+	}
+	if w.ordered != nil {
+		failed += w.ordered.Resubscribe(conn)
+	}
+	if w.merged != nil {
+		failed += w.merged.Resubscribe(conn)
+	}
+
+	w.logger.Printf("nats: connection down, resubscribed the topics of %d connections, %d subscriptions failed", len(affected), failed)
+	w.metrics.Counter("gateway_nats_resubscriptions_total", "Nats connections down whose subscriptions were moved to another connection").Inc()
+	if failed > 0 {
+		w.metrics.Counter("gateway_nats_resubscription_failures_total", "Subscriptions that couldn't be moved off a nats connection down").Add(float64(failed))
+	}
+
+	if !disconnected {
+		from = time.Now()
+	}
+	w.sendGaps(affected, from, time.Now())
+}
+
+// containsConn check if the nats connection is one of conns
+func containsConn(conns []*nats.Conn, conn *nats.Conn) bool {
+	for _, candidate := range conns {
+		if candidate == conn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNatsReconnectOptions(t *T) {
+	options := nats.GetDefaultOptions()
+	for _, option := range natsReconnectOptions(&Config{}) {
+		option(&options)
+	}
+	assert.Equal(t, DefaultNatsMaxReconnects, options.MaxReconnect)
+	assert.Equal(t, nats.DefaultReconnectWait, options.ReconnectWait)
+
+	options = nats.GetDefaultOptions()
+	for _, option := range natsReconnectOptions(&Config{NatsMaxReconnects: 5, NatsReconnectWait: 500, NatsReconnectBufferSize: 1024}) {
+		option(&options)
+	}
+	assert.Equal(t, 5, options.MaxReconnect)
+	assert.Equal(t, 500*time.Millisecond, options.ReconnectWait)
+	assert.Equal(t, 1024, options.ReconnectBufSize)
+}
+
+func TestNatsURL(t *T) {
+	assert.Equal(t, "nats://a:4222", natsURL(&Config{NatsAddress: "nats://a:4222"}))
+	assert.Equal(t, "nats://b:4222,nats://c:4222", natsURL(&Config{NatsAddress: "nats://a:4222", NatsServers: []string{"nats://b:4222", "nats://c:4222"}}))
+}
@@ -0,0 +1,28 @@
+package websocketnats
+
+const (
+	// SubscribeRedirectedNotice the topic is served by the gateways of another region, whose endpoint is given in url
+	SubscribeRedirectedNotice = "subscribe_redirected"
+	// RegionCode the topic is not served in the region of this instance
+	RegionCode = "region"
+)
+
+// servesRegion check if the topic is served by this instance, i.e. the topic is not restricted to regions or Config.Region is one of them
+func (w *NatsWebSocket) servesRegion(policy TopicConfig) bool {
+	return len(policy.Regions) == 0 || contains(policy.Regions, w.config.Region)
+}
+
+// redirectRegion send the client the endpoint of the first region serving the topic that has one
+func (w *NatsWebSocket) redirectRegion(connection *Connection, topic string, policy TopicConfig) {
+	notice := Notice{Type: SubscribeRedirectedNotice, Code: RegionCode, Topic: topic}
+	for _, region := range policy.Regions {
+		if endpoint := w.config.RegionEndpoints[region]; endpoint != "" {
+			notice.Region = region
+			notice.URL = endpoint
+			break
+		}
+	}
+
+	w.metrics.Counter("gateway_region_redirects_total", "Subscriptions redirected to the gateways of another region", "region", notice.Region).Inc()
+	connection.ReplyNotice(notice)
+}
@@ -0,0 +1,27 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionRedirect(t *T) {
+	w := New(&Config{
+		Region:          "eu",
+		RegionEndpoints: map[string]string{"us": "wss://us.gateway.example.com/"},
+	})
+	assert.True(t, w.servesRegion(TopicConfig{Pattern: "news"}))
+	assert.True(t, w.servesRegion(TopicConfig{Pattern: "news", Regions: []string{"eu", "us"}}))
+	assert.False(t, w.servesRegion(TopicConfig{Pattern: "news", Regions: []string{"us"}}))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := NewConnection(1, NewStreamTransport(server))
+
+	go w.redirectRegion(connection, "orders.us", TopicConfig{Pattern: "orders.us", Regions: []string{"ap", "us"}})
+	_, message, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `notice>:{"type":"subscribe_redirected","code":"region","topic":"orders.us","url":"wss://us.gateway.example.com/","region":"us"}`, string(message))
+}
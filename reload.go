@@ -0,0 +1,121 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ConfigLoader load the config to reload on SIGHUP or on the /reload admin endpoint, e.g. from the config file
+type ConfigLoader func() (*Config, error)
+
+// errNoConfigLoader no config loader was supplied with WithConfigLoader
+var errNoConfigLoader = errors.New("no config loader")
+
+// Reload apply the reloadable settings of the config without dropping the connections: the topics, the JWKS url and the
+// limits MaxMessageSize, MaxBatchCommands, MaxPendingRequests, MaxPendingCommandsBeforeAuth, MaxUnknownCommands, the
+// read sizes, the idle timeouts, the maximum connections, the connections per user, the anonymous connections per IP and
+// the token expiry, i.e. DisableTokenExpiry, TokenExpiryGrace and TokenExpiryWarning, as well as PublishTopics and
+// RequestTopics. The existing subscriptions the new topics no longer allow are revoked, see RevokeSubscriptions. The
+// other settings require a restart
+func (w *NatsWebSocket) Reload(config *Config) error {
+	if config == nil {
+		return errors.New("no config")
+	}
+
+	w.reloadMutex.Lock()
+	defer w.reloadMutex.Unlock()
+
+	live := *w.liveConfig()
+	live.Topics = config.Topics
+	live.NatsTopics = config.NatsTopics
+	live.PublishTopics = config.PublishTopics
+	live.RequestTopics = config.RequestTopics
+	live.JWKS = config.JWKS
+	live.MaxMessageSize = config.MaxMessageSize
+	live.MaxBatchCommands = config.MaxBatchCommands
+	live.MaxPendingRequests = config.MaxPendingRequests
+	live.MaxPendingCommandsBeforeAuth = config.MaxPendingCommandsBeforeAuth
+	live.MaxUnknownCommands = config.MaxUnknownCommands
+	live.MaxReadSizeBeforeLogin = config.MaxReadSizeBeforeLogin
+	live.MaxReadSize = config.MaxReadSize
+	live.IdleTimeout = config.IdleTimeout
+	live.AnonymousIdleTimeout = config.AnonymousIdleTimeout
+	live.MaxConnectionsPerUser = config.MaxConnectionsPerUser
+	live.MaxAnonymousConnectionsPerIP = config.MaxAnonymousConnectionsPerIP
+	live.MaxConnections = config.MaxConnections
+	live.UserLimitPolicy = config.UserLimitPolicy
+	live.DisableTokenExpiry = config.DisableTokenExpiry
+	live.TokenExpiryGrace = config.TokenExpiryGrace
+	live.TokenExpiryWarning = config.TokenExpiryWarning
+
+	w.topics.SetTopics(configuredTopics(&live))
+	w.reloaded.Store(&live)
+	revoked := w.RevokeSubscriptions()
+
+	w.events.PublishPolicyChange(PolicyEvent{Config: &live})
+	w.logger.Printf("config: reloaded, %d topics, %d subscriptions revoked", len(live.Topics)+len(live.NatsTopics), revoked)
+	return nil
+}
+
+// liveConfig get the config with the reloaded settings, see Reload
+func (w *NatsWebSocket) liveConfig() *Config {
+	if config, ok := w.reloaded.Load().(*Config); ok {
+		return config
+	}
+	return w.config
+}
+
+// reloadFromLoader reload the config from the config loader
+func (w *NatsWebSocket) reloadFromLoader() error {
+	if w.configLoader == nil {
+		return errNoConfigLoader
+	}
+
+	config, err := w.configLoader()
+	if err != nil {
+		return err
+	}
+	return w.Reload(config)
+}
+
+// watchReloadSignal reload the config on SIGHUP until the gateway is stopped
+func (w *NatsWebSocket) watchReloadSignal() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-hangup:
+			if err := w.reloadFromLoader(); err != nil {
+				w.logger.Printf("config: reload failed: %v", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// handleReload admin endpoint reloading the config from the config loader on POST
+func (w *NatsWebSocket) handleReload(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := w.reloadFromLoader(); err != nil {
+		status := http.StatusInternalServerError
+		if err == errNoConfigLoader {
+			status = http.StatusNotImplemented
+		}
+		http.Error(writer, err.Error(), status)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]interface{}{"reloaded": true})
+}
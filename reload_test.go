@@ -0,0 +1,35 @@
+package websocketnats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *T) {
+	config := &Config{JWKS: "https://old/jwks.json", Topics: []TopicConfig{{Pattern: "news"}}, MaxBatchCommands: 4}
+	loaded := &Config{JWKS: "https://new/jwks.json", Topics: []TopicConfig{{Pattern: "sports"}}, MaxBatchCommands: 8, ListenInterface: ":9999"}
+	w := New(config, WithConfigLoader(func() (*Config, error) { return loaded, nil }))
+
+	_, ok := w.topics.Lookup("sports")
+	assert.False(t, ok)
+
+	recorder := httptest.NewRecorder()
+	w.handleReload(recorder, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	_, ok = w.topics.Lookup("sports")
+	assert.True(t, ok)
+	_, ok = w.topics.Lookup("news")
+	assert.False(t, ok)
+	assert.Equal(t, "https://new/jwks.json", w.liveConfig().JWKS)
+	assert.Equal(t, 8, w.liveConfig().MaxBatchCommands)
+	assert.Equal(t, "", w.liveConfig().ListenInterface)
+	assert.Equal(t, 4, config.MaxBatchCommands)
+
+	recorder = httptest.NewRecorder()
+	New(&Config{}).handleReload(recorder, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
@@ -0,0 +1,143 @@
+package websocketnats
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// RequestPrefix request a nats service, e.g. request>:<id>:<subject>:<payload>. The reply is sent as reply>:<id>:<reply>,
+	// the failures as request>:<id>:<error>, the id being chosen by the client to correlate them
+	RequestPrefix = "request>:"
+	// RequestReplyPrefix prefix of the replies of the requests
+	RequestReplyPrefix = "reply>:"
+	// RequestEnvelope envelope command of the requests, the topic being the subject. The reply envelope carries the id of the request
+	RequestEnvelope = "request"
+
+	// DefaultRequestTimeout default timeout in milliseconds of the requests
+	DefaultRequestTimeout = 5000
+	// DefaultMaxPendingRequests default number of requests a connection may have waiting for their reply
+	DefaultMaxPendingRequests = 16
+)
+
+// requestResponder send the reply of a request to the client, or the failure if not empty
+type requestResponder func(reply []byte, failure string)
+
+// canRequest check if the subject matches one of the Config.RequestTopics patterns and is within the namespaces of the connection
+func (w *NatsWebSocket) canRequest(connection *Connection, subject string) bool {
+	if hasWildcard(subject) || !connection.AllowsTopic(subject) {
+		return false
+	}
+
+	for _, pattern := range w.liveConfig().RequestTopics {
+		if matchSubject(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// onRequest handle the request>: command of the text protocol
+func (w *NatsWebSocket) onRequest(connection *Connection, message []byte) {
+	arguments := bytes.SplitN(message, []byte(":"), 3)
+	if len(arguments) < 2 || len(arguments[0]) == 0 || len(arguments[1]) == 0 {
+		connection.Reply([]byte("invalid request"))
+		return
+	}
+
+	id := string(arguments[0])
+	payload := []byte{}
+	if len(arguments) == 3 {
+		payload = arguments[2]
+	}
+
+	w.request(connection, string(arguments[1]), payload, func(reply []byte, failure string) {
+		if failure != "" {
+			connection.SendText([]byte(RequestPrefix + id + ":" + failure))
+			return
+		}
+		connection.SendText(append([]byte(RequestReplyPrefix+id+":"), reply...))
+	})
+}
+
+// onRequestEnvelope handle the request envelope of the connections with a codec
+func (w *NatsWebSocket) onRequestEnvelope(connection *Connection, envelope Envelope) {
+	if !connection.IsLoggedIn() {
+		connection.sendEnvelope(Envelope{Command: ErrorEnvelope, Error: errorCodes["go away"], ID: envelope.ID})
+		return
+	}
+	if w.refuseReadOnly(connection, []byte(RequestPrefix)) {
+		return
+	}
+	if envelope.Topic == "" {
+		connection.sendEnvelope(Envelope{Command: ErrorEnvelope, Error: "invalid_command", ID: envelope.ID})
+		return
+	}
+
+	w.request(connection, envelope.Topic, envelope.Payload, func(reply []byte, failure string) {
+		if failure != "" {
+			connection.sendEnvelope(Envelope{Command: ErrorEnvelope, Topic: envelope.Topic, Error: errorCodes[failure], ID: envelope.ID})
+			return
+		}
+		connection.sendEnvelope(Envelope{Command: ReplyEnvelope, Topic: envelope.Topic, Payload: reply, ID: envelope.ID})
+	})
+}
+
+// request send the request of the logged in connection to the allow-listed subject, responding asynchronously once replied
+func (w *NatsWebSocket) request(connection *Connection, subject string, payload []byte, respond requestResponder) {
+	if !w.canRequest(connection, subject) {
+		connection.Logf("request rejected: subject %.64q not allowed", subject)
+		respond(nil, "forbidden")
+		return
+	}
+
+	if !w.IsReady() {
+		respond(nil, NatsUnavailable)
+		return
+	}
+
+	maxPending := w.liveConfig().MaxPendingRequests
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPendingRequests
+	}
+	pending := atomic.AddInt64(&connection.rpcInFlight, 1)
+	if pending > int64(maxPending) {
+		atomic.AddInt64(&connection.rpcInFlight, -1)
+		respond(nil, "too many requests")
+		return
+	}
+	connection.checkSoftLimit(PendingRequestsLimit, "", int(pending), maxPending)
+
+	timeout := time.Duration(w.config.RequestTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout * time.Millisecond
+	}
+
+	go func() {
+		defer atomic.AddInt64(&connection.rpcInFlight, -1)
+
+		busClient, err := w.natsPool.Get()
+		if err != nil {
+			respond(nil, NatsUnavailable)
+			return
+		}
+		defer w.natsPool.Put(busClient)
+
+		start := time.Now()
+		msg, err := busClient.Request(subject, payload, timeout)
+		w.metrics.Histogram("gateway_client_request_seconds", "Latency of the requests of the clients to the nats services", DefaultLatencyBuckets).Observe(time.Since(start).Seconds())
+
+		switch {
+		case err == nats.ErrTimeout:
+			respond(nil, "timeout")
+		case err != nil:
+			connection.Logf("request to %s: %v", subject, err)
+			respond(nil, "error")
+		default:
+			respond(msg.Data, "")
+		}
+	}()
+}
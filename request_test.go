@@ -0,0 +1,33 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanRequest(t *T) {
+	w := New(&Config{RequestTopics: []string{"rpc.>"}})
+	connection := NewConnection(1, nil)
+
+	assert.True(t, w.canRequest(connection, "rpc.users.get"))
+	assert.False(t, w.canRequest(connection, "rpc.*"))
+	assert.False(t, w.canRequest(connection, "orders.created"))
+}
+
+func TestRequestForbidden(t *T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	w := New(&Config{RequestTopics: []string{"rpc.>"}})
+	connection := NewConnection(1, NewStreamTransport(server))
+
+	go w.onRequest(connection, []byte("7:orders.created:{}"))
+	_, message, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "request>:7:forbidden", string(message))
+
+	go w.onRequest(connection, []byte("7"))
+	_, message, _ = NewStreamTransport(client).ReadMessage()
+	assert.Equal(t, "invalid request", string(message))
+}
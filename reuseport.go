@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package websocketnats
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// listenReusePort open the sockets listening on the address with SO_REUSEPORT, the kernel balancing the incoming
+// connections between them
+func listenReusePort(address string, sockets int) ([]net.Listener, error) {
+	config := net.ListenConfig{
+		Control: func(network, address string, conn syscall.RawConn) error {
+			var err error
+			if controlErr := conn.Control(func(fd uintptr) {
+				err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			}); controlErr != nil {
+				return controlErr
+			}
+			return err
+		},
+	}
+
+	listeners := make([]net.Listener, 0, sockets)
+	for i := 0; i < sockets; i++ {
+		listener, err := config.Listen(context.Background(), "tcp", address)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		// the next sockets share the port picked for the first one, e.g. with port 0
+		address = listener.Addr().String()
+	}
+	return listeners, nil
+}
@@ -0,0 +1,7 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package websocketnats
+
+// soReusePort SO_REUSEPORT socket option, missing from the syscall package
+const soReusePort = 0x200
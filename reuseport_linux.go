@@ -0,0 +1,4 @@
+package websocketnats
+
+// soReusePort SO_REUSEPORT socket option, missing from the syscall package
+const soReusePort = 0xf
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package websocketnats
+
+import (
+	"errors"
+	"net"
+)
+
+// listenReusePort SO_REUSEPORT is not supported on this platform
+func listenReusePort(address string, sockets int) ([]net.Listener, error) {
+	return nil, errors.New("listenSockets: SO_REUSEPORT not supported on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenReusePort(t *T) {
+	listeners, err := listenReusePort("127.0.0.1:0", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(listeners))
+	for _, listener := range listeners {
+		assert.Equal(t, listeners[0].Addr().String(), listener.Addr().String())
+		listener.Close()
+	}
+}
@@ -0,0 +1,61 @@
+package websocketnats
+
+const (
+	// SubscriptionRevokedNotice a subscription was dropped because the connection lost the access to its topic
+	SubscriptionRevokedNotice = "subscription_revoked"
+	// RevokedSessionEvent the gateway dropped a subscription of the connection
+	RevokedSessionEvent = "revoked"
+)
+
+// SetUserRoles replace the roles of the connections of the user, e.g. after an admin changed them, and revoke the
+// subscriptions the new roles no longer allow. Returns the number of revoked subscriptions
+func (w *NatsWebSocket) SetUserRoles(userID UserID, roles []string) int {
+	revoked := 0
+	for _, connection := range w.connections.ListUserConnections(userID) {
+		connection.setRoles(roles)
+		revoked += w.revokeSubscriptions(connection)
+	}
+	return revoked
+}
+
+// RevokeSubscriptions revoke on every connection the subscriptions the topic policies no longer allow, e.g. after Reload
+// restricted a topic to other roles or removed it. Returns the number of revoked subscriptions
+func (w *NatsWebSocket) RevokeSubscriptions() int {
+	revoked := 0
+	for _, connection := range w.connections.ListConnections() {
+		revoked += w.revokeSubscriptions(connection)
+	}
+	return revoked
+}
+
+// revokeSubscriptions unsubscribe the connection from the topics it may no longer subscribe to, and notify it with a
+// SubscriptionRevokedNotice per topic
+func (w *NatsWebSocket) revokeSubscriptions(connection *Connection) int {
+	revoked := 0
+	for _, topic := range connection.GetTopics() {
+		if isGatewayTopic(topic) || w.allowsSubscription(connection, topic) {
+			continue
+		}
+
+		// unsubscribed meanwhile
+		if connection.RemoveSubscription(topic) == nil {
+			continue
+		}
+		w.releaseTopic(connection, topic, false)
+		revoked++
+
+		w.metrics.Counter("gateway_subscriptions_revoked_total", "Subscriptions dropped after the connection lost the access to their topic").Inc()
+		connection.Logf("subscription to %.64q revoked", topic)
+		connection.SendNotice(Notice{Type: SubscriptionRevokedNotice, Code: "Forbidden", Topic: topic})
+		w.sendSessionEvent(connection, GatewayMessage{Event: RevokedSessionEvent, EventTopic: topic})
+	}
+	return revoked
+}
+
+// allowsSubscription check if the connection may still be subscribed to the topic, as on subscribe
+func (w *NatsWebSocket) allowsSubscription(connection *Connection, topic string) bool {
+	if _, ok := w.topicPolicy(connection, topic); !ok {
+		return false
+	}
+	return w.isTemporaryTopic(topic) || connection.AllowsTopic(topic)
+}
@@ -0,0 +1,47 @@
+package websocketnats
+
+import (
+	"net"
+	"strings"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevokeSubscriptions(t *T) {
+	w := New(&Config{Topics: []TopicConfig{{Pattern: "dash.>", Roles: []string{"admin"}}, {Pattern: "news"}}})
+
+	client, server := net.Pipe()
+	notices := make(chan string, 8)
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			n, err := client.Read(buffer)
+			if err != nil {
+				return
+			}
+			notices <- string(buffer[:n])
+		}
+	}()
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("user", "phone")
+	w.connections.OnLogin(connection)
+	connection.setRoles([]string{"admin"})
+	connection.AddSubscription("dash.sales", nil)
+	connection.AddSubscription("news", nil)
+
+	assert.Equal(t, 0, w.RevokeSubscriptions())
+
+	// the role change drops the subscription to the restricted topic only
+	assert.Equal(t, 1, w.SetUserRoles("user", nil))
+	assert.False(t, connection.IsSubscribed("dash.sales"))
+	assert.True(t, connection.IsSubscribed("news"))
+	notice := <-notices
+	assert.True(t, strings.Contains(notice, SubscriptionRevokedNotice))
+	assert.True(t, strings.Contains(notice, "dash.sales"))
+
+	// so does a reload removing the topic
+	assert.Nil(t, w.Reload(&Config{Topics: []TopicConfig{{Pattern: "dash.>", Roles: []string{"admin"}}}}))
+	assert.False(t, connection.IsSubscribed("news"))
+	assert.True(t, strings.Contains(<-notices, `"topic":"news"`))
+}
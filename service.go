@@ -0,0 +1,181 @@
+package websocketnats
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ServicePrefix privileged service login prefix, e.g. service>:<service token>
+	ServicePrefix = "service>:"
+	// PushPrefix push a message to all the connections of a user, e.g. push>:<user id>:<payload>. Replies push>:<user id>:<delivered count>
+	PushPrefix = "push>:"
+	// PresencePrefix query the presence of a user, e.g. presence>:<user id>. Replies presence>:<user id>:<connection count>
+	PresencePrefix = "presence>:"
+	// EventsPrefix subscribe to the gateway events, e.g. events>:. Events are then sent as event>:<json GatewayEvent>
+	EventsPrefix = "events>:"
+	// EventPrefix gateway event prefix
+	EventPrefix = "event>:"
+
+	// ServiceUserID reserved user id of the privileged service connections
+	ServiceUserID UserID = "$service"
+)
+
+const (
+	// LoginEvent a user device logged in
+	LoginEvent = "login"
+	// LogoutEvent a user device disconnected
+	LogoutEvent = "logout"
+)
+
+// GatewayEvent event about the connections of the gateway sent to the subscribed services
+type GatewayEvent struct {
+	Type         string       `json:"type"`
+	InstanceID   string       `json:"instanceId"`
+	ConnectionID ConnectionID `json:"connectionId"`
+	UserID       UserID       `json:"userId"`
+	DeviceID     DeviceID     `json:"deviceId"`
+	Time         int64        `json:"time"`
+}
+
+// EventSubscribers connections subscribed to the gateway events
+type EventSubscribers struct {
+	mutex       sync.RWMutex
+	connections map[*Connection]struct{}
+}
+
+// NewEventSubscribers init event subscribers
+func NewEventSubscribers() *EventSubscribers {
+	return &EventSubscribers{
+		mutex:       sync.RWMutex{},
+		connections: make(map[*Connection]struct{}),
+	}
+}
+
+// Add subscribe the connection
+func (s *EventSubscribers) Add(connection *Connection) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.connections[connection] = struct{}{}
+}
+
+// Remove unsubscribe the connection
+func (s *EventSubscribers) Remove(connection *Connection) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.connections, connection)
+}
+
+// Send send the event to all the subscribed connections
+func (s *EventSubscribers) Send(event GatewayEvent) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if len(s.connections) == 0 {
+		return
+	}
+
+	payload, _ := json.Marshal(event)
+	for connection := range s.connections {
+		connection.SendText(append([]byte(EventPrefix), payload...))
+	}
+}
+
+// IsService check if the connection is logged in as a privileged service
+func (c *Connection) IsService() bool {
+	_, userID, _ := c.GetInfo()
+	return userID == ServiceUserID
+}
+
+func (w *NatsWebSocket) emitEvent(eventType string, connectionID ConnectionID, userID UserID, deviceID DeviceID) {
+	if userID == "" || userID == ServiceUserID {
+		return
+	}
+
+	w.eventSubscribers.Send(GatewayEvent{
+		Type:         eventType,
+		InstanceID:   w.instanceID,
+		ConnectionID: connectionID,
+		UserID:       userID,
+		DeviceID:     deviceID,
+		Time:         time.Now().Unix(),
+	})
+}
+
+// serviceLogin login the connection as a privileged service if the token is one of Config.ServiceTokens
+func (w *NatsWebSocket) serviceLogin(connection *Connection, token []byte) {
+	authorized := false
+	for _, serviceToken := range w.config.ServiceTokens {
+		if serviceToken != "" && subtle.ConstantTimeCompare([]byte(serviceToken), token) == 1 {
+			authorized = true
+			break
+		}
+	}
+
+	if !authorized || connection.IsLoggedIn() {
+		connection.Logf("service login rejected")
+		connection.Reply([]byte(ServicePrefix + "Not Authorized"))
+		return
+	}
+
+	connectionID, _, _ := connection.GetInfo()
+	connection.Login(ServiceUserID, DeviceID(fmt.Sprintf("%s/%d", ServiceUserID, connectionID)))
+	w.connections.OnLogin(connection)
+	w.publishConnection(LoggedInEvent, connection)
+
+	connection.Reply([]byte(ServicePrefix + "ok"))
+}
+
+// onServiceMessage handle the commands reserved to the service connections. Returns false if the message is not a service command
+func (w *NatsWebSocket) onServiceMessage(connection *Connection, message []byte) bool {
+	switch {
+	case bytes.HasPrefix(message, []byte(PushPrefix)):
+		if !connection.IsService() {
+			connection.Reply([]byte("go away"))
+			return true
+		}
+
+		arguments := bytes.SplitN(message[len(PushPrefix):], []byte(":"), 2)
+		if len(arguments) != 2 {
+			connection.Reply([]byte("invalid push"))
+			return true
+		}
+
+		delivered := 0
+		for _, result := range w.SendToUser(UserID(arguments[0]), arguments[1]) {
+			if result.Status != DeviceFailed {
+				delivered++
+			}
+		}
+
+		connection.Reply([]byte(PushPrefix + string(arguments[0]) + ":" + strconv.Itoa(delivered)))
+	case bytes.HasPrefix(message, []byte(PresencePrefix)):
+		if !connection.IsService() {
+			connection.Reply([]byte("go away"))
+			return true
+		}
+
+		userID := message[len(PresencePrefix):]
+		count := len(w.connections.ListUserConnections(UserID(userID)))
+		connection.Reply([]byte(PresencePrefix + string(userID) + ":" + strconv.Itoa(count)))
+	case bytes.HasPrefix(message, []byte(EventsPrefix)):
+		if !connection.IsService() {
+			connection.Reply([]byte("go away"))
+			return true
+		}
+
+		w.eventSubscribers.Add(connection)
+		connection.Reply([]byte(EventsPrefix + "ok"))
+	default:
+		return false
+	}
+
+	return true
+}
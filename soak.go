@@ -0,0 +1,248 @@
+package websocketnats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// soakMarker prefix of the publish time embedded in the synthetic messages, in nanoseconds
+	soakMarker = "soak:"
+	// maxSoakSamples latencies kept per synthetic client for the percentiles
+	maxSoakSamples = 1000
+	// soakSettleTime time the in flight deliveries are given once the publishers stopped
+	soakSettleTime = 5 * time.Second
+)
+
+// SoakConfig scale of the soak test, see Config.Soak. Connections are spread evenly over Topics, and each of the Publishers
+// publishes Rate messages per second to a random topic for Duration seconds
+type SoakConfig struct {
+	// Connections number of synthetic clients
+	Connections int `json:"connections"`
+	// Topics number of topics the clients subscribe to
+	Topics int `json:"topics"`
+	// Publishers number of synthetic publishers
+	Publishers int `json:"publishers"`
+	// Rate messages per second of each publisher. 0 publishes as fast as possible
+	Rate int `json:"rate"`
+	// MessageSize size in bytes of the messages
+	MessageSize int `json:"messageSize"`
+	// Duration time in seconds the publishers publish
+	Duration int `json:"duration"`
+}
+
+// SoakReport allocation and latency characteristics measured by a soak test
+type SoakReport struct {
+	Connections int `json:"connections"`
+	Topics      int `json:"topics"`
+	// ConnectTime time to register and log in all the clients
+	ConnectTime time.Duration `json:"connectTime"`
+	// Published messages published, Deliveries deliveries expected and Received deliveries read by the clients
+	Published  int64 `json:"published"`
+	Deliveries int64 `json:"deliveries"`
+	Received   int64 `json:"received"`
+	// Duration time from the first publish to the last delivery read
+	Duration time.Duration `json:"duration"`
+	// Throughput deliveries read per second
+	Throughput float64 `json:"throughput"`
+	// LatencyP50, LatencyP99 and LatencyMax time from the publish to the read of the deliveries
+	LatencyP50 time.Duration `json:"latencyP50"`
+	LatencyP99 time.Duration `json:"latencyP99"`
+	LatencyMax time.Duration `json:"latencyMax"`
+	// AllocatedBytes and Allocations heap allocations of the whole test, BytesPerDelivery the allocated bytes per delivery read
+	AllocatedBytes   uint64  `json:"allocatedBytes"`
+	Allocations      uint64  `json:"allocations"`
+	BytesPerDelivery float64 `json:"bytesPerDelivery"`
+	// HeapInUse heap in use and Goroutines goroutines running with all the clients connected
+	HeapInUse  uint64 `json:"heapInUse"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// soakClient synthetic client reading its end of an in-process pipe
+type soakClient struct {
+	connection *Connection
+	conn       net.Conn
+	samples    []time.Duration
+	done       chan struct{}
+}
+
+// read read the deliveries until the pipe is closed, sampling their latency
+func (c *soakClient) read(received *int64, lastRead *int64) {
+	defer close(c.done)
+
+	transport := NewStreamTransport(c.conn)
+	for {
+		_, message, err := transport.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		now := time.Now()
+		atomic.AddInt64(received, 1)
+		atomic.StoreInt64(lastRead, now.UnixNano())
+		if len(c.samples) >= maxSoakSamples {
+			continue
+		}
+		if published, ok := parseSoakMarker(message); ok {
+			c.samples = append(c.samples, now.Sub(published))
+		}
+	}
+}
+
+// soakMessage synthetic message of the size, starting with its publish time
+func soakMessage(size int) []byte {
+	message := []byte(soakMarker + strconv.FormatInt(time.Now().UnixNano(), 10) + ":")
+	if padding := size - len(message); padding > 0 {
+		message = append(message, bytes.Repeat([]byte("x"), padding)...)
+	}
+	return message
+}
+
+// parseSoakMarker get the publish time of a synthetic message
+func parseSoakMarker(message []byte) (time.Time, bool) {
+	start := bytes.Index(message, []byte(soakMarker))
+	if start < 0 {
+		return time.Time{}, false
+	}
+	digits := message[start+len(soakMarker):]
+	end := bytes.IndexByte(digits, ':')
+	if end < 0 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(string(digits[:end]), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// Soak soak test the connection storage and the delivery of the gateway with synthetic clients and publishers, without
+// network nor nats: the clients read in-process pipes and the messages are dispatched to the subscribers of their topic
+// as the subscription multiplexer does. Meant for capacity planning, not for a gateway serving clients
+func (w *NatsWebSocket) Soak(config SoakConfig) SoakReport {
+	if config.Topics <= 0 {
+		config.Topics = 1
+	}
+	if config.Publishers <= 0 {
+		config.Publishers = 1
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	report := SoakReport{Connections: config.Connections, Topics: config.Topics}
+	var received, lastRead int64
+
+	// the subscribers of each topic, as shared by a subscription of the multiplexer
+	subscribers := make([]map[*Connection]MessageFilter, config.Topics)
+	for i := range subscribers {
+		subscribers[i] = make(map[*Connection]MessageFilter)
+	}
+
+	start := time.Now()
+	clients := make([]*soakClient, config.Connections)
+	for i := range clients {
+		client, server := net.Pipe()
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.Login(UserID(fmt.Sprintf("soak-%d", i)), "soak")
+		w.connections.OnLogin(connection)
+
+		topic := fmt.Sprintf("soak.%d", i%config.Topics)
+		connection.AddSubscription(topic, nil)
+		subscribers[i%config.Topics][connection] = nil
+
+		clients[i] = &soakClient{connection: connection, conn: client, done: make(chan struct{})}
+		go clients[i].read(&received, &lastRead)
+	}
+	report.ConnectTime = time.Since(start)
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	report.HeapInUse = memory.HeapInuse
+	report.Goroutines = runtime.NumGoroutine()
+
+	// publish
+	start = time.Now()
+	deadline := start.Add(time.Duration(config.Duration) * time.Second)
+	var wait sync.WaitGroup
+	for p := 0; p < config.Publishers; p++ {
+		wait.Add(1)
+		go func(random *rand.Rand) {
+			defer wait.Done()
+
+			var interval time.Duration
+			if config.Rate > 0 {
+				interval = time.Second / time.Duration(config.Rate)
+			}
+			for next := time.Now(); time.Now().Before(deadline); next = next.Add(interval) {
+				if delay := time.Until(next); delay > 0 {
+					time.Sleep(delay)
+				}
+
+				topic := random.Intn(config.Topics)
+				subject := fmt.Sprintf("soak.%d", topic)
+				w.dispatch(subject, subject, &nats.Msg{Subject: subject, Data: soakMessage(config.MessageSize)}, subscribers[topic])
+				atomic.AddInt64(&report.Published, 1)
+				atomic.AddInt64(&report.Deliveries, int64(len(subscribers[topic])))
+			}
+		}(rand.New(rand.NewSource(int64(p))))
+	}
+	wait.Wait()
+
+	// let the deferred deliveries settle
+	for settle := time.Now().Add(soakSettleTime); time.Now().Before(settle) && atomic.LoadInt64(&received) < report.Deliveries; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	report.Received = atomic.LoadInt64(&received)
+	if last := atomic.LoadInt64(&lastRead); last > 0 {
+		report.Duration = time.Unix(0, last).Sub(start)
+	}
+	if report.Duration > 0 {
+		report.Throughput = float64(report.Received) / report.Duration.Seconds()
+	}
+
+	for _, client := range clients {
+		w.disconnect(client.connection, websocket.CloseGoingAway, ShutdownReason)
+		client.conn.Close()
+		<-client.done
+	}
+
+	runtime.ReadMemStats(&after)
+	report.AllocatedBytes = after.TotalAlloc - before.TotalAlloc
+	report.Allocations = after.Mallocs - before.Mallocs
+	if report.Received > 0 {
+		report.BytesPerDelivery = float64(report.AllocatedBytes) / float64(report.Received)
+	}
+
+	samples := []time.Duration{}
+	for _, client := range clients {
+		samples = append(samples, client.samples...)
+	}
+	if len(samples) > 0 {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		report.LatencyP50 = samples[len(samples)/2]
+		report.LatencyP99 = samples[len(samples)*99/100]
+		report.LatencyMax = samples[len(samples)-1]
+	}
+	return report
+}
+
+// runSoak soak test the gateway with the scale of Config.Soak and log the report
+func (w *NatsWebSocket) runSoak() {
+	w.logger.Printf("soak: %d connections, %d topics, %d publishers for %ds", w.config.Soak.Connections, w.config.Soak.Topics, w.config.Soak.Publishers, w.config.Soak.Duration)
+	report, _ := json.Marshal(w.Soak(*w.config.Soak))
+	w.logger.Printf("soak: %s", report)
+}
@@ -0,0 +1,25 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoak(t *T) {
+	w := New(&Config{})
+	report := w.Soak(SoakConfig{Connections: 20, Topics: 4, Publishers: 2, Rate: 200, MessageSize: 64, Duration: 1})
+
+	assert.True(t, report.Published > 0)
+	assert.Equal(t, report.Deliveries, report.Received)
+	assert.True(t, report.Throughput > 0)
+	assert.True(t, report.LatencyP50 > 0 && report.LatencyP50 <= report.LatencyP99 && report.LatencyP99 <= report.LatencyMax)
+	assert.True(t, report.AllocatedBytes > 0)
+	assert.Empty(t, w.connections.ListConnections())
+
+	published, ok := parseSoakMarker(soakMessage(64))
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), published, time.Second)
+	assert.Len(t, soakMessage(64), 64)
+}
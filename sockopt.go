@@ -0,0 +1,77 @@
+package websocketnats
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// SocketOptions TCP options of the accepted connections, see Config.TCPKeepAlive, Config.TCPLinger and Config.TCPNoDelay
+type SocketOptions struct {
+	// KeepAlive keep-alive period, 0 keeping the default of Go, negative disabling the keep-alives
+	KeepAlive time.Duration
+	// Linger linger on close in seconds if set, 0 resetting the connection instead of leaving it in TIME_WAIT
+	Linger *int
+	// NoDelay TCP_NODELAY if set, enabled by default
+	NoDelay *bool
+}
+
+// socketOptions get the socket options of the config. Returns nil if none is set
+func (c *Config) socketOptions() *SocketOptions {
+	if c.TCPKeepAlive == 0 && c.TCPLinger == nil && c.TCPNoDelay == nil {
+		return nil
+	}
+	return &SocketOptions{
+		KeepAlive: time.Duration(c.TCPKeepAlive) * time.Second,
+		Linger:    c.TCPLinger,
+		NoDelay:   c.TCPNoDelay,
+	}
+}
+
+// apply set the options on the TCP connection
+func (o *SocketOptions) apply(conn *net.TCPConn) error {
+	if o.KeepAlive < 0 {
+		if err := conn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	} else if o.KeepAlive > 0 {
+		if err := conn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := conn.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if o.Linger != nil {
+		if err := conn.SetLinger(*o.Linger); err != nil {
+			return err
+		}
+	}
+	if o.NoDelay != nil {
+		if err := conn.SetNoDelay(*o.NoDelay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// socketOptionsListener set the socket options on the TCP connections it accepts
+type socketOptionsListener struct {
+	net.Listener
+	options *SocketOptions
+	logger  *log.Logger
+}
+
+func (l *socketOptionsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := l.options.apply(tcpConn); err != nil {
+			l.logger.Printf("socket options of %s: %v", conn.RemoteAddr(), err)
+		}
+	}
+	return conn, nil
+}
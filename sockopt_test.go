@@ -0,0 +1,31 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketOptions(t *T) {
+	assert.Nil(t, (&Config{}).socketOptions())
+
+	linger, noDelay := 0, false
+	w := New(&Config{ListenInterface: "127.0.0.1:0", TCPKeepAlive: 30, TCPLinger: &linger, TCPNoDelay: &noDelay})
+	listeners, err := w.listeners(w.config.ListenInterface)
+	assert.Nil(t, err)
+	assert.Len(t, listeners, 1)
+	defer listeners[0].Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listeners[0].Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := listeners[0].Accept()
+	assert.Nil(t, err)
+	assert.IsType(t, &net.TCPConn{}, conn)
+	conn.Close()
+}
@@ -0,0 +1,92 @@
+package websocketnats
+
+import (
+	"time"
+)
+
+const (
+	// LimitWarningNotice the client is approaching a limit, past which its messages are dropped or rejected or it is disconnected
+	LimitWarningNotice = "limit_warning"
+
+	// MessageSizeLimit the max message size of the client, see Config.MaxMessageSize
+	MessageSizeLimit = "message_size"
+	// TopicPayloadLimit the max payload of the topic, see TopicConfig.MaxPayload
+	TopicPayloadLimit = "topic_payload"
+	// TopicRateLimit the rate limit of the topic, see TopicConfig.RateLimit
+	TopicRateLimit = "topic_rate"
+	// PendingRequestsLimit the requests awaiting their reply, see Config.MaxPendingRequests
+	PendingRequestsLimit = "pending_requests"
+	// BatchCommandsLimit the commands of a frame, see Config.MaxBatchCommands
+	BatchCommandsLimit = "batch_commands"
+	// PendingCommandsLimit the commands waiting before the login, see Config.MaxPendingCommandsBeforeAuth
+	PendingCommandsLimit = "pending_commands"
+
+	// DefaultLimitWarningInterval default time in seconds between two warnings of the same limit to a connection
+	DefaultLimitWarningInterval = 60
+)
+
+// SoftLimits thresholds, as a ratio of the hard limits, at which the clients are warned
+type SoftLimits struct {
+	ratio     float64
+	overrides map[string]float64
+	interval  time.Duration
+}
+
+// NewSoftLimits init the soft limits at ratio of every limit, overridden per limit name. A ratio of 0 disables the warnings
+func NewSoftLimits(ratio float64, overrides map[string]float64, interval time.Duration) *SoftLimits {
+	if interval <= 0 {
+		interval = DefaultLimitWarningInterval * time.Second
+	}
+
+	return &SoftLimits{
+		ratio:     ratio,
+		overrides: overrides,
+		interval:  interval,
+	}
+}
+
+// Threshold get the usage of the limit at which the clients are warned, 0 if they are not
+func (s *SoftLimits) Threshold(limit string, max int) int {
+	ratio, ok := s.overrides[limit]
+	if !ok {
+		ratio = s.ratio
+	}
+	if ratio <= 0 || ratio >= 1 || max <= 0 {
+		return 0
+	}
+
+	threshold := int(float64(max) * ratio)
+	if threshold < 1 {
+		threshold = 1
+	}
+	return threshold
+}
+
+// checkSoftLimit warn the client whose usage of the limit reached its soft threshold without exceeding it,
+// at most once per interval for each limit and topic
+func (c *Connection) checkSoftLimit(limit, topic string, usage, max int) {
+	if c == nil || c.softLimits == nil {
+		return
+	}
+
+	threshold := c.softLimits.Threshold(limit, max)
+	if threshold == 0 || usage < threshold || usage > max {
+		return
+	}
+
+	key := limit + ":" + topic
+	now := time.Now()
+
+	c.dataMutex.Lock()
+	if now.Sub(c.limitWarnings[key]) < c.softLimits.interval {
+		c.dataMutex.Unlock()
+		return
+	}
+	if c.limitWarnings == nil {
+		c.limitWarnings = make(map[string]time.Time)
+	}
+	c.limitWarnings[key] = now
+	c.dataMutex.Unlock()
+
+	c.SendNotice(Notice{Type: LimitWarningNotice, Code: limit, Topic: topic, Limit: max, Usage: usage})
+}
@@ -0,0 +1,40 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftLimitThreshold(t *T) {
+	limits := NewSoftLimits(0.8, map[string]float64{TopicRateLimit: 0.5}, 0)
+	assert.Equal(t, 80, limits.Threshold(MessageSizeLimit, 100))
+	assert.Equal(t, 5, limits.Threshold(TopicRateLimit, 10))
+	assert.Equal(t, 1, limits.Threshold(BatchCommandsLimit, 1))
+	assert.Equal(t, 0, limits.Threshold(MessageSizeLimit, 0))
+	assert.Equal(t, 0, NewSoftLimits(0, nil, 0).Threshold(MessageSizeLimit, 100))
+}
+
+func TestCheckSoftLimit(t *T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := NewConnection(1, NewStreamTransport(server))
+	connection.softLimits = NewSoftLimits(0.8, nil, time.Minute)
+
+	go func() {
+		connection.checkSoftLimit(MessageSizeLimit, "news", 50, 100)
+		connection.checkSoftLimit(MessageSizeLimit, "news", 150, 100)
+		connection.checkSoftLimit(MessageSizeLimit, "news", 90, 100)
+		connection.checkSoftLimit(MessageSizeLimit, "news", 95, 100)
+	}()
+
+	_, message, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `notice>:{"type":"limit_warning","code":"message_size","topic":"news","limit":100,"usage":90}`, string(message))
+
+	client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, _, err = NewStreamTransport(client).ReadMessage()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,44 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ConnectionsReport connection stats served on the /stats admin endpoint
+type ConnectionsReport struct {
+	Connections int `json:"connections"`
+	Users       int `json:"users"`
+	Devices     int `json:"devices"`
+	// Anonymous connections not logged in
+	Anonymous int `json:"anonymous"`
+	// Topics number of subscribers of each topic
+	Topics map[string]int `json:"topics"`
+	// Throttled messages dropped or coalesced by the outbound rate limits of the connections
+	Throttled ThrottleCounts `json:"throttled"`
+	// StartedAt unix time the gateway started at, and Uptime seconds since
+	StartedAt int64 `json:"startedAt"`
+	Uptime    int64 `json:"uptime"`
+}
+
+// GetConnectionsReport get the connection stats of the gateway
+func (w *NatsWebSocket) GetConnectionsReport() ConnectionsReport {
+	stats := w.connections.GetStats()
+	return ConnectionsReport{
+		Connections: stats.NumberOfConnections,
+		Users:       stats.NumberOfUsers,
+		Devices:     stats.NumberOfDevices,
+		Anonymous:   stats.NumberOfNotLoggedConnections,
+		Topics:      w.connections.GetTopicSubscribers(),
+		Throttled:   w.throttled.get(),
+		StartedAt:   w.startedAt.Unix(),
+		Uptime:      int64(time.Since(w.startedAt) / time.Second),
+	}
+}
+
+// handleStats stats endpoint reporting the connections, the users, the devices and the subscribers by topic
+func (w *NatsWebSocket) handleStats(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(w.GetConnectionsReport())
+}
@@ -0,0 +1,102 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// DefaultStatsPublishInterval default interval in seconds the stats are published to Config.StatsSubject
+	DefaultStatsPublishInterval = 10
+	// StatsSchemaVersion version of the StatsReport schema, bumped on incompatible changes only
+	StatsSchemaVersion = 1
+)
+
+// StatsReport stats of the gateway instance published to nats. Fields are only ever added to the schema
+type StatsReport struct {
+	Schema               int    `json:"schema"`
+	InstanceID           string `json:"instanceId"`
+	Version              string `json:"version"`
+	Ready                bool   `json:"ready"`
+	Connections          int    `json:"connections"`
+	Users                int    `json:"users"`
+	Devices              int    `json:"devices"`
+	NotLoggedConnections int    `json:"notLoggedConnections"`
+	Subscriptions        int    `json:"subscriptions"`
+	Time                 int64  `json:"time"`
+}
+
+// StatsEncoder serialize the stats reports published to nats
+type StatsEncoder interface {
+	Encode(report StatsReport) ([]byte, error)
+}
+
+// JSONStatsEncoder the default stats encoder
+type JSONStatsEncoder struct{}
+
+// Encode serialize the report as json
+func (JSONStatsEncoder) Encode(report StatsReport) ([]byte, error) {
+	return json.Marshal(report)
+}
+
+func (w *NatsWebSocket) newStatsReport() StatsReport {
+	stats := w.connections.GetStats()
+	report := StatsReport{
+		Schema:               StatsSchemaVersion,
+		InstanceID:           w.instanceID,
+		Version:              Version(),
+		Ready:                w.IsReady(),
+		Connections:          stats.NumberOfConnections,
+		Users:                stats.NumberOfUsers,
+		Devices:              stats.NumberOfDevices,
+		NotLoggedConnections: stats.NumberOfNotLoggedConnections,
+		Time:                 time.Now().Unix(),
+	}
+	if w.subscriptions != nil {
+		report.Subscriptions = w.subscriptions.Count()
+	}
+	return report
+}
+
+// publishStats periodically publish the stats report to Config.StatsSubject, if set
+func (w *NatsWebSocket) publishStats() {
+	if w.config.StatsSubject == "" {
+		return
+	}
+
+	encoder := w.statsEncoder
+	if encoder == nil {
+		encoder = JSONStatsEncoder{}
+	}
+
+	interval := time.Duration(w.config.StatsPublishInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultStatsPublishInterval * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+
+		payload, err := encoder.Encode(w.newStatsReport())
+		if err != nil {
+			w.logger.Printf("stats: %v", err)
+			continue
+		}
+
+		busClient, err := w.natsPool.Get()
+		if err != nil {
+			continue
+		}
+		if err := busClient.Publish(w.config.StatsSubject, payload); err != nil {
+			w.logger.Printf("stats: %v", err)
+		}
+		w.natsPool.Put(busClient)
+	}
+}
@@ -0,0 +1,24 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsReport(t *T) {
+	w := New(&Config{InstanceID: "gw-1"})
+	report := w.newStatsReport()
+	assert.Equal(t, StatsSchemaVersion, report.Schema)
+	assert.Equal(t, "gw-1", report.InstanceID)
+
+	payload, err := JSONStatsEncoder{}.Encode(report)
+	assert.Nil(t, err)
+
+	fields := map[string]interface{}{}
+	json.Unmarshal(payload, &fields)
+	for _, field := range []string{"schema", "instanceId", "version", "ready", "connections", "users", "devices", "notLoggedConnections", "subscriptions", "time"} {
+		assert.Contains(t, fields, field)
+	}
+}
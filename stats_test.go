@@ -0,0 +1,63 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsEndpoint(t *T) {
+	w := New(&Config{URLPattern: "/ws", AdminToken: "secret"}, WithPool(unavailablePool{}))
+	handler := w.Handler()
+
+	connect := func() *Connection {
+		client, server := net.Pipe()
+		go discard(client)
+		return w.registerConnection(NewStreamTransport(server))
+	}
+	phone := connect()
+	phone.Login("user", "phone")
+	w.connections.OnLogin(phone)
+	phone.AddSubscription("news", nil)
+	tablet := connect()
+	tablet.Login("user", "tablet")
+	w.connections.OnLogin(tablet)
+	tablet.AddSubscription("news", nil)
+	tablet.AddSubscription("sports", nil)
+	connect()
+
+	request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var report ConnectionsReport
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, 3, report.Connections)
+	assert.Equal(t, 1, report.Users)
+	assert.Equal(t, 2, report.Devices)
+	assert.Equal(t, 1, report.Anonymous)
+	assert.Equal(t, map[string]int{"news": 2, "sports": 1}, report.Topics)
+	assert.True(t, report.StartedAt > 0)
+}
+
+func TestStatsEndpointWithoutToken(t *T) {
+	w := New(&Config{URLPattern: "/ws"}, WithPool(unavailablePool{}))
+
+	recorder := httptest.NewRecorder()
+	w.adminRoutes["/stats"].ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	w.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
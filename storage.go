@@ -2,13 +2,18 @@ package websocketnats
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
+// TenantTag connection tag holding the tenant the connection is counted against, usually set by the admission controller
+const TenantTag = "tenant"
+
 //const NOT_LOGGED_LIFE_TIME = 5 * time.Second
 //const PING_TIMEOUT = 10 * time.Minute
 
 // ConnectionsStats connection status
 type ConnectionsStats struct {
+	NumberOfConnections          int
 	NumberOfUsers                int
 	NumberOfDevices              int
 	NumberOfNotLoggedConnections int
@@ -21,6 +26,14 @@ type ConnectionsStorage struct {
 	connectionsByUserID          map[UserID]map[DeviceID]*Connection
 	connectionsByDeviceID        map[DeviceID]*Connection // one connection per device
 	numberOfNotLoggedConnections int
+	// userCounts and tenantCounts are only written with the lock held, but read atomically without it
+	userCounts   sync.Map // UserID -> *int64
+	tenantCounts sync.Map // string -> *int64
+	tenants      map[*Connection]string
+	// ipCounts and anonymousIPCounts count the connections by remote ip, see SetRemoteIP
+	ipCounts          sync.Map // string -> *int64
+	anonymousIPCounts sync.Map // string -> *int64
+	ips               map[*Connection]string
 }
 
 // NewConnectionsStorage init connections storage
@@ -31,6 +44,8 @@ func NewConnectionsStorage() *ConnectionsStorage {
 		connectionsByUserID:          make(map[UserID]map[DeviceID]*Connection),
 		connectionsByDeviceID:        make(map[DeviceID]*Connection),
 		numberOfNotLoggedConnections: 0,
+		tenants:                      make(map[*Connection]string),
+		ips:                          make(map[*Connection]string),
 	}
 }
 
@@ -54,6 +69,9 @@ func (s *ConnectionsStorage) OnLogin(connection *Connection) *Connection {
 	}
 
 	s.numberOfNotLoggedConnections--
+	if ip, ok := s.ips[connection]; ok {
+		addCount(&s.anonymousIPCounts, ip, -1)
+	}
 
 	deviceConnectionBefore := s.connectionsByDeviceID[connection.deviceID]
 	if deviceConnectionBefore != nil {
@@ -68,6 +86,12 @@ func (s *ConnectionsStorage) OnLogin(connection *Connection) *Connection {
 	}
 	userConnections[deviceID] = connection
 
+	addCount(&s.userCounts, userID, 1)
+	if tenant := connection.GetTag(TenantTag); tenant != "" {
+		s.tenants[connection] = tenant
+		addCount(&s.tenantCounts, tenant, 1)
+	}
+
 	return deviceConnectionBefore
 }
 
@@ -88,17 +112,32 @@ func (s *ConnectionsStorage) removeConnection(connection *Connection) {
 
 	delete(s.connectionsByID, connectionID)
 
+	ip, tracked := s.ips[connection]
+	if tracked {
+		delete(s.ips, connection)
+		addCount(&s.ipCounts, ip, -1)
+	}
+
 	if userID == "" {
 		s.numberOfNotLoggedConnections--
+		if tracked {
+			addCount(&s.anonymousIPCounts, ip, -1)
+		}
 		return
 	}
 
 	userConnections := s.connectionsByUserID[userID]
-	if userConnections != nil {
+	if userConnections != nil && userConnections[deviceID] == connection {
 		delete(userConnections, deviceID)
 		if len(userConnections) == 0 {
 			delete(s.connectionsByUserID, userID)
 		}
+		addCount(&s.userCounts, userID, -1)
+	}
+
+	if tenant, ok := s.tenants[connection]; ok {
+		delete(s.tenants, connection)
+		addCount(&s.tenantCounts, tenant, -1)
 	}
 
 	deviceConnection := s.connectionsByDeviceID[deviceID]
@@ -107,6 +146,51 @@ func (s *ConnectionsStorage) removeConnection(connection *Connection) {
 	}
 }
 
+// addCount increment the counter of the key, dropping it once back to zero. Lock must be held
+func addCount(counts *sync.Map, key interface{}, delta int64) {
+	value, _ := counts.LoadOrStore(key, new(int64))
+	if atomic.AddInt64(value.(*int64), delta) <= 0 {
+		counts.Delete(key)
+	}
+}
+
+func loadCount(counts *sync.Map, key interface{}) int {
+	value, ok := counts.Load(key)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt64(value.(*int64)))
+}
+
+// SetRemoteIP count the connection, not logged in yet, against its remote ip
+func (s *ConnectionsStorage) SetRemoteIP(connection *Connection, ip string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.ips[connection]; ok || s.connectionsByID[connection.id] != connection || connection.IsLoggedIn() {
+		return
+	}
+	s.ips[connection] = ip
+	addCount(&s.ipCounts, ip, 1)
+	addCount(&s.anonymousIPCounts, ip, 1)
+}
+
+// CountIPConnections get the number of connections from the ip, and how many of them are not logged in yet, without
+// taking the storage lock
+func (s *ConnectionsStorage) CountIPConnections(ip string) (connections int, anonymous int) {
+	return loadCount(&s.ipCounts, ip), loadCount(&s.anonymousIPCounts, ip)
+}
+
+// CountUserConnections get the number of logged in connections of the user without taking the storage lock
+func (s *ConnectionsStorage) CountUserConnections(userID UserID) int {
+	return loadCount(&s.userCounts, userID)
+}
+
+// CountByTenant get the number of logged in connections tagged with the tenant without taking the storage lock
+func (s *ConnectionsStorage) CountByTenant(tenant string) int {
+	return loadCount(&s.tenantCounts, tenant)
+}
+
 // GetUserConnections get connections by userID
 func (s *ConnectionsStorage) GetUserConnections(userID UserID) map[DeviceID]*Connection {
 	s.mutex.RLock()
@@ -115,6 +199,33 @@ func (s *ConnectionsStorage) GetUserConnections(userID UserID) map[DeviceID]*Con
 	return s.connectionsByUserID[userID]
 }
 
+// ListUserConnections get a copy of the connections of the user, safe to iterate without holding the storage lock
+func (s *ConnectionsStorage) ListUserConnections(userID UserID) []*Connection {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	userConnections := s.connectionsByUserID[userID]
+	connections := make([]*Connection, 0, len(userConnections))
+	for _, connection := range userConnections {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+// ListUsers get the users with at least one logged in connection
+func (s *ConnectionsStorage) ListUsers() []UserID {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]UserID, 0, len(s.connectionsByUserID))
+	for userID, connections := range s.connectionsByUserID {
+		if len(connections) > 0 {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
 // GetDeviceConnection get connections by device ID
 func (s *ConnectionsStorage) GetDeviceConnection(deviceID DeviceID) *Connection {
 	s.mutex.RLock()
@@ -131,12 +242,25 @@ func (s *ConnectionsStorage) GetConnectionByID(connectionID ConnectionID) *Conne
 	return s.connectionsByID[connectionID]
 }
 
+// ListConnections get a copy of all the connections, safe to iterate without holding the storage lock
+func (s *ConnectionsStorage) ListConnections() []*Connection {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	connections := make([]*Connection, 0, len(s.connectionsByID))
+	for _, connection := range s.connectionsByID {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
 // GetStats get connection storage status
 func (s *ConnectionsStorage) GetStats() ConnectionsStats {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	stats := ConnectionsStats{
+		NumberOfConnections:          len(s.connectionsByID),
 		NumberOfDevices:              len(s.connectionsByDeviceID),
 		NumberOfUsers:                len(s.connectionsByUserID),
 		NumberOfNotLoggedConnections: s.numberOfNotLoggedConnections,
@@ -145,32 +269,25 @@ func (s *ConnectionsStorage) GetStats() ConnectionsStats {
 	return stats
 }
 
+// GetTopicSubscribers get the number of connections subscribed to each topic
+func (s *ConnectionsStorage) GetTopicSubscribers() map[string]int {
+	subscribers := make(map[string]int)
+	for _, connection := range s.ListConnections() {
+		for _, topic := range connection.GetTopics() {
+			subscribers[topic]++
+		}
+	}
+	return subscribers
+}
+
 // RemoveIf remove connection wrapped by a condition and callback
 func (s *ConnectionsStorage) RemoveIf(condition func(con *Connection) bool, afterRemove func(con *Connection)) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for id, connection := range s.connectionsByID {
+	for _, connection := range s.connectionsByID {
 		if condition(connection) {
-			_, userID, deviceID := connection.GetInfo()
-
-			delete(s.connectionsByID, id)
-
-			if deviceID != "" {
-				delete(s.connectionsByDeviceID, deviceID)
-			}
-
-			if userID != "" {
-				userConnections := s.connectionsByUserID[userID]
-				if userConnections != nil {
-					if len(userConnections) == 1 {
-						delete(s.connectionsByUserID, userID)
-					} else {
-						delete(userConnections, deviceID)
-					}
-				}
-			}
-
+			s.removeConnection(connection)
 			afterRemove(connection)
 		}
 	}
@@ -0,0 +1,43 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountConnections(t *T) {
+	// the user is set directly, Login needs a websocket
+	storage := NewConnectionsStorage()
+
+	first := NewConnection(1, nil)
+	first.SetTag(TenantTag, "acme")
+	second := NewConnection(2, nil)
+	second.SetTag(TenantTag, "acme")
+
+	for _, connection := range []*Connection{first, second} {
+		storage.AddNewConnection(connection)
+	}
+	first.userID, first.deviceID = "user", "device-1"
+	storage.OnLogin(first)
+	second.userID, second.deviceID = "user", "device-2"
+	storage.OnLogin(second)
+
+	assert.Equal(t, 2, storage.CountUserConnections("user"))
+	assert.Equal(t, 2, storage.CountByTenant("acme"))
+
+	storage.RemoveConnection(first)
+	assert.Equal(t, 1, storage.CountUserConnections("user"))
+	assert.Equal(t, 1, storage.CountByTenant("acme"))
+
+	// logging in the same device again replaces the connection
+	third := NewConnection(3, nil)
+	storage.AddNewConnection(third)
+	third.userID, third.deviceID = "user", "device-2"
+	storage.OnLogin(third)
+	assert.Equal(t, 1, storage.CountUserConnections("user"))
+	assert.Equal(t, 0, storage.CountByTenant("acme"))
+
+	storage.RemoveConnection(third)
+	assert.Equal(t, 0, storage.CountUserConnections("user"))
+}
@@ -0,0 +1,133 @@
+// Package store stores of the gateway, e.g. the claim-check store of the oversized messages
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClaimTooLarge the payload alone exceeds the max size of the claim-check store
+var ErrClaimTooLarge = errors.New("claim-check: payload exceeds the store size")
+
+// ClaimCheckStore keeps the oversized payloads and returns the url the client fetches them from
+type ClaimCheckStore interface {
+	Put(topic string, data []byte) (url string, err error)
+}
+
+// MemoryClaimCheckStore claim-check store keeping the payloads in memory until they expire, served over http.
+// It keeps at most maxBytes of payloads, the oldest ones being evicted first
+type MemoryClaimCheckStore struct {
+	mutex    sync.Mutex
+	baseURL  string
+	ttl      time.Duration
+	maxBytes int
+	size     int
+	payloads map[string]claimCheck
+	// order ids of the payloads by put time, hence by expiry
+	order []string
+}
+
+type claimCheck struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryClaimCheckStore init a claim-check store whose urls are baseURL followed by the claim id, keeping at most
+// maxBytes of payloads. 0 does not limit the size
+func NewMemoryClaimCheckStore(baseURL string, ttl time.Duration, maxBytes int) *MemoryClaimCheckStore {
+	return &MemoryClaimCheckStore{
+		mutex:    sync.Mutex{},
+		baseURL:  baseURL,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		payloads: make(map[string]claimCheck),
+	}
+}
+
+// Put keep the payload until it expires or is evicted by the newer ones
+func (s *MemoryClaimCheckStore) Put(topic string, data []byte) (string, error) {
+	if s.maxBytes > 0 && len(data) > s.maxBytes {
+		return "", ErrClaimTooLarge
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(suffix)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.maxBytes > 0 && s.size+len(data) > s.maxBytes && len(s.order) > 0 {
+		s.removeOldest()
+	}
+	s.payloads[id] = claimCheck{data: data, expires: time.Now().Add(s.ttl)}
+	s.order = append(s.order, id)
+	s.size += len(data)
+
+	return s.baseURL + id, nil
+}
+
+// Run remove the expired payloads every interval until done is closed
+func (s *MemoryClaimCheckStore) Run(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.Expire(now)
+		case <-done:
+			return
+		}
+	}
+}
+
+// Expire remove the payloads expired at now
+func (s *MemoryClaimCheckStore) Expire(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.order) > 0 && now.After(s.payloads[s.order[0]].expires) {
+		s.removeOldest()
+	}
+}
+
+// Size bytes of payloads kept
+func (s *MemoryClaimCheckStore) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.size
+}
+
+// removeOldest remove the payload put first. Lock must be held
+func (s *MemoryClaimCheckStore) removeOldest() {
+	id := s.order[0]
+	s.order[0] = ""
+	s.order = s.order[1:]
+	s.size -= len(s.payloads[id].data)
+	delete(s.payloads, id)
+}
+
+// ServeHTTP serve the payload of the claim id ending the path
+func (s *MemoryClaimCheckStore) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	id := request.URL.Path[strings.LastIndexByte(request.URL.Path, '/')+1:]
+
+	s.mutex.Lock()
+	payload, ok := s.payloads[id]
+	s.mutex.Unlock()
+
+	if !ok || time.Now().After(payload.expires) {
+		http.NotFound(writer, request)
+		return
+	}
+
+	writer.Write(payload.data)
+}
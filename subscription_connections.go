@@ -0,0 +1,121 @@
+package websocketnats
+
+import (
+	"hash/fnv"
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultSubscriptionConnections default number of nats connections the subscriptions are multiplexed over
+	DefaultSubscriptionConnections = 4
+)
+
+// SubscriptionConnections fixed set of pooled nats connections the subscriptions of the gateway are multiplexed over,
+// rather than holding a pooled connection per subject. A key, e.g. the subject, always maps to the same connection.
+// The connections are taken from the pool on first use, replaced once closed for good, and held until Close
+type SubscriptionConnections struct {
+	mutex sync.Mutex
+	pool  NatsPool
+	conns []*nats.Conn
+}
+
+// NewSubscriptionConnections init the set of size connections taken from the pool, DefaultSubscriptionConnections if
+// size is not positive
+func NewSubscriptionConnections(pool NatsPool, size int) *SubscriptionConnections {
+	if size <= 0 {
+		size = DefaultSubscriptionConnections
+	}
+
+	return &SubscriptionConnections{
+		mutex: sync.Mutex{},
+		pool:  pool,
+		conns: make([]*nats.Conn, size),
+	}
+}
+
+// Get get the connection the key subscribes on, by the hash of the key. A connection is taken from the pool if its slot
+// is empty or its connection closed
+func (s *SubscriptionConnections) Get(key string) (*nats.Conn, error) {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	slot := int(hash.Sum32() % uint32(len(s.conns)))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if conn := s.conns[slot]; conn != nil && !conn.IsClosed() {
+		return conn, nil
+	}
+
+	conn, err := s.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	s.conns[slot] = conn
+	return conn, nil
+}
+
+// Rebalance replace the connections down, i.e. disconnected or closed, by connected pooled connections. A disconnected
+// connection is only replaced if the pool has a healthy one, see NatsPool.Healthy, otherwise it keeps its subscriptions
+// until it reconnects. Returns the connections replaced, whose subscriptions are to be moved and which are to be put back
+// in the pool then
+func (s *SubscriptionConnections) Rebalance() (replaced []*nats.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, conn := range s.conns {
+		if conn == nil || conn.IsConnected() {
+			continue
+		}
+
+		replacement := s.healthy()
+		if replacement == nil && conn.IsClosed() {
+			replacement, _ = s.pool.Get()
+		}
+		if replacement == nil {
+			continue
+		}
+
+		s.conns[i] = replacement
+		replaced = append(replaced, conn)
+	}
+	return replaced
+}
+
+// healthy take a connected connection from the pool, nil if it has none. Lock must be held
+func (s *SubscriptionConnections) healthy() *nats.Conn {
+	var healthy *nats.Conn
+	skipped := []*nats.Conn{}
+	for i := s.pool.Healthy(); i > 0 && healthy == nil; i-- {
+		conn, err := s.pool.Get()
+		if err != nil {
+			break
+		}
+
+		if conn.IsConnected() {
+			healthy = conn
+		} else {
+			skipped = append(skipped, conn)
+		}
+	}
+
+	for _, conn := range skipped {
+		s.pool.Put(conn)
+	}
+	return healthy
+}
+
+// Close return the connections to the pool
+func (s *SubscriptionConnections) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, conn := range s.conns {
+		if conn != nil {
+			s.pool.Put(conn)
+			s.conns[i] = nil
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package websocketnats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	. "testing"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingPool pool handing out unconnected nats connections, counting them
+type countingPool struct {
+	gets, puts int
+}
+
+func (p *countingPool) Get() (*nats.Conn, error) {
+	p.gets++
+	return &nats.Conn{}, nil
+}
+
+func (p *countingPool) Put(conn *nats.Conn) { p.puts++ }
+func (p *countingPool) Empty()              {}
+func (p *countingPool) Avail() int          { return 0 }
+func (p *countingPool) Healthy() int        { return 0 }
+
+func TestSubscriptionConnections(t *T) {
+	pool := &countingPool{}
+	connections := NewSubscriptionConnections(pool, 2)
+
+	first, err := connections.Get("news")
+	assert.Nil(t, err)
+	again, _ := connections.Get("news")
+	assert.True(t, first == again)
+
+	for i := 0; i < 100; i++ {
+		_, err := connections.Get(fmt.Sprintf("topic.%d", i))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, pool.gets)
+
+	connections.Close()
+	assert.Equal(t, 2, pool.puts)
+
+	_, err = NewSubscriptionConnections(unavailablePool{}, 0).Get("news")
+	assert.NotNil(t, err)
+}
+
+// fakeNatsServer serve the handshake and the pings of the nats protocol, enough for the clients to connect.
+// stop closes the server and its client connections
+func fakeNatsServer(t *T) (url string, stop func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	var mutex sync.Mutex
+	conns := []net.Conn{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			conns = append(conns, conn)
+			mutex.Unlock()
+
+			go func() {
+				fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.HasPrefix(line, "PING") {
+						fmt.Fprintf(conn, "PONG\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), func() {
+		listener.Close()
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+func TestSubscriptionConnectionsRebalance(t *T) {
+	downURL, stopDown := fakeNatsServer(t)
+	upURL, stopUp := fakeNatsServer(t)
+	defer stopUp()
+
+	dials := 0
+	pool, err := NewPoolCustom(downURL, 1, func(url string, options ...nats.Option) (*nats.Conn, error) {
+		if dials++; dials > 1 {
+			url = upURL
+		}
+		return nats.Connect(url, options...)
+	})
+	assert.Nil(t, err)
+	defer pool.Empty()
+
+	connections := NewSubscriptionConnections(pool, 1)
+	down, err := connections.Get("news")
+	assert.Nil(t, err)
+	defer down.Close()
+
+	up, err := pool.Dial()
+	assert.Nil(t, err)
+	pool.Put(up)
+	assert.Equal(t, 1, pool.Healthy())
+
+	// nothing to move while connected
+	assert.Empty(t, connections.Rebalance())
+
+	stopDown()
+	assert.True(t, waitFor(func() bool { return !down.IsConnected() }))
+	assert.False(t, down.IsClosed())
+
+	assert.Equal(t, []*nats.Conn{down}, connections.Rebalance())
+	conn, err := connections.Get("news")
+	assert.Nil(t, err)
+	assert.True(t, conn == up)
+	assert.Equal(t, 0, pool.Healthy())
+
+	// a disconnected idle connection is not healthy
+	pool.Put(down)
+	assert.Equal(t, 0, pool.Healthy())
+	assert.Equal(t, 1, pool.Avail())
+}
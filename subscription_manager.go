@@ -0,0 +1,220 @@
+package websocketnats
+
+import (
+	"sync"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// SubscriptionDispatcher deliver a message of a shared subscription to the websocket subscribers of the topic, each with its filter
+type SubscriptionDispatcher func(topic, subject string, msg *nats.Msg, subscribers map[*Connection]MessageFilter)
+
+// SubscriptionManager keeps one nats subscription per subject and queue group, shared by all the websocket subscribers of the subject.
+// The subscription is made on the subscription connection of the subject when the first client subscribes, then
+// unsubscribed when the last one leaves
+type SubscriptionManager struct {
+	mutex       sync.Mutex
+	connections *SubscriptionConnections
+	dispatch    SubscriptionDispatcher
+	shared      map[string]*sharedSubscription
+	// keys key of the shared subscription of each subject a connection subscribed to
+	keys map[*Connection]map[string]string
+}
+
+type sharedSubscription struct {
+	topic        string
+	subject      string
+	queue        string
+	busClient    *nats.Conn
+	subscription *nats.Subscription
+	balance      bool
+	// subscribers copied on write, so the messages are dispatched without holding the lock
+	subscribers map[*Connection]MessageFilter
+}
+
+// NewSubscriptionManager init subscription manager
+func NewSubscriptionManager(connections *SubscriptionConnections, dispatch SubscriptionDispatcher) *SubscriptionManager {
+	return &SubscriptionManager{
+		mutex:       sync.Mutex{},
+		connections: connections,
+		dispatch:    dispatch,
+		shared:      make(map[string]*sharedSubscription),
+		keys:        make(map[*Connection]map[string]string),
+	}
+}
+
+// subscriptionKey key of the shared subscription of the subject in the queue group, spaces being invalid in subjects
+func subscriptionKey(subject, queue string) string {
+	if queue == "" {
+		return subject
+	}
+	return subject + " " + queue
+}
+
+// Subscribe add the connection to the subscribers of the subject the topic is routed to. A nil filter delivers every message.
+// A non empty queue subscribes in that nats queue group, and balance delivers each message to one of the subscribers only
+func (m *SubscriptionManager) Subscribe(connection *Connection, topic, subject, queue string, balance bool, filter MessageFilter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := subscriptionKey(subject, queue)
+	shared := m.shared[key]
+	if shared == nil {
+		busClient, err := m.connections.Get(subject)
+		if err != nil {
+			return err
+		}
+
+		shared = &sharedSubscription{
+			topic:       topic,
+			subject:     subject,
+			queue:       queue,
+			busClient:   busClient,
+			balance:     balance,
+			subscribers: make(map[*Connection]MessageFilter),
+		}
+		if err := m.subscribe(shared); err != nil {
+			return err
+		}
+		m.shared[key] = shared
+	}
+
+	if m.keys[connection] == nil {
+		m.keys[connection] = make(map[string]string)
+	}
+	m.keys[connection][subject] = key
+
+	subscribers := make(map[*Connection]MessageFilter, len(shared.subscribers)+1)
+	for subscriber, subscriberFilter := range shared.subscribers {
+		subscribers[subscriber] = subscriberFilter
+	}
+	subscribers[connection] = filter
+	shared.subscribers = subscribers
+	return nil
+}
+
+// subscribe make the nats subscription of the shared subscription on its connection
+func (m *SubscriptionManager) subscribe(shared *sharedSubscription) error {
+	subscription, err := shared.busClient.QueueSubscribe(shared.subject, shared.queue, func(msg *nats.Msg) {
+		m.mutex.Lock()
+		subscribers := shared.subscribers
+		m.mutex.Unlock()
+
+		if shared.balance {
+			subscribers = pickSubscriber(subscribers)
+		}
+		m.dispatch(shared.topic, shared.subject, msg, subscribers)
+	})
+	if err != nil {
+		return err
+	}
+
+	shared.subscription = subscription
+	return nil
+}
+
+// Resubscribe move the subscriptions made on the nats connection, closed or disconnected, to the connection replacing it.
+// Returns the number of subscriptions that couldn't be moved, whose subscribers don't get messages anymore
+func (m *SubscriptionManager) Resubscribe(conn *nats.Conn) (failed int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, shared := range m.shared {
+		if shared.busClient != conn {
+			continue
+		}
+
+		// not replayed if the connection reconnects
+		shared.subscription.Unsubscribe()
+
+		busClient, err := m.connections.Get(shared.subject)
+		if err != nil {
+			failed++
+			continue
+		}
+
+		shared.busClient = busClient
+		if err := m.subscribe(shared); err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Unsubscribe remove the connection from the subscribers of the subject. The last one leaving releases the nats subscription
+func (m *SubscriptionManager) Unsubscribe(connection *Connection, subject string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.keys[connection][subject]
+	if !ok {
+		return
+	}
+	delete(m.keys[connection], subject)
+	if len(m.keys[connection]) == 0 {
+		delete(m.keys, connection)
+	}
+
+	shared := m.shared[key]
+	if shared == nil {
+		return
+	}
+
+	if len(shared.subscribers) == 1 {
+		delete(m.shared, key)
+		shared.subscription.Unsubscribe()
+		return
+	}
+
+	subscribers := make(map[*Connection]MessageFilter, len(shared.subscribers)-1)
+	for subscriber, filter := range shared.subscribers {
+		if subscriber != connection {
+			subscribers[subscriber] = filter
+		}
+	}
+	shared.subscribers = subscribers
+}
+
+// Affected get the subscribers of the subscriptions made on the nats connection, with their topics
+func (m *SubscriptionManager) Affected(busClient *nats.Conn) map[*Connection][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	affected := make(map[*Connection][]string)
+	for _, shared := range m.shared {
+		if shared.busClient != busClient {
+			continue
+		}
+		for connection := range shared.subscribers {
+			affected[connection] = append(affected[connection], shared.topic)
+		}
+	}
+	return affected
+}
+
+// pickSubscriber pick one of the subscribers, at random by the map iteration order
+func pickSubscriber(subscribers map[*Connection]MessageFilter) map[*Connection]MessageFilter {
+	for connection, filter := range subscribers {
+		return map[*Connection]MessageFilter{connection: filter}
+	}
+	return subscribers
+}
+
+// Count get the number of live nats subscriptions
+func (m *SubscriptionManager) Count() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return len(m.shared)
+}
+
+// Subscribers get the number of websocket subscribers of the subject, outside of the queue groups
+func (m *SubscriptionManager) Subscribers(subject string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if shared := m.shared[subject]; shared != nil {
+		return len(shared.subscribers)
+	}
+	return 0
+}
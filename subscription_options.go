@@ -0,0 +1,105 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubscriptionOptions options of a subscription request, given as query string after the topic, e.g. topic>:orders?new_only=true
+type SubscriptionOptions struct {
+	// NewOnly only deliver the messages published after the subscription was established.
+	// Enforced on the timestamp field of json payloads, see Config.MessageTimestampField
+	NewOnly bool
+	// Deliver where the subscriptions bound to a stream start, DeliverAll, DeliverLast or DeliverNew, e.g. topic>:orders?deliver=last
+	Deliver string
+	// StartSequence stream sequence the subscriptions bound to a stream start from, e.g. topic>:orders?start_seq=42
+	StartSequence uint64
+	// Queue queue group the client joins, if allowed by TopicConfig.ClientQueueGroups, e.g. topic>:jobs?queue=workers
+	Queue string
+}
+
+// MessageFilter decides if a bus message is delivered to a subscriber
+type MessageFilter func(data []byte) bool
+
+// parseSubscription split the subscription request into topic and options
+func parseSubscription(request string) (string, SubscriptionOptions) {
+	options := SubscriptionOptions{}
+
+	index := strings.IndexByte(request, '?')
+	if index < 0 {
+		return request, options
+	}
+
+	query, err := url.ParseQuery(request[index+1:])
+	if err == nil {
+		options.NewOnly = query.Get("new_only") == "true"
+		switch deliver := query.Get("deliver"); deliver {
+		case DeliverAll, DeliverLast, DeliverNew:
+			options.Deliver = deliver
+		}
+		options.StartSequence, _ = strconv.ParseUint(query.Get("start_seq"), 10, 64)
+		options.Queue = query.Get("queue")
+	}
+
+	return request[:index], options
+}
+
+// clientQueueGroup the nats queue group of the queue option, empty if invalid. Prefixed so it can't join the group of the gateways
+func clientQueueGroup(queue string) string {
+	if queue == "" || len(queue) > 64 {
+		return ""
+	}
+	for _, r := range queue {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return ""
+		}
+	}
+	return "client." + queue
+}
+
+// newMessageFilter build the filter enforcing the subscription options. Returns nil if every message is delivered
+func (w *NatsWebSocket) newMessageFilter(options SubscriptionOptions) MessageFilter {
+	if !options.NewOnly {
+		return nil
+	}
+
+	field := w.config.MessageTimestampField
+	if field == "" {
+		field = DefaultMessageTimestampField
+	}
+
+	since := time.Now()
+	return func(data []byte) bool {
+		published, ok := messageTimestamp(data, field)
+		return !ok || !published.Before(since)
+	}
+}
+
+// messageTimestamp read the publish time of a json payload from a unix timestamp, in seconds or milliseconds, or a RFC3339 string
+func messageTimestamp(data []byte, field string) (time.Time, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return time.Time{}, false
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return time.Time{}, false
+	}
+
+	switch value := payload[field].(type) {
+	case float64:
+		// past 1e12 the timestamp can only be in milliseconds
+		if value > 1e12 {
+			return time.Unix(0, int64(value)*int64(time.Millisecond)), true
+		}
+		return time.Unix(int64(value), 0), true
+	case string:
+		published, err := time.Parse(time.RFC3339Nano, value)
+		return published, err == nil
+	}
+
+	return time.Time{}, false
+}
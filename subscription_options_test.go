@@ -0,0 +1,39 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubscription(t *T) {
+	topic, options := parseSubscription("test.a?new_only=true")
+	assert.Equal(t, "test.a", topic)
+	assert.True(t, options.NewOnly)
+
+	topic, options = parseSubscription("test.a")
+	assert.Equal(t, "test.a", topic)
+	assert.False(t, options.NewOnly)
+}
+
+func TestClientQueueGroup(t *T) {
+	_, options := parseSubscription("jobs?queue=workers")
+	assert.Equal(t, "workers", options.Queue)
+	assert.Equal(t, "client.workers", clientQueueGroup(options.Queue))
+	assert.Equal(t, "", clientQueueGroup("workers.>"))
+	assert.Equal(t, "", clientQueueGroup(""))
+
+	subscribers := map[*Connection]MessageFilter{NewConnection(1, nil): nil, NewConnection(2, nil): nil}
+	assert.Equal(t, 1, len(pickSubscriber(subscribers)))
+}
+
+func TestNewOnlyFilter(t *T) {
+	w := New(&Config{})
+	filter := w.newMessageFilter(SubscriptionOptions{NewOnly: true})
+
+	assert.False(t, filter([]byte(`{"timestamp":1500000000}`)))
+	assert.False(t, filter([]byte(`{"timestamp":"2018-04-06T07:27:25Z"}`)))
+	assert.True(t, filter([]byte(`{"timestamp":`+time.Now().Add(time.Minute).Format("\"2006-01-02T15:04:05Z07:00\"")+`}`)))
+	assert.True(t, filter([]byte("whosyourdaddy")))
+}
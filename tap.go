@@ -0,0 +1,164 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// TapMetadata taps carry the metadata of the frames only, i.e. time, size and frame type
+	TapMetadata = "metadata"
+	// TapPayloads taps may carry the redacted and truncated payloads when the operator asks for them
+	TapPayloads = "payloads"
+)
+
+// websocketTranscriptSink streams the frames as json to an admin websocket
+type websocketTranscriptSink struct {
+	mutex sync.Mutex
+	conn  *websocket.Conn
+}
+
+func (s *websocketTranscriptSink) Write(frame TranscriptFrame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	return s.conn.WriteJSON(frame)
+}
+
+func (s *websocketTranscriptSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "tap over"))
+	return s.conn.Close()
+}
+
+// NewTap init a tap mirroring the outbound frames of a connection to the sink until the duration elapses.
+// Without payloads only the metadata of the frames is mirrored
+func NewTap(sink TranscriptSink, duration time.Duration, maxPayload int, redactions []*regexp.Regexp, payloads bool) *Transcript {
+	tap := NewTranscript(sink, duration, maxPayload, redactions)
+	tap.outboundOnly = true
+	tap.metadataOnly = !payloads
+	return tap
+}
+
+// SetTap attach the tap mirroring the outbound frames of the connection. A nil tap detaches the current one
+func (c *Connection) SetTap(tap *Transcript) {
+	c.dataMutex.Lock()
+	previous := c.tap
+	c.tap = tap
+	c.dataMutex.Unlock()
+
+	if previous != nil && previous != tap {
+		previous.Close()
+	}
+}
+
+// detachTap detach the tap if it is still the one of the connection
+func (c *Connection) detachTap(tap *Transcript) {
+	c.dataMutex.Lock()
+	if c.tap == tap {
+		c.tap = nil
+	}
+	c.dataMutex.Unlock()
+
+	tap.Close()
+}
+
+// handleTap admin endpoint attaching a debug tap to a live connection: /taps?connectionId=<id>&seconds=<duration>&payloads=true.
+// A websocket upgrade request streams the frames to the admin websocket, a POST publishes them to Config.TapSubject suffixed by the connection id.
+// The payloads are mirrored only if Config.TapPolicy allows them
+func (w *NatsWebSocket) handleTap(writer http.ResponseWriter, request *http.Request) {
+	upgrade := websocket.IsWebSocketUpgrade(request)
+	if !upgrade && request.Method != http.MethodPost {
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	id, err := strconv.ParseInt(query.Get("connectionId"), 10, 64)
+	if err != nil {
+		http.Error(writer, "invalid connectionId", http.StatusBadRequest)
+		return
+	}
+
+	connection := w.connections.GetConnectionByID(ConnectionID(id))
+	if connection == nil {
+		http.Error(writer, "connection not found", http.StatusNotFound)
+		return
+	}
+
+	payloads := query.Get("payloads") == "true"
+	if payloads && w.config.TapPolicy != TapPayloads {
+		http.Error(writer, "payloads not allowed by the tap policy", http.StatusForbidden)
+		return
+	}
+
+	maxSeconds := w.config.MaxTranscriptSeconds
+	if maxSeconds <= 0 {
+		maxSeconds = DefaultMaxTranscriptSeconds
+	}
+
+	seconds, err := strconv.Atoi(query.Get("seconds"))
+	if err != nil || seconds <= 0 || seconds > maxSeconds {
+		seconds = maxSeconds
+	}
+
+	maxPayload := w.config.TranscriptMaxPayload
+	if maxPayload <= 0 {
+		maxPayload = DefaultTranscriptMaxPayload
+	}
+	duration := time.Duration(seconds) * time.Second
+
+	if upgrade {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+
+		tap := NewTap(&websocketTranscriptSink{conn: conn}, duration, maxPayload, w.transcriptRedactions, payloads)
+		connection.SetTap(tap)
+		time.AfterFunc(duration, func() { connection.detachTap(tap) })
+
+		// the tap is over once the operator goes away
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				connection.detachTap(tap)
+				return
+			}
+		}
+	}
+
+	if w.config.TapSubject == "" {
+		http.Error(writer, "tap subject not configured", http.StatusBadRequest)
+		return
+	}
+
+	target := fmt.Sprintf("%s.%d", w.config.TapSubject, id)
+	sink, err := NewNatsTranscriptSink(w.natsPool, target)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tap := NewTap(sink, duration, maxPayload, w.transcriptRedactions, payloads)
+	connection.SetTap(tap)
+	time.AfterFunc(duration, func() { connection.detachTap(tap) })
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]interface{}{
+		"connectionId": id,
+		"seconds":      seconds,
+		"target":       target,
+		"payloads":     payloads,
+	})
+}
@@ -0,0 +1,33 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTap(t *T) {
+	sink := &memoryTranscriptSink{}
+	tap := NewTap(sink, time.Minute, 20, nil, false)
+
+	assert.True(t, tap.Record(1, TranscriptInbound, websocket.TextMessage, []byte("topic>:test.a")))
+	assert.True(t, tap.Record(1, TranscriptOutbound, websocket.BinaryMessage, []byte("payload")))
+	assert.Equal(t, 1, len(sink.frames))
+	assert.Equal(t, TranscriptOutbound, sink.frames[0].Direction)
+	assert.Equal(t, "", sink.frames[0].Payload)
+	assert.Equal(t, 7, sink.frames[0].Size)
+	assert.True(t, sink.frames[0].Binary)
+
+	sink = &memoryTranscriptSink{}
+	tap = NewTap(sink, time.Minute, 20, nil, true)
+	tap.Record(1, TranscriptOutbound, websocket.TextMessage, []byte("payload"))
+	assert.Equal(t, "payload", sink.frames[0].Payload)
+
+	connection := NewConnection(1, nil)
+	connection.SetTap(tap)
+	connection.detachTap(tap)
+	assert.True(t, sink.closed)
+	assert.Nil(t, connection.tap)
+}
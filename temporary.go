@@ -0,0 +1,60 @@
+package websocketnats
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// TemporaryPrefix get the prefix of the temporary topics of the session, replied as tmp>:<prefix>, e.g. tmp>:tmp.3f9a...
+	TemporaryPrefix = "tmp>:"
+	// DefaultTemporaryTopicPrefix default first token of the temporary topics, followed by the session id
+	DefaultTemporaryTopicPrefix = "tmp"
+)
+
+func newSessionID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// SessionID get the random id of the session of the connection, scoping its temporary topics
+func (c *Connection) SessionID() string {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	return c.sessionID
+}
+
+func (w *NatsWebSocket) temporaryTopicPrefix() string {
+	if w.config.TemporaryTopicPrefix != "" {
+		return w.config.TemporaryTopicPrefix
+	}
+	return DefaultTemporaryTopicPrefix
+}
+
+// temporaryTopics get the prefix of the temporary topics of the connection, e.g. tmp.<session id>
+func (w *NatsWebSocket) temporaryTopics(connection *Connection) string {
+	return w.temporaryTopicPrefix() + "." + connection.SessionID()
+}
+
+// isTemporaryTopic check if the topic is one of the temporary topics, of any session
+func (w *NatsWebSocket) isTemporaryTopic(topic string) bool {
+	return w.config.TemporaryTopics && strings.HasPrefix(topic, w.temporaryTopicPrefix()+".")
+}
+
+// ownsTemporaryTopic check if the topic is a temporary topic of the session of the connection, wildcards allowed
+func (w *NatsWebSocket) ownsTemporaryTopic(connection *Connection, topic string) bool {
+	prefix := w.temporaryTopics(connection) + "."
+	return w.isTemporaryTopic(topic) && strings.HasPrefix(topic, prefix) && len(topic) > len(prefix)
+}
+
+// sendTemporaryPrefix reply the prefix of the temporary topics of the session, the backend jobs publishing under it
+func (w *NatsWebSocket) sendTemporaryPrefix(connection *Connection) {
+	if !w.config.TemporaryTopics {
+		connection.Reply([]byte("invalid topic"))
+		return
+	}
+	connection.Reply([]byte(TemporaryPrefix + w.temporaryTopics(connection)))
+}
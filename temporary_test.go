@@ -0,0 +1,31 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporaryTopics(t *T) {
+	w := New(&Config{TemporaryTopics: true})
+	connection := NewConnection(1, nil)
+	connection.sessionID = newSessionID()
+	other := NewConnection(2, nil)
+	other.sessionID = newSessionID()
+
+	own := w.temporaryTopics(connection)
+	_, ok := w.topicPolicy(connection, own+".progress")
+	assert.True(t, ok)
+	_, ok = w.topicPolicy(connection, own+".>")
+	assert.True(t, ok)
+	_, ok = w.topicPolicy(connection, own)
+	assert.False(t, ok)
+	_, ok = w.topicPolicy(other, own+".progress")
+	assert.False(t, ok)
+	_, ok = w.topicPolicy(connection, "tmp.*.progress")
+	assert.False(t, ok)
+
+	w = New(&Config{})
+	_, ok = w.topicPolicy(connection, own+".progress")
+	assert.False(t, ok)
+}
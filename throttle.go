@@ -0,0 +1,127 @@
+package websocketnats
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAcceptRetryAfter default Retry-After in seconds sent to throttled upgrade requests
+	DefaultAcceptRetryAfter = 5
+	// DefaultUpgradeQueueTimeout default time in milliseconds an upgrade request may wait for an upgrade slot
+	DefaultUpgradeQueueTimeout = 2000
+)
+
+// AcceptThrottle admission control of the upgrade requests. Once the connects per second exceed the threshold,
+// a growing fraction of the requests is rejected so a reconnect storm doesn't stampede nats and the JWKS endpoint
+type AcceptThrottle struct {
+	mutex       sync.Mutex
+	threshold   int
+	retryAfter  int
+	windowStart time.Time
+	accepted    int
+	random      *rand.Rand
+}
+
+// NewAcceptThrottle init an accept throttle allowing threshold connects per second. Retry-After is jittered around retryAfter seconds
+func NewAcceptThrottle(threshold int, retryAfter int) *AcceptThrottle {
+	if retryAfter < 1 {
+		retryAfter = DefaultAcceptRetryAfter
+	}
+
+	return &AcceptThrottle{
+		mutex:       sync.Mutex{},
+		threshold:   threshold,
+		retryAfter:  retryAfter,
+		windowStart: time.Now(),
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Admit decide if the upgrade request is accepted. If not, the returned Retry-After in seconds is jittered between retryAfter and twice retryAfter
+func (t *AcceptThrottle) Admit() (admitted bool, retryAfter int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.windowStart) >= time.Second {
+		t.windowStart = now
+		t.accepted = 0
+	}
+
+	if t.accepted >= t.threshold {
+		// the further over the threshold, the higher the rejection probability
+		overload := float64(t.accepted-t.threshold+1) / float64(t.threshold)
+		if t.random.Float64() < overload {
+			return false, t.retryAfter + t.random.Intn(t.retryAfter+1)
+		}
+	}
+
+	t.accepted++
+	return true, 0
+}
+
+// UpgradeLimiter bounds the number of upgrade handshakes in flight. Requests over the limit wait in a bounded queue
+// for a free slot, so a burst of handshakes doesn't starve the read and write loops of the connected clients.
+// The TLS handshake is done by net/http before the request is handled, so only the admission and upgrade are covered
+type UpgradeLimiter struct {
+	queued   int64 // first for the 64-bit alignment of atomic operations
+	slots    chan struct{}
+	maxQueue int64
+	timeout  time.Duration
+}
+
+// NewUpgradeLimiter init an upgrade limiter allowing concurrency upgrades in flight and maxQueue waiting for at most timeout
+func NewUpgradeLimiter(concurrency int, maxQueue int, timeout time.Duration) *UpgradeLimiter {
+	if timeout <= 0 {
+		timeout = DefaultUpgradeQueueTimeout * time.Millisecond
+	}
+
+	return &UpgradeLimiter{
+		slots:    make(chan struct{}, concurrency),
+		maxQueue: int64(maxQueue),
+		timeout:  timeout,
+	}
+}
+
+// Acquire take an upgrade slot, waiting in the queue if none is free. Returns false if the queue is full or the wait timed out
+func (l *UpgradeLimiter) Acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt64(&l.queued, 1) > l.maxQueue {
+		atomic.AddInt64(&l.queued, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Release free the upgrade slot
+func (l *UpgradeLimiter) Release() {
+	<-l.slots
+}
+
+// InFlight get the number of upgrades in flight
+func (l *UpgradeLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Queued get the number of upgrade requests waiting for a slot
+func (l *UpgradeLimiter) Queued() int {
+	return int(atomic.LoadInt64(&l.queued))
+}
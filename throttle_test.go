@@ -0,0 +1,51 @@
+package websocketnats
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptThrottle(t *T) {
+	throttle := NewAcceptThrottle(10, 2)
+
+	accepted := 0
+	for i := 0; i < 100; i++ {
+		admitted, retryAfter := throttle.Admit()
+		if admitted {
+			accepted++
+			continue
+		}
+
+		assert.True(t, retryAfter >= 2 && retryAfter <= 4)
+	}
+
+	// everything under the threshold is accepted, nothing beyond twice the threshold
+	assert.True(t, accepted >= 10 && accepted <= 20)
+}
+
+func TestUpgradeLimiter(t *T) {
+	limiter := NewUpgradeLimiter(1, 1, 50*time.Millisecond)
+
+	assert.True(t, limiter.Acquire())
+
+	// the queued request gets the slot once released
+	released := make(chan bool)
+	go func() {
+		released <- limiter.Acquire()
+	}()
+	for limiter.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	assert.False(t, limiter.Acquire())
+
+	limiter.Release()
+	assert.True(t, <-released)
+
+	// the wait times out
+	assert.False(t, limiter.Acquire())
+	assert.Equal(t, 1, limiter.InFlight())
+}
@@ -0,0 +1,94 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// TokenExpiringNotice the token of the connection expires soon, the client should log in again with a fresh token
+	TokenExpiringNotice = "token_expiring"
+	// TokenExpiredReason close reason of the connections whose token expired, grace period included
+	TokenExpiredReason = "TokenExpired"
+	// DefaultTokenExpiryWarning default time in seconds before the token expires the TokenExpiringNotice is sent
+	DefaultTokenExpiryWarning = 60
+)
+
+// tokenExpiry get the expiry of the exp claim, zero if the token doesn't expire
+func tokenExpiry(claims jwt.MapClaims) time.Time {
+	switch exp := claims["exp"].(type) {
+	case float64:
+		return time.Unix(int64(exp), 0)
+	case json.Number:
+		if seconds, err := exp.Int64(); err == nil {
+			return time.Unix(seconds, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// setTokenExpiry record the expiry of the token the connection logged in with, again on each login with a fresh token
+func (c *Connection) setTokenExpiry(expiry time.Time) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.tokenExpiry = expiry
+	c.tokenExpiryWarned = false
+}
+
+// GetTokenExpiry get the expiry of the token the connection logged in with, zero if it doesn't expire
+func (c *Connection) GetTokenExpiry() time.Time {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	return c.tokenExpiry
+}
+
+// expireTokens warn the connections whose token expires within Config.TokenExpiryWarning with a TokenExpiringNotice,
+// and close the ones whose token expired more than Config.TokenExpiryGrace ago. A login with a fresh token of the same
+// user extends the connection
+func (w *NatsWebSocket) expireTokens(now time.Time) {
+	config := w.liveConfig()
+	if config.DisableTokenExpiry {
+		return
+	}
+
+	grace := time.Duration(config.TokenExpiryGrace) * time.Second
+	warning := time.Duration(config.TokenExpiryWarning) * time.Second
+	if config.TokenExpiryWarning == 0 {
+		warning = DefaultTokenExpiryWarning * time.Second
+	}
+
+	for _, connection := range w.connections.ListConnections() {
+		connection.dataMutex.Lock()
+		expiry, warned := connection.tokenExpiry, connection.tokenExpiryWarned
+		warn := !expiry.IsZero() && !warned && warning > 0 && now.After(expiry.Add(-warning))
+		if warn {
+			connection.tokenExpiryWarned = true
+		}
+		connection.dataMutex.Unlock()
+
+		if expiry.IsZero() {
+			continue
+		}
+
+		if now.After(expiry.Add(grace)) {
+			w.metrics.Counter("gateway_token_expiry_total", "Connections warned or closed for the expiry of their token by action", "action", "closed").Inc()
+			connection.Logf("token expired at %s, closing", expiry.Format(time.RFC3339))
+			w.disconnect(connection, websocket.ClosePolicyViolation, TokenExpiredReason)
+			continue
+		}
+
+		if warn {
+			w.metrics.Counter("gateway_token_expiry_total", "Connections warned or closed for the expiry of their token by action", "action", "warned").Inc()
+			connection.SendNotice(Notice{
+				Type:        TokenExpiringNotice,
+				ExpiresAt:   expiry.Unix() * 1000,
+				GracePeriod: int64(grace / time.Millisecond),
+			})
+		}
+	}
+}
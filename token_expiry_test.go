@@ -0,0 +1,87 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	. "testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenExpiry(t *T) {
+	assert.Equal(t, time.Unix(1700000000, 0), tokenExpiry(jwt.MapClaims{"exp": float64(1700000000)}))
+	assert.Equal(t, time.Unix(1700000000, 0), tokenExpiry(jwt.MapClaims{"exp": json.Number("1700000000")}))
+	assert.True(t, tokenExpiry(jwt.MapClaims{}).IsZero())
+}
+
+func TestExpireTokens(t *T) {
+	w := New(&Config{TokenExpiryGrace: 30}, WithPool(unavailablePool{}))
+
+	received := make(chan string, 4)
+	client, server := net.Pipe()
+	go func() {
+		transport := NewStreamTransport(client)
+		for {
+			_, message, err := transport.ReadMessage()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- string(message)
+		}
+	}()
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("user", "phone")
+	w.connections.OnLogin(connection)
+
+	expiry := time.Now().Add(time.Hour)
+	connection.setTokenExpiry(expiry)
+
+	// far from the expiry, nothing is sent
+	w.expireTokens(time.Now())
+	// within the warning, the notice is sent once
+	w.expireTokens(expiry.Add(-30 * time.Second))
+	w.expireTokens(expiry.Add(-20 * time.Second))
+	notice := <-received
+	assert.True(t, strings.HasPrefix(notice, NoticePrefix+`{"type":"token_expiring"`), notice)
+	assert.Contains(t, notice, `"gracePeriod":30000`)
+
+	// expired, but within the grace period
+	w.expireTokens(expiry.Add(10 * time.Second))
+	assert.Len(t, w.connections.ListConnections(), 1)
+
+	// a fresh token extends the connection
+	connection.setTokenExpiry(expiry.Add(time.Hour))
+	w.expireTokens(expiry.Add(time.Minute))
+	assert.Len(t, w.connections.ListConnections(), 1)
+
+	w.expireTokens(expiry.Add(2 * time.Hour))
+	assert.Len(t, w.connections.ListConnections(), 0)
+}
+
+func TestReloadTokenExpiry(t *T) {
+	w := New(&Config{DisableTokenExpiry: true}, WithPool(unavailablePool{}))
+
+	client, server := net.Pipe()
+	go discard(client)
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("user", "phone")
+	w.connections.OnLogin(connection)
+
+	expiry := time.Now().Add(-time.Minute)
+	connection.setTokenExpiry(expiry)
+
+	w.expireTokens(time.Now())
+	assert.Len(t, w.connections.ListConnections(), 1)
+
+	assert.Nil(t, w.Reload(&Config{TokenExpiryGrace: 120}))
+	w.expireTokens(time.Now())
+	assert.Len(t, w.connections.ListConnections(), 1)
+
+	assert.Nil(t, w.Reload(&Config{}))
+	w.expireTokens(time.Now())
+	assert.Len(t, w.connections.ListConnections(), 0)
+}
@@ -0,0 +1,312 @@
+package websocketnats
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// DefaultRolesClaim default token claim holding the roles of the user
+	DefaultRolesClaim = "roles"
+)
+
+// TopicConfig policy of the topics matching the pattern
+type TopicConfig struct {
+	// Pattern topic or nats subject pattern of the topics, e.g. news or dash.>
+	Pattern string `json:"pattern"`
+	// Roles token roles allowed to subscribe, any of them is enough. Empty allows every logged in client
+	Roles []string `json:"roles"`
+	// RateLimit messages per second delivered to each subscriber, the others are dropped. 0 disables the limit
+	RateLimit int `json:"rateLimit"`
+	// MaxPayload size in bytes of the largest message delivered, the larger ones are dropped. 0 disables the limit
+	MaxPayload int `json:"maxPayload"`
+	// Priority topics with a priority above 0 keep flowing while the subscriptions are paused by Config.OutboundHighWatermark
+	Priority int `json:"priority"`
+	// Weight messages of the topic sent in a row to a subscriber lagging behind, before the messages of its other topics
+	// get their turn, so a firehose topic can't starve a critical one. Defaults to 1
+	Weight int `json:"weight"`
+	// LastValue keep the last message of the topic and send it to the new subscribers
+	LastValue bool `json:"lastValue"`
+	// Transform name of the transform applied to the messages, see WithTransform
+	Transform string `json:"transform"`
+	// Stream JetStream stream the subscriptions are bound to, replaying the messages from the deliver option of the client
+	Stream string `json:"stream"`
+	// Durable keep a durable consumer per device and topic, so the messages missed while disconnected are delivered on resubscribe
+	Durable bool `json:"durable"`
+	// QueueGroup nats queue group the gateway instances subscribe in, so each message reaches the subscribers of one instance only
+	QueueGroup string `json:"queueGroup"`
+	// ClientQueueGroups allow the clients to join a queue group with the queue option, e.g. topic>:jobs?queue=workers,
+	// each message being delivered to one member of the group
+	ClientQueueGroups bool `json:"clientQueueGroups"`
+	// Merge subjects merged into the topic, e.g. orders.created, orders.updated and orders.cancelled into orders,
+	// the pattern being the name of the topic the clients subscribe to
+	Merge []string `json:"merge"`
+	// DedupKey json field of the merged messages keyed by, e.g. orderId: a message equal to the latest of its key is dropped,
+	// and the new subscribers get the latest message of each key first
+	DedupKey string `json:"dedupKey"`
+	// MaxDedupKeys keys whose latest message is kept, the least recently updated being forgotten. Defaults to DefaultMergeMaxKeys
+	MaxDedupKeys int `json:"maxDedupKeys"`
+	// Regions regions whose instances serve the topic, see Config.Region. Empty serves it everywhere
+	Regions []string `json:"regions"`
+}
+
+// Transform rewrite a message of the topic before it is delivered. Returning nil drops the message
+type Transform func(topic string, data []byte) []byte
+
+// TopicPolicies per-topic configuration of the gateway. The first entry matching a topic applies
+type TopicPolicies struct {
+	mutex      sync.RWMutex
+	topics     []TopicConfig
+	transforms map[string]Transform
+	lastValues map[string][]byte
+}
+
+// NewTopicPolicies init the topic policies
+func NewTopicPolicies(topics []TopicConfig) *TopicPolicies {
+	return &TopicPolicies{
+		mutex:      sync.RWMutex{},
+		topics:     topics,
+		transforms: make(map[string]Transform),
+		lastValues: make(map[string][]byte),
+	}
+}
+
+// configuredTopics the topics of the config, the deprecated NatsTopics being entries without policy
+func configuredTopics(config *Config) []TopicConfig {
+	topics := append([]TopicConfig{}, config.Topics...)
+	for _, topic := range config.NatsTopics {
+		topics = append(topics, TopicConfig{Pattern: topic})
+	}
+	return topics
+}
+
+// RegisterTransform register the transform under the name referenced by TopicConfig.Transform
+func (p *TopicPolicies) RegisterTransform(name string, transform Transform) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.transforms[name] = transform
+}
+
+// SetTopics replace the topic policies, e.g. on a config reload
+func (p *TopicPolicies) SetTopics(topics []TopicConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.topics = topics
+}
+
+// Lookup get the policy of the topic. Returns false if the topic is not configured
+func (p *TopicPolicies) Lookup(topic string) (TopicConfig, bool) {
+	p.mutex.RLock()
+	topics := p.topics
+	p.mutex.RUnlock()
+
+	for _, config := range topics {
+		if config.Pattern == topic || matchSubject(config.Pattern, topic) {
+			return config, true
+		}
+	}
+	return TopicConfig{}, false
+}
+
+// Weight get the number of deferred messages of the topic sent in a row to a connection, 1 unless configured
+func (p *TopicPolicies) Weight(topic string) int {
+	if p == nil {
+		return 1
+	}
+
+	config, _ := p.Lookup(topic)
+	if config.Weight > 0 {
+		return config.Weight
+	}
+	return 1
+}
+
+// Prioritized check if the topic keeps flowing while the subscriptions are paused
+func (p *TopicPolicies) Prioritized(topic string) bool {
+	config, _ := p.Lookup(topic)
+	return config.Priority > 0
+}
+
+// Apply run the transform of the topic on the message and keep it as the last value if the topic retains it.
+// Returns nil if the message is dropped
+func (p *TopicPolicies) Apply(topic string, data []byte) []byte {
+	config, ok := p.Lookup(topic)
+	if !ok {
+		return data
+	}
+
+	if config.Transform != "" {
+		p.mutex.RLock()
+		transform := p.transforms[config.Transform]
+		p.mutex.RUnlock()
+
+		if transform != nil {
+			if data = transform(topic, data); data == nil {
+				return nil
+			}
+		}
+	}
+
+	if config.LastValue {
+		p.mutex.Lock()
+		p.lastValues[topic] = data
+		p.mutex.Unlock()
+	}
+	return data
+}
+
+// LastValues get the last messages kept of the topics the topic covers, by topic
+func (p *TopicPolicies) LastValues(topic string) map[string][]byte {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	values := make(map[string][]byte)
+	if !hasWildcard(topic) {
+		if data, ok := p.lastValues[topic]; ok {
+			values[topic] = data
+		}
+		return values
+	}
+
+	for subject, data := range p.lastValues {
+		if matchSubject(topic, subject) {
+			values[subject] = data
+		}
+	}
+	return values
+}
+
+// newTopicFilter build the filter enforcing the payload and rate limits of the topic, warning the connection approaching them.
+// Returns nil if every message is delivered
+func newTopicFilter(connection *Connection, topic string, config TopicConfig) MessageFilter {
+	if config.MaxPayload <= 0 && config.RateLimit <= 0 {
+		return nil
+	}
+
+	mutex := sync.Mutex{}
+	windowStart := time.Now()
+	delivered := 0
+
+	return func(data []byte) bool {
+		if config.MaxPayload > 0 {
+			if len(data) > config.MaxPayload {
+				return false
+			}
+			connection.checkSoftLimit(TopicPayloadLimit, topic, len(data), config.MaxPayload)
+		}
+		if config.RateLimit <= 0 {
+			return true
+		}
+
+		mutex.Lock()
+		if now := time.Now(); now.Sub(windowStart) >= time.Second {
+			windowStart = now
+			delivered = 0
+		}
+		if delivered >= config.RateLimit {
+			mutex.Unlock()
+			return false
+		}
+		delivered++
+		usage := delivered
+		mutex.Unlock()
+
+		connection.checkSoftLimit(TopicRateLimit, topic, usage, config.RateLimit)
+		return true
+	}
+}
+
+// combineFilters deliver the messages passing every filter. Nil filters are skipped
+func combineFilters(filters ...MessageFilter) MessageFilter {
+	active := []MessageFilter{}
+	for _, filter := range filters {
+		if filter != nil {
+			active = append(active, filter)
+		}
+	}
+
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+
+	return func(data []byte) bool {
+		for _, filter := range active {
+			if !filter(data) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// tokenRoles read the roles of the user from the claim, either a list or a space separated string
+func tokenRoles(claims jwt.MapClaims, claim string) []string {
+	switch value := claims[claim].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		roles := []string{}
+		for _, entry := range value {
+			if role, ok := entry.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// HasAnyRole check if the connection holds one of the roles. Always true if no role is required
+func (c *Connection) HasAnyRole(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	for _, role := range roles {
+		if contains(c.roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Connection) setRoles(roles []string) {
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+
+	c.roles = roles
+}
+
+// topicPolicy get the policy of the topic if the connection may subscribe to it, the temporary topics of its session included.
+// A wildcard topic is rejected if it covers a topic restricted to roles the connection doesn't hold
+func (w *NatsWebSocket) topicPolicy(connection *Connection, topic string) (TopicConfig, bool) {
+	// the temporary topics are reserved to their session
+	if w.isTemporaryTopic(topic) {
+		return TopicConfig{Pattern: topic}, w.ownsTemporaryTopic(connection, topic)
+	}
+
+	config, ok := w.topics.Lookup(topic)
+	if !ok || !connection.HasAnyRole(config.Roles) {
+		return TopicConfig{}, false
+	}
+
+	if hasWildcard(topic) {
+		for _, restricted := range w.topics.topics {
+			if matchSubject(topic, restricted.Pattern) && !connection.HasAnyRole(restricted.Roles) {
+				return TopicConfig{}, false
+			}
+		}
+	}
+	return config, true
+}
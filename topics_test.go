@@ -0,0 +1,85 @@
+package websocketnats
+
+import (
+	"bytes"
+	. "testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicPolicies(t *T) {
+	topics := NewTopicPolicies(configuredTopics(&Config{
+		NatsTopics: []string{"test.a"},
+		Topics: []TopicConfig{
+			{Pattern: "dash.>", Roles: []string{"admin"}, Transform: "upper", LastValue: true},
+			{Pattern: "news", Priority: 1},
+		},
+	}))
+	topics.RegisterTransform("upper", func(topic string, data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		return bytes.ToUpper(data)
+	})
+
+	config, ok := topics.Lookup("dash.sales")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"admin"}, config.Roles)
+	_, ok = topics.Lookup("test.a")
+	assert.True(t, ok)
+	_, ok = topics.Lookup("test.b")
+	assert.False(t, ok)
+	assert.True(t, topics.Prioritized("news"))
+	assert.False(t, topics.Prioritized("test.a"))
+
+	assert.Equal(t, "HI", string(topics.Apply("dash.sales", []byte("hi"))))
+	assert.Nil(t, topics.Apply("dash.sales", []byte{}))
+	assert.Equal(t, map[string][]byte{"dash.sales": []byte("HI")}, topics.LastValues("dash.sales"))
+	assert.Equal(t, map[string][]byte{"dash.sales": []byte("HI")}, topics.LastValues("dash.*"))
+	assert.Equal(t, "hi", string(topics.Apply("test.a", []byte("hi"))))
+	assert.Empty(t, topics.LastValues("test.a"))
+}
+
+func TestTopicFilter(t *T) {
+	assert.Nil(t, newTopicFilter(nil, "news", TopicConfig{Pattern: "news"}))
+
+	filter := newTopicFilter(nil, "news", TopicConfig{Pattern: "news", RateLimit: 2, MaxPayload: 4})
+	assert.False(t, filter([]byte("large")))
+	assert.True(t, filter([]byte("a")))
+	assert.True(t, filter([]byte("b")))
+	assert.False(t, filter([]byte("c")))
+
+	combined := combineFilters(nil, func(data []byte) bool { return len(data) > 0 })
+	assert.False(t, combined([]byte{}))
+	assert.Nil(t, combineFilters(nil, nil))
+}
+
+func TestTopicRoles(t *T) {
+	assert.Equal(t, []string{"admin", "ops"}, tokenRoles(jwt.MapClaims{"roles": []interface{}{"admin", "ops"}}, "roles"))
+	assert.Equal(t, []string{"admin", "ops"}, tokenRoles(jwt.MapClaims{"scope": "admin ops"}, "scope"))
+	assert.Nil(t, tokenRoles(jwt.MapClaims{}, "roles"))
+
+	connection := NewConnection(1, nil)
+	assert.True(t, connection.HasAnyRole(nil))
+	assert.False(t, connection.HasAnyRole([]string{"admin"}))
+	connection.setRoles([]string{"ops", "admin"})
+	assert.True(t, connection.HasAnyRole([]string{"admin"}))
+}
+
+func TestWildcardTopicPolicy(t *T) {
+	w := New(&Config{Topics: []TopicConfig{
+		{Pattern: "orders.secret", Roles: []string{"admin"}},
+		{Pattern: "orders.>"},
+	}})
+
+	connection := NewConnection(1, nil)
+	_, ok := w.topicPolicy(connection, "orders.eu")
+	assert.True(t, ok)
+	_, ok = w.topicPolicy(connection, "orders.*")
+	assert.False(t, ok)
+
+	connection.setRoles([]string{"admin"})
+	_, ok = w.topicPolicy(connection, "orders.*")
+	assert.True(t, ok)
+}
@@ -0,0 +1,102 @@
+package websocketnats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// UpgradeSpan span of a websocket upgrade
+	UpgradeSpan = "websocket.upgrade"
+	// LoginSpan span of a login, the JWT validation included
+	LoginSpan = "gateway.login"
+	// JWTSpan span of the validation of the JWT of a login
+	JWTSpan = "gateway.jwt"
+	// SubscribeSpan span of a subscribe
+	SubscribeSpan = "gateway.subscribe"
+	// DeliverySpan span of the delivery of a nats message to the websocket subscribers
+	DeliverySpan = "nats.deliver"
+)
+
+// TraceCarrier propagated trace context, the W3C traceparent and tracestate keys
+type TraceCarrier map[string]string
+
+// Tracer tracing backend of the message path, e.g. an adapter to an OpenTelemetry tracer and its propagator, see WithTracer
+type Tracer interface {
+	// Start start a span, child of the span of ctx, or of the remote span of the carrier if ctx has none
+	Start(ctx context.Context, name string, carrier TraceCarrier) (context.Context, Span)
+}
+
+// Span span started by a Tracer
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
+
+// startSpan start a span with the tracer if any
+func (w *NatsWebSocket) startSpan(ctx context.Context, name string, carrier TraceCarrier) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if w.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return w.tracer.Start(ctx, name, carrier)
+}
+
+// traceContext get the context of the upgrade span of the connection, parent of its login and subscribe spans
+func (c *Connection) traceContext() context.Context {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+
+	if c.trace == nil {
+		return context.Background()
+	}
+	return c.trace
+}
+
+// headerCarrier get the trace context propagated by the headers of the upgrade request
+func headerCarrier(header http.Header) TraceCarrier {
+	if header.Get("traceparent") == "" {
+		return nil
+	}
+	return TraceCarrier{"traceparent": header.Get("traceparent"), "tracestate": header.Get("tracestate")}
+}
+
+// startDeliverySpan start the delivery span of a nats message. Its trace context is only parsed with a tracer, sparing
+// the payload scan to every delivery otherwise
+func (w *NatsWebSocket) startDeliverySpan(msg *nats.Msg) Span {
+	if w.tracer == nil {
+		return noopSpan{}
+	}
+	_, span := w.tracer.Start(context.Background(), DeliverySpan, natsCarrier(msg))
+	return span
+}
+
+// natsCarrier get the trace context propagated by a nats message. The nats client predating the message headers,
+// it is read from the traceparent and tracestate fields of the json payloads
+func natsCarrier(msg *nats.Msg) TraceCarrier {
+	if !bytes.Contains(msg.Data, []byte(`"traceparent"`)) {
+		return nil
+	}
+
+	var fields struct {
+		TraceParent string `json:"traceparent"`
+		TraceState  string `json:"tracestate"`
+	}
+	if err := json.Unmarshal(msg.Data, &fields); err != nil || fields.TraceParent == "" {
+		return nil
+	}
+	return TraceCarrier{"traceparent": fields.TraceParent, "tracestate": fields.TraceState}
+}
@@ -0,0 +1,106 @@
+package websocketnats
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedSpan struct {
+	mutex      *sync.Mutex
+	name       string
+	carrier    TraceCarrier
+	attributes map[string]interface{}
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) RecordError(err error) { s.SetAttribute("error", err) }
+
+func (s *recordedSpan) End() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ended = true
+}
+
+func (s *recordedSpan) isEnded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ended
+}
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, carrier TraceCarrier) (context.Context, Span) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	span := &recordedSpan{mutex: &r.mutex, name: name, carrier: carrier, attributes: map[string]interface{}{}}
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func (r *recordingTracer) find(name string) *recordedSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, span := range r.spans {
+		if span.name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *T) {
+	tracer := &recordingTracer{}
+	w := New(&Config{URLPattern: "/", HeartbeatInterval: -1, Topics: []TopicConfig{{Pattern: "news"}}}, WithPool(unavailablePool{}), WithTracer(tracer))
+	defer w.Stop()
+
+	server := httptest.NewServer(w.Handler())
+	defer server.Close()
+
+	header := http.Header{"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	assert.True(t, waitFor(func() bool { return tracer.find(UpgradeSpan) != nil && tracer.find(UpgradeSpan).isEnded() }))
+	upgrade := tracer.find(UpgradeSpan)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", upgrade.carrier["traceparent"])
+
+	client, stream := net.Pipe()
+	go discard(client)
+	connection := w.registerConnection(NewStreamTransport(stream))
+	w.setupSubsrciber(connection, []byte("unknown"))
+	subscribe := tracer.find(SubscribeSpan)
+	assert.NotNil(t, subscribe)
+	assert.Equal(t, "unknown", subscribe.attributes["gateway.topic"])
+	assert.True(t, subscribe.isEnded())
+
+	data := []byte(`{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01","text":"hi"}`)
+	w.dispatch("news", "news", &nats.Msg{Subject: "news", Data: data}, map[*Connection]MessageFilter{connection: nil})
+	delivery := tracer.find(DeliverySpan)
+	assert.NotNil(t, delivery)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", delivery.carrier["traceparent"])
+	assert.Equal(t, 1, delivery.attributes["gateway.recipients"])
+
+	assert.Nil(t, natsCarrier(&nats.Msg{Data: []byte("plain")}))
+	assert.Equal(t, noopSpan{}, New(&Config{}).startDeliverySpan(&nats.Msg{Data: data}))
+}
@@ -0,0 +1,296 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultTranscriptMaxPayload default number of payload bytes kept per captured frame
+	DefaultTranscriptMaxPayload = 1024
+	// DefaultMaxTranscriptSeconds default upper bound of a capture duration
+	DefaultMaxTranscriptSeconds = 300
+
+	// TranscriptInbound frame received from the client
+	TranscriptInbound = "in"
+	// TranscriptOutbound frame sent to the client
+	TranscriptOutbound = "out"
+)
+
+// loginRedaction login and service tokens are never captured
+var loginRedaction = regexp.MustCompile(`^(` + regexp.QuoteMeta(LoginPrefix) + `|` + regexp.QuoteMeta(ServicePrefix) + `).*`)
+
+// TranscriptFrame captured websocket frame
+type TranscriptFrame struct {
+	ConnectionID ConnectionID `json:"connectionId"`
+	Time         int64        `json:"time"`
+	Direction    string       `json:"direction"`
+	Binary       bool         `json:"binary"`
+	Size         int          `json:"size"`
+	Payload      string       `json:"payload"`
+	Truncated    bool         `json:"truncated"`
+}
+
+// TranscriptSink destination of the captured frames
+type TranscriptSink interface {
+	Write(frame TranscriptFrame) error
+	Close() error
+}
+
+// Transcript bounded capture of the frames of a connection, for debugging support cases
+type Transcript struct {
+	mutex      sync.Mutex
+	until      time.Time
+	maxPayload int
+	redactions []*regexp.Regexp
+	sink       TranscriptSink
+	closed     bool
+	// outboundOnly and metadataOnly narrow the capture of the taps, see NewTap
+	outboundOnly bool
+	metadataOnly bool
+}
+
+// NewTranscript init a transcript writing to the sink until the duration elapses
+func NewTranscript(sink TranscriptSink, duration time.Duration, maxPayload int, redactions []*regexp.Regexp) *Transcript {
+	return &Transcript{
+		mutex:      sync.Mutex{},
+		until:      time.Now().Add(duration),
+		maxPayload: maxPayload,
+		redactions: redactions,
+		sink:       sink,
+	}
+}
+
+// Record capture the frame after redaction and truncation. Returns false once the transcript is over
+func (t *Transcript) Record(connectionID ConnectionID, direction string, messageType int, payload []byte) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return false
+	}
+	if t.outboundOnly && direction != TranscriptOutbound {
+		return true
+	}
+
+	now := time.Now()
+	if now.After(t.until) {
+		t.close()
+		return false
+	}
+
+	redacted := loginRedaction.ReplaceAll(payload, []byte("${1}[REDACTED]"))
+	for _, redaction := range t.redactions {
+		redacted = redaction.ReplaceAll(redacted, []byte("[REDACTED]"))
+	}
+
+	frame := TranscriptFrame{
+		ConnectionID: connectionID,
+		Time:         now.UnixNano() / int64(time.Millisecond),
+		Direction:    direction,
+		Binary:       messageType == websocket.BinaryMessage,
+		Size:         len(payload),
+	}
+
+	if t.metadataOnly {
+		redacted = nil
+	}
+	if len(redacted) > t.maxPayload {
+		redacted = redacted[:t.maxPayload]
+		frame.Truncated = true
+	}
+	frame.Payload = string(redacted)
+
+	if err := t.sink.Write(frame); err != nil {
+		t.close()
+		return false
+	}
+
+	return true
+}
+
+// Close stop the capture
+func (t *Transcript) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.close()
+}
+
+func (t *Transcript) close() {
+	if t.closed {
+		return
+	}
+
+	t.closed = true
+	t.sink.Close()
+}
+
+// fileTranscriptSink writes the frames as json lines
+type fileTranscriptSink struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileTranscriptSink create the transcript file
+func NewFileTranscriptSink(path string) (TranscriptSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTranscriptSink{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (s *fileTranscriptSink) Write(frame TranscriptFrame) error {
+	return s.encoder.Encode(frame)
+}
+
+func (s *fileTranscriptSink) Close() error {
+	return s.file.Close()
+}
+
+// natsTranscriptSink publishes the frames as json to a nats subject
+type natsTranscriptSink struct {
+	pool      NatsPool
+	busClient *nats.Conn
+	subject   string
+}
+
+// NewNatsTranscriptSink publish the frames to the subject
+func NewNatsTranscriptSink(pool NatsPool, subject string) (TranscriptSink, error) {
+	busClient, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	return &natsTranscriptSink{pool: pool, busClient: busClient, subject: subject}, nil
+}
+
+func (s *natsTranscriptSink) Write(frame TranscriptFrame) error {
+	payload, _ := json.Marshal(frame)
+	return s.busClient.Publish(s.subject, payload)
+}
+
+func (s *natsTranscriptSink) Close() error {
+	s.pool.Put(s.busClient)
+	return nil
+}
+
+// SetTranscript attach the transcript capturing the frames of the connection. A nil transcript detaches the current one
+func (c *Connection) SetTranscript(transcript *Transcript) {
+	c.dataMutex.Lock()
+	previous := c.transcript
+	c.transcript = transcript
+	c.dataMutex.Unlock()
+
+	if previous != nil && previous != transcript {
+		previous.Close()
+	}
+}
+
+func (c *Connection) record(direction string, messageType int, payload []byte) {
+	c.dataMutex.RLock()
+	transcript := c.transcript
+	tap := c.tap
+	id := c.id
+	c.dataMutex.RUnlock()
+
+	if tap != nil && !tap.Record(id, direction, messageType, payload) {
+		c.dataMutex.Lock()
+		if c.tap == tap {
+			c.tap = nil
+		}
+		c.dataMutex.Unlock()
+	}
+
+	if transcript != nil && !transcript.Record(id, direction, messageType, payload) {
+		c.dataMutex.Lock()
+		if c.transcript == transcript {
+			c.transcript = nil
+		}
+		c.dataMutex.Unlock()
+	}
+}
+
+// handleTranscript admin endpoint starting a capture: POST /transcripts?connectionId=<id>&seconds=<duration>&sink=<file|nats>
+func (w *NatsWebSocket) handleTranscript(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	id, err := strconv.ParseInt(query.Get("connectionId"), 10, 64)
+	if err != nil {
+		http.Error(writer, "invalid connectionId", http.StatusBadRequest)
+		return
+	}
+
+	connection := w.connections.GetConnectionByID(ConnectionID(id))
+	if connection == nil {
+		http.Error(writer, "connection not found", http.StatusNotFound)
+		return
+	}
+
+	maxSeconds := w.config.MaxTranscriptSeconds
+	if maxSeconds <= 0 {
+		maxSeconds = DefaultMaxTranscriptSeconds
+	}
+
+	seconds, err := strconv.Atoi(query.Get("seconds"))
+	if err != nil || seconds <= 0 || seconds > maxSeconds {
+		seconds = maxSeconds
+	}
+
+	var sink TranscriptSink
+	var target string
+	switch query.Get("sink") {
+	case "nats":
+		if w.config.TranscriptSubject == "" {
+			http.Error(writer, "transcript subject not configured", http.StatusBadRequest)
+			return
+		}
+		target = fmt.Sprintf("%s.%d", w.config.TranscriptSubject, id)
+		sink, err = NewNatsTranscriptSink(w.natsPool, target)
+	default:
+		if w.config.TranscriptDir == "" {
+			http.Error(writer, "transcript directory not configured", http.StatusBadRequest)
+			return
+		}
+		target = filepath.Join(w.config.TranscriptDir, fmt.Sprintf("connection-%d-%d.jsonl", id, time.Now().Unix()))
+		sink, err = NewFileTranscriptSink(target)
+	}
+
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	maxPayload := w.config.TranscriptMaxPayload
+	if maxPayload <= 0 {
+		maxPayload = DefaultTranscriptMaxPayload
+	}
+
+	duration := time.Duration(seconds) * time.Second
+	transcript := NewTranscript(sink, duration, maxPayload, w.transcriptRedactions)
+	connection.SetTranscript(transcript)
+	time.AfterFunc(duration, transcript.Close)
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]interface{}{
+		"connectionId": id,
+		"seconds":      seconds,
+		"target":       target,
+	})
+}
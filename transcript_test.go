@@ -0,0 +1,44 @@
+package websocketnats
+
+import (
+	"regexp"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryTranscriptSink struct {
+	frames []TranscriptFrame
+	closed bool
+}
+
+func (s *memoryTranscriptSink) Write(frame TranscriptFrame) error {
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+func (s *memoryTranscriptSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestTranscriptRecord(t *T) {
+	sink := &memoryTranscriptSink{}
+	transcript := NewTranscript(sink, time.Minute, 20, []*regexp.Regexp{regexp.MustCompile(`secret=\w+`)})
+
+	assert.True(t, transcript.Record(1, TranscriptInbound, websocket.TextMessage, []byte(LoginPrefix+MockJWT)))
+	assert.True(t, transcript.Record(1, TranscriptOutbound, websocket.TextMessage, []byte("secret=abc")))
+	assert.True(t, transcript.Record(1, TranscriptOutbound, websocket.TextMessage, []byte("0123456789abcdefghijklmno")))
+
+	assert.Equal(t, LoginPrefix+"[REDACTED]", sink.frames[0].Payload)
+	assert.Equal(t, "[REDACTED]", sink.frames[1].Payload)
+	assert.Equal(t, "0123456789abcdefghij", sink.frames[2].Payload)
+	assert.True(t, sink.frames[2].Truncated)
+	assert.Equal(t, 25, sink.frames[2].Size)
+
+	transcript.Close()
+	assert.True(t, sink.closed)
+	assert.False(t, transcript.Record(1, TranscriptInbound, websocket.TextMessage, []byte("ping")))
+}
@@ -0,0 +1,135 @@
+package websocketnats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport message oriented connection to a client. *websocket.Conn is the default transport,
+// the stream transport carries the experimental WebTransport sessions
+type Transport interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetReadDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	Close() error
+}
+
+// TransportUpgrader upgrade an admitted request to a transport, returning the subprotocol the client negotiated if any
+type TransportUpgrader func(writer http.ResponseWriter, request *http.Request) (transport Transport, subprotocol string, err error)
+
+var errFrameTooLarge = errors.New("transport: frame too large")
+
+// StreamTransport transport over a bidirectional stream, e.g. a WebTransport stream over HTTP/3.
+// Each message is framed by its websocket message type on one byte and its length on 4 bytes big-endian
+type StreamTransport struct {
+	stream     io.ReadWriteCloser
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	readLimit  int64
+}
+
+// NewStreamTransport init the transport over the stream
+func NewStreamTransport(stream io.ReadWriteCloser) *StreamTransport {
+	return &StreamTransport{
+		stream:     stream,
+		reader:     bufio.NewReader(stream),
+		writeMutex: sync.Mutex{},
+	}
+}
+
+// ReadMessage read the next message. The end of the stream and the close messages are reported as a normal closure
+func (t *StreamTransport) ReadMessage() (messageType int, p []byte, err error) {
+	header := make([]byte, 5)
+	if _, err = io.ReadFull(t.reader, header); err != nil {
+		if err == io.EOF {
+			err = &websocket.CloseError{Code: websocket.CloseNormalClosure}
+		}
+		return
+	}
+
+	messageType = int(header[0])
+	length := binary.BigEndian.Uint32(header[1:])
+	if t.readLimit > 0 && int64(length) > t.readLimit {
+		return 0, nil, errFrameTooLarge
+	}
+
+	p = make([]byte, length)
+	if _, err = io.ReadFull(t.reader, p); err != nil {
+		return
+	}
+
+	if messageType == websocket.CloseMessage {
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}
+	return
+}
+
+// SetWriteDeadline set the write deadline of the stream if it supports one
+func (t *StreamTransport) SetWriteDeadline(deadline time.Time) error {
+	if stream, ok := t.stream.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		return stream.SetWriteDeadline(deadline)
+	}
+	return nil
+}
+
+// WriteMessage write a message
+func (t *StreamTransport) WriteMessage(messageType int, data []byte) error {
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = byte(messageType)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+
+	_, err := t.stream.Write(frame)
+	return err
+}
+
+// SetReadDeadline set the read deadline if the stream supports it
+func (t *StreamTransport) SetReadDeadline(deadline time.Time) error {
+	if stream, ok := t.stream.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return stream.SetReadDeadline(deadline)
+	}
+	return nil
+}
+
+// SetReadLimit set the maximum size of a message read from the client. 0 means no limit
+func (t *StreamTransport) SetReadLimit(limit int64) {
+	t.readLimit = limit
+}
+
+// Close close the stream
+func (t *StreamTransport) Close() error {
+	return t.stream.Close()
+}
+
+// WebTransportHandler experimental handler serving the clients of another transport, e.g. WebTransport over HTTP/3,
+// through the same admission, session, auth and subscription layers as the websocket clients.
+// The upgrader runs once the request is admitted, typically accepting the session and its first bidirectional stream
+func (w *NatsWebSocket) WebTransportHandler(upgrader TransportUpgrader) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		w.accept(writer, request, upgrader)
+	})
+}
+
+// upgradeWebsocket the websocket upgrader of the transports
+func (w *NatsWebSocket) upgradeWebsocket(writer http.ResponseWriter, request *http.Request) (Transport, string, error) {
+	if w.upgrader.EnableCompression && offersCompression(request) {
+		return w.upgradeCompressed(writer, request)
+	}
+
+	connection, err := w.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return connection, connection.Subprotocol(), nil
+}
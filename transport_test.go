@@ -0,0 +1,53 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamTransport(t *T) {
+	client, server := net.Pipe()
+	clientTransport := NewStreamTransport(client)
+	serverTransport := NewStreamTransport(server)
+	serverTransport.SetReadLimit(8)
+
+	go func() {
+		clientTransport.WriteMessage(websocket.TextMessage, []byte("ping"))
+		clientTransport.WriteMessage(websocket.BinaryMessage, []byte("too large"))
+	}()
+
+	messageType, message, err := serverTransport.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.Equal(t, "ping", string(message))
+
+	_, _, err = serverTransport.ReadMessage()
+	assert.Equal(t, errFrameTooLarge, err)
+
+	client2, server2 := net.Pipe()
+	go client2.Close()
+	_, _, err = NewStreamTransport(server2).ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	server.Close()
+}
+
+func TestCloseTwice(t *T) {
+	client, server := net.Pipe()
+	go discard(client)
+	connection := NewConnection(1, NewStreamTransport(server))
+	connection.Login("user", "phone")
+
+	done := make(chan struct{})
+	go func() {
+		connection.Close(websocket.CloseGoingAway, "first")
+		close(done)
+	}()
+	connection.Close(websocket.CloseGoingAway, "second")
+	<-done
+
+	assert.True(t, connection.IsClosed())
+	assert.False(t, connection.IsLoggedIn())
+}
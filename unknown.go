@@ -0,0 +1,47 @@
+package websocketnats
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// UnknownCommandIgnore unknown commands are logged and ignored, the default
+	UnknownCommandIgnore = "ignore"
+	// UnknownCommandReply unknown commands are answered with UnknownCommandResponse
+	UnknownCommandReply = "reply"
+	// UnknownCommandScore unknown commands are answered and counted, the connection being disconnected after Config.MaxUnknownCommands
+	UnknownCommandScore = "score"
+
+	// UnknownCommandResponse response of the unknown commands
+	UnknownCommandResponse = "unknown command"
+	// DefaultMaxUnknownCommands default number of unknown commands a connection may send with the score policy
+	DefaultMaxUnknownCommands = 10
+)
+
+// onUnknownCommand handle a command matching no prefix according to Config.UnknownCommands
+func (w *NatsWebSocket) onUnknownCommand(connection *Connection, message []byte) {
+	connection.Logf("unknown command: %.32q", message)
+	w.metrics.Counter("gateway_unknown_commands_total", "Commands matching no known command").Inc()
+
+	switch w.config.UnknownCommands {
+	case UnknownCommandReply:
+		connection.Reply([]byte(UnknownCommandResponse))
+	case UnknownCommandScore:
+		connection.Reply([]byte(UnknownCommandResponse))
+
+		connection.dataMutex.Lock()
+		connection.unknownCommands++
+		score := connection.unknownCommands
+		connection.dataMutex.Unlock()
+
+		max := w.liveConfig().MaxUnknownCommands
+		if max <= 0 {
+			max = DefaultMaxUnknownCommands
+		}
+		if score >= max {
+			connection.Logf("too many unknown commands, disconnecting")
+			w.metrics.Counter("gateway_unknown_command_disconnects_total", "Connections disconnected for sending too many unknown commands").Inc()
+			w.disconnect(connection, websocket.ClosePolicyViolation, "TooManyUnknownCommands")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnknownCommandScore(t *T) {
+	w := New(&Config{UnknownCommands: UnknownCommandScore, MaxUnknownCommands: 2})
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := NewConnection(1, NewStreamTransport(server))
+
+	done := make(chan struct{})
+	go func() {
+		w.onTextMessage(connection, []byte("subscribe>:news"))
+		w.onTextMessage(connection, []byte("subscribe>:news"))
+		close(done)
+	}()
+
+	reader := NewStreamTransport(client)
+	for i := 0; i < 2; i++ {
+		_, message, err := reader.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, UnknownCommandResponse, string(message))
+	}
+	assert.Equal(t, "unknown_command", replyEnvelope([]byte(UnknownCommandResponse), 1).Error)
+
+	reader.ReadMessage()
+	<-done
+	assert.Equal(t, ConnectionID(-1), connection.id)
+}
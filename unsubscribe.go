@@ -0,0 +1,48 @@
+package websocketnats
+
+const (
+	// DuplicateIdempotent subscribing again to a topic succeeds without subscribing twice
+	DuplicateIdempotent = "idempotent"
+	// DuplicateError subscribing again to a topic is rejected with "already subscribed"
+	DuplicateError = "error"
+	// DuplicateRefCount subscribing again to a topic counts a reference, the topic is unsubscribed once every subscribe is matched by an unsubscribe
+	DuplicateRefCount = "refcount"
+
+	// UnsubscribedSessionEvent the connection unsubscribed from a topic
+	UnsubscribedSessionEvent = "unsubscribed"
+)
+
+// unsubscribe drop the subscription of the connection to the topic
+func (w *NatsWebSocket) unsubscribe(connection *Connection, topic string) {
+	if !connection.IsSubscribed(topic) {
+		connection.Reply([]byte("not subscribed"))
+		return
+	}
+
+	if w.config.DuplicateSubscriptions == DuplicateRefCount && !connection.ReleaseSubscription(topic) {
+		return
+	}
+
+	connection.RemoveSubscription(topic)
+	w.releaseTopic(connection, topic, true)
+
+	w.sendSessionEvent(connection, GatewayMessage{Event: UnsubscribedSessionEvent, EventTopic: topic})
+}
+
+// releaseTopic release what the subscription of the connection to the topic holds. deleteDurable deletes its durable
+// stream consumer too, see JetStreamBridge.Release
+func (w *NatsWebSocket) releaseTopic(connection *Connection, topic string, deleteDurable bool) {
+	if w.jetstream != nil {
+		w.jetstream.Release(connection, topic, deleteDurable)
+	}
+	if w.merged != nil {
+		w.merged.Unsubscribe(connection, topic)
+	}
+	if w.ordered != nil {
+		w.ordered.Unsubscribe(connection, w.routeSubject(connection, topic))
+	} else if w.subscriptions != nil {
+		w.subscriptions.Unsubscribe(connection, w.routeSubject(connection, topic))
+	}
+	w.callbacks.Release(connection, topic)
+	w.fanout.Release(topic)
+}
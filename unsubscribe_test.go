@@ -0,0 +1,24 @@
+package websocketnats
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionRefCount(t *T) {
+	connection := NewConnection(1, nil)
+
+	assert.True(t, connection.AddSubscription("test.a", nil))
+	connection.RetainSubscription("test.a")
+
+	assert.False(t, connection.ReleaseSubscription("test.a"))
+	assert.True(t, connection.ReleaseSubscription("test.a"))
+
+	connection.RemoveSubscription("test.a")
+	assert.False(t, connection.IsSubscribed("test.a"))
+
+	// subscribing again starts over
+	assert.True(t, connection.AddSubscription("test.a", nil))
+	assert.True(t, connection.ReleaseSubscription("test.a"))
+}
@@ -0,0 +1,60 @@
+package websocketnats
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// newUpgrader init the websocket upgrader of the config: the buffer sizes, the compression, the subprotocols and the origin
+// check of Config.AllowedOrigins
+func (w *NatsWebSocket) newUpgrader() websocket.Upgrader {
+	subprotocols := w.config.Subprotocols
+	if len(subprotocols) == 0 {
+		subprotocols = []string{ProtobufSubprotocol, JSONSubprotocol}
+	}
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:    w.config.ReadBufferSize,
+		WriteBufferSize:   w.config.WriteBufferSize,
+		EnableCompression: w.config.EnableCompression,
+		Subprotocols:      subprotocols,
+	}
+	if len(w.config.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = w.checkOrigin
+	}
+	return upgrader
+}
+
+// checkOrigin accept the upgrades without origin, e.g. from the native clients, or from an origin of Config.AllowedOrigins
+func (w *NatsWebSocket) checkOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" || matchOrigin(w.config.AllowedOrigins, origin) {
+		return true
+	}
+
+	w.metrics.Counter("gateway_origin_rejected_total", "Upgrades rejected for their origin").Inc()
+	w.logger.Printf("upgrade rejected: origin %.64q not allowed", origin)
+	return false
+}
+
+// matchOrigin match the origin against the allowed origins, e.g. https://app.example.com, https://*.example.com or * for any origin
+func matchOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+
+		if index := strings.Index(pattern, "*."); index >= 0 {
+			prefix, suffix := pattern[:index], pattern[index+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package websocketnats
+
+import (
+	"net/http/httptest"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchOrigin(t *T) {
+	allowed := []string{"https://app.example.com", "https://*.example.org"}
+
+	assert.True(t, matchOrigin(allowed, "https://APP.example.com"))
+	assert.True(t, matchOrigin(allowed, "https://eu.example.org"))
+	assert.False(t, matchOrigin(allowed, "https://example.org"))
+	assert.False(t, matchOrigin(allowed, "http://eu.example.org"))
+	assert.False(t, matchOrigin(allowed, "https://evil.com:.example.org"))
+	assert.False(t, matchOrigin(allowed, "https://evil.com"))
+	assert.True(t, matchOrigin([]string{"*"}, "https://evil.com"))
+}
+
+func TestNewUpgrader(t *T) {
+	w := New(&Config{AllowedOrigins: []string{"https://app.example.com"}, ReadBufferSize: 512, Subprotocols: []string{JSONSubprotocol}})
+	assert.Equal(t, 512, w.upgrader.ReadBufferSize)
+	assert.Equal(t, []string{JSONSubprotocol}, w.upgrader.Subprotocols)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	assert.True(t, w.upgrader.CheckOrigin(request))
+	request.Header.Set("Origin", "https://app.example.com")
+	assert.True(t, w.upgrader.CheckOrigin(request))
+	request.Header.Set("Origin", "https://evil.com")
+	assert.False(t, w.upgrader.CheckOrigin(request))
+
+	assert.Nil(t, New(&Config{}).upgrader.CheckOrigin)
+	assert.NotNil(t, (&Config{URLPattern: "/", Subprotocols: []string{"mqtt"}}).Validate())
+}
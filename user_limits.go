@@ -0,0 +1,52 @@
+package websocketnats
+
+import (
+	"sort"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// UserLimitReject a login past Config.MaxConnectionsPerUser is rejected with login>:too many connections
+	UserLimitReject = "reject"
+	// UserLimitEvict a login past Config.MaxConnectionsPerUser closes the oldest connections of the user
+	UserLimitEvict = "evict"
+
+	// TooManyConnectionsResponse login response past Config.MaxConnectionsPerUser with UserLimitReject
+	TooManyConnectionsResponse = "too many connections"
+	// TooManyConnectionsReason close reason of the connections evicted by UserLimitEvict
+	TooManyConnectionsReason = "TooManyConnections"
+)
+
+// admitUser enforce Config.MaxConnectionsPerUser on the login of the device, whose previous connection if any doesn't
+// count since it is replaced. Returns false if the login is rejected
+func (w *NatsWebSocket) admitUser(userID UserID, deviceID DeviceID) bool {
+	config := w.liveConfig()
+	if config.MaxConnectionsPerUser <= 0 {
+		return true
+	}
+
+	others := []*Connection{}
+	for _, connection := range w.connections.ListUserConnections(userID) {
+		if _, _, connectionDeviceID := connection.GetInfo(); connectionDeviceID != deviceID {
+			others = append(others, connection)
+		}
+	}
+	excess := len(others) - config.MaxConnectionsPerUser + 1
+	if excess <= 0 {
+		return true
+	}
+
+	if config.UserLimitPolicy != UserLimitEvict {
+		w.metrics.Counter("gateway_user_limit_total", "Logins past the connections per user by action", "action", UserLimitReject).Inc()
+		return false
+	}
+
+	sort.Slice(others, func(i, j int) bool { return others[i].GetStartTime().Before(others[j].GetStartTime()) })
+	for _, oldest := range others[:excess] {
+		oldest.Logf("evicted by a newer connection of the user")
+		w.disconnect(oldest, websocket.ClosePolicyViolation, TooManyConnectionsReason)
+	}
+	w.metrics.Counter("gateway_user_limit_total", "Logins past the connections per user by action", "action", UserLimitEvict).Add(float64(excess))
+	return true
+}
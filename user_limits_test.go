@@ -0,0 +1,41 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmitUser(t *T) {
+	w := New(&Config{MaxConnectionsPerUser: 2}, WithPool(unavailablePool{}))
+
+	connect := func(userID UserID, deviceID DeviceID, age time.Duration) *Connection {
+		client, server := net.Pipe()
+		go discard(client)
+		connection := w.registerConnection(NewStreamTransport(server))
+		connection.startTime = time.Now().Add(-age)
+		connection.Login(userID, deviceID)
+		w.connections.OnLogin(connection)
+		return connection
+	}
+	connect("user", "phone", 2*time.Minute)
+	connect("user", "laptop", time.Minute)
+	connect("other", "desktop", time.Hour)
+
+	assert.True(t, w.admitUser("user", "phone"), "the device replaces its own connection")
+	assert.True(t, w.admitUser("other", "laptop"))
+	assert.False(t, w.admitUser("user", "tablet"))
+	assert.Len(t, w.connections.ListUserConnections("user"), 2)
+
+	w.config.UserLimitPolicy = UserLimitEvict
+	assert.True(t, w.admitUser("user", "tablet"))
+	remaining := w.connections.ListUserConnections("user")
+	assert.Len(t, remaining, 1)
+	_, _, deviceID := remaining[0].GetInfo()
+	assert.Equal(t, DeviceID("laptop"), deviceID, "the oldest connection is evicted")
+
+	assert.Nil(t, (&Config{URLPattern: "/", UserLimitPolicy: UserLimitEvict}).Validate())
+	assert.NotNil(t, (&Config{URLPattern: "/", UserLimitPolicy: "drop"}).Validate())
+}
@@ -0,0 +1,60 @@
+package websocketnats
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+const (
+	// ProtocolVersion version of the websocket protocol spoken by the gateway, bumped on incompatible changes
+	ProtocolVersion = 1
+
+	// VersionCapability capability a client declares to get the build version in the login reply, i.e. ok:<version>
+	VersionCapability = "version"
+)
+
+// build metadata, set at link time, e.g.
+// go build -ldflags "-X github.com/ilovelili/dongfeng-websocket-nats.version=1.4.0 -X github.com/ilovelili/dongfeng-websocket-nats.commit=$(git rev-parse HEAD)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+// BuildInfo build metadata of the gateway
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Protocol  int    `json:"protocol"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Version get the version of the gateway build
+func Version() string {
+	return version
+}
+
+// Build get the build metadata of the gateway
+func Build() BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		Protocol:  ProtocolVersion,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// handleStatus status endpoint reporting the build and the state of the instance
+func (w *NatsWebSocket) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]interface{}{
+		"instanceId": w.instanceID,
+		"build":      Build(),
+		"ready":      w.IsReady(),
+		"draining":   w.IsDraining(),
+		"stats":      w.connections.GetStats(),
+	})
+}
@@ -1,23 +1,32 @@
-// Package websocketnats One-way websocket gateway for nats.
+// Package websocketnats websocket gateway for nats.
 // limitations:
-// . Does not support sending data to websocket server except login request
-// . Does not support protobuf
-// . Does not support websocket binary reading / sending
+// . Clients only send commands, e.g. login, subscribe or publish to the allow-listed subjects
+// . Clients speak the json protocol, see JSONSubprotocol, the prefix protocol is kept behind Config.LegacyProtocol
+// . Clients negotiating the protobuf subprotocol exchange the Envelope of protocol/envelope.proto in binary frames
 // The unsupported features can be easily added into the lib if we need rich websocket functionalities
 package websocketnats
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/gorilla/websocket"
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 // Config configurations of nats websocket gateway
@@ -28,7 +37,364 @@ type Config struct {
 	NatsAddress     string   `json:"natsAddress"`
 	NatsPoolSize    int      `json:"natsPoolSize"`
 	NatsTopics      []string `json:"natsTopics"`
-	RemoteAddr      string   `json:"remoteAddr"`
+	// SubscriptionConnections number of pooled nats connections the subscriptions are multiplexed over, by subject.
+	// Defaults to DefaultSubscriptionConnections
+	SubscriptionConnections int `json:"subscriptionConnections"`
+	// JWKSCacheTTL time in seconds the JWKS is cached. Defaults to DefaultJWKSCacheTTL
+	JWKSCacheTTL int `json:"jwksCacheTtl"`
+	// JWKSTimeout timeout in milliseconds of the JWKS fetches. Defaults to DefaultJWKSTimeout
+	JWKSTimeout int `json:"jwksTimeout"`
+	// Topics topics the clients may subscribe to, with their policy. Supersedes NatsTopics, whose entries are kept as topics without policy
+	Topics []TopicConfig `json:"topics"`
+	// RolesClaim token claim holding the roles required by TopicConfig.Roles. Defaults to DefaultRolesClaim
+	RolesClaim string `json:"rolesClaim"`
+	// UnknownCommands policy of the commands matching no known command, UnknownCommandIgnore, UnknownCommandReply or
+	// UnknownCommandScore. Defaults to UnknownCommandIgnore
+	UnknownCommands string `json:"unknownCommands"`
+	// MaxUnknownCommands unknown commands after which a connection is disconnected with UnknownCommandScore. Defaults to DefaultMaxUnknownCommands
+	MaxUnknownCommands int `json:"maxUnknownCommands"`
+	// ReadOnlyRoles token roles of the observers, e.g. dashboards, which may subscribe but are refused the publish and request commands
+	ReadOnlyRoles []string `json:"readOnlyRoles"`
+	// Region region label of the instance, serving the topics restricted to it by TopicConfig.Regions
+	Region string `json:"region"`
+	// TemporaryTopics allow the clients to subscribe to the topics scoped to their session, <TemporaryTopicPrefix>.<session id>.>,
+	// e.g. progress streams of backend jobs. The session id is replied to tmp>:
+	TemporaryTopics bool `json:"temporaryTopics"`
+	// TemporaryTopicPrefix first token of the temporary topics. Defaults to DefaultTemporaryTopicPrefix
+	TemporaryTopicPrefix string `json:"temporaryTopicPrefix"`
+	// RegionEndpoints public endpoint of the gateways of each region, sent to the clients subscribing to a topic of another region
+	RegionEndpoints map[string]string `json:"regionEndpoints"`
+	// JetStreamDeliverPrefix subject prefix the durable consumers of the stream topics deliver to. Defaults to DefaultJetStreamDeliverPrefix
+	JetStreamDeliverPrefix string `json:"jetStreamDeliverPrefix"`
+	// PublishTopics nats subjects the logged in clients may publish to with publish>:, wildcards allowed, e.g. chat.>
+	PublishTopics []string `json:"publishTopics"`
+	// RequestTopics nats subjects the logged in clients may send requests to with request>:, wildcards allowed, e.g. rpc.>
+	RequestTopics []string `json:"requestTopics"`
+	// RequestTimeout timeout in milliseconds of the requests. Defaults to DefaultRequestTimeout
+	RequestTimeout int `json:"requestTimeout"`
+	// MaxPendingRequests number of requests a connection may have waiting for their reply. Defaults to DefaultMaxPendingRequests
+	MaxPendingRequests int `json:"maxPendingRequests"`
+	// SoftLimitRatio ratio of the limits at which the clients are warned with a limit_warning notice before being rejected,
+	// dropped or disconnected, e.g. 0.8. 0 disables the warnings
+	SoftLimitRatio float64 `json:"softLimitRatio"`
+	// SoftLimits ratio overriding SoftLimitRatio by limit, e.g. {"topic_rate": 0.5}
+	SoftLimits map[string]float64 `json:"softLimits"`
+	// LimitWarningInterval time in seconds between two warnings of the same limit. Defaults to DefaultLimitWarningInterval
+	LimitWarningInterval int `json:"limitWarningInterval"`
+	// PreferencesTTL time in seconds the notification preferences of a connection are cached. Defaults to DefaultPreferencesTTL
+	PreferencesTTL int `json:"preferencesTtl"`
+	// AnalyticsURL url the session records are posted to as newline delimited json, e.g. the ClickHouse http interface
+	AnalyticsURL string `json:"analyticsUrl"`
+	// AnalyticsFile file the session records are appended to as newline delimited json, if no AnalyticsURL is set
+	AnalyticsFile string `json:"analyticsFile"`
+	// AnalyticsTimeout timeout in milliseconds of the posts to AnalyticsURL. Defaults to DefaultAnalyticsTimeout
+	AnalyticsTimeout int `json:"analyticsTimeout"`
+	// AnalyticsBatchSize number of session records written at once. Defaults to DefaultAnalyticsBatchSize
+	AnalyticsBatchSize int `json:"analyticsBatchSize"`
+	// AnalyticsFlushInterval interval in seconds the pending session records are written. Defaults to DefaultAnalyticsFlushInterval
+	AnalyticsFlushInterval int `json:"analyticsFlushInterval"`
+	// AnalyticsQueueSize number of session records waiting to be written, beyond which they are dropped. Defaults to DefaultAnalyticsQueueSize
+	AnalyticsQueueSize int `json:"analyticsQueueSize"`
+	// Deprecated: RemoteAddr is no longer used as device id, see DeviceIdentifier
+	RemoteAddr string `json:"remoteAddr"`
+	// MaxConnectionLogsPerMinute number of log lines a single connection may write per minute. Defaults to DefaultMaxConnectionLogsPerMinute
+	MaxConnectionLogsPerMinute int `json:"maxConnectionLogsPerMinute"`
+	// MaxConnectsPerSecond upgrade requests per second before admission control kicks in. 0 disables the throttling
+	MaxConnectsPerSecond int `json:"maxConnectsPerSecond"`
+	// ConnectRetryAfter base Retry-After in seconds sent with the 503 of throttled upgrade requests. Defaults to DefaultAcceptRetryAfter
+	ConnectRetryAfter int `json:"connectRetryAfter"`
+	// MaxConcurrentUpgrades number of upgrade handshakes in flight at once. 0 disables the limit
+	MaxConcurrentUpgrades int `json:"maxConcurrentUpgrades"`
+	// MaxQueuedUpgrades number of upgrade requests waiting for a free slot, the others are rejected with 503
+	MaxQueuedUpgrades int `json:"maxQueuedUpgrades"`
+	// UpgradeQueueTimeout time in milliseconds a queued upgrade request waits for a slot. Defaults to DefaultUpgradeQueueTimeout
+	UpgradeQueueTimeout int `json:"upgradeQueueTimeout"`
+	// OrderedUserDelivery deliver the messages of all the subscriptions of a user through a single FIFO queue.
+	// Without it messages of different topics may reach the client in another order than they were published
+	OrderedUserDelivery bool `json:"orderedUserDelivery"`
+	// DeliveryDeadline time in milliseconds a nats message may spend being delivered to the subscribers of a topic, or to the devices of a user in ordered mode,
+	// the remaining ones get it asynchronously. 0 disables the deadline
+	DeliveryDeadline int `json:"deliveryDeadline"`
+	// OrderedQueueSize size of the per user queue in ordered mode. Defaults to DefaultOrderedQueueSize
+	OrderedQueueSize int `json:"orderedQueueSize"`
+	// OutboundHighWatermark number of frames waiting to be written across all the connections above which
+	// the upstream subscriptions are paused, until the depth drops to half of it. 0 disables the pausing
+	OutboundHighWatermark int `json:"outboundHighWatermark"`
+	// MaxOutboundPause time in milliseconds a subscription is paused at most. Defaults to DefaultMaxOutboundPause
+	MaxOutboundPause int `json:"maxOutboundPause"`
+	// DuplicateSubscriptions what a subscribe to a topic the connection is already subscribed to does:
+	// DuplicateIdempotent (default), DuplicateError or DuplicateRefCount
+	DuplicateSubscriptions string `json:"duplicateSubscriptions"`
+	// CanaryPercent percentage of the users whose connections are canaries
+	CanaryPercent int `json:"canaryPercent"`
+	// CanaryClaims token claims marking the connection as a canary, e.g. {"group": "beta"}
+	CanaryClaims map[string]string `json:"canaryClaims"`
+	// CanaryTopicPrefix prefix of the nats subjects the canary connections subscribe to instead of the topics, e.g. v2.
+	CanaryTopicPrefix string `json:"canaryTopicPrefix"`
+	// ConnectWelcome text/template of the message sent on connect, executed with WelcomeData, e.g. welcome>:{"version":"{{.Version}}"}
+	ConnectWelcome string `json:"connectWelcome"`
+	// LoginWelcome text/template of the message sent after the login reply, executed with WelcomeData
+	LoginWelcome string `json:"loginWelcome"`
+	// FeatureFlags feature flags of the deployment given to the welcome templates
+	FeatureFlags []string `json:"featureFlags"`
+	// AudienceNamespaces topic patterns each token audience (aud or azp claim) may subscribe to, e.g. {"dashboard": ["dash.>"]}.
+	// Tokens of an unmapped audience may not subscribe to anything once set
+	AudienceNamespaces map[string][]string `json:"audienceNamespaces"`
+	// HistoryURL url of the http history service backing the history>: command, see HTTPHistorySource
+	HistoryURL string `json:"historyUrl"`
+	// HistorySubject subject of the nats history service backing the history>: command if no HistoryURL is set, see NatsHistorySource
+	HistorySubject string `json:"historySubject"`
+	// HistoryTimeout timeout in milliseconds of the history service calls. Defaults to DefaultHistoryTimeout
+	HistoryTimeout int `json:"historyTimeout"`
+	// MessageIDField field of the json payloads identifying the messages. Defaults to DefaultMessageIDField
+	MessageIDField string `json:"messageIdField"`
+	// MaxMessageSize max size in bytes of a message delivered to a client, the larger ones are replaced by an oversized notice.
+	// Clients may lower it with the maxMessageSize query parameter of the upgrade url, down to MinMessageSize. 0 disables the limit
+	MaxMessageSize int `json:"maxMessageSize"`
+	// MaxReadSizeBeforeLogin max size in bytes of a message read from a client before its login, the connection being
+	// closed with 1009 beyond. Defaults to the limit of WithReadLimit, DefaultReadLimit unless set
+	MaxReadSizeBeforeLogin int64 `json:"maxReadSizeBeforeLogin"`
+	// MaxReadSize max size in bytes of a message read from a logged in client, the connection being closed with 1009 beyond.
+	// Defaults to DefaultMaxReadSize
+	MaxReadSize int64 `json:"maxReadSize"`
+	// ClaimCheckURL public url the oversized messages are served on, ending with ClaimCheckPath, e.g. https://gateway.example.com/claims/.
+	// The url of the message is sent with the oversized notice
+	ClaimCheckURL string `json:"claimCheckUrl"`
+	// ClaimCheckTTL time in seconds an oversized message can be fetched. Defaults to DefaultClaimCheckTTL
+	ClaimCheckTTL int `json:"claimCheckTtl"`
+	// ClaimCheckMaxBytes max bytes of oversized messages kept for the claim-check urls, the oldest being evicted first.
+	// Defaults to DefaultClaimCheckMaxBytes
+	ClaimCheckMaxBytes int `json:"claimCheckMaxBytes"`
+	// MessageTimestampField field of the json payloads holding their publish time, used by the new_only subscription option.
+	// Defaults to DefaultMessageTimestampField
+	MessageTimestampField string `json:"messageTimestampField"`
+	// TopicFanout fan-out cap per topic on this instance
+	TopicFanout map[string]TopicFanout `json:"topicFanout"`
+	// ClientHeartbeatInterval interval in seconds the logged in clients must send a frame within, e.g. ping, advertised after the login.
+	// 0 disables the enforcement
+	ClientHeartbeatInterval int `json:"clientHeartbeatInterval"`
+	// MaxClientHeartbeatInterval longest interval in seconds a client may ask with the heartbeat query parameter, e.g. on battery
+	MaxClientHeartbeatInterval int `json:"maxClientHeartbeatInterval"`
+	// ClientHeartbeatTolerance number of intervals a client may miss. Defaults to DefaultClientHeartbeatTolerance
+	ClientHeartbeatTolerance int `json:"clientHeartbeatTolerance"`
+	// HeartbeatLoadThreshold number of connections above which the advertised interval is doubled. 0 disables the scaling
+	HeartbeatLoadThreshold int `json:"heartbeatLoadThreshold"`
+	// PingInterval interval in seconds the gateway pings the connections with websocket ping frames, so the half-open ones
+	// are detected without the clients sending pings. 0 disables the pings
+	PingInterval int `json:"pingInterval"`
+	// PongTimeout time in seconds without any frame or pong after which a pinged connection is closed. Defaults to twice PingInterval
+	PongTimeout int `json:"pongTimeout"`
+	// WriteTimeout time in seconds to write a frame to a client before its connection is closed, so a stuck peer
+	// doesn't block the nats callbacks. Defaults to DefaultWriteTimeout, negative disables it
+	WriteTimeout int `json:"writeTimeout"`
+	// MaxOutboundMessagesPerSecond and MaxOutboundBytesPerSecond limit the messages of the topics delivered to each
+	// connection, with a burst of one second, so a chatty topic can't saturate a mobile client. 0 is unlimited
+	MaxOutboundMessagesPerSecond int `json:"maxOutboundMessagesPerSecond"`
+	MaxOutboundBytesPerSecond    int `json:"maxOutboundBytesPerSecond"`
+	// OutboundRatePolicy what a message over the outbound rate does, OutboundRateDrop (default) drops it and
+	// OutboundRateCoalesce keeps the latest message of each topic until the rate allows it
+	OutboundRatePolicy string `json:"outboundRatePolicy"`
+	// SendQueueSize number of frames queued per connection for its writer goroutine, so the nats deliveries don't wait on
+	// the slow clients. 0 writes the frames from the sending goroutine
+	SendQueueSize int `json:"sendQueueSize"`
+	// SendQueuePolicy what a full send queue does, SendQueueDrop (default) drops the frame and SendQueueClose closes the connection
+	SendQueuePolicy string `json:"sendQueuePolicy"`
+	// MaxConnections maximum number of connections of the gateway, further upgrades are rejected with 503 rather than
+	// degrading the existing clients. 0 is unlimited
+	MaxConnections int `json:"maxConnections"`
+	// MaxAnonymousConnectionsPerIP maximum number of connections not logged in yet from a client IP, further upgrades
+	// are rejected with 429. 0 is unlimited. Behind a load balancer, set TrustedProxies so the clients aren't counted
+	// as the IP of the load balancer
+	MaxAnonymousConnectionsPerIP int `json:"maxAnonymousConnectionsPerIP"`
+	// TrustedProxies IPs or CIDRs of the load balancers and ingresses in front of the gateway. The client IP of their
+	// requests is taken from X-Forwarded-For, skipping the trusted proxies, or else from X-Real-IP
+	TrustedProxies []string `json:"trustedProxies"`
+	// MaxConnectionsPerUser maximum number of connections of a user, enforced at login according to UserLimitPolicy.
+	// 0 is unlimited
+	MaxConnectionsPerUser int `json:"maxConnectionsPerUser"`
+	// UserLimitPolicy what a login past MaxConnectionsPerUser does, UserLimitReject (default) rejects it and UserLimitEvict
+	// closes the oldest connections of the user
+	UserLimitPolicy string `json:"userLimitPolicy"`
+	// DisableTokenExpiry keep the connections open past the expiry of their token
+	DisableTokenExpiry bool `json:"disableTokenExpiry"`
+	// TokenExpiryGrace time in seconds a connection stays open after the expiry of its token, to log in with a fresh one
+	TokenExpiryGrace int `json:"tokenExpiryGrace"`
+	// TokenExpiryWarning time in seconds before the expiry of the token the client is sent a token_expiring notice.
+	// Defaults to DefaultTokenExpiryWarning, negative sends none
+	TokenExpiryWarning int `json:"tokenExpiryWarning"`
+	// IdleTimeout time in seconds without any frame or pong after which a logged in connection is closed. 0 disables it
+	IdleTimeout int `json:"idleTimeout"`
+	// AnonymousIdleTimeout time in seconds without any frame or pong after which a connection not logged in is closed.
+	// Defaults to UnLoggedConnectionTimeout, negative disables it
+	AnonymousIdleTimeout int `json:"anonymousIdleTimeout"`
+	// ShutdownGracePeriod time in seconds the connections are given between the shutdown notice and being closed on Stop.
+	// 0 closes them right away
+	ShutdownGracePeriod int `json:"shutdownGracePeriod"`
+	// MaxReconnectDelay upper bound in seconds of the jittered reconnect delay sent in the shutdown notice. Defaults to DefaultMaxReconnectDelay
+	MaxReconnectDelay int `json:"maxReconnectDelay"`
+	// NatsStartupRetry serve websocket connections even if nats is unavailable at startup, and keep retrying nats with backoff.
+	// Subscriptions are refused with NatsUnavailable until connected. Start panics if nats is unavailable otherwise
+	NatsStartupRetry bool `json:"natsStartupRetry"`
+	// NatsServers urls of the nats cluster nodes, superseding NatsAddress. The connections fail over between them
+	// and the nodes the cluster advertises
+	NatsServers []string `json:"natsServers"`
+	// NatsDontRandomize connect to NatsServers in order rather than in random order
+	NatsDontRandomize bool `json:"natsDontRandomize"`
+	// NatsMaxReconnects reconnect attempts of a nats connection before it is closed and its subscriptions moved to another one.
+	// Defaults to DefaultNatsMaxReconnects, negative retries forever
+	NatsMaxReconnects int `json:"natsMaxReconnects"`
+	// NatsReconnectWait time in milliseconds between two reconnect attempts. Defaults to the nats client default
+	NatsReconnectWait int `json:"natsReconnectWait"`
+	// NatsReconnectBufferSize size in bytes of the messages published while reconnecting that are buffered. Defaults to the nats client default
+	NatsReconnectBufferSize int `json:"natsReconnectBufferSize"`
+	// NatsUser user name of the nats connections, with NatsPassword
+	NatsUser string `json:"natsUser"`
+	// NatsPassword password of NatsUser
+	NatsPassword string `json:"natsPassword"`
+	// NatsToken authentication token of the nats connections
+	NatsToken string `json:"natsToken"`
+	// NatsTLSCAFile certificate authorities verifying the nats servers, in PEM
+	NatsTLSCAFile string `json:"natsTlsCaFile"`
+	// NatsTLSCertFile client certificate of the nats connections, with NatsTLSKeyFile
+	NatsTLSCertFile string `json:"natsTlsCertFile"`
+	// NatsTLSKeyFile private key of NatsTLSCertFile
+	NatsTLSKeyFile string `json:"natsTlsKeyFile"`
+	// NatsCredentialsFile credentials file of the nats connections, holding the user JWT and the NKey seed
+	NatsCredentialsFile string `json:"natsCredentialsFile"`
+	// NatsNkeySeedFile NKey seed file of the nats connections, when the servers authenticate NKeys without JWT
+	NatsNkeySeedFile string `json:"natsNkeySeedFile"`
+	// LoginChallenge require the login token to carry the nonce issued by challenge>: as nonce claim, preventing token replay
+	LoginChallenge bool `json:"loginChallenge"`
+	// ChallengeTTL time in seconds a login nonce is valid. Defaults to DefaultChallengeTTL
+	ChallengeTTL int `json:"challengeTtl"`
+	// BinaryPayloads forward the nats payloads in binary frames to every client, not only to the ones declaring the binary capability
+	BinaryPayloads bool `json:"binaryPayloads"`
+	// GzipPayloads decompress the gzip compressed nats payloads for the clients not declaring the gzip capability.
+	// The payloads are detected by the gzip magic number since nats messages carry no headers
+	GzipPayloads bool `json:"gzipPayloads"`
+	// LegacyProtocol keep the prefix protocol, e.g. login>:<token> or topic>:<topic>, for the clients negotiating no subprotocol.
+	// Otherwise they speak the json protocol, see JSONSubprotocol
+	LegacyProtocol bool `json:"legacyProtocol"`
+	// AllowedOrigins origins the browsers may upgrade from, e.g. https://app.example.com, https://*.example.com or * for any.
+	// The upgrades without origin are accepted. Only the same origin is accepted if empty
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// ReadBufferSize and WriteBufferSize size in bytes of the io buffers of the websocket connections, 4096 if 0
+	ReadBufferSize  int `json:"readBufferSize"`
+	WriteBufferSize int `json:"writeBufferSize"`
+	// EnableCompression negotiate the permessage-deflate extension with the clients supporting it
+	EnableCompression bool `json:"enableCompression"`
+	// CompressionLevel flate level of the compressed messages, from -2 for huffman only to 9 for the best compression. 1 if 0
+	CompressionLevel int `json:"compressionLevel"`
+	// CompressionThreshold size in bytes from which the messages are compressed. Defaults to DefaultCompressionThreshold
+	CompressionThreshold int `json:"compressionThreshold"`
+	// Subprotocols websocket subprotocols the gateway negotiates, among ProtobufSubprotocol and JSONSubprotocol. Both if empty
+	Subprotocols []string `json:"subprotocols"`
+	// CommandWorkers number of workers processing the commands off the read loops, so a slow login doesn't block reading the pings.
+	// 0 processes the commands on the read loop
+	CommandWorkers int `json:"commandWorkers"`
+	// MaxPendingCommandsBeforeAuth number of frames a connection not logged in yet may have waiting for the command workers,
+	// beyond which it is disconnected. Defaults to DefaultMaxPendingCommandsBeforeAuth
+	MaxPendingCommandsBeforeAuth int `json:"maxPendingCommandsBeforeAuth"`
+	// CommandPipelining allow several commands in one frame, newline delimited or as a json array of strings
+	CommandPipelining bool `json:"commandPipelining"`
+	// MaxBatchCommands number of commands allowed in one frame. Defaults to DefaultMaxBatchCommands
+	MaxBatchCommands int `json:"maxBatchCommands"`
+	// ServiceTokens tokens of the privileged backend services, see ServicePrefix
+	ServiceTokens []string `json:"serviceTokens"`
+	// InstanceID id of the gateway instance in the fleet. Generated from the hostname and pid if empty
+	InstanceID string `json:"instanceId"`
+	// AdvertiseAddress address of the instance reported to the fleet. Defaults to ListenInterface
+	AdvertiseAddress string `json:"advertiseAddress"`
+	// HeartbeatSubject subject the heartbeats are published to. Defaults to DefaultHeartbeatSubject
+	HeartbeatSubject string `json:"heartbeatSubject"`
+	// HeartbeatInterval heartbeat interval in seconds. Defaults to DefaultHeartbeatInterval, negative disables the heartbeat
+	HeartbeatInterval int `json:"heartbeatInterval"`
+	// GatewayStatsInterval interval in seconds of the snapshots sent to the $gateway.stats subscribers. Defaults to DefaultGatewayStatsInterval
+	GatewayStatsInterval int `json:"gatewayStatsInterval"`
+	// UserPushSubject subject pattern the messages to a user are published to, its * token being the user id.
+	// Defaults to DefaultUserPushSubject
+	UserPushSubject string `json:"userPushSubject"`
+	// DisableUserPush don't subscribe to UserPushSubject
+	DisableUserPush bool `json:"disableUserPush"`
+	// BroadcastSubject subject of the announcements to every connection, suffixed by .users or .anonymous for the logged in
+	// connections or the others only, see Broadcast. Defaults to DefaultBroadcastSubject
+	BroadcastSubject string `json:"broadcastSubject"`
+	// DisableBroadcast don't subscribe to BroadcastSubject
+	DisableBroadcast bool `json:"disableBroadcast"`
+	// PresenceSubject subject of the presence requests, see PresenceRequest. Defaults to DefaultPresenceSubject
+	PresenceSubject string `json:"presenceSubject"`
+	// DisablePresence don't subscribe to PresenceSubject
+	DisablePresence bool `json:"disablePresence"`
+	// ControlSubject subject of the admin commands to every instance, see ControlCommand. The commands to this instance only
+	// are sent to the subject suffixed by the instance id. Disabled if empty
+	ControlSubject string `json:"controlSubject"`
+	// StatsSubject subject the stats reports are published to, for the bus based monitoring. Disabled if empty
+	StatsSubject string `json:"statsSubject"`
+	// StatsPublishInterval interval in seconds of the stats reports. Defaults to DefaultStatsPublishInterval
+	StatsPublishInterval int `json:"statsPublishInterval"`
+	// FlowHighWatermark messages of a topic waiting in the delivery queues at which a slow advisory is published to its producers,
+	// and a resume advisory once they drop to half of it. Disabled if 0
+	FlowHighWatermark int `json:"flowHighWatermark"`
+	// FlowSubjectPrefix prefix of the subjects of the flow advisories, followed by the topic. Defaults to DefaultFlowSubjectPrefix
+	FlowSubjectPrefix string `json:"flowSubjectPrefix"`
+	// StatsDAddress address of the statsd agent the metrics are pushed to, e.g. 127.0.0.1:8125
+	StatsDAddress string `json:"statsdAddress"`
+	// StatsDPrefix prefix of the statsd metric names
+	StatsDPrefix string `json:"statsdPrefix"`
+	// StatsDTags send the metric labels as datadog tags
+	StatsDTags bool `json:"statsdTags"`
+	// MetricsPushInterval interval in seconds the metrics are pushed to the sink. Defaults to DefaultMetricsPushInterval
+	MetricsPushInterval int `json:"metricsPushInterval"`
+	// ListenSockets sockets listening on ListenInterface with SO_REUSEPORT, each with its acceptor loop, for the accept
+	// throughput of the many-core machines during the reconnect storms. A single socket if less than 2. Linux, macOS and FreeBSD only
+	ListenSockets int `json:"listenSockets"`
+	// TCPKeepAlive keep-alive period in seconds of the accepted connections, e.g. below the idle timeout of the NATs and
+	// load balancers on the way. 0 keeps the default of Go, negative disables the keep-alives
+	TCPKeepAlive int `json:"tcpKeepAlive"`
+	// TCPLinger time in seconds the closed connections linger to send their pending data, 0 resetting them instead of
+	// leaving them in TIME_WAIT. The default of the OS if unset
+	TCPLinger *int `json:"tcpLinger"`
+	// TCPNoDelay disable the Nagle algorithm of the accepted connections. Enabled if unset
+	TCPNoDelay *bool `json:"tcpNoDelay"`
+	// TLSCertFile certificate of the listener, serving wss:// and https://. Plain http if empty, unless WithTLSConfig is given
+	TLSCertFile string `json:"tlsCertFile"`
+	// TLSKeyFile private key of the listener certificate
+	TLSKeyFile string `json:"tlsKeyFile"`
+	// WebTransportListen UDP address of the experimental WebTransport listener over HTTP/3, e.g. :4433, serving URLPattern
+	// with the TLSCertFile certificate. Disabled if empty. Requires the webtransport build tag
+	WebTransportListen string `json:"webTransportListen"`
+	// AdminListenInterface separate interface for /metrics and the admin endpoints, /readyz being served on both. If empty
+	// the admin endpoints are served on ListenInterface once AdminToken is set. Requires AdminToken
+	AdminListenInterface string `json:"adminListenInterface"`
+	// AdminTLSCertFile certificate of the admin listener. The admin listener serves plain http if empty
+	AdminTLSCertFile string `json:"adminTlsCertFile"`
+	// AdminTLSKeyFile private key of the admin listener certificate
+	AdminTLSKeyFile string `json:"adminTlsKeyFile"`
+	// AdminToken bearer token required by the admin endpoints. They are not served if empty, only /readyz is
+	AdminToken string `json:"adminToken"`
+	// Pprof serve the net/http/pprof handlers and the runtime stats under /debug/, with the admin endpoints unless
+	// DebugListenInterface is set. Requires DebugToken or AdminToken
+	Pprof bool `json:"pprof"`
+	// DebugListenInterface separate interface for the debug endpoints, see Pprof
+	DebugListenInterface string `json:"debugListenInterface"`
+	// DebugToken bearer token required by the debug endpoints. Defaults to AdminToken
+	DebugToken string `json:"debugToken"`
+	// TranscriptDir directory of the session transcript files
+	TranscriptDir string `json:"transcriptDir"`
+	// TranscriptSubject subject prefix of the session transcripts published to nats, suffixed by the connection id
+	TranscriptSubject string `json:"transcriptSubject"`
+	// TranscriptRedactions regular expressions of the payload parts replaced by [REDACTED] in transcripts. Login tokens are always redacted
+	TranscriptRedactions []string `json:"transcriptRedactions"`
+	// TranscriptMaxPayload payload bytes kept per captured frame. Defaults to DefaultTranscriptMaxPayload
+	TranscriptMaxPayload int `json:"transcriptMaxPayload"`
+	// MaxTranscriptSeconds upper bound of a capture duration. Defaults to DefaultMaxTranscriptSeconds
+	MaxTranscriptSeconds int `json:"maxTranscriptSeconds"`
+	// TapSubject subject prefix the debug taps publish the outbound frames to, suffixed by the connection id
+	TapSubject string `json:"tapSubject"`
+	// TapPolicy what the debug taps may mirror, TapMetadata (default) or TapPayloads
+	TapPolicy string `json:"tapPolicy"`
+	// Soak hidden, makes Start soak test the gateway with synthetic clients and publishers and log the report instead of serving
+	Soak *SoakConfig `json:"soak,omitempty"`
 }
 
 // MessageType Text or Binary
@@ -41,49 +407,230 @@ const (
 	Binary MessageType = 1
 )
 
+const (
+	// DefaultMessageTimestampField default field of the json payloads holding their publish time
+	DefaultMessageTimestampField = "timestamp"
+)
+
 const (
 	// LoginPrefix login prefix
 	LoginPrefix = "login>:"
 
+	// UnsubscribePrefix unsubscribe prefix, e.g. untopic>:<topic>
+	UnsubscribePrefix = "untopic>:"
 	// TopicPrefix message bus topic prefix
 	TopicPrefix = "topic>:"
 )
 
 const (
-	// MaxUnLoggedConnectionCount allow in the pool. If conection exceeds the threshold, the connections exceeds the UnLoggedConnectionTimeout will be closed
+	// DefaultReadLimit default size in bytes of the largest message read from a client before its login, see WithReadLimit
+	DefaultReadLimit = 1024
+	// DefaultMaxReadSize default size in bytes of the largest message read from a logged in client, see Config.MaxReadSize
+	DefaultMaxReadSize = 64 * 1024
+	// MaxUnLoggedConnectionCount allow in the pool.
+	// Deprecated: no longer enforced, the anonymous connections are capped per IP, see Config.MaxAnonymousConnectionsPerIP
 	MaxUnLoggedConnectionCount = 200
-	// UnLoggedConnectionTimeout timeout in seconds for the un-logged in connections
+	// UnLoggedConnectionTimeout timeout in seconds for the un-logged in connections, the default of Config.AnonymousIdleTimeout
 	UnLoggedConnectionTimeout = 60
 )
 
 // NatsWebSocket Nats websocket entity. Including config, pool, server info and so on
 type NatsWebSocket struct {
 	config               *Config
-	natsPool             *Pool
+	natsPool             NatsPool
 	httpServer           *http.Server
+	adminServer          *http.Server
+	debugServer          *http.Server
+	webTransport         io.Closer
+	trustedProxies       []*net.IPNet
+	adminRoutes          map[string]http.Handler
+	metrics              *Metrics
+	metricsSink          MetricsSink
+	tracer               Tracer
+	statsEncoder         StatsEncoder
+	softLimits           *SoftLimits
+	throttled            throttleCounts
+	jwks                 *JWKSCache
+	flow                 *FlowControl
+	preferenceStore      PreferenceStore
+	natsOptions          []nats.Option
+	analyticsSink        AnalyticsSink
+	sessionExporter      *SessionExporter
+	tlsConfig            *tls.Config
+	listener             net.Listener
+	instanceID           string
+	startedAt            time.Time
+	done                 chan struct{}
+	stopOnce             sync.Once
+	initOnce             sync.Once
+	reloadMutex          sync.Mutex
+	reloaded             atomic.Value
+	configLoader         ConfigLoader
+	transcriptRedactions []*regexp.Regexp
 	upgrader             websocket.Upgrader
+	readLimit            int64
 	connections          *ConnectionsStorage
+	callbacks            *TopicCallbacks
+	acceptThrottle       *AcceptThrottle
+	upgradeLimiter       *UpgradeLimiter
+	commandWorkers       chan struct{}
+	admission            AdmissionController
+	ordered              *OrderedDelivery
+	eventSubscribers     *EventSubscribers
+	events               *EventBus
+	gatewayTopics        *GatewayTopics
+	outbound             *OutboundStats
+	deviceIdentifier     DeviceIdentifier
+	namespaceResolver    NamespaceResolver
+	historySource        HistorySource
+	claimCheck           ClaimCheckStore
+	claimCheckHandler    http.Handler
+	connectWelcome       *template.Template
+	loginWelcome         *template.Template
+	fanout               *FanoutCounter
+	subscriptions        *SubscriptionManager
+	subscriptionConns    *SubscriptionConnections
+	topics               *TopicPolicies
+	jetstream            *JetStreamBridge
+	merged               *MergedStreams
+	outages              *natsOutages
+	logger               *log.Logger
 	lastConnectionNumber int64
+	ready                int32
+	draining             int32
 }
 
-// New constructor
-func New(config *Config) *NatsWebSocket {
-	return &NatsWebSocket{
-		config:      config,
-		upgrader:    websocket.Upgrader{},
-		connections: NewConnectionsStorage(),
+// New constructor. The internals are overridden by the options, e.g. WithPool, WithLogger, WithUpgrader or WithReadLimit.
+// A nil config is the default config, see Config.SetDefaults. The config stays a parameter rather than an option: the
+// internals are built from it before the options are applied, and existing callers keep compiling
+func New(config *Config, opts ...Option) *NatsWebSocket {
+	if config == nil {
+		config = &Config{}
+		config.SetDefaults()
+	}
+
+	w := &NatsWebSocket{
+		config:           config,
+		readLimit:        DefaultReadLimit,
+		connections:      NewConnectionsStorage(),
+		callbacks:        NewTopicCallbacks(),
+		eventSubscribers: NewEventSubscribers(),
+		events:           NewEventBus(),
+		gatewayTopics:    NewGatewayTopics(),
+		deviceIdentifier: DefaultDeviceIdentifier,
+		outages:          newNatsOutages(),
+		topics:           NewTopicPolicies(configuredTopics(config)),
+		fanout:           NewFanoutCounter(),
+		adminRoutes:      make(map[string]http.Handler),
+		metrics:          NewMetrics(),
+		instanceID:       config.InstanceID,
+		startedAt:        time.Now(),
+		done:             make(chan struct{}),
+		logger:           log.New(os.Stderr, "", log.LstdFlags),
+	}
+
+	if w.instanceID == "" {
+		w.instanceID = newInstanceID()
+	}
+
+	w.namespaceResolver = w.audienceNamespaces
+
+	if config.ClaimCheckURL != "" {
+		ttl := config.ClaimCheckTTL
+		if ttl <= 0 {
+			ttl = DefaultClaimCheckTTL
+		}
+
+		maxBytes := config.ClaimCheckMaxBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultClaimCheckMaxBytes
+		}
+
+		store := NewMemoryClaimCheckStore(config.ClaimCheckURL, time.Duration(ttl)*time.Second, maxBytes)
+		w.claimCheck = store
+		w.claimCheckHandler = store
+		go store.Run(claimCheckExpiryInterval, w.done)
+	}
+
+	maxPause := config.MaxOutboundPause
+	if maxPause <= 0 {
+		maxPause = DefaultMaxOutboundPause
+	}
+	w.jwks = NewJWKSCache(time.Duration(config.JWKSCacheTTL)*time.Second, time.Duration(config.JWKSTimeout)*time.Millisecond, w.metrics)
+	w.softLimits = NewSoftLimits(config.SoftLimitRatio, config.SoftLimits, time.Duration(config.LimitWarningInterval)*time.Second)
+	w.outbound = NewOutboundStats(config.OutboundHighWatermark, time.Duration(maxPause)*time.Millisecond)
+	if config.FlowHighWatermark > 0 {
+		w.flow = NewFlowControl(config.FlowHighWatermark, w.publishFlowAdvisory)
+	}
+
+	if config.MaxConnectsPerSecond > 0 {
+		w.acceptThrottle = NewAcceptThrottle(config.MaxConnectsPerSecond, config.ConnectRetryAfter)
 	}
+
+	if config.CommandWorkers > 0 {
+		w.commandWorkers = make(chan struct{}, config.CommandWorkers)
+	}
+
+	if config.MaxConcurrentUpgrades > 0 {
+		timeout := time.Duration(config.UpgradeQueueTimeout) * time.Millisecond
+		w.upgradeLimiter = NewUpgradeLimiter(config.MaxConcurrentUpgrades, config.MaxQueuedUpgrades, timeout)
+	}
+	w.upgrader = w.newUpgrader()
+	w.trustedProxies, _ = parseTrustedProxies(config.TrustedProxies)
+	w.subscribeModules()
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	for _, expression := range config.TranscriptRedactions {
+		redaction, err := regexp.Compile(expression)
+		if err != nil {
+			w.logger.Printf("transcript: invalid redaction %q: %v", expression, err)
+			continue
+		}
+		w.transcriptRedactions = append(w.transcriptRedactions, redaction)
+	}
+
+	w.connectWelcome = w.parseWelcome("connect", config.ConnectWelcome)
+	w.loginWelcome = w.parseWelcome("login", config.LoginWelcome)
+
+	w.registerMetrics()
+	w.HandleAdmin("/metrics", w.metrics)
+	w.HandleAdmin("/transcripts", http.HandlerFunc(w.handleTranscript))
+	w.HandleAdmin("/taps", http.HandlerFunc(w.handleTap))
+	w.HandleAdmin("/status", http.HandlerFunc(w.handleStatus))
+	w.HandleAdmin("/stats", http.HandlerFunc(w.handleStats))
+	w.HandleAdmin("/connections", http.HandlerFunc(w.handleConnections))
+	w.HandleAdmin("/reload", http.HandlerFunc(w.handleReload))
+	w.adminRoutes["/readyz"] = http.HandlerFunc(w.handleReadyz)
+	w.registerDebugRoutes()
+
+	return w
+}
+
+// Metrics get the metrics registry of the gateway
+func (w *NatsWebSocket) Metrics() *Metrics {
+	return w.metrics
+}
+
+// HandleAdmin register an internal endpoint. Served on the admin listener if configured, otherwise on the public one once
+// Config.AdminToken is set. Always requires Config.AdminToken. Should be called before the gateway starts
+func (w *NatsWebSocket) HandleAdmin(pattern string, handler http.Handler) {
+	w.adminRoutes[pattern] = w.adminAuth(handler)
 }
 
 // Start init a nats connection pool and then start http server
 func (w *NatsWebSocket) Start() error {
-	stopSignal := getOsSignalWatcher()
-	natsPool, err := NewPool(w.config.NatsAddress, w.config.NatsPoolSize)
-	if err != nil {
-		log.Panicf("can't connect to nats: %v", err)
+	if w.config.Soak != nil {
+		w.runSoak()
+		return nil
 	}
 
-	w.natsPool = natsPool
+	stopSignal := getOsSignalWatcher()
+	w.Init()
+
+	natsPool := w.natsPool
 	defer func() { natsPool.Empty() }()
 
 	go func() {
@@ -94,93 +641,318 @@ func (w *NatsWebSocket) Start() error {
 	return w.startHTTPServer()
 }
 
-// Stop shutdown http server and finalize nats connection pool
+// Init connect nats and start the background tasks of the gateway without serving http, once. Called by Start and Handler
+func (w *NatsWebSocket) Init() {
+	w.initOnce.Do(w.init)
+}
+
+func (w *NatsWebSocket) init() {
+	connected := true
+	if w.natsPool == nil {
+		natsPool, err := NewPoolCustom(natsURL(w.config), w.config.NatsPoolSize, w.dialNats)
+		if err != nil {
+			if !w.config.NatsStartupRetry {
+				w.logger.Panicf("can't connect to nats: %v", err)
+			}
+
+			w.logger.Printf("can't connect to nats, serving without it until connected: %v", err)
+			connected = false
+			go w.connectNatsWithBackoff(natsPool, w.startBusTasks)
+		}
+
+		w.natsPool = natsPool
+	}
+
+	natsPool := w.natsPool
+	connections := NewSubscriptionConnections(natsPool, w.config.SubscriptionConnections)
+	w.subscriptionConns = connections
+	w.subscriptions = NewSubscriptionManager(connections, w.dispatch)
+	w.jetstream = NewJetStreamBridge(connections, w.config.JetStreamDeliverPrefix, 0)
+	w.merged = NewMergedStreams(connections, w.dispatch)
+
+	if w.config.OrderedUserDelivery {
+		w.ordered = NewOrderedDelivery(connections, w.callbacks, w.outbound, w.config.OrderedQueueSize)
+		w.ordered.SetTopics(w.topics)
+		w.ordered.SetDeadline(
+			time.Duration(w.config.DeliveryDeadline)*time.Millisecond,
+			w.metrics.Counter("gateway_delivery_deadline_exceeded_total", "Messages whose delivery exceeded the deadline and was finished asynchronously"),
+		)
+	}
+
+	if w.historySource == nil {
+		timeout := time.Duration(w.config.HistoryTimeout) * time.Millisecond
+		if timeout <= 0 {
+			timeout = DefaultHistoryTimeout * time.Millisecond
+		}
+
+		if w.config.HistoryURL != "" {
+			w.historySource = NewHTTPHistorySource(w.config.HistoryURL, timeout)
+		} else if w.config.HistorySubject != "" {
+			w.historySource = NewNatsHistorySource(natsPool, w.config.HistorySubject, timeout)
+		}
+	}
+
+	if connected {
+		w.setReady(true)
+		w.startBusTasks()
+	}
+
+	go w.publishGatewayStats()
+	go w.publishStats()
+	w.startSessionExporter()
+	w.startPings()
+	w.startReaper()
+
+	if w.metricsSink == nil && w.config.StatsDAddress != "" {
+		sink, err := NewStatsDSink(w.config.StatsDAddress, w.config.StatsDPrefix, w.config.StatsDTags)
+		if err != nil {
+			w.logger.Printf("metrics: %v", err)
+		} else {
+			w.metricsSink = sink
+		}
+	}
+
+	if w.metricsSink != nil {
+		go w.pushMetrics()
+	}
+
+	if w.configLoader != nil {
+		go w.watchReloadSignal()
+	}
+
+	if w.config.AdminListenInterface != "" {
+		w.startAdminServer()
+	}
+
+	if w.config.Pprof && w.config.DebugListenInterface != "" {
+		w.startDebugServer()
+	}
+
+	if w.config.WebTransportListen != "" {
+		if err := w.startWebTransport(); err != nil {
+			w.logger.Printf("webtransport: %v", err)
+		}
+	}
+}
+
+// Stop drain the connections for Config.ShutdownGracePeriod if set, then shutdown, see Shutdown
 func (w *NatsWebSocket) Stop() {
-	if w.httpServer != nil {
-		w.httpServer.Shutdown(nil)
-		log.Println("http: shutdown")
+	if w.config.ShutdownGracePeriod > 0 && !w.IsDraining() {
+		w.Drain(ShutdownReason, time.Duration(w.config.ShutdownGracePeriod)*time.Second)
 	}
 
-	w.natsPool.Empty()
-	log.Println("nats-pool: empty")
+	w.Shutdown(context.Background())
+}
+
+// OnTopic register a callback invoked for each bus message of the topic while at least one client is subscribed to it.
+// With DeliverInstead the messages are no longer sent to the websocket subscribers
+func (w *NatsWebSocket) OnTopic(topic string, mode DeliveryMode, callback DeliveryCallback) {
+	w.callbacks.Register(topic, mode, callback)
 }
 
 func (w *NatsWebSocket) getNewConnectionID() ConnectionID {
 	return ConnectionID(atomic.AddInt64(&w.lastConnectionNumber, 1))
 }
 
-func (w *NatsWebSocket) registerConnection(connection *websocket.Conn) *Connection {
-	wsConnection := NewConnection(w.getNewConnectionID(), connection)
+func (w *NatsWebSocket) registerConnection(transport Transport) *Connection {
+	wsConnection := NewConnection(w.getNewConnectionID(), transport)
+	wsConnection.sessionID = newSessionID()
+	if w.config.MaxConnectionLogsPerMinute > 0 {
+		wsConnection.SetLogLimit(w.config.MaxConnectionLogsPerMinute)
+		wsConnection.SetLogOutput(w.logger)
+	}
+	wsConnection.outbound = w.outbound
+	wsConnection.softLimits = w.softLimits
+	wsConnection.flow = w.flow
+	wsConnection.policies = w.topics
+	wsConnection.events = w.events
+	wsConnection.writeTimeout = w.writeTimeout()
+	wsConnection.outboundRate = w.newOutboundRate()
+	wsConnection.writeTimeouts = w.metrics.Counter("gateway_write_timeouts_total", "Connections closed after a write timed out")
+	if w.config.SendQueueSize > 0 {
+		policy := w.config.SendQueuePolicy
+		if policy == "" {
+			policy = SendQueueDrop
+		}
+		overflows := w.metrics.Counter("gateway_send_queue_overflows_total", "Frames sent to a full send queue by policy", "policy", policy)
+		wsConnection.startWritePump(w.config.SendQueueSize, policy, overflows)
+	}
+	wsConnection.watchPongs()
 	w.connections.AddNewConnection(wsConnection)
 
-	connection.SetCloseHandler(func(code int, Text string) error {
-		w.onClose(wsConnection)
-		return nil
-	})
+	if connection, ok := transport.(interface {
+		SetCloseHandler(handler func(code int, text string) error)
+	}); ok {
+		connection.SetCloseHandler(func(code int, Text string) error {
+			w.onClose(wsConnection)
+			return nil
+		})
+	}
 
 	return wsConnection
 }
 
 func (w *NatsWebSocket) unregisterConnection(connection *Connection) {
 	w.connections.RemoveConnection(connection)
+	w.publishConnection(DisconnectedEvent, connection)
 }
 
 func (w *NatsWebSocket) onConnection(writer http.ResponseWriter, request *http.Request) {
-	connection, err := w.upgrader.Upgrade(writer, request, nil)
+	w.accept(writer, request, w.upgradeWebsocket)
+}
+
+// accept admit the request, upgrade it to a transport and serve the connection
+func (w *NatsWebSocket) accept(writer http.ResponseWriter, request *http.Request, upgrader TransportUpgrader) {
+	if w.IsDraining() {
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	if !w.admitConnection() {
+		http.Error(writer, ServerFullReason, http.StatusServiceUnavailable)
+		return
+	}
+
+	ip := w.clientIP(request)
+	if !w.admitIP(ip) {
+		http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+
+	if w.acceptThrottle != nil {
+		if admitted, retryAfter := w.acceptThrottle.Admit(); !admitted {
+			w.metrics.Counter("gateway_throttled_upgrades_total", "Upgrade requests rejected by the accept throttle").Inc()
+			writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if w.upgradeLimiter != nil {
+		if !w.upgradeLimiter.Acquire() {
+			w.metrics.Counter("gateway_upgrade_queue_rejections_total", "Upgrade requests rejected because no upgrade slot was free in time").Inc()
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		defer w.upgradeLimiter.Release()
+	}
+
+	var decision AdmissionDecision
+	if w.admission != nil {
+		var err error
+		decision, err = w.admission.Admit(newAdmissionRequest(request, ip, w.connections.GetStats().NumberOfConnections))
+		if err != nil {
+			w.logger.Printf("admission: %v", err)
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		if !decision.Accept {
+			status := decision.Status
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			http.Error(writer, decision.Reason, status)
+			return
+		}
+	}
+
+	trace, span := w.startSpan(request.Context(), UpgradeSpan, headerCarrier(request.Header))
+	transport, subprotocol, err := upgrader(writer, request)
 	if err != nil {
+		span.RecordError(err)
+		span.End()
 		return
 	}
+	span.SetAttribute("websocket.subprotocol", subprotocol)
+	span.End()
+
+	// sets the maximum size for a message read from the peer, raised once logged in
+	readLimit, maxReadSize := w.readLimits()
+	transport.SetReadLimit(readLimit)
+	con := w.registerConnection(transport)
+	w.connections.SetRemoteIP(con, ip)
+	con.maxReadSize = maxReadSize
+	con.request = request
+	con.trace = trace
+	con.capabilities = parseCapabilities(request)
+	con.maxMessageSize = w.negotiateMaxMessageSize(request)
+	con.binaryPayloads = w.config.BinaryPayloads || con.HasCapability(BinaryCapability)
+	con.gzipPayloads = w.config.GzipPayloads
+	con.codec = codecs[subprotocol]
+	if con.codec == nil && !w.config.LegacyProtocol {
+		con.codec = JSONCodec{}
+	}
+	con.claimCheck = w.claimCheck
+	con.messageIDField = w.config.MessageIDField
+	if con.messageIDField == "" {
+		con.messageIDField = DefaultMessageIDField
+	}
+	for key, value := range decision.Tags {
+		con.SetTag(key, value)
+	}
+	w.publishConnection(ConnectedEvent, con)
 
-	// sets the maximum size for a message read from the peer
-	connection.SetReadLimit(1024) // Glory for hard coding!
-	con := w.registerConnection(connection)
+	w.sendWelcome(con, w.connectWelcome)
 
 	// handle input
 	go w.handleInputMessages(con)
 
-	w.cleanConnectionsIfNeed(con)
 }
 
-func (w *NatsWebSocket) cleanConnectionsIfNeed(connection *Connection) {
-	now := time.Now().Unix()
-	stats := w.connections.GetStats()
-
-	if stats.NumberOfNotLoggedConnections > MaxUnLoggedConnectionCount {
-		w.connections.RemoveIf(func(con *Connection) bool {
-			return now-con.GetStartTime().Unix() > UnLoggedConnectionTimeout
-		}, func(con *Connection) {
-			con.Close(websocket.ClosePolicyViolation, "Auth")
-		})
+// readLimits get the read limits of a new connection, before and after its login
+func (w *NatsWebSocket) readLimits() (beforeLogin int64, afterLogin int64) {
+	config := w.liveConfig()
+	beforeLogin, afterLogin = config.MaxReadSizeBeforeLogin, config.MaxReadSize
+	if beforeLogin <= 0 {
+		beforeLogin = w.readLimit
 	}
+	if afterLogin <= 0 {
+		afterLogin = DefaultMaxReadSize
+	}
+	return
 }
 
 func (w *NatsWebSocket) handleInputMessages(connection *Connection) {
 	for {
 		messageType, message, err := connection.ReadMessage()
+		if err == websocket.ErrReadLimit || err == errFrameTooLarge {
+			w.metrics.Counter("gateway_read_limit_exceeded_total", "Connections closed for a message over their read limit").Inc()
+			connection.Logf("read failed: %v", err)
+			w.onClose(connection)
+			connection.Close(websocket.CloseMessageTooBig, "MessageTooBig")
+			return
+		}
 		if err != nil {
-			connection.Close(websocket.CloseInternalServerErr, "ServerError")
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				connection.Logf("read failed: %v", err)
+			}
 			w.onClose(connection)
+			connection.Close(websocket.CloseInternalServerErr, "ServerError")
 			return
 		}
 
 		connection.UpdateLastPingTime()
+		connection.extendReadDeadline()
+		connection.countInbound(len(message))
 
-		switch messageType {
-		case websocket.TextMessage:
-			w.onTextMessage(connection, message)
-		case websocket.BinaryMessage:
-			w.onBinaryMessage(connection, message)
-		case websocket.CloseMessage:
+		if messageType == websocket.CloseMessage {
 			w.onClose(connection)
 			return
 		}
+
+		w.dispatchFrame(connection, messageType, message)
 	}
 }
 
 func (w *NatsWebSocket) onTextMessage(connection *Connection, message []byte) {
 	// respond ping
 	if bytes.Compare(message, []byte("ping")) == 0 {
-		connection.SendText([]byte("pong"))
+		connection.Reply([]byte("pong"))
+		return
+	}
+
+	if w.refuseReadOnly(connection, message) {
 		return
 	}
 
@@ -190,10 +962,76 @@ func (w *NatsWebSocket) onTextMessage(connection *Connection, message []byte) {
 		return
 	}
 
+	isChallengeMessage := bytes.HasPrefix(message, []byte(ChallengePrefix))
+	if isChallengeMessage {
+		w.challenge(connection)
+		return
+	}
+
+	isServiceMessage := bytes.HasPrefix(message, []byte(ServicePrefix))
+	if isServiceMessage {
+		w.serviceLogin(connection, message[len(ServicePrefix):])
+		return
+	}
+
+	if w.onServiceMessage(connection, message) {
+		return
+	}
+
+	isHistoryMessage := bytes.HasPrefix(message, []byte(HistoryPrefix))
+	if isHistoryMessage {
+		if !connection.IsLoggedIn() {
+			connection.Reply([]byte("go away"))
+			return
+		}
+
+		w.history(connection, message[len(HistoryPrefix):])
+		return
+	}
+
+	isPublishMessage := bytes.HasPrefix(message, []byte(PublishPrefix))
+	if isPublishMessage {
+		if !connection.IsLoggedIn() {
+			connection.Reply([]byte("go away"))
+			return
+		}
+
+		w.publish(connection, message[len(PublishPrefix):])
+		return
+	}
+
+	isRequestMessage := bytes.HasPrefix(message, []byte(RequestPrefix))
+	if isRequestMessage {
+		if !connection.IsLoggedIn() {
+			connection.Reply([]byte("go away"))
+			return
+		}
+
+		w.onRequest(connection, message[len(RequestPrefix):])
+		return
+	}
+
+	isTemporaryMessage := bytes.HasPrefix(message, []byte(TemporaryPrefix))
+	if isTemporaryMessage {
+		if !connection.IsLoggedIn() {
+			connection.Reply([]byte("go away"))
+			return
+		}
+
+		w.sendTemporaryPrefix(connection)
+		return
+	}
+
+	isUnsubscribeMessage := bytes.HasPrefix(message, []byte(UnsubscribePrefix))
+	if isUnsubscribeMessage {
+		w.unsubscribe(connection, string(message[len(UnsubscribePrefix):]))
+		return
+	}
+
 	isTopicMessage := bytes.HasPrefix(message, []byte(TopicPrefix))
 	if isTopicMessage {
 		if !connection.IsLoggedIn() {
-			connection.SendText([]byte("go away"))
+			connection.Reply([]byte("go away"))
 			return
 		}
 
@@ -201,15 +1039,20 @@ func (w *NatsWebSocket) onTextMessage(connection *Connection, message []byte) {
 		w.setupSubsrciber(connection, message[len(TopicPrefix):])
 		return
 	}
-}
 
-// we don't support binary msg yet. But I leave the interface here. The implementation should be very easy
-func (w *NatsWebSocket) onBinaryMessage(connection *Connection, message []byte) {
-	connection.SendText([]byte("binary message is not supported yet"))
-	return
+	w.onUnknownCommand(connection, message)
 }
 
 func (w *NatsWebSocket) onClose(connection *Connection) {
+	w.eventSubscribers.Remove(connection)
+	w.gatewayTopics.Remove(connection)
+	connection.SetTranscript(nil)
+	connection.SetTap(nil)
+
+	for topic := range connection.TakeSubscriptions() {
+		w.releaseTopic(connection, topic, false)
+	}
+
 	connectionID, _, _ := connection.GetInfo()
 	if connectionID == -1 {
 		return
@@ -218,44 +1061,200 @@ func (w *NatsWebSocket) onClose(connection *Connection) {
 	w.unregisterConnection(connection)
 }
 
-func (w *NatsWebSocket) setupSubsrciber(connection *Connection, topic []byte) {
+func (w *NatsWebSocket) setupSubsrciber(connection *Connection, request []byte) {
+	requestedTopic, options := parseSubscription(string(request))
+
+	_, span := w.startSpan(connection.traceContext(), SubscribeSpan, nil)
+	span.SetAttribute("gateway.topic", requestedTopic)
+	defer span.End()
+
+	// served by the gateway itself
+	if isGatewayTopic(requestedTopic) {
+		w.subscribeGatewayTopic(connection, requestedTopic)
+		return
+	}
+
 	// the topic is invalid
-	if !contains(w.config.NatsTopics, string(topic)) {
-		connection.SendText([]byte("invalid topic"))
+	policy, ok := w.topicPolicy(connection, requestedTopic)
+	if !ok {
+		connection.Logf("subscribe rejected: invalid topic %.64q", requestedTopic)
+		connection.Reply([]byte("invalid topic"))
 		return
 	}
 
-	busClient, err := w.natsPool.Get()
-	if err != nil {
-		log.Fatalf("Can't connect to nats: %v", err)
+	if !w.isTemporaryTopic(requestedTopic) && !connection.AllowsTopic(requestedTopic) {
+		connection.Logf("subscribe rejected: topic %.64q outside the namespaces of the token", requestedTopic)
+		connection.Reply([]byte("invalid topic"))
 		return
 	}
 
-	_, err = busClient.Subscribe(string(topic), func(msg *nats.Msg) {
-		connection.SendText([]byte(msg.Data))
-	})
+	if !w.servesRegion(policy) {
+		w.redirectRegion(connection, requestedTopic, policy)
+		return
+	}
 
+	if connection.IsSubscribed(requestedTopic) {
+		switch w.config.DuplicateSubscriptions {
+		case DuplicateError:
+			connection.Reply([]byte("already subscribed"))
+		case DuplicateRefCount:
+			connection.RetainSubscription(requestedTopic)
+		}
+		return
+	}
+
+	if !w.IsReady() {
+		connection.Reply([]byte(NatsUnavailable))
+		return
+	}
+
+	queue, balance := policy.QueueGroup, false
+	if options.Queue != "" {
+		if queue = clientQueueGroup(options.Queue); queue == "" || !policy.ClientQueueGroups {
+			connection.Reply([]byte(TopicPrefix + requestedTopic + ":forbidden"))
+			return
+		}
+		balance = true
+	}
+
+	topic, admitted := w.acquireFanout(connection, requestedTopic)
+	if !admitted {
+		return
+	}
+
+	filter := combineFilters(w.newMessageFilter(options), newTopicFilter(connection, topic, policy))
+	subject := w.routeSubject(connection, topic)
+
+	deliversToWebsocket := w.callbacks.DeliversToWebsocket(topic)
+
+	var err error
+	switch {
+	case !deliversToWebsocket:
+		// the callback of a DeliverInstead topic replaces the websocket delivery, no websocket subscription is needed
+		err = w.callbacks.Retain(connection, topic, w.subscriptionConns)
+	case len(policy.Merge) > 0:
+		err = w.merged.Subscribe(connection, topic, policy, filter)
+	case policy.Stream != "":
+		err = w.subscribeStream(connection, topic, subject, policy, options, filter)
+	case w.ordered != nil:
+		err = w.ordered.Subscribe(connection, subject, filter)
+	default:
+		err = w.subscriptions.Subscribe(connection, topic, subject, queue, balance, filter)
+	}
 	if err != nil {
-		log.Fatalf("Can't connect to nats: %v", err)
+		connection.Logf("subscribe to %s failed: %v", topic, err)
+		w.fanout.Release(topic)
+		connection.Reply([]byte(NatsUnavailable))
+		return
+	}
+
+	w.trackSubscription(connection, topic, nil)
+	if !deliversToWebsocket {
 		return
 	}
+	w.sendLastValue(connection, topic, filter)
+	if len(policy.Merge) > 0 {
+		w.sendLatest(connection, topic, filter)
+	}
+}
+
+// dispatch deliver a message of a shared subscription to the websocket subscribers of the topic
+func (w *NatsWebSocket) dispatch(topic, subject string, msg *nats.Msg, subscribers map[*Connection]MessageFilter) {
+	if !w.callbacks.DeliversToWebsocket(topic) {
+		return
+	}
+
+	delivered := deliveredTopic(topic, subject, msg)
+	data := w.topics.Apply(delivered, msg.Data)
+	if data == nil {
+		return
+	}
+
+	span := w.startDeliverySpan(msg)
+	defer span.End()
+
+	recipients := make([]*Connection, 0, len(subscribers))
+	for connection, filter := range subscribers {
+		if filter == nil || filter(data) {
+			recipients = append(recipients, connection)
+		}
+	}
+
+	if !w.topics.Prioritized(topic) {
+		w.outbound.WaitBelowHighWatermark()
+	}
+	span.SetAttribute("gateway.topic", delivered)
+	span.SetAttribute("gateway.recipients", len(recipients))
+	deadline := time.Duration(w.config.DeliveryDeadline) * time.Millisecond
+	if fanOut(recipients, delivered, data, deadline) > 0 {
+		w.metrics.Counter("gateway_delivery_deadline_exceeded_total", "Messages whose delivery exceeded the deadline and was finished asynchronously").Inc()
+	}
+}
+
+// sendLastValue send the last messages kept of the topics the subscription covers to the new subscriber
+func (w *NatsWebSocket) sendLastValue(connection *Connection, topic string, filter MessageFilter) {
+	for subject, data := range w.topics.LastValues(topic) {
+		if filter == nil || filter(data) {
+			connection.Deliver(subject, data)
+		}
+	}
+}
+
+// deliveredTopic get the topic a message is delivered as, the subject it was published to for the wildcard subscriptions.
+// The subject is stripped of the routing prefix the topic is subscribed with, see routeSubject
+func deliveredTopic(topic, subject string, msg *nats.Msg) string {
+	if !hasWildcard(topic) {
+		return topic
+	}
+	return strings.TrimPrefix(msg.Subject, subject[:len(subject)-len(topic)])
+}
+
+// trackSubscription track the subscription on the connection. The subscription is nil if it is shared by the user in ordered mode
+func (w *NatsWebSocket) trackSubscription(connection *Connection, topic string, subscription *nats.Subscription) {
+	connection.recordTopic(topic)
+	if connection.AddSubscription(topic, subscription) {
+		if err := w.callbacks.Retain(connection, topic, w.subscriptionConns); err != nil {
+			connection.Logf("topic callback of %s not subscribed: %v", topic, err)
+		}
+	}
+
+	w.sendSessionEvent(connection, GatewayMessage{Event: SubscribedSessionEvent, EventTopic: topic})
 }
 
 // https://stackoverflow.com/questions/4361173/http-headers-in-websockets-client-api
 // Can't assign JWT in request header. So send the explicit login request like login>:Bearer <id token>
 func (w *NatsWebSocket) login(connection *Connection, tokenBinary []byte) {
+	trace, span := w.startSpan(connection.traceContext(), LoginSpan, nil)
+	defer span.End()
+
 	idtoken, valid := ResolveIDToken(string(tokenBinary))
 	if !valid {
-		connection.SendText([]byte(LoginPrefix + "Not Authorized"))
+		connection.Logf("login rejected: malformed token")
+		connection.Reply([]byte(LoginPrefix + "Not Authorized"))
 		return
 	}
 
-	claims, token, err := ParseJWT(idtoken, w.config.JWKS)
+	_, jwtSpan := w.startSpan(trace, JWTSpan, nil)
+	claims, token, err := w.parseJWT(idtoken)
+	if err != nil {
+		jwtSpan.RecordError(err)
+	}
+	jwtSpan.End()
 	if err != nil || !token.Valid {
-		connection.SendText([]byte(LoginPrefix + "Not Authorized"))
+		connection.Logf("login rejected: %v", err)
+		connection.Reply([]byte(LoginPrefix + "Not Authorized"))
 		return
 	}
 
+	if w.config.LoginChallenge {
+		nonce, _ := claims["nonce"].(string)
+		if !connection.verifyNonce(nonce) {
+			connection.Logf("login rejected: nonce mismatch")
+			connection.Reply([]byte(LoginPrefix + "Not Authorized"))
+			return
+		}
+	}
+
 	var userID UserID
 	var deviceID DeviceID
 
@@ -266,55 +1265,199 @@ func (w *NatsWebSocket) login(connection *Connection, tokenBinary []byte) {
 		userID = UserID(claims["name"].(string))
 	}
 
-	// fallback to remote ip if no device id found in claims
-	// if did, ok := claims["deviceId"]; ok {
-	// 	deviceID = DeviceID(did.(string))
-	// } else {
-	//	deviceID = DeviceID(w.config.RemoteAddr)
-	// }
-	deviceID = DeviceID(w.config.RemoteAddr)
+	// $ prefixed user ids are reserved for the gateway, e.g. ServiceUserID
+	if strings.HasPrefix(string(userID), "$") {
+		connection.Logf("login rejected: reserved user id %q", userID)
+		connection.Reply([]byte(LoginPrefix + "Not Authorized"))
+		return
+	}
+
+	deviceID = w.deviceIdentifier(connection.request, userID, claims, connection.GetCapabilities())
 
 	_, conUserID, _ := connection.GetInfo()
 
 	if conUserID != "" {
 		// user mismatch, which is not good
 		if conUserID != userID {
-			connection.SendText([]byte("go away"))
+			connection.Reply([]byte("go away"))
 			return
 		}
 
-		connection.SendText([]byte("ok"))
+		// a fresh token extends the connection
+		connection.setTokenExpiry(tokenExpiry(claims))
+		connection.Reply([]byte("ok"))
 		return
 	}
 
+	if !w.admitUser(userID, deviceID) {
+		connection.Logf("login rejected: too many connections of %q", userID)
+		connection.Reply([]byte(LoginPrefix + TooManyConnectionsResponse))
+		return
+	}
+
+	connection.setNamespaces(w.namespaceResolver(claims))
+	rolesClaim := w.config.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = DefaultRolesClaim
+	}
+	connection.setRoles(tokenRoles(claims, rolesClaim))
+	w.setReadOnly(connection)
+	if w.isCanary(userID, claims) {
+		connection.SetTag(CanaryTag, "true")
+	}
+	connection.setTokenExpiry(tokenExpiry(claims))
 	connection.Login(userID, deviceID)
+	w.loadPreferences(connection)
 
 	deviceConnectionBefore := w.connections.OnLogin(connection)
 	if deviceConnectionBefore != nil {
 		// purge the previous connection
-		deviceConnectionBefore.Close(websocket.CloseGoingAway, "OneConnectionPerDevice")
 		w.unregisterConnection(deviceConnectionBefore)
+		deviceConnectionBefore.Close(websocket.CloseGoingAway, "OneConnectionPerDevice")
 	}
 
-	connection.SendText([]byte("ok"))
+	w.publishConnection(LoggedInEvent, connection)
+	span.SetAttribute("user.id", string(userID))
+
+	if connection.HasCapability(VersionCapability) {
+		connection.Reply([]byte("ok:" + Version()))
+	} else {
+		connection.Reply([]byte("ok"))
+	}
+	w.sendWelcome(connection, w.loginWelcome)
+	w.advertiseHeartbeat(connection)
 }
 
-func (w *NatsWebSocket) startHTTPServer() error {
+// Handler http handler of the websocket endpoint on Config.URLPattern, the claim check, /readyz and the admin routes unless
+// they are served on Config.AdminListenInterface, to embed the gateway in an existing server instead of calling Start.
+// The gateway is initialized on the first call, see Init, the embedding server calls Stop on shutdown
+func (w *NatsWebSocket) Handler() http.Handler {
+	w.Init()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc(w.config.URLPattern, w.onConnection)
-	srv := http.Server{
-		Addr:    w.config.ListenInterface,
+	if w.claimCheckHandler != nil {
+		mux.Handle(ClaimCheckPath, w.claimCheckHandler)
+	}
+
+	for pattern, handler := range w.publicAdminRoutes() {
+		mux.Handle(pattern, handler)
+	}
+	return mux
+}
+
+func (w *NatsWebSocket) startHTTPServer() error {
+	// a server supplied by WithHTTPServer keeps its settings, e.g. its timeouts
+	srv := w.httpServer
+	if srv == nil {
+		srv = &http.Server{}
+		w.httpServer = srv
+	}
+	if srv.Addr == "" {
+		srv.Addr = w.config.ListenInterface
+	}
+	if srv.Handler == nil {
+		srv.Handler = w.Handler()
+	}
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = w.tlsConfig
+	}
+
+	listeners, err := w.listeners(srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	address := srv.Addr
+	if len(listeners) > 0 {
+		address = listeners[0].Addr().String()
+	}
+
+	// the certificates may come from the tls config only, e.g. its GetCertificate
+	secure := w.config.TLSCertFile != "" || srv.TLSConfig != nil
+	if secure {
+		w.logger.Println("Start nats-https on: " + address)
+	} else {
+		w.logger.Println("Start nats-http on: " + address)
+	}
+
+	if len(listeners) == 0 {
+		if secure {
+			return srv.ListenAndServeTLS(w.config.TLSCertFile, w.config.TLSKeyFile)
+		}
+		return srv.ListenAndServe()
+	}
+
+	// one acceptor loop per listener, until the server is shut down
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if secure {
+				served <- srv.ServeTLS(listener, w.config.TLSCertFile, w.config.TLSKeyFile)
+				return
+			}
+			served <- srv.Serve(listener)
+		}(listener)
+	}
+	return <-served
+}
+
+// listeners get the listeners the gateway serves on: the one supplied by WithListener, or Config.ListenSockets sockets
+// opened with SO_REUSEPORT, setting the socket options of the config on the accepted connections. None if the server
+// listens on the address itself
+func (w *NatsWebSocket) listeners(address string) (listeners []net.Listener, err error) {
+	options := w.config.socketOptions()
+	if w.listener != nil {
+		listeners = []net.Listener{w.listener}
+	} else if w.config.ListenSockets > 1 {
+		listeners, err = listenReusePort(address, w.config.ListenSockets)
+	} else if options != nil {
+		var listener net.Listener
+		listener, err = net.Listen("tcp", address)
+		listeners = []net.Listener{listener}
+	}
+	if err != nil || options == nil {
+		return
+	}
+
+	for i, listener := range listeners {
+		listeners[i] = &socketOptionsListener{Listener: listener, options: options, logger: w.logger}
+	}
+	return
+}
+
+// startAdminServer serve the admin routes on Config.AdminListenInterface
+func (w *NatsWebSocket) startAdminServer() {
+	mux := http.NewServeMux()
+	for pattern, handler := range w.adminRoutes {
+		mux.Handle(pattern, handler)
+	}
+
+	w.adminServer = &http.Server{
+		Addr:    w.config.AdminListenInterface,
 		Handler: mux,
 	}
 
-	w.httpServer = &srv
+	w.logger.Println("Start admin-http on: " + w.config.AdminListenInterface)
 
-	log.Println("Start nats-http on: " + w.config.ListenInterface)
-	return srv.ListenAndServe()
+	// created before serving, so a shutdown right after the start sees it
+	server := w.adminServer
+	go func() {
+		var err error
+		if w.config.AdminTLSCertFile != "" {
+			err = server.ListenAndServeTLS(w.config.AdminTLSCertFile, w.config.AdminTLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			w.logger.Printf("admin-http: %v", err)
+		}
+	}()
 }
 
 func getOsSignalWatcher() chan os.Signal {
-	stopChannel := make(chan os.Signal)
+	stopChannel := make(chan os.Signal, 1)
 	signal.Notify(stopChannel, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL)
 
 	return stopChannel
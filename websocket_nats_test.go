@@ -48,6 +48,7 @@ func startWsServer() *NatsWebSocket {
 		NatsAddress:     natsaddress,
 		NatsPoolSize:    natspoolsize,
 		NatsTopics:      []string{"test.a", "test.b"},
+		LegacyProtocol:  true,
 	})
 
 	go func() {
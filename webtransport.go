@@ -0,0 +1,61 @@
+//go:build webtransport
+// +build webtransport
+
+package websocketnats
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// startWebTransport serve the WebTransport sessions on Config.WebTransportListen over HTTP/3, the first bidirectional
+// stream of each session carrying the messages framed by NewStreamTransport
+func (w *NatsWebSocket) startWebTransport() error {
+	certificate, err := tls.LoadX509KeyPair(w.config.TLSCertFile, w.config.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", w.config.WebTransportListen)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	server := &webtransport.Server{
+		H3: &http3.Server{
+			Handler:   mux,
+			TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{certificate}}),
+		},
+	}
+	// the origin is checked like the websocket upgrades, same origin unless Config.AllowedOrigins is set
+	if len(w.config.AllowedOrigins) > 0 {
+		server.CheckOrigin = w.checkOrigin
+	}
+	webtransport.ConfigureHTTP3Server(server.H3)
+	mux.Handle(w.config.URLPattern, w.WebTransportHandler(func(writer http.ResponseWriter, request *http.Request) (Transport, string, error) {
+		session, err := server.Upgrade(writer, request)
+		if err != nil {
+			return nil, "", err
+		}
+		stream, err := session.AcceptStream(request.Context())
+		if err != nil {
+			session.CloseWithError(0, err.Error())
+			return nil, "", err
+		}
+		return NewStreamTransport(stream), request.URL.Query().Get("protocol"), nil
+	}))
+
+	w.webTransport = server
+	w.logger.Println("Start webtransport on: " + conn.LocalAddr().String())
+	go func() {
+		if err := server.Serve(conn); err != nil && err != http.ErrServerClosed {
+			w.logger.Printf("webtransport: %v", err)
+		}
+	}()
+	return nil
+}
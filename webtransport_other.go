@@ -0,0 +1,11 @@
+//go:build !webtransport
+// +build !webtransport
+
+package websocketnats
+
+import "errors"
+
+// startWebTransport the WebTransport listener needs the webtransport build tag
+func (w *NatsWebSocket) startWebTransport() error {
+	return errors.New("built without the webtransport build tag, Config.WebTransportListen ignored")
+}
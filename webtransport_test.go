@@ -0,0 +1,95 @@
+//go:build webtransport
+// +build webtransport
+
+package websocketnats
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/webtransport-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// selfSignedCertificate write a certificate of localhost and its key to the directory
+func selfSignedCertificate(t *T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return
+}
+
+func TestWebTransportListener(t *T) {
+	dir, err := ioutil.TempDir("", "webtransport")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := selfSignedCertificate(t, dir)
+
+	// reserve a free udp port
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := conn.LocalAddr().String()
+	conn.Close()
+
+	gateway := New(&Config{
+		URLPattern:         "/wt",
+		HeartbeatInterval:  -1,
+		LegacyProtocol:     true,
+		TLSCertFile:        certFile,
+		TLSKeyFile:         keyFile,
+		WebTransportListen: address,
+	}, WithPool(unavailablePool{}))
+	gateway.Init()
+	defer gateway.Stop()
+
+	dialer := webtransport.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer dialer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, session, err := dialer.Dial(ctx, "https://"+address+"/wt", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 200, response.StatusCode)
+	defer session.CloseWithError(0, "")
+
+	stream, err := session.OpenStreamSync(ctx)
+	assert.Nil(t, err)
+	stream.SetDeadline(time.Now().Add(5 * time.Second))
+	transport := NewStreamTransport(stream)
+	assert.Nil(t, transport.WriteMessage(websocket.TextMessage, []byte(LoginPrefix+"invalid")))
+
+	_, reply, err := transport.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, LoginPrefix+"Not Authorized", string(reply))
+	assert.True(t, waitFor(func() bool { return len(gateway.connections.ListConnections()) == 1 }))
+}
@@ -0,0 +1,60 @@
+package websocketnats
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// WelcomeData data the welcome templates are executed with
+type WelcomeData struct {
+	ConnectionID ConnectionID
+	SessionID    string
+	UserID       UserID
+	DeviceID     DeviceID
+	InstanceID   string
+	Version      string
+	Features     []string
+	Capabilities []string
+}
+
+// parseWelcome parse the welcome template, nil if none is configured
+func (w *NatsWebSocket) parseWelcome(name string, text string) *template.Template {
+	if text == "" {
+		return nil
+	}
+
+	welcome, err := template.New(name).Parse(text)
+	if err != nil {
+		w.logger.Printf("welcome: invalid %s template: %v", name, err)
+		return nil
+	}
+	return welcome
+}
+
+// sendWelcome send the welcome message rendered for the connection
+func (w *NatsWebSocket) sendWelcome(connection *Connection, welcome *template.Template) {
+	if welcome == nil {
+		return
+	}
+
+	connectionID, userID, deviceID := connection.GetInfo()
+	data := WelcomeData{
+		ConnectionID: connectionID,
+		SessionID:    connection.SessionID(),
+		UserID:       userID,
+		DeviceID:     deviceID,
+		InstanceID:   w.instanceID,
+		Version:      Version(),
+		Features:     w.config.FeatureFlags,
+		Capabilities: connection.GetCapabilities(),
+	}
+
+	var message bytes.Buffer
+	if err := welcome.Execute(&message, data); err != nil {
+		connection.Logf("welcome: %v", err)
+		return
+	}
+
+	// replied so it follows the login reply even in a pipelined batch
+	connection.Reply(message.Bytes())
+}
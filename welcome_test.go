@@ -0,0 +1,23 @@
+package websocketnats
+
+import (
+	"bytes"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWelcomeTemplate(t *T) {
+	w := New(&Config{
+		LoginWelcome: `welcome>:{"userId":"{{.UserID}}","features":"{{range $i, $f := .Features}}{{if $i}},{{end}}{{$f}}{{end}}"}`,
+		FeatureFlags: []string{"history", "gzip"},
+	})
+	assert.NotNil(t, w.loginWelcome)
+	assert.Nil(t, w.connectWelcome)
+
+	var message bytes.Buffer
+	assert.Nil(t, w.loginWelcome.Execute(&message, WelcomeData{UserID: "user", Features: w.config.FeatureFlags}))
+	assert.Equal(t, `welcome>:{"userId":"user","features":"history,gzip"}`, message.String())
+
+	assert.Nil(t, w.parseWelcome("invalid", "{{.Unclosed"))
+}
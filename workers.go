@@ -0,0 +1,108 @@
+package websocketnats
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMaxQueuedFrames default number of frames of a connection waiting for a command worker
+	DefaultMaxQueuedFrames = 64
+	// DefaultMaxPendingCommandsBeforeAuth default number of frames a connection not logged in yet may have waiting
+	DefaultMaxPendingCommandsBeforeAuth = 8
+	// TooManyCommandsResponse response of the commands refused while the connection has DefaultMaxQueuedFrames waiting
+	TooManyCommandsResponse = "too many commands"
+)
+
+// inputFrame frame read from the client waiting to be processed
+type inputFrame struct {
+	messageType int
+	message     []byte
+}
+
+// dispatchFrame process the frame. With command workers, the frame is queued on the connection and processed by the
+// worker pool so a slow command, e.g. a login fetching the JWKS, doesn't block the read loop. The frames of a connection
+// are processed one at a time in the order they were read, so the responses keep the order of the commands
+func (w *NatsWebSocket) dispatchFrame(connection *Connection, messageType int, message []byte) {
+	if w.commandWorkers == nil {
+		w.processFrame(connection, messageType, message)
+		return
+	}
+
+	loggedIn := connection.IsLoggedIn()
+
+	connection.dataMutex.Lock()
+	defer connection.dataMutex.Unlock()
+
+	// an unauthenticated client piling up commands, e.g. behind a slow login, is disconnected
+	if !loggedIn && len(connection.frames) >= w.maxPendingBeforeAuth() {
+		connection.logger.Printf("too many pending commands before login, disconnecting")
+		go w.disconnect(connection, websocket.ClosePolicyViolation, "TooManyPendingCommands")
+		return
+	}
+	if !loggedIn {
+		// the lock is held, the warning is sent asynchronously
+		go connection.checkSoftLimit(PendingCommandsLimit, "", len(connection.frames)+1, w.maxPendingBeforeAuth())
+	}
+
+	// the client is told to slow down rather than losing its command silently
+	if len(connection.frames) >= DefaultMaxQueuedFrames {
+		connection.logger.Printf("too many queued commands, frame refused")
+		w.metrics.Counter("gateway_commands_throttled_total", "Commands refused while their connection had too many queued").Inc()
+		// the lock is held, the response is sent asynchronously
+		go connection.Reply([]byte(TooManyCommandsResponse))
+		return
+	}
+
+	connection.frames = append(connection.frames, inputFrame{messageType: messageType, message: message})
+	if !connection.processing {
+		connection.processing = true
+		go w.processFrames(connection)
+	}
+}
+
+// processFrames process the queued frames of the connection on a command worker until none is left
+func (w *NatsWebSocket) processFrames(connection *Connection) {
+	w.commandWorkers <- struct{}{}
+	defer func() { <-w.commandWorkers }()
+
+	for {
+		connection.dataMutex.Lock()
+		if len(connection.frames) == 0 {
+			connection.processing = false
+			connection.dataMutex.Unlock()
+			return
+		}
+		frame := connection.frames[0]
+		connection.frames = connection.frames[1:]
+		connection.dataMutex.Unlock()
+
+		w.processFrame(connection, frame.messageType, frame.message)
+	}
+}
+
+func (w *NatsWebSocket) processFrame(connection *Connection, messageType int, message []byte) {
+	if connection.codec != nil && connection.codec.FrameType() == messageType {
+		w.onEnvelope(connection, message)
+		return
+	}
+
+	switch messageType {
+	case websocket.TextMessage:
+		w.onTextFrame(connection, message)
+	case websocket.BinaryMessage:
+		w.onBinaryMessage(connection, message)
+	}
+}
+
+func (w *NatsWebSocket) maxPendingBeforeAuth() int {
+	if max := w.liveConfig().MaxPendingCommandsBeforeAuth; max > 0 {
+		return max
+	}
+	return DefaultMaxPendingCommandsBeforeAuth
+}
+
+// disconnect unregister and close the connection
+func (w *NatsWebSocket) disconnect(connection *Connection, code int, reason string) {
+	w.unregisterConnection(connection)
+	connection.Close(code, reason)
+}
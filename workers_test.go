@@ -0,0 +1,40 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchFrameQueueFull(t *T) {
+	w := New(&Config{CommandWorkers: 1}, WithPool(unavailablePool{}))
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.Login("user", "device")
+
+	// the only worker is busy, the frames queue up
+	w.commandWorkers <- struct{}{}
+	for i := 0; i < DefaultMaxQueuedFrames; i++ {
+		w.dispatchFrame(connection, websocket.TextMessage, []byte("noop"))
+	}
+	w.dispatchFrame(connection, websocket.TextMessage, []byte("noop"))
+
+	_, frame, err := NewStreamTransport(client).ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, TooManyCommandsResponse, string(frame))
+
+	connection.dataMutex.RLock()
+	assert.Len(t, connection.frames, DefaultMaxQueuedFrames)
+	connection.dataMutex.RUnlock()
+
+	go discard(client)
+	<-w.commandWorkers
+	assert.True(t, waitFor(func() bool {
+		connection.dataMutex.RLock()
+		defer connection.dataMutex.RUnlock()
+		return !connection.processing
+	}))
+}
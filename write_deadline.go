@@ -0,0 +1,47 @@
+package websocketnats
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// DefaultWriteTimeout default time in seconds to write a frame to a client, see Config.WriteTimeout
+	DefaultWriteTimeout = 10
+)
+
+// writeTimeout get the time to write a frame to a connection, 0 if not bounded
+func (w *NatsWebSocket) writeTimeout() time.Duration {
+	timeout := w.config.WriteTimeout
+	if timeout == 0 {
+		timeout = DefaultWriteTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// setWriteDeadline bound the next write of the connection, with the write mutex held
+func (c *Connection) setWriteDeadline() {
+	if c.writeTimeout <= 0 {
+		return
+	}
+	if transport, ok := c.ws.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		transport.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
+// checkWrite close the transport if the write timed out, the peer being stuck, with the write mutex held.
+// The read loop then fails and unregisters the connection
+func (c *Connection) checkWrite(err error) {
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		return
+	}
+
+	if c.writeTimeouts != nil {
+		c.writeTimeouts.Inc()
+	}
+	c.Logf("write timed out after %s, closing", c.writeTimeout)
+	c.ws.Close()
+}
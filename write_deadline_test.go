@@ -0,0 +1,34 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTimeout(t *T) {
+	assert.Equal(t, DefaultWriteTimeout*time.Second, New(&Config{}).writeTimeout())
+	assert.Equal(t, time.Duration(0), New(&Config{WriteTimeout: -1}).writeTimeout())
+
+	w := New(&Config{})
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := w.registerConnection(NewStreamTransport(server))
+	connection.writeTimeout = 50 * time.Millisecond
+
+	// nobody reads the client side, the write times out instead of blocking
+	written := make(chan error, 1)
+	go func() { written <- connection.writeText([]byte("stuck")) }()
+	select {
+	case err := <-written:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("write not timed out")
+	}
+
+	// and the connection is closed
+	_, err := client.Read(make([]byte, 16))
+	assert.NotNil(t, err)
+}
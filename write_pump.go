@@ -0,0 +1,136 @@
+package websocketnats
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// SendQueueDrop a frame sent to a full send queue is dropped
+	SendQueueDrop = "drop"
+	// SendQueueClose a connection whose send queue is full is closed with 1013 and the SlowConsumer reason
+	SendQueueClose = "close"
+
+	// SlowConsumerReason close reason of the connections closed by SendQueueClose
+	SlowConsumerReason = "SlowConsumer"
+)
+
+// errSendQueueFull the frame was dropped, the send queue of the connection being full
+var errSendQueueFull = errors.New("send queue full")
+
+// errConnectionClosed the frame was sent after the connection was closed
+var errConnectionClosed = errors.New("connection closed")
+
+// outboundFrame frame waiting in the send queue of a connection
+type outboundFrame struct {
+	messageType int
+	data        []byte
+}
+
+// writePump writer goroutine of a connection with a send queue, see Config.SendQueueSize
+type writePump struct {
+	frames    chan outboundFrame
+	policy    string
+	overflows *Counter
+	stop      chan struct{}
+	stopped   chan struct{}
+	stopOnce  sync.Once
+}
+
+// startWritePump decouple the senders of the connection, e.g. the nats callbacks, from its socket: the frames are queued,
+// up to size, and written by a dedicated goroutine. A full queue drops the frame or closes the connection according to the policy
+func (c *Connection) startWritePump(size int, policy string, overflows *Counter) {
+	c.pump = &writePump{
+		frames:    make(chan outboundFrame, size),
+		policy:    policy,
+		overflows: overflows,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go c.runWritePump(c.pump)
+}
+
+// runWritePump write the queued frames until the pump is stopped
+func (c *Connection) runWritePump(pump *writePump) {
+	defer close(pump.stopped)
+
+	for {
+		select {
+		case frame := <-pump.frames:
+			c.writeFrame(frame.messageType, frame.data)
+		case <-pump.stop:
+			return
+		}
+	}
+}
+
+// queueFrame queue the frame for the write pump
+func (c *Connection) queueFrame(messageType int, data []byte) error {
+	select {
+	case <-c.pump.stop:
+		return errConnectionClosed
+	default:
+	}
+
+	select {
+	case c.pump.frames <- outboundFrame{messageType: messageType, data: data}:
+		return nil
+	default:
+	}
+
+	if c.pump.overflows != nil {
+		c.pump.overflows.Inc()
+	}
+	if c.pump.policy == SendQueueClose {
+		c.pump.stopOnce.Do(func() {
+			c.Logf("send queue full, closing")
+			close(c.pump.stop)
+			go c.closeSlowConsumer()
+		})
+		return errSendQueueFull
+	}
+
+	c.Logf("send queue full, frame dropped")
+	return errSendQueueFull
+}
+
+// closeSlowConsumer close the transport of the connection whose send queue overflowed. The read loop then fails and
+// unregisters the connection
+func (c *Connection) closeSlowConsumer() {
+	<-c.pump.stopped
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if transport, ok := c.ws.(interface {
+		WriteControl(messageType int, data []byte, deadline time.Time) error
+	}); ok {
+		transport.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, SlowConsumerReason), time.Now().Add(time.Second))
+	}
+	c.ws.Close()
+}
+
+// flushWritePump stop the write pump and write the frames still queued, with the write mutex held, so the close frame
+// follows them
+func (c *Connection) flushWritePump() {
+	if c.pump == nil {
+		return
+	}
+
+	c.pump.stopOnce.Do(func() { close(c.pump.stop) })
+	c.writeMutex.Unlock()
+	<-c.pump.stopped
+	c.writeMutex.Lock()
+
+	for {
+		select {
+		case frame := <-c.pump.frames:
+			c.writeLocked(frame.messageType, frame.data)
+		default:
+			return
+		}
+	}
+}
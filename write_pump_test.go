@@ -0,0 +1,83 @@
+package websocketnats
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePump(t *T) {
+	w := New(&Config{SendQueueSize: 2})
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := w.registerConnection(NewStreamTransport(server))
+
+	// the client doesn't read: the queue fills up and the next frames are dropped
+	sent := make(chan error, 8)
+	go func() {
+		for _, message := range []string{"a", "b", "c", "d"} {
+			sent <- connection.writeText([]byte(message))
+		}
+	}()
+	dropped := 0
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-sent:
+			if err == errSendQueueFull {
+				dropped++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("sender blocked by the client")
+		}
+	}
+	assert.True(t, dropped > 0)
+
+	// the queued frames are flushed before the close frame
+	go connection.Close(websocket.CloseGoingAway, "")
+	transport := NewStreamTransport(client)
+	received := []string{}
+	for {
+		_, message, err := transport.ReadMessage()
+		if err != nil {
+			break
+		}
+		received = append(received, string(message))
+	}
+	assert.Len(t, received, 4-dropped)
+	assert.Equal(t, []string{"a", "b"}, received[:2])
+}
+
+func TestWritePumpClose(t *T) {
+	w := New(&Config{SendQueueSize: 1, SendQueuePolicy: SendQueueClose})
+	client, server := net.Pipe()
+	defer client.Close()
+	connection := w.registerConnection(NewStreamTransport(server))
+
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = connection.writeText([]byte("x"))
+	}
+	assert.Equal(t, errSendQueueFull, err)
+	assert.Equal(t, errConnectionClosed, connection.writeText([]byte("x")))
+
+	// the slow consumer gets the frame being written, then its connection is closed
+	transport := NewStreamTransport(client)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := transport.ReadMessage(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("slow consumer not closed")
+	}
+}